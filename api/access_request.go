@@ -0,0 +1,34 @@
+package api
+
+import "github.com/infrahq/infra/uid"
+
+type AccessRequest struct {
+	ID      uid.ID `json:"id"`
+	Created Time   `json:"created"`
+	Updated Time   `json:"updated"`
+
+	Identity  uid.ID `json:"identity" note:"id of the identity that requested access"`
+	Privilege string `json:"privilege" example:"view"`
+	Resource  string `json:"resource" example:"kubernetes.staging.web"`
+	Reason    string `json:"reason,omitempty"`
+
+	Status    string `json:"status" example:"pending" note:"pending, approved, or denied"`
+	DecidedBy uid.ID `json:"decidedBy,omitempty" note:"id of the identity that approved or denied the request"`
+	Decided   Time   `json:"decided"`
+	Grant     uid.ID `json:"grant,omitempty" note:"id of the grant created when the request was approved"`
+}
+
+type ListAccessRequestsRequest struct {
+	Status string `form:"status" example:"pending"`
+}
+
+type CreateAccessRequestRequest struct {
+	Privilege string `json:"privilege" validate:"required" example:"view"`
+	Resource  string `json:"resource" validate:"required" example:"kubernetes.staging.web"`
+	Reason    string `json:"reason"`
+}
+
+type UpdateAccessRequestRequest struct {
+	ID     uid.ID `uri:"id" json:"-" validate:"required"`
+	Status string `json:"status" validate:"required,oneof=approved denied" example:"approved"`
+}
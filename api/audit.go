@@ -0,0 +1,40 @@
+package api
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/uid"
+)
+
+// KubernetesAuditRecord is a request a connector proxied to the Kubernetes API server on behalf of an identity
+type KubernetesAuditRecord struct {
+	ID          uid.ID   `json:"id"`
+	Time        Time     `json:"time" note:"Time the connector received the request"`
+	Destination string   `json:"destination" example:"kubernetes.production"`
+	Identity    string   `json:"identity" note:"Name of the identity the request was impersonated as"`
+	Groups      []string `json:"groups"`
+	Verb        string   `json:"verb" example:"get"`
+	APIGroup    string   `json:"apiGroup" example:"apps"`
+	Resource    string   `json:"resource" example:"deployments"`
+	Subresource string   `json:"subresource,omitempty" example:"log"`
+	Namespace   string   `json:"namespace,omitempty" example:"default"`
+	Name        string   `json:"name,omitempty"`
+	Path        string   `json:"path" note:"Request path, for requests that are not for a resource"`
+	Code        int      `json:"code" note:"HTTP status code of the response"`
+	Latency     Duration `json:"latency"`
+}
+
+type ListKubernetesAuditRecordsRequest struct {
+	Destination string    `form:"destination" example:"kubernetes.production"`
+	Identity    string    `form:"identity"`
+	Namespace   string    `form:"namespace"`
+	Verb        string    `form:"verb"`
+	Resource    string    `form:"resource"`
+	Since       time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00" note:"Only return records after this time"`
+	Limit       int       `form:"limit" validate:"min=0" note:"Maximum number of records to return, the most recent first"`
+}
+
+type CreateKubernetesAuditRecordsRequest struct {
+	Destination string                  `json:"destination" validate:"required"`
+	Records     []KubernetesAuditRecord `json:"records" validate:"required,min=1,max=1000"`
+}
@@ -0,0 +1,42 @@
+package api
+
+import "github.com/infrahq/infra/uid"
+
+type AuthzCheckRequest struct {
+	Subject   uid.PolymorphicID `form:"subject" validate:"required" note:"a polymorphic field primarily expecting a user, machine, or group ID"`
+	Privilege string            `form:"privilege" example:"view" note:"a role or permission, or empty for any privilege"`
+	Resource  string            `form:"resource" validate:"required" example:"kubernetes.production.web"`
+}
+
+// AuthzDecision explains whether a subject has a privilege on a resource
+type AuthzDecision struct {
+	Subject   uid.PolymorphicID `json:"subject"`
+	Privilege string            `json:"privilege,omitempty"`
+	Resource  string            `json:"resource"`
+
+	Allowed bool           `json:"allowed"`
+	Reason  string         `json:"reason,omitempty" note:"Why access is denied"`
+	Grants  []AppliedGrant `json:"grants" note:"The grants that give access"`
+	Denials []AppliedGrant `json:"denials,omitempty" note:"The deny grants that take access away, deny beats allow"`
+	Related []AppliedGrant `json:"related,omitempty" note:"Grants of the privilege, or on the resource, that do not give access"`
+}
+
+// AppliedGrant is a grant that applies to a subject, directly or through a group it belongs to
+type AppliedGrant struct {
+	Grant     Grant          `json:"grant"`
+	Group     uid.ID         `json:"group,omitempty" note:"id of the group the grant applies through, empty when it is granted to the subject"`
+	GroupName string         `json:"groupName,omitempty"`
+	Skipped   []SkippedGrant `json:"skipped,omitempty" note:"Where the connector could not apply the grant in its last sync"`
+	DeniedBy  []uid.ID       `json:"deniedBy,omitempty" note:"ids of the deny grants that take away what the grant gives"`
+}
+
+type AuthzEffectiveRequest struct {
+	Subject uid.PolymorphicID `form:"subject" validate:"required" note:"a polymorphic field primarily expecting a user, machine, or group ID"`
+}
+
+// EffectiveAccess is every grant that applies to a subject, and the Infra API permissions they give it
+type EffectiveAccess struct {
+	Subject     uid.PolymorphicID `json:"subject"`
+	Grants      []AppliedGrant    `json:"grants"`
+	Permissions []string          `json:"permissions" note:"Infra API permissions the subject has on every resource"`
+}
@@ -0,0 +1,57 @@
+package api
+
+import "github.com/infrahq/infra/uid"
+
+// BreakGlass is an emergency account for when the identity providers are down. Its secret is split between two
+// holders, and logging in with both halves unlocks a grant for a limited time.
+type BreakGlass struct {
+	ID      uid.ID `json:"id"`
+	Created Time   `json:"created"`
+	Updated Time   `json:"updated"`
+
+	Name      string   `json:"name" example:"emergency"`
+	Identity  uid.ID   `json:"identity" note:"id of the machine identity the account logs in as"`
+	Holders   []string `json:"holders" example:"alice@example.com" note:"who hold each half of the secret"`
+	Privilege string   `json:"privilege" example:"admin" note:"the role or permission granted while the account is unlocked"`
+	Resource  string   `json:"resource" example:"infra"`
+	Duration  Duration `json:"duration" example:"1h0m0s" note:"how long the account stays unlocked"`
+	CreatedBy uid.ID   `json:"createdBy"`
+
+	Unlocked Time   `json:"unlocked" note:"Time the account was last unlocked"`
+	Expires  Time   `json:"expires" note:"Time the grant is revoked, zero while the account is locked"`
+	Grant    uid.ID `json:"grant,omitempty" note:"id of the grant, while the account is unlocked"`
+}
+
+// BreakGlassEvent is an audit entry of a break-glass account being unlocked, used, or locked again
+type BreakGlassEvent struct {
+	ID         uid.ID `json:"id"`
+	Time       Time   `json:"time"`
+	BreakGlass uid.ID `json:"breakGlass"`
+	Name       string `json:"name"`
+	Kind       string `json:"kind" example:"unlocked" note:"unlocked, unlock-failed, used, locked, or expired"`
+	SourceIP   string `json:"sourceIP,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+type ListBreakGlassRequest struct {
+	Name string `form:"name"`
+}
+
+type CreateBreakGlassRequest struct {
+	Name      string   `json:"name" validate:"required" example:"emergency"`
+	Holders   []string `json:"holders" validate:"len=2,dive,required" example:"alice@example.com" note:"who will hold each half of the secret"`
+	Privilege string   `json:"privilege" example:"admin" note:"defaults to admin"`
+	Resource  string   `json:"resource" example:"infra" note:"defaults to infra"`
+	Duration  Duration `json:"duration" example:"1h0m0s" note:"how long the account stays unlocked, defaults to an hour"`
+}
+
+type CreateBreakGlassResponse struct {
+	BreakGlass BreakGlass `json:"breakGlass"`
+	Secrets    []string   `json:"secrets" note:"the halves of the secret, in the order of the holders. They are only shown once."`
+}
+
+// LoginRequestBreakGlass unlocks a break-glass account with both halves of its secret
+type LoginRequestBreakGlass struct {
+	Name    string   `json:"name" validate:"required"`
+	Secrets []string `json:"secrets" validate:"len=2,dive,required" note:"both halves of the secret, in any order"`
+}
@@ -0,0 +1,11 @@
+package api
+
+type CreateClientCertificateRequest struct {
+	CSR string `json:"csr" validate:"required" note:"PEM encoded certificate signing request, for the common name 'User <identity ID>' of the calling identity"`
+}
+
+type ClientCertificate struct {
+	Certificate string `json:"certificate" note:"PEM encoded client certificate, which authenticates the identity instead of an access key"`
+	CA          string `json:"ca" note:"PEM encoded bundle of the Infra CAs, which the server's certificate is trusted with"`
+	Expires     Time   `json:"expires"`
+}
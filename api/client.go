@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/infrahq/infra/uid"
 )
@@ -54,6 +57,21 @@ func checkError(status int, body []byte) error {
 }
 
 func get[Res any](client Client, path string) (*Res, error) {
+	body, err := getBytes(client, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var res Res
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("parsing json response: %w. partial text: %q", err, partialText(body, 100))
+	}
+
+	return &res, nil
+}
+
+// getBytes returns the response body without decoding it, for responses that are not JSON
+func getBytes(client Client, path string) ([]byte, error) {
 	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", client.URL, path), nil)
 	if err != nil {
 		return nil, err
@@ -77,12 +95,7 @@ func get[Res any](client Client, path string) (*Res, error) {
 		return nil, fmt.Errorf("GET %q responded %d: %w", path, resp.StatusCode, err)
 	}
 
-	var res Res
-	if err := json.Unmarshal(body, &res); err != nil {
-		return nil, fmt.Errorf("parsing json response: %w. partial text: %q", err, partialText(body, 100))
-	}
-
-	return &res, nil
+	return body, nil
 }
 
 func list[Res any](client Client, path string, query map[string]string) ([]Res, error) {
@@ -198,7 +211,7 @@ func delete(client Client, path string) error {
 }
 
 func (c Client) ListIdentities(req ListIdentitiesRequest) ([]Identity, error) {
-	return list[Identity](c, "/v1/identities", map[string]string{"name": req.Name})
+	return list[Identity](c, "/v1/identities", map[string]string{"name": req.Name, "group": req.Group.String()})
 }
 
 func (c Client) GetIdentity(id uid.ID) (*Identity, error) {
@@ -241,6 +254,22 @@ func (c Client) ListGroupGrants(id uid.ID) ([]Grant, error) {
 	return list[Grant](c, fmt.Sprintf("/v1/groups/%s/grants", id), nil)
 }
 
+func (c Client) ListGroupGroups(id uid.ID) ([]Group, error) {
+	return list[Group](c, fmt.Sprintf("/v1/groups/%s/groups", id), nil)
+}
+
+func (c Client) ListGroupMembers(id uid.ID) ([]Group, error) {
+	return list[Group](c, fmt.Sprintf("/v1/groups/%s/members", id), nil)
+}
+
+func (c Client) AddGroupMember(req *AddGroupMemberRequest) (*Group, error) {
+	return post[AddGroupMemberRequest, Group](c, fmt.Sprintf("/v1/groups/%s/members", req.ID), req)
+}
+
+func (c Client) RemoveGroupMember(req RemoveGroupMemberRequest) error {
+	return delete(c, fmt.Sprintf("/v1/groups/%s/members/%s", req.ID, req.Member))
+}
+
 func (c Client) ListProviders(name string) ([]Provider, error) {
 	return list[Provider](c, "/v1/providers", map[string]string{"name": name})
 }
@@ -273,8 +302,88 @@ func (c Client) DeleteGrant(id uid.ID) error {
 	return delete(c, fmt.Sprintf("/v1/grants/%s", id))
 }
 
+func (c Client) ListAccessRequests(req ListAccessRequestsRequest) ([]AccessRequest, error) {
+	return list[AccessRequest](c, "/v1/access-requests", map[string]string{"status": req.Status})
+}
+
+func (c Client) CreateAccessRequest(req *CreateAccessRequestRequest) (*AccessRequest, error) {
+	return post[CreateAccessRequestRequest, AccessRequest](c, "/v1/access-requests", req)
+}
+
+func (c Client) UpdateAccessRequest(req UpdateAccessRequestRequest) (*AccessRequest, error) {
+	return put[UpdateAccessRequestRequest, AccessRequest](c, fmt.Sprintf("/v1/access-requests/%s", req.ID), &req)
+}
+
+func (c Client) ListReviews(req ListReviewsRequest) ([]Review, error) {
+	return list[Review](c, "/v1/reviews", map[string]string{"name": req.Name, "status": req.Status})
+}
+
+func (c Client) GetReview(id uid.ID) (*Review, error) {
+	return get[Review](c, fmt.Sprintf("/v1/reviews/%s", id))
+}
+
+func (c Client) CreateReview(req *CreateReviewRequest) (*Review, error) {
+	return post[CreateReviewRequest, Review](c, "/v1/reviews", req)
+}
+
+func (c Client) UpdateReview(req UpdateReviewRequest) (*Review, error) {
+	return put[UpdateReviewRequest, Review](c, fmt.Sprintf("/v1/reviews/%s", req.ID), &req)
+}
+
+func (c Client) ListReviewItems(id uid.ID) ([]ReviewItem, error) {
+	return list[ReviewItem](c, fmt.Sprintf("/v1/reviews/%s/items", id), nil)
+}
+
+func (c Client) UpdateReviewItem(req UpdateReviewItemRequest) (*ReviewItem, error) {
+	return put[UpdateReviewItemRequest, ReviewItem](c, fmt.Sprintf("/v1/reviews/%s/items/%s", req.ReviewID, req.ID), &req)
+}
+
+// ExportReview downloads the evidence of a review, as csv or json
+func (c Client) ExportReview(id uid.ID, format string) ([]byte, error) {
+	return getBytes(c, fmt.Sprintf("/v1/reviews/%s/export?format=%s", id, format))
+}
+
+func (c Client) ListBreakGlass(req ListBreakGlassRequest) ([]BreakGlass, error) {
+	return list[BreakGlass](c, "/v1/break-glass", map[string]string{"name": req.Name})
+}
+
+func (c Client) GetBreakGlass(id uid.ID) (*BreakGlass, error) {
+	return get[BreakGlass](c, fmt.Sprintf("/v1/break-glass/%s", id))
+}
+
+func (c Client) CreateBreakGlass(req *CreateBreakGlassRequest) (*CreateBreakGlassResponse, error) {
+	return post[CreateBreakGlassRequest, CreateBreakGlassResponse](c, "/v1/break-glass", req)
+}
+
+func (c Client) DeleteBreakGlass(id uid.ID) error {
+	return delete(c, fmt.Sprintf("/v1/break-glass/%s", id))
+}
+
+// LockBreakGlass revokes the grant of an unlocked break-glass account before its time is up
+func (c Client) LockBreakGlass(id uid.ID) (*BreakGlass, error) {
+	return post[Resource, BreakGlass](c, fmt.Sprintf("/v1/break-glass/%s/lock", id), &Resource{ID: id})
+}
+
+func (c Client) ListBreakGlassEvents(id uid.ID) ([]BreakGlassEvent, error) {
+	return list[BreakGlassEvent](c, fmt.Sprintf("/v1/break-glass/%s/events", id), nil)
+}
+
+func (c Client) ListPermissions() (*PermissionMatrix, error) {
+	return get[PermissionMatrix](c, "/v1/permissions")
+}
+
+func (c Client) CheckAuthz(req AuthzCheckRequest) (*AuthzDecision, error) {
+	query := url.Values{"subject": {req.Subject.String()}, "privilege": {req.Privilege}, "resource": {req.Resource}}
+	return get[AuthzDecision](c, "/v1/authz/check?"+query.Encode())
+}
+
+func (c Client) GetEffectiveAccess(req AuthzEffectiveRequest) (*EffectiveAccess, error) {
+	query := url.Values{"subject": {req.Subject.String()}}
+	return get[EffectiveAccess](c, "/v1/authz/effective?"+query.Encode())
+}
+
 func (c Client) ListDestinations(req ListDestinationsRequest) ([]Destination, error) {
-	return list[Destination](c, "/v1/destinations", map[string]string{"name": req.Name, "unique_id": req.UniqueID})
+	return list[Destination](c, "/v1/destinations", map[string]string{"name": req.Name, "unique_id": req.UniqueID, "selector": req.Selector})
 }
 
 func (c Client) CreateDestination(req *CreateDestinationRequest) (*Destination, error) {
@@ -285,6 +394,115 @@ func (c Client) UpdateDestination(req UpdateDestinationRequest) (*Destination, e
 	return put[UpdateDestinationRequest, Destination](c, fmt.Sprintf("/v1/destinations/%s", req.ID.String()), &req)
 }
 
+func (c Client) DestinationHeartbeat(req *DestinationHeartbeatRequest) (*Destination, error) {
+	return post[DestinationHeartbeatRequest, Destination](c, fmt.Sprintf("/v1/destinations/%s/heartbeat", req.ID), req)
+}
+
+func (c Client) SignDestinationCertificate(req *SignDestinationCertificateRequest) (*DestinationCertificate, error) {
+	return post[SignDestinationCertificateRequest, DestinationCertificate](c, fmt.Sprintf("/v1/destinations/%s/certificate", req.ID), req)
+}
+
+// OpenDestinationTunnel upgrades a connection to the server to a tunnel, which requests for the destination are
+// proxied through. The connection can only be upgraded over HTTP/1.1, so the client must not use HTTP/2.
+func (c Client) OpenDestinationTunnel(id uid.ID) (io.ReadWriteCloser, error) {
+	path := fmt.Sprintf("/v1/destinations/%s/tunnel", id)
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", c.URL, path), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+c.AccessKey)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", DestinationTunnelProtocol)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %q: %w", path, err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading response: %w", err)
+		}
+
+		if err := checkError(resp.StatusCode, body); err != nil {
+			return nil, fmt.Errorf("GET %q responded %d: %w", path, resp.StatusCode, err)
+		}
+
+		return nil, fmt.Errorf("GET %q responded %d, expected an upgrade", path, resp.StatusCode)
+	}
+
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %q: upgraded connection is not writable", path)
+	}
+
+	return conn, nil
+}
+
+func (c Client) ListKubernetesAuditRecords(req ListKubernetesAuditRecordsRequest) ([]KubernetesAuditRecord, error) {
+	query := map[string]string{
+		"destination": req.Destination,
+		"identity":    req.Identity,
+		"namespace":   req.Namespace,
+		"verb":        req.Verb,
+		"resource":    req.Resource,
+	}
+
+	if !req.Since.IsZero() {
+		query["since"] = req.Since.UTC().Format(time.RFC3339)
+	}
+
+	if req.Limit > 0 {
+		query["limit"] = strconv.Itoa(req.Limit)
+	}
+
+	return list[KubernetesAuditRecord](c, "/v1/audit/kubernetes", query)
+}
+
+func (c Client) CreateKubernetesAuditRecords(req *CreateKubernetesAuditRecordsRequest) error {
+	_, err := post[CreateKubernetesAuditRecordsRequest, EmptyResponse](c, "/v1/audit/kubernetes", req)
+	return err
+}
+
+func (c Client) RegisterDestination(req *RegisterDestinationRequest) (*RegisterDestinationResponse, error) {
+	return post[RegisterDestinationRequest, RegisterDestinationResponse](c, "/v1/destinations/register", req)
+}
+
+func (c Client) ListClusterTrusts(req ListClusterTrustsRequest) ([]ClusterTrust, error) {
+	return list[ClusterTrust](c, "/v1/cluster-trusts", map[string]string{"name": req.Name})
+}
+
+func (c Client) CreateClusterTrust(req *CreateClusterTrustRequest) (*ClusterTrust, error) {
+	return post[CreateClusterTrustRequest, ClusterTrust](c, "/v1/cluster-trusts", req)
+}
+
+func (c Client) DeleteClusterTrust(id uid.ID) error {
+	return delete(c, fmt.Sprintf("/v1/cluster-trusts/%s", id))
+}
+
+func (c Client) ListSessionRecordings(req ListSessionRecordingsRequest) ([]SessionRecording, error) {
+	return list[SessionRecording](c, "/v1/recordings", map[string]string{"destination": req.Destination, "identity": req.Identity})
+}
+
+func (c Client) GetSessionRecording(id uid.ID) (*SessionRecording, error) {
+	return get[SessionRecording](c, fmt.Sprintf("/v1/recordings/%s", id))
+}
+
+// GetSessionRecordingCast downloads a session recording in asciicast v2 format
+func (c Client) GetSessionRecordingCast(id uid.ID) ([]byte, error) {
+	return getBytes(c, fmt.Sprintf("/v1/recordings/%s/cast", id))
+}
+
+func (c Client) CreateSessionRecording(req *CreateSessionRecordingRequest) (*SessionRecording, error) {
+	return post[CreateSessionRecordingRequest, SessionRecording](c, "/v1/recordings", req)
+}
+
 func (c Client) DeleteDestination(id uid.ID) error {
 	return delete(c, fmt.Sprintf("/v1/destinations/%s", id))
 }
@@ -305,6 +523,12 @@ func (c Client) CreateToken() (*CreateTokenResponse, error) {
 	return post[EmptyRequest, CreateTokenResponse](c, "/v1/tokens", &EmptyRequest{})
 }
 
+// CreateClientCertificate has the server sign a client certificate for the calling identity, which authenticates
+// it to servers that verify client certificates
+func (c Client) CreateClientCertificate(req *CreateClientCertificateRequest) (*ClientCertificate, error) {
+	return post[CreateClientCertificateRequest, ClientCertificate](c, "/v1/certificates", req)
+}
+
 func (c Client) Introspect() (*Introspect, error) {
 	return get[Introspect](c, "/v1/introspect")
 }
@@ -313,6 +537,14 @@ func (c Client) Login(req *LoginRequest) (*LoginResponse, error) {
 	return post[LoginRequest, LoginResponse](c, "/v1/login", req)
 }
 
+func (c Client) StartDeviceFlow(req *StartDeviceFlowRequest) (*DeviceFlowResponse, error) {
+	return post[StartDeviceFlowRequest, DeviceFlowResponse](c, "/v1/device", req)
+}
+
+func (c Client) GetDeviceFlowStatus(req *DeviceFlowStatusRequest) (*DeviceFlowStatusResponse, error) {
+	return post[DeviceFlowStatusRequest, DeviceFlowStatusResponse](c, "/v1/device/status", req)
+}
+
 func (c Client) Logout() error {
 	_, err := post[EmptyRequest, EmptyResponse](c, "/v1/logout", &EmptyRequest{})
 	return err
@@ -0,0 +1,43 @@
+package api
+
+import "github.com/infrahq/infra/uid"
+
+type ClusterTrust struct {
+	ID             uid.ID `json:"id"`
+	Created        Time   `json:"created"`
+	Updated        Time   `json:"updated"`
+	Name           string `json:"name" note:"Name of the destination the cluster registers as"`
+	Server         string `json:"server,omitempty" example:"https://10.0.0.1:6443"`
+	CA             string `json:"ca,omitempty"`
+	Issuer         string `json:"issuer,omitempty" example:"https://oidc.eks.us-west-2.amazonaws.com/id/EXAMPLE"`
+	Audience       string `json:"audience,omitempty"`
+	ServiceAccount string `json:"serviceAccount" example:"infra:infra-connector"`
+	UniqueID       string `json:"uniqueID,omitempty" note:"Set when the cluster first registers"`
+}
+
+type ListClusterTrustsRequest struct {
+	Name string `form:"name"`
+}
+
+type CreateClusterTrustRequest struct {
+	Name           string `json:"name" validate:"required"`
+	Server         string `json:"server" validate:"required_without=Issuer,excluded_with=Issuer" note:"Kubernetes API server that reviews the connector's tokens"`
+	CA             string `json:"ca" validate:"required_with=Server"`
+	ReviewerToken  string `json:"reviewerToken" validate:"excluded_with=Issuer" note:"Token used to review tokens, defaults to the connector's own token"`
+	Issuer         string `json:"issuer" validate:"required_without=Server" note:"OIDC issuer of the cluster's service account tokens"`
+	Audience       string `json:"audience" validate:"required_with=Issuer"`
+	ServiceAccount string `json:"serviceAccount" validate:"required" example:"infra:infra-connector"`
+}
+
+type RegisterDestinationRequest struct {
+	Name       string                `json:"name" validate:"required"`
+	UniqueID   string                `json:"uniqueID" validate:"required"`
+	Connection DestinationConnection `json:"connection"`
+	Token      string                `json:"token" validate:"required" note:"The connector's Kubernetes service account token"`
+}
+
+type RegisterDestinationResponse struct {
+	Destination Destination `json:"destination"`
+	AccessKey   string      `json:"accessKey"`
+	Expires     Time        `json:"expires"`
+}
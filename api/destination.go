@@ -4,6 +4,14 @@ import (
 	"github.com/infrahq/infra/uid"
 )
 
+// Destination statuses, based on the heartbeats reported by the connector
+const (
+	DestinationStatusPending   = "pending"   // the connector has not reported a heartbeat yet
+	DestinationStatusConnected = "connected" // the connector is reporting heartbeats and syncing grants
+	DestinationStatusError     = "error"     // the connector is reporting heartbeats, but failed to sync grants
+	DestinationStatusStale     = "stale"     // the connector stopped reporting heartbeats
+)
+
 type Destination struct {
 	ID         uid.ID                `json:"id"`
 	UniqueID   string                `json:"uniqueID" form:"uniqueID" example:"94c2c570a20311180ec325fd56"`
@@ -11,22 +19,51 @@ type Destination struct {
 	Created    Time                  `json:"created"`
 	Updated    Time                  `json:"updated"`
 	Connection DestinationConnection `json:"connection"`
+	Labels     map[string]string     `json:"labels,omitempty"`
+
+	Status       string `json:"status" note:"One of pending, connected, error, or stale"`
+	Version      string `json:"version,omitempty" note:"Version of the connector"`
+	LastSeen     Time   `json:"lastSeen" note:"Time of the last heartbeat from the connector"`
+	LastSync     Time   `json:"lastSync" note:"Time the connector last synced grants successfully"`
+	SyncError    string `json:"syncError,omitempty" note:"Error from the connector's last attempt to sync grants"`
+	RoleBindings int    `json:"roleBindings" note:"Number of role bindings managed by the connector"`
+
+	SkippedGrants []SkippedGrant `json:"skippedGrants,omitempty" note:"Grants the connector could not apply in its last sync"`
+}
+
+// SkippedGrant is a grant the connector could not apply to a destination, or one of its namespaces
+type SkippedGrant struct {
+	Grant     uid.ID `json:"grant"`
+	Resource  string `json:"resource" note:"Destination or namespace the grant applies to, once for each a resource pattern matches"`
+	Privilege string `json:"privilege"`
+	Reason    string `json:"reason" note:"Why the grant had no effect"`
 }
 
 type DestinationConnection struct {
-	URL string `json:"url" validate:"required" example:"aa60eexample.us-west-2.elb.amazonaws.com"`
-	CA  string `json:"ca" example:"-----BEGIN CERTIFICATE-----\nMIIDNTCCAh2gAwIBAgIRALRetnpcTo9O3V2fAK3ix+c\n-----END CERTIFICATE-----\n"`
+	URL    string `json:"url" validate:"required_without=Tunnel" example:"aa60eexample.us-west-2.elb.amazonaws.com"`
+	CA     string `json:"ca" example:"-----BEGIN CERTIFICATE-----\nMIIDNTCCAh2gAwIBAgIRALRetnpcTo9O3V2fAK3ix+c\n-----END CERTIFICATE-----\n"`
+	Tunnel bool   `json:"tunnel,omitempty" note:"The connector is reached through a tunnel it opens to the server, instead of at its URL"`
 }
 
+// DestinationTunnelProtocol is the protocol a connector upgrades its connection to the server to, when it opens a
+// tunnel. Requests for the destination are multiplexed over the tunnel with yamux.
+const DestinationTunnelProtocol = "infra-tunnel"
+
+// DestinationTunnelClientHeader carries the address of the client a request through a tunnel is from. The connector
+// trusts it from the server, the only peer of the tunnel, instead of X-Forwarded-For.
+const DestinationTunnelClientHeader = "Infra-Tunnel-Client"
+
 type ListDestinationsRequest struct {
 	Name     string `form:"name"`
 	UniqueID string `form:"unique_id"`
+	Selector string `form:"selector" example:"env=production,region!=us-east-1" note:"Label selector, requirements are key=value, key!=value, key, or !key"`
 }
 
 type CreateDestinationRequest struct {
 	UniqueID   string                `json:"uniqueID"`
 	Name       string                `json:"name" validate:"required"`
 	Connection DestinationConnection `json:"connection"`
+	Labels     map[string]string     `json:"labels"`
 }
 
 type UpdateDestinationRequest struct {
@@ -34,4 +71,28 @@ type UpdateDestinationRequest struct {
 	Name       string                `json:"name" validate:"required"`
 	UniqueID   string                `json:"uniqueID"`
 	Connection DestinationConnection `json:"connection"`
+	Labels     map[string]string     `json:"labels" note:"Replaces the labels of the destination, they are kept when omitted"`
+}
+
+type DestinationHeartbeatRequest struct {
+	ID           uid.ID `uri:"id" json:"-" validate:"required"`
+	Version      string `json:"version"`
+	LastSync     Time   `json:"lastSync"`
+	SyncError    string `json:"syncError"`
+	RoleBindings int    `json:"roleBindings"`
+
+	SkippedGrants []SkippedGrant `json:"skippedGrants" note:"Grants the connector could not apply, replacing those reported before"`
+
+	Labels map[string]string `json:"labels" note:"Labels of the connector, such as its cloud region, set on the destination"`
+}
+
+type SignDestinationCertificateRequest struct {
+	ID  uid.ID `uri:"id" json:"-" validate:"required"`
+	CSR string `json:"csr" validate:"required" note:"PEM encoded certificate signing request, for the common name 'Connector <destination name>' and the host of the destination's URL"`
+}
+
+type DestinationCertificate struct {
+	Certificate string `json:"certificate" note:"PEM encoded serving certificate for the connector"`
+	CA          string `json:"ca" note:"PEM encoded bundle of the Infra CAs, which clients trust the certificate with"`
+	Expires     Time   `json:"expires"`
 }
@@ -0,0 +1,35 @@
+package api
+
+import "github.com/infrahq/infra/uid"
+
+// Device flow statuses, as named by the OAuth 2.0 device authorization grant (RFC 8628)
+const (
+	DeviceFlowStatusPending  = "authorization_pending"
+	DeviceFlowStatusSlowDown = "slow_down"
+	DeviceFlowStatusDenied   = "access_denied"
+	DeviceFlowStatusExpired  = "expired_token"
+	DeviceFlowStatusApproved = "approved"
+)
+
+type StartDeviceFlowRequest struct {
+	ProviderID uid.ID `json:"providerID" validate:"required"`
+	ClientID   string `json:"clientID" note:"When set, the session is refreshable and bound to this client"`
+}
+
+type DeviceFlowResponse struct {
+	DeviceCode              string `json:"deviceCode" note:"Secret code the device polls with"`
+	UserCode                string `json:"userCode" example:"BDWP-HQPK" note:"Code the user enters to approve the device"`
+	VerificationURI         string `json:"verificationURI" note:"Where the user approves the device"`
+	VerificationURIComplete string `json:"verificationURIComplete" note:"Verification URI which includes the user code"`
+	ExpiresIn               int64  `json:"expiresIn" note:"Seconds until the device code expires"`
+	Interval                int64  `json:"interval" note:"Seconds the device must wait between polls"`
+}
+
+type DeviceFlowStatusRequest struct {
+	DeviceCode string `json:"deviceCode" validate:"required"`
+}
+
+type DeviceFlowStatusResponse struct {
+	Status string         `json:"status" example:"authorization_pending" note:"One of authorization_pending, slow_down, access_denied, expired_token or approved"`
+	Login  *LoginResponse `json:"login,omitempty" note:"Set once the device is approved"`
+}
@@ -13,7 +13,26 @@ type Grant struct {
 
 	Subject   uid.PolymorphicID `json:"subject" note:"a polymorphic field primarily expecting an user, or group ID"`
 	Privilege string            `json:"privilege" note:"a role or permission"`
-	Resource  string            `json:"resource" note:"a resource name in Infra's Universal Resource Notation"`
+	Resource  string            `json:"resource" note:"a resource name in Infra's Universal Resource Notation, or a pattern such as kubernetes.*.team-a-*"`
+	Deny      bool              `json:"deny" note:"a deny grant takes away the privilege, or every privilege when it is *, even when other grants give it"`
+
+	Conditions *GrantConditions `json:"conditions,omitempty" note:"limits on when the grant applies, it always applies when omitted"`
+}
+
+// GrantConditions limit when a grant applies. A grant applies when every condition it has is met.
+type GrantConditions struct {
+	CIDRs    []string     `json:"cidrs,omitempty" example:"10.0.0.0/8" note:"source addresses the grant applies from"`
+	Windows  []TimeWindow `json:"windows,omitempty" note:"recurring times the grant applies in, any of them"`
+	MFALevel int          `json:"mfaLevel,omitempty" validate:"min=0,max=2" note:"how the identity must have authenticated: 1 with a second factor, 2 with a hardware key"`
+}
+
+// TimeWindow is a recurring time of day, on some days of the week. Windows that end before they start end on the
+// next day.
+type TimeWindow struct {
+	Days     []string `json:"days,omitempty" example:"mon" note:"days of the week, mon to sun, every day when omitted"`
+	Start    string   `json:"start" validate:"required" example:"09:00"`
+	End      string   `json:"end" validate:"required" example:"17:00"`
+	Timezone string   `json:"timezone,omitempty" example:"America/New_York" note:"IANA time zone, UTC when omitted"`
 }
 
 type ListGrantsRequest struct {
@@ -25,5 +44,8 @@ type ListGrantsRequest struct {
 type CreateGrantRequest struct {
 	Subject   uid.PolymorphicID `json:"subject" validate:"required" note:"a polymorphic field primarily expecting a user, machine, or group ID"`
 	Privilege string            `json:"privilege" validate:"required" example:"view" note:"a role or permission"`
-	Resource  string            `json:"resource" validate:"required" example:"kubernetes.production" note:"a resource name in Infra's Universal Resource Notation"`
+	Resource  string            `json:"resource" validate:"required" example:"kubernetes.production" note:"a resource name in Infra's Universal Resource Notation, or a pattern such as kubernetes[env=prod].*"`
+	Deny      bool              `json:"deny" note:"deny the privilege instead of granting it, * denies every privilege"`
+
+	Conditions *GrantConditions `json:"conditions" note:"limits on when the grant applies, deny grants can not have conditions"`
 }
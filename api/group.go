@@ -18,3 +18,13 @@ type ListGroupsRequest struct {
 type CreateGroupRequest struct {
 	Name string `json:"name" validate:"required"`
 }
+
+type AddGroupMemberRequest struct {
+	ID    uid.ID `uri:"id" json:"-" validate:"required"`
+	Group uid.ID `json:"group" validate:"required" note:"The group that becomes a member, and inherits the grants of the group"`
+}
+
+type RemoveGroupMemberRequest struct {
+	ID     uid.ID `uri:"id" validate:"required"`
+	Member uid.ID `uri:"member" validate:"required"`
+}
@@ -14,7 +14,8 @@ type Identity struct {
 }
 
 type ListIdentitiesRequest struct {
-	Name string `form:"name"`
+	Name  string `form:"name"`
+	Group uid.ID `form:"group" note:"only identities in the group, directly or through the groups in it"`
 }
 
 type CreateIdentityRequest struct {
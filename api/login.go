@@ -13,10 +13,22 @@ type LoginRequestPasswordCredentials struct {
 	Password string `json:"password" validate:"required"`
 }
 
+// LoginRequestFederation is a signed token from an external issuer the server trusts, such as
+// a Kubernetes projected service account token or a CI OIDC token
+type LoginRequestFederation struct {
+	Token string `json:"token" validate:"required"`
+}
+
 type LoginRequest struct {
-	AccessKey           string                           `json:"accessKey" validate:"excluded_with=OIDC,excluded_with=PasswordCredentials"`
-	PasswordCredentials *LoginRequestPasswordCredentials `json:"passwordCredentials" validate:"excluded_with=OIDC,excluded_with=AccessKey"`
-	OIDC                *LoginRequestOIDC                `json:"oidc" validate:"excluded_with=KeyExchange,excluded_with=PasswordCredentials"`
+	AccessKey           string                           `json:"accessKey" validate:"excluded_with=OIDC,excluded_with=PasswordCredentials,excluded_with=RefreshToken,excluded_with=Federation,excluded_with=BreakGlass"`
+	PasswordCredentials *LoginRequestPasswordCredentials `json:"passwordCredentials" validate:"excluded_with=OIDC,excluded_with=AccessKey,excluded_with=RefreshToken,excluded_with=Federation,excluded_with=BreakGlass"`
+	OIDC                *LoginRequestOIDC                `json:"oidc" validate:"excluded_with=KeyExchange,excluded_with=PasswordCredentials,excluded_with=RefreshToken,excluded_with=Federation,excluded_with=BreakGlass"`
+	RefreshToken        string                           `json:"refreshToken" validate:"excluded_with=OIDC,excluded_with=PasswordCredentials,excluded_with=AccessKey,excluded_with=Federation,excluded_with=BreakGlass" note:"Refresh token from a previous login, must be used with the same clientID"`
+	Federation          *LoginRequestFederation          `json:"federation" validate:"excluded_with=OIDC,excluded_with=PasswordCredentials,excluded_with=AccessKey,excluded_with=RefreshToken,excluded_with=BreakGlass" note:"Workload identity token from a trusted issuer, exchanged for a short-lived machine access key"`
+	BreakGlass          *LoginRequestBreakGlass          `json:"breakGlass" validate:"excluded_with=OIDC,excluded_with=PasswordCredentials,excluded_with=AccessKey,excluded_with=RefreshToken,excluded_with=Federation" note:"Both halves of the secret of a break-glass account, which unlock its grant until its time is up"`
+
+	// ClientID binds a refreshable session to the client that started it
+	ClientID string `json:"clientID" validate:"required_with=RefreshToken" note:"When set, a short-lived access key and a refresh token bound to this client are issued"`
 }
 
 type LoginResponse struct {
@@ -25,4 +37,5 @@ type LoginResponse struct {
 	AccessKey              string            `json:"accessKey"`
 	PasswordUpdateRequired bool              `json:"passwordUpdateRequired,omitempty"`
 	Expires                Time              `json:"expires"`
+	RefreshToken           string            `json:"refreshToken,omitempty"`
 }
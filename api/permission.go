@@ -0,0 +1,18 @@
+package api
+
+// Permission is an action on a kind of Infra API resource, which can be granted on its own or as part of a role
+type Permission struct {
+	Name        string `json:"name" example:"grants:create"`
+	Description string `json:"description"`
+}
+
+// Role is a bundle of permissions, which it grants when it is granted on infra
+type Role struct {
+	Name        string   `json:"name" example:"view"`
+	Permissions []string `json:"permissions"`
+}
+
+type PermissionMatrix struct {
+	Permissions []Permission `json:"permissions"`
+	Roles       []Role       `json:"roles"`
+}
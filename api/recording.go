@@ -0,0 +1,45 @@
+package api
+
+import (
+	"github.com/infrahq/infra/uid"
+)
+
+// Kinds of session recordings
+const (
+	SessionRecordingExec        = "exec"
+	SessionRecordingAttach      = "attach"
+	SessionRecordingPortForward = "portforward"
+)
+
+// SessionRecording is an interactive session a connector recorded, such as kubectl exec
+type SessionRecording struct {
+	ID          uid.ID `json:"id"`
+	Destination string `json:"destination" example:"kubernetes.production"`
+	Identity    string `json:"identity" note:"Name of the identity that started the session"`
+	Kind        string `json:"kind" example:"exec" note:"One of exec, attach, or portforward"`
+	Namespace   string `json:"namespace" example:"default"`
+	Pod         string `json:"pod"`
+	Container   string `json:"container,omitempty"`
+	Command     string `json:"command,omitempty" example:"sh"`
+	Started     Time   `json:"started"`
+	Ended       Time   `json:"ended"`
+	Size        int    `json:"size" note:"Size of the recording in bytes"`
+}
+
+type ListSessionRecordingsRequest struct {
+	Destination string `form:"destination" example:"kubernetes.production"`
+	Identity    string `form:"identity"`
+}
+
+type CreateSessionRecordingRequest struct {
+	Destination string `json:"destination" validate:"required"`
+	Identity    string `json:"identity" validate:"required"`
+	Kind        string `json:"kind" validate:"required,oneof=exec attach portforward"`
+	Namespace   string `json:"namespace"`
+	Pod         string `json:"pod"`
+	Container   string `json:"container"`
+	Command     string `json:"command"`
+	Started     Time   `json:"started"`
+	Ended       Time   `json:"ended"`
+	Cast        []byte `json:"cast" validate:"required" note:"The recording in asciicast v2 format"`
+}
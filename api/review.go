@@ -0,0 +1,69 @@
+package api
+
+import "github.com/infrahq/infra/uid"
+
+type Review struct {
+	ID      uid.ID `json:"id"`
+	Created Time   `json:"created"`
+	Updated Time   `json:"updated"`
+
+	Name        string   `json:"name" example:"2022-q3"`
+	Resource    string   `json:"resource,omitempty" example:"kubernetes.production" note:"Resource the reviewed grants are on or under"`
+	Privilege   string   `json:"privilege,omitempty" example:"admin"`
+	SubjectKind string   `json:"subjectKind,omitempty" example:"group" note:"identity or group"`
+	Reviewers   []uid.ID `json:"reviewers" note:"ids of the identities that decide to keep or revoke the grants"`
+
+	Status    string `json:"status" example:"open" note:"open or closed"`
+	CreatedBy uid.ID `json:"createdBy"`
+	ClosedBy  uid.ID `json:"closedBy,omitempty"`
+	Closed    Time   `json:"closed"`
+}
+
+// ReviewItem is a grant in a review, as it was when the review was created, and the decision to keep or revoke it
+type ReviewItem struct {
+	ID     uid.ID `json:"id"`
+	Review uid.ID `json:"review"`
+
+	Grant       uid.ID            `json:"grant"`
+	Subject     uid.PolymorphicID `json:"subject"`
+	SubjectName string            `json:"subjectName"`
+	Privilege   string            `json:"privilege"`
+	Resource    string            `json:"resource"`
+
+	Decision  string `json:"decision" example:"keep" note:"pending, keep, or revoke"`
+	Comment   string `json:"comment,omitempty"`
+	DecidedBy uid.ID `json:"decidedBy,omitempty"`
+	Decided   Time   `json:"decided"`
+	Revoked   Time   `json:"revoked" note:"Time the grant was deleted, when the review closed"`
+}
+
+// ReviewEvidence is a review and its items, exported as evidence of the decisions
+type ReviewEvidence struct {
+	Review Review       `json:"review"`
+	Items  []ReviewItem `json:"items"`
+}
+
+type ListReviewsRequest struct {
+	Name   string `form:"name"`
+	Status string `form:"status" example:"open"`
+}
+
+type CreateReviewRequest struct {
+	Name        string   `json:"name" validate:"required" example:"2022-q3"`
+	Resource    string   `json:"resource" example:"kubernetes.production" note:"Review the grants on the resource and the resources under it, or every resource if empty"`
+	Privilege   string   `json:"privilege" example:"admin" note:"Review the grants of the privilege, or every privilege if empty"`
+	SubjectKind string   `json:"subjectKind" validate:"omitempty,oneof=identity group" example:"group" note:"Review the grants to identities or to groups, or both if empty"`
+	Reviewers   []uid.ID `json:"reviewers" validate:"required,min=1"`
+}
+
+type UpdateReviewRequest struct {
+	ID     uid.ID `uri:"id" json:"-" validate:"required"`
+	Status string `json:"status" validate:"required,oneof=closed" example:"closed"`
+}
+
+type UpdateReviewItemRequest struct {
+	ReviewID uid.ID `uri:"id" json:"-" validate:"required"`
+	ID       uid.ID `uri:"item" json:"-" validate:"required"`
+	Decision string `json:"decision" validate:"required,oneof=keep revoke" example:"revoke"`
+	Comment  string `json:"comment"`
+}
@@ -45,8 +45,10 @@ require (
 	github.com/gin-contrib/static v0.0.1
 	github.com/go-gormigrate/gormigrate/v2 v2.0.0
 	github.com/google/go-cmp v0.5.7
+	github.com/hashicorp/yamux v0.0.0-20180604194846-3520598351bb
 	github.com/iancoleman/strcase v0.2.0
 	github.com/mitchellh/mapstructure v1.4.3
+	github.com/moby/spdystream v0.2.0
 	github.com/spf13/afero v1.8.2
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.10.1
@@ -106,7 +108,6 @@ require (
 	github.com/hashicorp/golang-lru v0.5.4 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/hashicorp/vault/sdk v0.4.1 // indirect
-	github.com/hashicorp/yamux v0.0.0-20180604194846-3520598351bb // indirect
 	github.com/imdario/mergo v0.3.12 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/jackc/chunkreader/v2 v2.0.1 // indirect
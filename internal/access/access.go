@@ -2,12 +2,17 @@ package access
 
 import (
 	"fmt"
+	"net"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/resource"
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
 )
 
@@ -20,8 +25,8 @@ func getDB(c *gin.Context) *gorm.DB {
 	return db
 }
 
-// hasAuthorization checks if a caller is the owner of a resource before checking if they have an approprite role to access it
-func hasAuthorization(c *gin.Context, requestedResource uid.ID, isResourceOwner func(c *gin.Context, requestedResourceID uid.ID) (bool, error), oneOfRoles ...string) (*gorm.DB, error) {
+// hasAuthorization checks if a caller is the owner of a resource before checking if they have the permission to access it
+func hasAuthorization(c *gin.Context, requestedResource uid.ID, isResourceOwner func(c *gin.Context, requestedResourceID uid.ID) (bool, error), permission models.Permission) (*gorm.DB, error) {
 	owner, err := isResourceOwner(c, requestedResource)
 	if err != nil {
 		return nil, fmt.Errorf("owner lookup: %w", err)
@@ -31,59 +36,333 @@ func hasAuthorization(c *gin.Context, requestedResource uid.ID, isResourceOwner
 		return getDB(c), nil
 	}
 
-	return RequireInfraRole(c, oneOfRoles...)
+	return RequirePermission(c, permission, ResourceInfraAPI)
 }
 
 const ResourceInfraAPI = "infra"
 
-// RequireInfraRole checks that the identity in the context can perform an action on a resource based on their granted roles
+// RequireInfraRole checks that the identity in the context has been granted one of the Infra roles on infra, with
+// the conditions of the request
 func RequireInfraRole(c *gin.Context, oneOfRoles ...string) (*gorm.DB, error) {
-	db := getDB(c)
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range oneOfRoles {
+		if a.has(role, ResourceInfraAPI) {
+			return a.db, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: requestor does not have required grant", internal.ErrForbidden)
+}
+
+// Can checks if an identity or group has a privilege that means it can perform an action on a resource, granted to
+// it or to the groups it belongs to, directly or through other groups. Grants match the resource by their resource
+// pattern, e.g. a grant on kubernetes.* can act on kubernetes.production, and a grant on kubernetes.*[env=prod] can
+// act on the destinations labeled env=prod. Deny grants of the privilege on the resource, or on a resource it is
+// under, take the privilege away even when other grants give it. Grants with conditions apply in their time windows,
+// but not when they need a source address or an mfa level, which are only known for requests.
+func Can(db *gorm.DB, subject uid.PolymorphicID, privilege, name string) (bool, error) {
+	a, err := newSubjectAuthorizer(db, subject)
+	if err != nil {
+		return false, err
+	}
+
+	a.conditions = &models.ConditionContext{Time: time.Now()}
+
+	return a.has(privilege, name), nil
+}
+
+// requestConditions are the conditions of the request in the context, which the conditions of grants are checked
+// against
+func requestConditions(c *gin.Context) models.ConditionContext {
+	conditions := models.ConditionContext{Time: time.Now()}
+
+	if c.Request != nil {
+		conditions.SourceIP = net.ParseIP(c.ClientIP())
+	}
+
+	if key := currentAccessKey(c); key != nil {
+		conditions.MFALevel = key.MFALevel
+	}
+
+	return conditions
+}
+
+// subjectGroups lists the groups an identity or group belongs to, directly or through other groups
+func subjectGroups(db *gorm.DB, subject uid.PolymorphicID) ([]models.Group, error) {
+	id, err := subject.ID()
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []models.Group
+
+	switch {
+	case subject.IsIdentity():
+		groups, err = data.ListIdentityGroups(db, id)
+	case subject.IsGroup():
+		groups, err = data.ListGroupAncestors(db, id)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("auth user groups: %w", err)
+	}
 
+	return groups, nil
+}
+
+// RequirePermission checks that the identity in the context has a permission on a resource, either granted directly
+// or as part of an Infra role. Permissions that do not act on a particular resource are checked on infra.
+func RequirePermission(c *gin.Context, permission models.Permission, target string) (*gorm.DB, error) {
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.require(permission, target); err != nil {
+		return nil, err
+	}
+
+	return a.db, nil
+}
+
+// authorizer checks the permissions of the identity in the context, and the groups it belongs to
+type authorizer struct {
+	db     *gorm.DB
+	grants []models.Grant
+	groups []models.Group
+	labels resource.Labels
+
+	// conditions are what the conditions of grants are checked against, nil to apply grants whatever their
+	// conditions
+	conditions *models.ConditionContext
+}
+
+func newAuthorizer(c *gin.Context) (*authorizer, error) {
 	identity := CurrentIdentity(c)
 	if identity == nil {
 		return nil, fmt.Errorf("no active identity")
 	}
 
-	for _, role := range oneOfRoles {
-		ok, err := Can(db, identity.PolyID(), role, ResourceInfraAPI)
+	a, err := newSubjectAuthorizer(getDB(c), identity.PolyID())
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := requestConditions(c)
+	a.conditions = &conditions
+
+	return a, nil
+}
+
+// newSubjectAuthorizer checks the permissions of an identity or group, and the groups it belongs to
+func newSubjectAuthorizer(db *gorm.DB, subject uid.PolymorphicID) (*authorizer, error) {
+	grants, err := data.ListGrants(db, data.BySubject(subject))
+	if err != nil {
+		return nil, fmt.Errorf("has grants: %w", err)
+	}
+
+	a := &authorizer{db: db, grants: grants, labels: destinationLabels(db)}
+
+	a.groups, err = subjectGroups(db, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range a.groups {
+		groupGrants, err := data.ListGrants(db, data.BySubject(group.PolyID()))
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("has grants: %w", err)
+		}
+
+		a.grants = append(a.grants, groupGrants...)
+	}
+
+	return a, nil
+}
+
+// can checks if a permission is granted on a resource, or the caller owns the resource, and is not denied
+func (a *authorizer) can(permission models.Permission, target string) bool {
+	return a.canDirectly(permission, target) || a.owns(permission, target)
+}
+
+// canDirectly checks if a permission is granted on a resource by a role or a permission grant, and is not denied
+func (a *authorizer) canDirectly(permission models.Permission, target string) bool {
+	if a.denies(permission, target) {
+		return false
+	}
+
+	for _, g := range a.grants {
+		if a.allows(g, permission, target) {
+			return true
 		}
+	}
+
+	return false
+}
 
-		if ok {
-			return db, nil
+// owns checks if the caller owns a resource, and the owner role includes the permission. Owners of a resource also
+// own the resources under it.
+func (a *authorizer) owns(permission models.Permission, target string) bool {
+	if a.denies(permission, target) {
+		return false
+	}
+
+	for _, g := range a.grants {
+		if a.ownerAllows(g, permission, target) {
+			return true
 		}
 	}
 
-	// check if they belong to a group that is authorized
-	groups, err := data.ListIdentityGroups(db, identity.ID)
-	if err != nil {
-		return nil, fmt.Errorf("auth user groups: %w", err)
+	return false
+}
+
+// denies checks if a deny grant takes a permission on a resource away
+func (a *authorizer) denies(permission models.Permission, target string) bool {
+	for _, g := range a.grants {
+		if a.takes(g, string(permission), target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// has checks if a privilege is granted on a resource by name, and is not denied
+func (a *authorizer) has(privilege, name string) bool {
+	allowed := false
+
+	for _, g := range a.grants {
+		switch {
+		case a.takes(g, privilege, name):
+			return false
+		case !g.Deny && a.applies(g) && g.Privilege == privilege && resource.Match(g.Resource, name, a.labels):
+			allowed = true
+		}
+	}
+
+	return allowed
+}
+
+// applies checks if the conditions of a grant are met
+func (a *authorizer) applies(g models.Grant) bool {
+	return a.conditions == nil || g.Conditions.Check(*a.conditions) == nil
+}
+
+// allows checks if a grant gives a permission on a resource, by an Infra role or a permission grant
+func (a *authorizer) allows(g models.Grant, permission models.Permission, target string) bool {
+	switch {
+	case g.Deny || !a.applies(g):
+		return false
+	case a.roleIncludes(g, permission):
+		return true
+	case models.IsPermission(g.Privilege) && models.Permission(g.Privilege).Includes(permission):
+		// the target may be the pattern of a grant, which the grant must provably match all of
+		return resource.Match(g.Resource, ResourceInfraAPI, a.labels) || resource.MatchPattern(g.Resource, target, a.labels)
 	}
 
-	for _, group := range groups {
-		for _, role := range oneOfRoles {
-			ok, err := Can(db, group.PolyID(), role, ResourceInfraAPI)
-			if err != nil {
-				return nil, err
-			}
+	return false
+}
+
+// ownerAllows checks if a grant makes its subject an owner of a resource, and the owner role includes the permission.
+// The target may be the pattern of a grant, so owners only act on patterns that are provably within what they own:
+// an owner of kubernetes[env!=prod] can not grant on kubernetes.*, which includes prod.
+func (a *authorizer) ownerAllows(g models.Grant, permission models.Permission, target string) bool {
+	return !g.Deny && a.applies(g) && g.Privilege == models.InfraOwnerRole && ownerIncludes(permission) && resource.ContainsPattern(g.Resource, target, a.labels)
+}
 
-			if ok {
-				return db, nil
-			}
+// groupOf is the group a grant applies through, or nil when it is granted to the subject directly
+func (a *authorizer) groupOf(g models.Grant) *models.Group {
+	for i := range a.groups {
+		if a.groups[i].PolyID() == g.Subject {
+			return &a.groups[i]
 		}
 	}
 
-	return nil, fmt.Errorf("%w: requestor does not have required grant", internal.ErrForbidden)
+	return nil
 }
 
-// Can checks if an identity has a privilege that means it can perform an action on a resource
-func Can(db *gorm.DB, identity uid.PolymorphicID, privilege, resource string) (bool, error) {
-	grants, err := data.ListGrants(db, data.BySubject(identity), data.ByPrivilege(privilege), data.ByResource(resource))
-	if err != nil {
-		return false, fmt.Errorf("has grants: %w", err)
+// canAny checks if a permission is granted on any resource, to list the resources it is granted on
+func (a *authorizer) canAny(permission models.Permission) bool {
+	for _, g := range a.grants {
+		switch {
+		case g.Deny || !a.applies(g):
+			continue
+		case a.roleIncludes(g, permission):
+			return true
+		case models.IsPermission(g.Privilege) && models.Permission(g.Privilege).Includes(permission):
+			return true
+		case g.Privilege == models.InfraOwnerRole && ownerIncludes(permission):
+			return true
+		}
+	}
+
+	return false
+}
+
+// roleIncludes checks if a grant is of an Infra role that includes the permission. Roles only grant their permissions
+// when they are granted on infra, on other resources they are the roles of the destination.
+func (a *authorizer) roleIncludes(g models.Grant, permission models.Permission) bool {
+	bundle, ok := models.InfraRoles[g.Privilege]
+	if !ok || !resource.Match(g.Resource, ResourceInfraAPI, a.labels) {
+		return false
+	}
+
+	for _, p := range bundle {
+		if p.Includes(permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ownerIncludes(permission models.Permission) bool {
+	for _, p := range models.OwnerPermissions {
+		if p.Includes(permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *authorizer) require(permission models.Permission, target string) error {
+	if !a.can(permission, target) {
+		return fmt.Errorf("%w: requestor does not have permission %s on %s", internal.ErrForbidden, permission, target)
+	}
+
+	return nil
+}
+
+// requireGrant checks the caller can create or delete a grant. Owners can only manage the grants of the privileges
+// they may hand out, which default to models.DefaultOwnerPrivileges, and never Infra permissions or deny grants.
+func (a *authorizer) requireGrant(permission models.Permission, grant *models.Grant, ownerPrivileges []string) error {
+	if a.canDirectly(permission, grant.Resource) {
+		return nil
+	}
+
+	if err := a.require(permission, grant.Resource); err != nil {
+		return err
+	}
+
+	// a deny can restrict an owner too, so owners can neither remove denies nor add them
+	if grant.Deny {
+		return fmt.Errorf("%w: owners can not manage deny grants", internal.ErrForbidden)
+	}
+
+	if ownerPrivileges == nil {
+		ownerPrivileges = models.DefaultOwnerPrivileges
+	}
+
+	for _, privilege := range ownerPrivileges {
+		if privilege == grant.Privilege && !models.IsPermission(privilege) {
+			return nil
+		}
 	}
 
-	return len(grants) > 0, nil
+	return fmt.Errorf("%w: owners can only grant %s", internal.ErrForbidden, strings.Join(ownerPrivileges, ", "))
 }
@@ -12,8 +12,12 @@ import (
 	"github.com/infrahq/infra/uid"
 )
 
+// currentAccessKey is the access key the request was authenticated with, or the access key its client certificate was
+// issued with
 func currentAccessKey(c *gin.Context) *models.AccessKey {
-	accessKey, ok := c.MustGet("key").(*models.AccessKey)
+	value, _ := c.Get("key")
+
+	accessKey, ok := value.(*models.AccessKey)
 	if !ok {
 		return nil
 	}
@@ -22,7 +26,7 @@ func currentAccessKey(c *gin.Context) *models.AccessKey {
 }
 
 func ListAccessKeys(c *gin.Context, identityID uid.ID, name string) ([]models.AccessKey, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole, models.InfraViewRole)
+	db, err := RequirePermission(c, models.PermissionAccessKeysRead, ResourceInfraAPI)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +35,7 @@ func ListAccessKeys(c *gin.Context, identityID uid.ID, name string) ([]models.Ac
 }
 
 func CreateAccessKey(c *gin.Context, accessKey *models.AccessKey, identityID uid.ID) (body string, err error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequirePermission(c, models.PermissionAccessKeysCreate, ResourceInfraAPI)
 	if err != nil {
 		return "", err
 	}
@@ -55,7 +59,7 @@ func CreateAccessKey(c *gin.Context, accessKey *models.AccessKey, identityID uid
 }
 
 func DeleteAccessKey(c *gin.Context, id uid.ID) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequirePermission(c, models.PermissionAccessKeysDelete, ResourceInfraAPI)
 	if err != nil {
 		return err
 	}
@@ -66,9 +70,16 @@ func DeleteAccessKey(c *gin.Context, id uid.ID) error {
 func DeleteRequestAccessKey(c *gin.Context) error {
 	// does not need authorization check, this action is limited to the calling key
 	key := currentAccessKey(c)
+	if key == nil {
+		return fmt.Errorf("%w: request was not authenticated with an access key", internal.ErrBadRequest)
+	}
 
 	db := getDB(c)
 
+	if key.FamilyID != 0 {
+		return revokeSession(db, key.FamilyID)
+	}
+
 	return data.DeleteAccessKey(db, key.ID)
 }
 
@@ -81,42 +92,46 @@ func DeleteAllIdentityAccessKeys(c *gin.Context) error {
 
 	db := getDB(c)
 
+	if err := data.DeleteRefreshTokens(db, data.ByIssuedFor(identity.ID)); err != nil {
+		return err
+	}
+
 	return data.DeleteAccessKeys(db, data.ByIssuedFor(identity.ID))
 }
 
-// ExchangeAccessKey allows a key exchange to get a new key with a shorter lifetime
-func ExchangeAccessKey(c *gin.Context, requestingAccessKey string, expiry time.Time) (string, *models.Identity, error) {
+// ExchangeAccessKey allows a key exchange to get a new key with a shorter lifetime. The new key belongs to the session
+// of the exchanged key, if it has one, and the session it is refreshed in can not outlive the exchanged key, which is
+// when the returned sessionExpiry is.
+func ExchangeAccessKey(c *gin.Context, requestingAccessKey string, expiry time.Time) (secret string, identity *models.Identity, sessionExpiry time.Time, err error) {
 	db := getDB(c)
 
 	validatedRequestKey, err := data.ValidateAccessKey(db, requestingAccessKey)
 	if err != nil {
-		return "", nil, fmt.Errorf("%w: invalid access key in exchange: %v", internal.ErrUnauthorized, err)
+		return "", nil, time.Time{}, fmt.Errorf("%w: invalid access key in exchange: %v", internal.ErrUnauthorized, err)
 	}
 
 	if expiry.After(validatedRequestKey.ExpiresAt) {
-		return "", nil, fmt.Errorf("%w: cannot exchange an access key for another access key with a longer lifetime", internal.ErrBadRequest)
+		return "", nil, time.Time{}, fmt.Errorf("%w: cannot exchange an access key for another access key with a longer lifetime", internal.ErrBadRequest)
 	}
 
-	identity, err := data.GetIdentity(db, data.ByID(validatedRequestKey.IssuedFor))
+	identity, err = data.GetIdentity(db, data.ByID(validatedRequestKey.IssuedFor))
 	if err != nil {
-		return "", nil, fmt.Errorf("get identity exchange: %w", err)
-	}
-
-	if identity.Kind != models.MachineKind {
-		// this flow isn't supported for user identities yet
-		return "", nil, internal.ErrNotImplemented
+		return "", nil, time.Time{}, fmt.Errorf("get identity exchange: %w", err)
 	}
 
 	exchangedAccessKey := &models.AccessKey{
-		IssuedFor:  validatedRequestKey.IssuedFor,
-		ProviderID: validatedRequestKey.ProviderID,
-		ExpiresAt:  expiry,
+		IssuedFor:    validatedRequestKey.IssuedFor,
+		ProviderID:   validatedRequestKey.ProviderID,
+		ExpiresAt:    expiry,
+		MFALevel:     validatedRequestKey.MFALevel,
+		BreakGlassID: validatedRequestKey.BreakGlassID,
+		FamilyID:     validatedRequestKey.FamilyID,
 	}
 
-	secret, err := data.CreateAccessKey(db, exchangedAccessKey)
+	secret, err = data.CreateAccessKey(db, exchangedAccessKey)
 	if err != nil {
-		return "", nil, fmt.Errorf("create exchanged token: %w", err)
+		return "", nil, time.Time{}, fmt.Errorf("create exchanged token: %w", err)
 	}
 
-	return secret, identity, nil
+	return secret, identity, validatedRequestKey.ExpiresAt, nil
 }
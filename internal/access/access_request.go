@@ -0,0 +1,156 @@
+package access
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/resource"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// CreateAccessRequest requests a grant for the caller, which the owners of the resource can approve
+func CreateAccessRequest(c *gin.Context, request *models.AccessRequest) error {
+	// does not need authorization check, the request is for the calling identity
+	identity := CurrentIdentity(c)
+	if identity == nil {
+		return fmt.Errorf("no active identity")
+	}
+
+	if err := resource.Validate(request.Resource); err != nil {
+		return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	if err := models.ValidatePermission(request.Privilege); err != nil {
+		return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	request.IdentityID = identity.ID
+	request.Status = models.AccessRequestPending
+
+	return data.CreateAccessRequest(getDB(c), request)
+}
+
+// ListAccessRequests lists the caller's own requests, and the requests for the resources it can read the requests of
+func ListAccessRequests(c *gin.Context, status string) ([]models.AccessRequest, error) {
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	requests, err := data.ListAccessRequests(a.db, data.ByOptionalStatus(status))
+	if err != nil {
+		return nil, err
+	}
+
+	identity := CurrentIdentity(c)
+	readable := make([]models.AccessRequest, 0, len(requests))
+
+	for _, r := range requests {
+		if r.IdentityID == identity.ID || a.can(models.PermissionAccessRequestsRead, r.Resource) {
+			readable = append(readable, r)
+		}
+	}
+
+	return readable, nil
+}
+
+func GetAccessRequest(c *gin.Context, id uid.ID) (*models.AccessRequest, error) {
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := data.GetAccessRequest(a.db, data.ByID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if request.IdentityID == CurrentIdentity(c).ID {
+		return request, nil
+	}
+
+	if err := a.require(models.PermissionAccessRequestsRead, request.Resource); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// DecideAccessRequest approves or denies a pending request. Approving it grants the requested privilege, which owners
+// of the resource can only approve for ownerPrivileges, nil allows the default privileges. Identities can not decide
+// their own requests.
+func DecideAccessRequest(c *gin.Context, id uid.ID, status string, ownerPrivileges []string) (*models.AccessRequest, error) {
+	if status != models.AccessRequestApproved && status != models.AccessRequestDenied {
+		return nil, fmt.Errorf("%w: access requests can only be %s or %s", internal.ErrBadRequest, models.AccessRequestApproved, models.AccessRequestDenied)
+	}
+
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := data.GetAccessRequest(a.db, data.ByID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	identity := CurrentIdentity(c)
+
+	grant := &models.Grant{
+		Subject:   uid.NewIdentityPolymorphicID(request.IdentityID),
+		Privilege: request.Privilege,
+		Resource:  request.Resource,
+		CreatedBy: identity.ID,
+	}
+
+	if err := a.requireGrant(models.PermissionAccessRequestsApprove, grant, ownerPrivileges); err != nil {
+		return nil, err
+	}
+
+	if request.IdentityID == identity.ID {
+		return nil, fmt.Errorf("%w: cannot decide own access request", internal.ErrForbidden)
+	}
+
+	if request.Status != models.AccessRequestPending {
+		return nil, fmt.Errorf("%w: access request is already %s", internal.ErrBadRequest, request.Status)
+	}
+
+	if status == models.AccessRequestApproved {
+		existing, err := data.ListGrants(a.db, data.BySubject(grant.Subject), data.ByPrivilege(grant.Privilege), data.ByResource(grant.Resource))
+		if err != nil {
+			return nil, err
+		}
+
+		// only an unconditional allow gives what was requested, a deny or conditional grant for it does not
+		var found bool
+		for i := range existing {
+			if !existing[i].Deny && existing[i].Conditions.IsEmpty() {
+				grant, found = &existing[i], true
+				break
+			}
+		}
+
+		if !found {
+			if err := data.CreateGrant(a.db, grant); err != nil {
+				return nil, fmt.Errorf("approve access request: %w", err)
+			}
+		}
+
+		request.GrantID = grant.ID
+	}
+
+	request.Status = status
+	request.DecidedBy = identity.ID
+	request.DecidedAt = time.Now().UTC()
+
+	if err := data.SaveAccessRequest(a.db, request); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
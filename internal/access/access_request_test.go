@@ -0,0 +1,122 @@
+package access
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestAccessRequests(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+	admin := CurrentIdentity(c)
+
+	owner := &models.Identity{Name: "owner@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, owner)
+	assert.NilError(t, err)
+
+	requester := &models.Identity{Name: "dev@example.com", Kind: models.UserKind}
+	err = data.CreateIdentity(db, requester)
+	assert.NilError(t, err)
+
+	err = CreateGrant(c, &models.Grant{Subject: owner.PolyID(), Privilege: models.InfraOwnerRole, Resource: "kubernetes.staging"}, nil)
+	assert.NilError(t, err)
+
+	c.Set("identity", requester)
+
+	request := func(t *testing.T, privilege, resource string) *models.AccessRequest {
+		r := &models.AccessRequest{Privilege: privilege, Resource: resource, Reason: "on call"}
+		err := CreateAccessRequest(c, r)
+		assert.NilError(t, err)
+		assert.Equal(t, r.Status, models.AccessRequestPending)
+
+		return r
+	}
+
+	staging := request(t, "edit", "kubernetes.staging.web")
+	production := request(t, "edit", "kubernetes.production.web")
+	escalation := request(t, "cluster-admin", "kubernetes.staging")
+
+	t.Run("requesters can not approve their own", func(t *testing.T) {
+		_, err := DecideAccessRequest(c, staging.ID, models.AccessRequestApproved, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		requests, err := ListAccessRequests(c, "")
+		assert.NilError(t, err)
+		assert.Equal(t, len(requests), 3)
+	})
+
+	c.Set("identity", owner)
+
+	t.Run("owners see the requests for their resources", func(t *testing.T) {
+		requests, err := ListAccessRequests(c, models.AccessRequestPending)
+		assert.NilError(t, err)
+		assert.Equal(t, len(requests), 2)
+
+		_, err = GetAccessRequest(c, production.ID)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	t.Run("owners can not approve outside their resources", func(t *testing.T) {
+		_, err := DecideAccessRequest(c, production.ID, models.AccessRequestApproved, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		_, err = DecideAccessRequest(c, escalation.ID, models.AccessRequestApproved, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		// denying is limited the same way
+		_, err = DecideAccessRequest(c, escalation.ID, models.AccessRequestDenied, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	approved, err := DecideAccessRequest(c, staging.ID, models.AccessRequestApproved, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, approved.Status, models.AccessRequestApproved)
+	assert.Equal(t, approved.DecidedBy, owner.ID)
+
+	grant, err := data.GetGrant(db, data.ByID(approved.GrantID))
+	assert.NilError(t, err)
+	assert.Equal(t, grant.Subject, requester.PolyID())
+	assert.Equal(t, grant.Privilege, "edit")
+	assert.Equal(t, grant.Resource, "kubernetes.staging.web")
+	assert.Equal(t, grant.CreatedBy, owner.ID)
+
+	_, err = DecideAccessRequest(c, staging.ID, models.AccessRequestDenied, nil)
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+	c.Set("identity", admin)
+
+	denied, err := DecideAccessRequest(c, escalation.ID, models.AccessRequestDenied, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, denied.Status, models.AccessRequestDenied)
+	assert.Equal(t, denied.GrantID, uid.ID(0))
+
+	t.Run("approving beside a deny or conditional grant", func(t *testing.T) {
+		deny := &models.Grant{Subject: requester.PolyID(), Privilege: "edit", Resource: "kubernetes.staging.api", Deny: true}
+		err := data.CreateGrant(db, deny)
+		assert.NilError(t, err)
+
+		conditional := &models.Grant{Subject: requester.PolyID(), Privilege: "edit", Resource: "kubernetes.staging.api", Conditions: models.GrantConditions{CIDRs: []string{"10.0.0.0/8"}}}
+		err = data.CreateGrant(db, conditional)
+		assert.NilError(t, err)
+
+		c.Set("identity", requester)
+		r := request(t, "edit", "kubernetes.staging.api")
+		c.Set("identity", admin)
+
+		approved, err := DecideAccessRequest(c, r.ID, models.AccessRequestApproved, nil)
+		assert.NilError(t, err)
+
+		// the request is approved with a grant of its own, not linked to the grants that do not give it
+		assert.Assert(t, approved.GrantID != deny.ID && approved.GrantID != conditional.ID)
+
+		grant, err := data.GetGrant(db, data.ByID(approved.GrantID))
+		assert.NilError(t, err)
+		assert.Assert(t, !grant.Deny)
+		assert.Assert(t, grant.Conditions.IsEmpty())
+	})
+}
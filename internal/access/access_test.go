@@ -2,18 +2,23 @@ package access
 
 import (
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ssoroka/slice"
+	"gopkg.in/square/go-jose.v2/jwt"
 	"gorm.io/gorm"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 
+	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/claims"
 	"github.com/infrahq/infra/internal/server/authn"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
@@ -89,6 +94,35 @@ func TestBasicGrant(t *testing.T) {
 	cant(t, db, "i:alice", "write", "infra.machines")
 }
 
+func TestResourcePatternGrant(t *testing.T) {
+	db := setupDB(t)
+	err := data.CreateIdentity(db, tom)
+	assert.NilError(t, err)
+
+	grant(t, db, tom, "i:steven", "view", "kubernetes.*.team-a-*")
+	can(t, db, "i:steven", "view", "kubernetes.staging.team-a-api")
+	can(t, db, "i:steven", "view", "kubernetes.production.team-a-web")
+	cant(t, db, "i:steven", "view", "kubernetes.staging.team-b-api")
+	cant(t, db, "i:steven", "view", "kubernetes.staging")
+	cant(t, db, "i:steven", "edit", "kubernetes.staging.team-a-api")
+
+	grant(t, db, tom, "i:bob", "view", "kubernetes.*")
+	can(t, db, "i:bob", "view", "kubernetes.staging")
+	cant(t, db, "i:bob", "view", "kubernetes.staging.default")
+	cant(t, db, "i:bob", "view", "infra")
+
+	err = data.CreateDestination(db, &models.Destination{Name: "kubernetes.production", UniqueID: "production", Labels: models.Labels{"env": "prod"}})
+	assert.NilError(t, err)
+
+	err = data.CreateDestination(db, &models.Destination{Name: "kubernetes.staging", UniqueID: "staging"})
+	assert.NilError(t, err)
+
+	grant(t, db, tom, "i:alice", "edit", "kubernetes[env=prod].*.*")
+	can(t, db, "i:alice", "edit", "kubernetes.production.default")
+	cant(t, db, "i:alice", "edit", "kubernetes.staging.default")
+	cant(t, db, "i:alice", "edit", "kubernetes.unknown.default")
+}
+
 func TestUsersGroupGrant(t *testing.T) {
 	db := setupDB(t)
 	err := data.CreateIdentity(db, tom)
@@ -119,6 +153,150 @@ func TestUsersGroupGrant(t *testing.T) {
 	assert.Assert(t, authDB != nil)
 }
 
+func TestNestedGroupGrant(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+
+	dev := &models.Identity{Name: "dev@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, dev)
+	assert.NilError(t, err)
+
+	engineering := &models.Group{Name: "engineering"}
+	platform := &models.Group{Name: "platform"}
+	oncall := &models.Group{Name: "platform-oncall"}
+
+	for _, g := range []*models.Group{engineering, platform, oncall} {
+		err := data.CreateGroup(db, g)
+		assert.NilError(t, err)
+	}
+
+	err = data.BindGroupIdentities(db, oncall, *dev)
+	assert.NilError(t, err)
+
+	err = AddGroupMember(c, engineering.ID, platform.ID)
+	assert.NilError(t, err)
+
+	err = AddGroupMember(c, platform.ID, oncall.ID)
+	assert.NilError(t, err)
+
+	err = AddGroupMember(c, oncall.ID, engineering.ID)
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+	grant(t, db, CurrentIdentity(c), engineering.PolyID(), "view", "kubernetes.production")
+	grant(t, db, CurrentIdentity(c), engineering.PolyID(), models.InfraViewRole, "infra")
+
+	can(t, db, dev.PolyID(), "view", "kubernetes.production")
+	can(t, db, oncall.PolyID(), "view", "kubernetes.production")
+	cant(t, db, dev.PolyID(), "edit", "kubernetes.production")
+
+	_, err = data.InitializeSettings(db, false)
+	assert.NilError(t, err)
+
+	token, err := data.CreateIdentityToken(db, dev.ID, nil)
+	assert.NilError(t, err)
+
+	parsed, err := jwt.ParseSigned(token.Token)
+	assert.NilError(t, err)
+
+	var custom claims.Custom
+	err = parsed.UnsafeClaimsWithoutVerification(&custom)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(custom.Groups, 3))
+	assert.Assert(t, is.Contains(custom.Groups, "engineering"))
+
+	c.Set("identity", dev)
+
+	_, err = RequirePermission(c, models.PermissionGroupsRead, ResourceInfraAPI)
+	assert.NilError(t, err)
+
+	groups, err := ListGroupGroups(c, oncall.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(groups), 2)
+
+	err = AddGroupMember(c, engineering.ID, oncall.ID)
+	assert.ErrorIs(t, err, internal.ErrForbidden)
+}
+
+func TestConditionalGrants(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+
+	dev := &models.Identity{Name: "dev@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, dev)
+	assert.NilError(t, err)
+
+	office := models.GrantConditions{CIDRs: []string{"10.0.0.0/8"}}
+
+	err = CreateGrant(c, &models.Grant{Subject: dev.PolyID(), Privilege: "view", Resource: "kubernetes.production", Conditions: models.GrantConditions{CIDRs: []string{"10.0.0.1"}}}, nil)
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+	err = CreateGrant(c, &models.Grant{Subject: dev.PolyID(), Privilege: "view", Resource: "kubernetes.production", Deny: true, Conditions: office}, nil)
+	assert.Error(t, err, "bad request: deny grants can not have conditions")
+
+	err = CreateGrant(c, &models.Grant{Subject: dev.PolyID(), Privilege: string(models.PermissionGrantsRead), Resource: ResourceInfraAPI, Conditions: office}, nil)
+	assert.NilError(t, err)
+
+	err = CreateGrant(c, &models.Grant{Subject: dev.PolyID(), Privilege: models.InfraViewRole, Resource: ResourceInfraAPI, Conditions: models.GrantConditions{MFALevel: models.MFALevelAny}}, nil)
+	assert.NilError(t, err)
+
+	view := &models.Grant{Subject: dev.PolyID(), Privilege: "view", Resource: "kubernetes.production", Conditions: office}
+	err = CreateGrant(c, view, nil)
+	assert.NilError(t, err)
+
+	// the day after today never matches a window on today
+	tomorrow := strings.ToLower(time.Now().UTC().AddDate(0, 0, 1).Weekday().String()[:3])
+	err = CreateGrant(c, &models.Grant{Subject: dev.PolyID(), Privilege: "edit", Resource: "kubernetes.production", Conditions: models.GrantConditions{Windows: []api.TimeWindow{{Days: []string{tomorrow}, Start: "00:00", End: "23:59"}}}}, nil)
+	assert.NilError(t, err)
+
+	// the address of a request is not known outside of it
+	cant(t, db, dev.PolyID(), "view", "kubernetes.production")
+
+	request := func(remoteAddr string, mfaLevel int) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/v1/grants", nil)
+		c.Request.RemoteAddr = remoteAddr
+		c.Set("db", db)
+		c.Set("identity", dev)
+		c.Set("key", &models.AccessKey{IssuedFor: dev.ID, MFALevel: mfaLevel})
+
+		return c
+	}
+
+	_, err = RequirePermission(request("10.1.2.3:42312", models.MFALevelNone), models.PermissionGrantsRead, ResourceInfraAPI)
+	assert.NilError(t, err)
+
+	_, err = RequirePermission(request("192.168.1.2:42312", models.MFALevelNone), models.PermissionGrantsRead, ResourceInfraAPI)
+	assert.ErrorIs(t, err, internal.ErrForbidden)
+
+	_, err = RequireInfraRole(request("192.168.1.2:42312", models.MFALevelNone), models.InfraViewRole)
+	assert.ErrorIs(t, err, internal.ErrForbidden)
+
+	_, err = RequireInfraRole(request("192.168.1.2:42312", models.MFALevelAny), models.InfraViewRole)
+	assert.NilError(t, err)
+
+	_, err = data.InitializeSettings(db, false)
+	assert.NilError(t, err)
+
+	tokenClaims := func(c *gin.Context) claims.Custom {
+		token, err := CreateToken(c)
+		assert.NilError(t, err)
+
+		parsed, err := jwt.ParseSigned(token.Token)
+		assert.NilError(t, err)
+
+		var custom claims.Custom
+		err = parsed.UnsafeClaimsWithoutVerification(&custom)
+		assert.NilError(t, err)
+
+		return custom
+	}
+
+	// only destination grants whose conditions are met are in the token
+	custom := tokenClaims(request("10.1.2.3:42312", models.MFALevelHardware))
+	assert.DeepEqual(t, custom.Grants, []claims.Grant{{ID: view.ID.String(), CIDRs: office.CIDRs}})
+
+	custom = tokenClaims(request("192.168.1.2:42312", models.MFALevelHardware))
+	assert.Assert(t, is.Len(custom.Grants, 0))
+}
+
 func TestInfraRequireInfraRole(t *testing.T) {
 	db := setupDB(t)
 
@@ -171,6 +349,298 @@ func TestInfraRequireInfraRole(t *testing.T) {
 	})
 }
 
+func TestRequirePermission(t *testing.T) {
+	db := setupDB(t)
+
+	setup := func(t *testing.T, privilege, resource string) *gin.Context {
+		testIdentity := &models.Identity{Name: fmt.Sprintf("infra-%s-%s", privilege, time.Now()), Kind: models.MachineKind}
+
+		err := data.CreateIdentity(db, testIdentity)
+		assert.NilError(t, err)
+
+		err = data.CreateGrant(db, &models.Grant{Subject: testIdentity.PolyID(), Privilege: privilege, Resource: resource})
+		assert.NilError(t, err)
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set("db", db)
+		c.Set("identity", testIdentity)
+
+		return c
+	}
+
+	t.Run("role bundles", func(t *testing.T) {
+		c := setup(t, models.InfraViewRole, ResourceInfraAPI)
+
+		_, err := RequirePermission(c, models.PermissionGrantsRead, ResourceInfraAPI)
+		assert.NilError(t, err)
+
+		_, err = RequirePermission(c, models.PermissionGrantsCreate, "kubernetes.staging")
+		assert.Error(t, err, "forbidden: requestor does not have permission grants:create on kubernetes.staging")
+	})
+
+	t.Run("roles on destinations are not bundles", func(t *testing.T) {
+		c := setup(t, models.InfraAdminRole, "kubernetes.staging")
+
+		_, err := RequirePermission(c, models.PermissionGrantsCreate, "kubernetes.staging")
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	t.Run("permission on a resource", func(t *testing.T) {
+		c := setup(t, string(models.PermissionGrantsCreate), "kubernetes.staging.*")
+
+		_, err := RequirePermission(c, models.PermissionGrantsCreate, "kubernetes.staging.default")
+		assert.NilError(t, err)
+
+		_, err = RequirePermission(c, models.PermissionGrantsCreate, "kubernetes.production.default")
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		_, err = RequirePermission(c, models.PermissionGrantsDelete, "kubernetes.staging.default")
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	t.Run("every action", func(t *testing.T) {
+		c := setup(t, "grants:*", ResourceInfraAPI)
+
+		_, err := RequirePermission(c, models.PermissionGrantsDelete, "kubernetes.production")
+		assert.NilError(t, err)
+
+		_, err = RequirePermission(c, models.PermissionIdentitiesRead, ResourceInfraAPI)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+}
+
+func TestScopedGrants(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+
+	lead := &models.Identity{Name: "lead@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, lead)
+	assert.NilError(t, err)
+
+	for _, p := range []models.Permission{models.PermissionGrantsRead, models.PermissionGrantsCreate, models.PermissionGrantsDelete} {
+		err := CreateGrant(c, &models.Grant{Subject: lead.PolyID(), Privilege: string(p), Resource: "kubernetes.staging.*"}, nil)
+		assert.NilError(t, err)
+	}
+
+	production := &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: "kubernetes.production.default"}
+	err = CreateGrant(c, production, nil)
+	assert.NilError(t, err)
+
+	c.Set("identity", lead)
+
+	staging := &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: "kubernetes.staging.default"}
+	err = CreateGrant(c, staging, nil)
+	assert.NilError(t, err)
+
+	err = CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: "kubernetes.production.default"}, nil)
+	assert.ErrorIs(t, err, internal.ErrForbidden)
+
+	err = CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "grants:fly", Resource: "kubernetes.staging.default"}, nil)
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+	grants, err := ListGrants(c, "i:1234", "", "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(grants), 1)
+	assert.Equal(t, grants[0].ID, staging.ID)
+
+	_, err = GetGrant(c, production.ID)
+	assert.ErrorIs(t, err, internal.ErrForbidden)
+
+	err = DeleteGrant(c, production.ID, nil)
+	assert.ErrorIs(t, err, internal.ErrForbidden)
+
+	err = DeleteGrant(c, staging.ID, nil)
+	assert.NilError(t, err)
+}
+
+func TestScopedGrantsSelectors(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+
+	for name, labels := range map[string]models.Labels{
+		"kubernetes.production": {"env": "prod"},
+		"kubernetes.staging":    {"env": "staging"},
+	} {
+		err := data.CreateDestination(db, &models.Destination{Name: name, UniqueID: name, Labels: labels})
+		assert.NilError(t, err)
+	}
+
+	lead := &models.Identity{Name: "lead@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, lead)
+	assert.NilError(t, err)
+
+	err = CreateGrant(c, &models.Grant{Subject: lead.PolyID(), Privilege: string(models.PermissionGrantsCreate), Resource: "kubernetes[env!=prod].*.*"}, nil)
+	assert.NilError(t, err)
+
+	err = CreateGrant(c, &models.Grant{Subject: lead.PolyID(), Privilege: string(models.PermissionGrantsCreate), Resource: "kubernetes.team-*.*"}, nil)
+	assert.NilError(t, err)
+
+	c.Set("identity", lead)
+
+	for _, resource := range []string{"kubernetes.staging.default", "kubernetes[env!=prod].*.*", "kubernetes[env!=prod,team=a].*.web", "kubernetes.team-*.*", "kubernetes.team-a.default"} {
+		err := CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: resource}, nil)
+		assert.NilError(t, err, resource)
+	}
+
+	// patterns that reach prod, or resources the glob does not match
+	for _, resource := range []string{"kubernetes.*.*", "kubernetes.production.default", "kubernetes[env=prod].*.*", "kubernetes.*.default", "kubernetes.team*.*", "kubernetes[env!=prod].*"} {
+		err := CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: resource}, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden, resource)
+	}
+}
+
+func TestOwnerDelegation(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+
+	owner := &models.Identity{Name: "owner@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, owner)
+	assert.NilError(t, err)
+
+	err = CreateGrant(c, &models.Grant{Subject: owner.PolyID(), Privilege: models.InfraOwnerRole, Resource: "kubernetes.staging"}, nil)
+	assert.NilError(t, err)
+
+	coOwner := &models.Grant{Subject: "i:5678", Privilege: models.InfraOwnerRole, Resource: "kubernetes.staging"}
+	err = CreateGrant(c, coOwner, nil)
+	assert.NilError(t, err)
+
+	production := &models.Grant{Subject: "i:1234", Privilege: "view", Resource: "kubernetes.production"}
+	err = CreateGrant(c, production, nil)
+	assert.NilError(t, err)
+
+	admin := CurrentIdentity(c)
+
+	c.Set("identity", owner)
+
+	var created []*models.Grant
+
+	for _, resource := range []string{"kubernetes.staging", "kubernetes.staging.default", "kubernetes.staging.*"} {
+		g := &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: resource}
+		err := CreateGrant(c, g, nil)
+		assert.NilError(t, err, resource)
+
+		created = append(created, g)
+	}
+
+	t.Run("escalation outside the prefix", func(t *testing.T) {
+		for _, resource := range []string{"kubernetes.production", "kubernetes.*", "kubernetes.staging-2", "kubernetes", "infra", "*", "kubernetes.staging[env=prod]"} {
+			err := CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: resource}, nil)
+			assert.ErrorIs(t, err, internal.ErrForbidden, resource)
+		}
+
+		err := DeleteGrant(c, production.ID, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	t.Run("privileges owners can not grant", func(t *testing.T) {
+		for _, privilege := range []string{"cluster-admin", models.InfraOwnerRole, models.InfraAdminRole, string(models.PermissionGrantsCreate), "grants:*"} {
+			err := CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: privilege, Resource: "kubernetes.staging.default"}, nil)
+			assert.ErrorIs(t, err, internal.ErrForbidden, privilege)
+		}
+
+		// co-owners can not remove each other
+		err := DeleteGrant(c, coOwner.ID, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	t.Run("deny grants", func(t *testing.T) {
+		c.Set("identity", admin)
+
+		deny := &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: "kubernetes.staging.kube-system", Deny: true}
+		err := CreateGrant(c, deny, nil)
+		assert.NilError(t, err)
+
+		c.Set("identity", owner)
+
+		err = DeleteGrant(c, deny.ID, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		err = CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "view", Resource: "kubernetes.staging.default", Deny: true}, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		c.Set("identity", admin)
+
+		err = DeleteGrant(c, deny.ID, nil)
+		assert.NilError(t, err)
+
+		c.Set("identity", owner)
+	})
+
+	t.Run("configured privileges", func(t *testing.T) {
+		err := CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "admin", Resource: "kubernetes.staging.default"}, []string{"admin"})
+		assert.NilError(t, err)
+
+		err = CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: "kubernetes.staging.web"}, []string{"admin"})
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		err = CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "grants:create", Resource: "kubernetes.staging.default"}, []string{"grants:create"})
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	t.Run("list who has access", func(t *testing.T) {
+		grants, err := ListGrants(c, "", "", "")
+		assert.NilError(t, err)
+
+		for _, g := range grants {
+			assert.Assert(t, g.Resource != production.Resource)
+		}
+
+		assert.Equal(t, len(grants), 6) // both owners, and the four grants created on staging
+	})
+
+	for _, g := range created {
+		err := DeleteGrant(c, g.ID, nil)
+		assert.NilError(t, err)
+	}
+
+	t.Run("owners are not admins", func(t *testing.T) {
+		_, err := RequirePermission(c, models.PermissionIdentitiesCreate, ResourceInfraAPI)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		_, err = RequirePermission(c, models.PermissionDestinationsDelete, "kubernetes.staging")
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+}
+
+func TestOwnerDelegationSelectors(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+
+	for name, labels := range map[string]models.Labels{
+		"kubernetes.production": {"env": "prod", "pci": "true"},
+		"kubernetes.staging":    {"env": "staging"},
+		"kubernetes.payments":   {"env": "staging", "pci": "true"},
+	} {
+		err := data.CreateDestination(db, &models.Destination{Name: name, UniqueID: name, Labels: labels})
+		assert.NilError(t, err)
+	}
+
+	owner := &models.Identity{Name: "owner@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, owner)
+	assert.NilError(t, err)
+
+	for _, resource := range []string{"kubernetes[env!=prod]", "kubernetes[!pci]"} {
+		err = CreateGrant(c, &models.Grant{Subject: owner.PolyID(), Privilege: models.InfraOwnerRole, Resource: resource}, nil)
+		assert.NilError(t, err)
+	}
+
+	production := &models.Grant{Subject: "i:1234", Privilege: "view", Resource: "kubernetes.*"}
+	err = CreateGrant(c, production, nil)
+	assert.NilError(t, err)
+
+	c.Set("identity", owner)
+
+	for _, resource := range []string{"kubernetes.staging", "kubernetes.staging.*", "kubernetes.payments.default", "kubernetes[env!=prod].*", "kubernetes[!pci,team=a].*.default"} {
+		err := CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: resource}, nil)
+		assert.NilError(t, err, resource)
+	}
+
+	// patterns that reach resources outside of the selectors, because they have wildcards or other selectors
+	for _, resource := range []string{"kubernetes.*", "kubernetes.*.*", "kubernetes.production", "kubernetes[env=prod].*", "kubernetes[pci].*", "kubernetes.prod*", "kubernetes"} {
+		err := CreateGrant(c, &models.Grant{Subject: "i:1234", Privilege: "edit", Resource: resource}, nil)
+		assert.ErrorIs(t, err, internal.ErrForbidden, resource)
+	}
+
+	err = DeleteGrant(c, production.ID, nil)
+	assert.ErrorIs(t, err, internal.ErrForbidden)
+}
+
 func grant(t *testing.T, db *gorm.DB, currentUser *models.Identity, subject uid.PolymorphicID, privilege, resource string) {
 	err := data.CreateGrant(db, &models.Grant{
 		Subject:   subject,
@@ -197,10 +667,15 @@ func cant(t *testing.T, db *gorm.DB, subject uid.PolymorphicID, privilege, resou
 type mockOIDCImplementation struct {
 	UserEmailResp  string
 	UserGroupsResp []string
+	AMRResp        []string
+}
+
+func (m *mockOIDCImplementation) AuthorizeURL(state string) (string, error) {
+	return "https://example.com/authorize?state=" + state, nil
 }
 
-func (m *mockOIDCImplementation) ExchangeAuthCodeForProviderTokens(code string) (acc, ref string, exp time.Time, email string, err error) {
-	return "acc", "ref", exp, m.UserEmailResp, nil
+func (m *mockOIDCImplementation) ExchangeAuthCodeForProviderTokens(code string) (acc, ref string, exp time.Time, email string, amr []string, err error) {
+	return "acc", "ref", exp, m.UserEmailResp, m.AMRResp, nil
 }
 
 func (o *mockOIDCImplementation) RefreshAccessToken(providerUser *models.ProviderUser) (accessToken string, expiry *time.Time, err error) {
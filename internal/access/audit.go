@@ -0,0 +1,43 @@
+package access
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// CreateKubernetesAuditRecords stores the requests a connector proxied to its destination. The records are
+// always attributed to the destination, so a connector can not record requests for another cluster.
+func CreateKubernetesAuditRecords(c *gin.Context, destinationName string, records []models.KubernetesAuditRecord) error {
+	db, err := RequirePermission(c, models.PermissionAuditCreate, ResourceInfraAPI)
+	if err != nil {
+		return err
+	}
+
+	destination, err := data.GetDestination(db, data.ByName(destinationName))
+	if err != nil {
+		return err
+	}
+
+	if err := authorizeTrustedDestination(c, db, destination); err != nil {
+		return err
+	}
+
+	for i := range records {
+		records[i].Destination = destination.Name
+	}
+
+	return data.CreateKubernetesAuditRecords(db, records)
+}
+
+func ListKubernetesAuditRecords(c *gin.Context, filter models.KubernetesAuditRecord, since time.Time, limit int) ([]models.KubernetesAuditRecord, error) {
+	db, err := RequirePermission(c, models.PermissionAuditRead, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.ListKubernetesAuditRecords(db, data.ByExample(filter), data.ByTimeAfter(since), data.MostRecent(limit))
+}
@@ -0,0 +1,261 @@
+package access
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/resource"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// AppliedGrant is a grant that applies to a subject, directly or through a group it belongs to
+type AppliedGrant struct {
+	Grant models.Grant
+
+	// Group is the group the grant applies through, nil when it is granted to the subject
+	Group *models.Group
+
+	// Skipped is where the connector could not apply the grant
+	Skipped models.SkippedGrants
+
+	// DeniedBy are the deny grants that take away what the grant gives
+	DeniedBy []uid.ID
+}
+
+// Decision explains whether a subject has a privilege on a resource
+type Decision struct {
+	Allowed bool
+	Reason  string
+
+	// Grants are the grants that give the privilege
+	Grants []AppliedGrant
+
+	// Denials are the deny grants that take the privilege away, which beat the grants that give it
+	Denials []AppliedGrant
+
+	// Related are the grants of the privilege on other resources, and of other privileges on the resource
+	Related []AppliedGrant
+}
+
+// EffectiveAccess is every grant that applies to a subject, and the Infra API permissions they give it on infra
+type EffectiveAccess struct {
+	Grants      []AppliedGrant
+	Permissions []models.Permission
+}
+
+// CheckAccess explains whether a subject has a privilege on a resource, and which grants give it. Infra permissions
+// are checked as the API checks them, and other privileges as the connector applies them: grants on a destination
+// apply to its namespaces. An empty privilege checks for any privilege on the resource.
+func CheckAccess(c *gin.Context, subject uid.PolymorphicID, privilege, target string) (*Decision, error) {
+	if err := resource.Validate(target); err != nil {
+		return nil, fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	db, err := authorizeExplain(c, subject, target)
+	if err != nil {
+		return nil, err
+	}
+
+	subjectAuthorizer, err := newExplainedAuthorizer(db, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped, err := listSkippedGrants(db)
+	if err != nil {
+		return nil, err
+	}
+
+	decision := &Decision{Grants: []AppliedGrant{}}
+
+	for _, g := range subjectAuthorizer.grants {
+		applied := AppliedGrant{Grant: g, Group: subjectAuthorizer.groupOf(g)}
+
+		for _, s := range skipped[g.ID] {
+			if s.Resource == target || strings.HasPrefix(target, s.Resource+".") {
+				applied.Skipped = append(applied.Skipped, s)
+			}
+		}
+
+		switch {
+		case subjectAuthorizer.takes(g, privilege, target):
+			decision.Denials = append(decision.Denials, applied)
+		case subjectAuthorizer.gives(g, privilege, target):
+			decision.Grants = append(decision.Grants, applied)
+		case g.Privilege == privilege || resource.Contains(g.Resource, target, subjectAuthorizer.labels):
+			decision.Related = append(decision.Related, applied)
+		}
+	}
+
+	decision.Allowed = len(decision.Grants) > 0 && len(decision.Denials) == 0
+
+	switch {
+	case decision.Allowed:
+	case len(decision.Denials) > 0:
+		denial := decision.Denials[0].Grant
+		decision.Reason = fmt.Sprintf("denied by a deny grant of %s on %s, which beats any grant that gives it", denial.Privilege, denial.Resource)
+	case len(subjectAuthorizer.grants) == 0:
+		decision.Reason = fmt.Sprintf("%s has no grants, directly or through its groups", subject)
+	case privilege == "":
+		decision.Reason = fmt.Sprintf("no grant applies to %s", target)
+	case models.IsPermission(privilege):
+		decision.Reason = fmt.Sprintf("no grant of %s, or of a role that includes it, applies to %s", privilege, target)
+	default:
+		decision.Reason = fmt.Sprintf("no grant of %s applies to %s", privilege, target)
+	}
+
+	return decision, nil
+}
+
+// GetEffectiveAccess lists every grant that applies to a subject, and the Infra API permissions it has on infra
+func GetEffectiveAccess(c *gin.Context, subject uid.PolymorphicID) (*EffectiveAccess, error) {
+	db, err := authorizeExplain(c, subject, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	subjectAuthorizer, err := newExplainedAuthorizer(db, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped, err := listSkippedGrants(db)
+	if err != nil {
+		return nil, err
+	}
+
+	effective := &EffectiveAccess{Grants: []AppliedGrant{}, Permissions: []models.Permission{}}
+
+	for _, g := range subjectAuthorizer.grants {
+		applied := AppliedGrant{Grant: g, Group: subjectAuthorizer.groupOf(g), Skipped: skipped[g.ID]}
+
+		if !g.Deny {
+			for _, d := range subjectAuthorizer.grants {
+				if subjectAuthorizer.takes(d, g.Privilege, g.Resource) {
+					applied.DeniedBy = append(applied.DeniedBy, d.ID)
+				}
+			}
+		}
+
+		effective.Grants = append(effective.Grants, applied)
+	}
+
+	for p := range models.Permissions {
+		if subjectAuthorizer.canDirectly(p, ResourceInfraAPI) {
+			effective.Permissions = append(effective.Permissions, p)
+		}
+	}
+
+	sort.Slice(effective.Permissions, func(i, j int) bool {
+		return effective.Permissions[i] < effective.Permissions[j]
+	})
+
+	return effective, nil
+}
+
+// authorizeExplain checks the caller can see the access of a subject on a resource. Identities can see their own
+// access and the access of their groups, others need to be able to read the grants on the resource.
+func authorizeExplain(c *gin.Context, subject uid.PolymorphicID, target string) (*gorm.DB, error) {
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if subject == CurrentIdentity(c).PolyID() {
+		return a.db, nil
+	}
+
+	for _, group := range a.groups {
+		if group.PolyID() == subject {
+			return a.db, nil
+		}
+	}
+
+	if err := a.require(models.PermissionGrantsRead, target); err != nil {
+		return nil, err
+	}
+
+	return a.db, nil
+}
+
+// newExplainedAuthorizer checks the subject exists before loading its grants
+func newExplainedAuthorizer(db *gorm.DB, subject uid.PolymorphicID) (*authorizer, error) {
+	id, err := subject.ID()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	switch {
+	case subject.IsIdentity():
+		_, err = data.GetIdentity(db, data.ByID(id))
+	case subject.IsGroup():
+		_, err = data.GetGroup(db, data.ByID(id))
+	default:
+		return nil, fmt.Errorf("%w: unknown subject %q", internal.ErrBadRequest, subject)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newSubjectAuthorizer(db, subject)
+}
+
+// gives checks if a grant gives a privilege on a resource. Grants of any privilege give access to the resources
+// under the resource they are granted on, such as the namespaces of a destination.
+func (a *authorizer) gives(g models.Grant, privilege, target string) bool {
+	switch {
+	case g.Deny:
+		return false
+	case models.IsPermission(privilege):
+		return a.allows(g, models.Permission(privilege), target) || a.ownerAllows(g, models.Permission(privilege), target)
+	case privilege != "" && g.Privilege != privilege:
+		return false
+	}
+
+	return resource.Contains(g.Resource, target, a.labels)
+}
+
+// takes checks if a deny grant takes a privilege on a resource away. A deny grant takes away what the same grant
+// would give, and a deny of every privilege takes away every privilege on its resource and the resources under it,
+// or on the Infra API when it is granted on infra.
+func (a *authorizer) takes(g models.Grant, privilege, target string) bool {
+	switch {
+	case !g.Deny:
+		return false
+	case g.Privilege == models.DenyAllPrivileges:
+		return resource.Contains(g.Resource, target, a.labels) || (models.IsPermission(privilege) && resource.Match(g.Resource, ResourceInfraAPI, a.labels))
+	case privilege == "":
+		return false
+	}
+
+	allow := g
+	allow.Deny = false
+
+	return a.gives(allow, privilege, target)
+}
+
+// listSkippedGrants lists where the connectors could not apply each grant, by grant
+func listSkippedGrants(db *gorm.DB) (map[uid.ID]models.SkippedGrants, error) {
+	destinations, err := data.ListDestinations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := make(map[uid.ID]models.SkippedGrants)
+
+	for _, d := range destinations {
+		for _, s := range d.SkippedGrants {
+			skipped[s.Grant] = append(skipped[s.Grant], s)
+		}
+	}
+
+	return skipped, nil
+}
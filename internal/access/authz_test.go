@@ -0,0 +1,223 @@
+package access
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestCheckAccess(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+	admin := CurrentIdentity(c)
+
+	dev := &models.Identity{Name: "dev@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, dev)
+	assert.NilError(t, err)
+
+	other := &models.Identity{Name: "other@example.com", Kind: models.UserKind}
+	err = data.CreateIdentity(db, other)
+	assert.NilError(t, err)
+
+	err = db.Model(dev).Association("Groups").Append([]models.Group{{Name: "developers"}})
+	assert.NilError(t, err)
+
+	developers, err := data.GetGroup(db, data.ByName("developers"))
+	assert.NilError(t, err)
+
+	direct := &models.Grant{Subject: dev.PolyID(), Privilege: "view", Resource: "kubernetes.production"}
+	err = data.CreateGrant(db, direct)
+	assert.NilError(t, err)
+
+	throughGroup := &models.Grant{Subject: developers.PolyID(), Privilege: "edit", Resource: "kubernetes.staging"}
+	err = data.CreateGrant(db, throughGroup)
+	assert.NilError(t, err)
+
+	owner := &models.Grant{Subject: developers.PolyID(), Privilege: models.InfraOwnerRole, Resource: "kubernetes.staging"}
+	err = data.CreateGrant(db, owner)
+	assert.NilError(t, err)
+
+	err = data.CreateDestination(db, &models.Destination{
+		Name:     "staging",
+		UniqueID: "staging",
+		SkippedGrants: models.SkippedGrants{
+			{Grant: throughGroup.ID, Resource: "kubernetes.staging.web", Privilege: "edit", Reason: "namespace does not exist"},
+		},
+	})
+	assert.NilError(t, err)
+
+	t.Run("allowed through a group", func(t *testing.T) {
+		decision, err := CheckAccess(c, dev.PolyID(), "edit", "kubernetes.staging.web")
+		assert.NilError(t, err)
+		assert.Assert(t, decision.Allowed)
+		assert.Equal(t, len(decision.Grants), 1)
+		assert.Equal(t, decision.Grants[0].Grant.ID, throughGroup.ID)
+		assert.Equal(t, decision.Grants[0].Group.ID, developers.ID)
+		assert.DeepEqual(t, decision.Grants[0].Skipped, models.SkippedGrants{
+			{Grant: throughGroup.ID, Resource: "kubernetes.staging.web", Privilege: "edit", Reason: "namespace does not exist"},
+		})
+	})
+
+	t.Run("denied with the related grants", func(t *testing.T) {
+		decision, err := CheckAccess(c, dev.PolyID(), "edit", "kubernetes.production.web")
+		assert.NilError(t, err)
+		assert.Assert(t, !decision.Allowed)
+		assert.Equal(t, decision.Reason, "no grant of edit applies to kubernetes.production.web")
+		assert.Equal(t, len(decision.Grants), 0)
+
+		related := map[string]bool{}
+		for _, g := range decision.Related {
+			related[g.Grant.Privilege+" "+g.Grant.Resource] = true
+		}
+
+		assert.DeepEqual(t, related, map[string]bool{"view kubernetes.production": true, "edit kubernetes.staging": true})
+	})
+
+	t.Run("any privilege", func(t *testing.T) {
+		decision, err := CheckAccess(c, dev.PolyID(), "", "kubernetes.production.web")
+		assert.NilError(t, err)
+		assert.Assert(t, decision.Allowed)
+		assert.Equal(t, decision.Grants[0].Grant.ID, direct.ID)
+		assert.Assert(t, decision.Grants[0].Group == nil)
+	})
+
+	t.Run("infra permissions", func(t *testing.T) {
+		decision, err := CheckAccess(c, dev.PolyID(), string(models.PermissionGrantsCreate), "kubernetes.staging.web")
+		assert.NilError(t, err)
+		assert.Assert(t, decision.Allowed)
+		assert.Equal(t, decision.Grants[0].Grant.ID, owner.ID)
+
+		decision, err = CheckAccess(c, dev.PolyID(), string(models.PermissionGrantsCreate), ResourceInfraAPI)
+		assert.NilError(t, err)
+		assert.Assert(t, !decision.Allowed)
+
+		decision, err = CheckAccess(c, admin.PolyID(), string(models.PermissionBackupsRestore), ResourceInfraAPI)
+		assert.NilError(t, err)
+		assert.Assert(t, decision.Allowed)
+		assert.Equal(t, decision.Grants[0].Grant.Privilege, models.InfraAdminRole)
+	})
+
+	t.Run("no grants", func(t *testing.T) {
+		decision, err := CheckAccess(c, other.PolyID(), "view", "kubernetes.production")
+		assert.NilError(t, err)
+		assert.Assert(t, !decision.Allowed)
+		assert.Equal(t, decision.Reason, other.PolyID().String()+" has no grants, directly or through its groups")
+	})
+
+	t.Run("effective access", func(t *testing.T) {
+		effective, err := GetEffectiveAccess(c, dev.PolyID())
+		assert.NilError(t, err)
+		assert.Equal(t, len(effective.Grants), 3)
+		assert.Equal(t, len(effective.Permissions), 0)
+
+		effective, err = GetEffectiveAccess(c, admin.PolyID())
+		assert.NilError(t, err)
+		assert.Equal(t, len(effective.Permissions), len(models.Permissions))
+	})
+
+	t.Run("identities explain their own access", func(t *testing.T) {
+		c.Set("identity", other)
+		defer c.Set("identity", admin)
+
+		_, err := CheckAccess(c, other.PolyID(), "view", "kubernetes.production")
+		assert.NilError(t, err)
+
+		_, err = CheckAccess(c, dev.PolyID(), "view", "kubernetes.production")
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		_, err = GetEffectiveAccess(c, dev.PolyID())
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	t.Run("owners explain access to their resources", func(t *testing.T) {
+		c.Set("identity", dev)
+		defer c.Set("identity", admin)
+
+		_, err := CheckAccess(c, other.PolyID(), "view", "kubernetes.staging.web")
+		assert.NilError(t, err)
+
+		_, err = CheckAccess(c, other.PolyID(), "view", "kubernetes.production")
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+}
+
+func TestDenyGrants(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+	admin := CurrentIdentity(c)
+
+	contractor := &models.Identity{Name: "contractor@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, contractor)
+	assert.NilError(t, err)
+
+	engineering := &models.Group{Name: "engineering"}
+	contractors := &models.Group{Name: "contractors"}
+
+	for _, g := range []*models.Group{engineering, contractors} {
+		err := data.CreateGroup(db, g)
+		assert.NilError(t, err)
+
+		err = data.BindGroupIdentities(db, g, *contractor)
+		assert.NilError(t, err)
+	}
+
+	grant(t, db, admin, engineering.PolyID(), "edit", "kubernetes.prod.web")
+	grant(t, db, admin, engineering.PolyID(), "edit", "kubernetes.staging")
+	grant(t, db, admin, engineering.PolyID(), models.InfraViewRole, ResourceInfraAPI)
+
+	can(t, db, contractor.PolyID(), "edit", "kubernetes.prod.web")
+
+	deny := &models.Grant{Subject: contractors.PolyID(), Privilege: models.DenyAllPrivileges, Resource: "kubernetes.prod", Deny: true}
+	err = CreateGrant(c, deny, nil)
+	assert.NilError(t, err)
+
+	denyView := &models.Grant{Subject: contractor.PolyID(), Privilege: models.InfraViewRole, Resource: ResourceInfraAPI, Deny: true}
+	err = CreateGrant(c, denyView, nil)
+	assert.NilError(t, err)
+
+	err = CreateGrant(c, &models.Grant{Subject: contractor.PolyID(), Privilege: models.DenyAllPrivileges, Resource: "kubernetes.dev"}, nil)
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+	t.Run("deny beats allow", func(t *testing.T) {
+		cant(t, db, contractor.PolyID(), "edit", "kubernetes.prod.web")
+		can(t, db, contractor.PolyID(), "edit", "kubernetes.staging")
+		can(t, db, engineering.PolyID(), "edit", "kubernetes.prod.web")
+	})
+
+	t.Run("explained", func(t *testing.T) {
+		decision, err := CheckAccess(c, contractor.PolyID(), "edit", "kubernetes.prod.web")
+		assert.NilError(t, err)
+		assert.Assert(t, !decision.Allowed)
+		assert.Equal(t, len(decision.Grants), 1)
+		assert.Equal(t, len(decision.Denials), 1)
+		assert.Equal(t, decision.Denials[0].Grant.ID, deny.ID)
+		assert.Equal(t, decision.Reason, "denied by a deny grant of * on kubernetes.prod, which beats any grant that gives it")
+
+		effective, err := GetEffectiveAccess(c, contractor.PolyID())
+		assert.NilError(t, err)
+		assert.Equal(t, len(effective.Permissions), 0)
+
+		for _, applied := range effective.Grants {
+			if applied.Grant.Deny {
+				continue
+			}
+
+			switch applied.Grant.Resource {
+			case "kubernetes.prod.web", ResourceInfraAPI:
+				assert.Equal(t, len(applied.DeniedBy), 1, applied.Grant.Resource)
+			default:
+				assert.Equal(t, len(applied.DeniedBy), 0, applied.Grant.Resource)
+			}
+		}
+	})
+
+	t.Run("infra permissions", func(t *testing.T) {
+		c.Set("identity", contractor)
+		defer c.Set("identity", admin)
+
+		_, err := RequirePermission(c, models.PermissionGrantsRead, ResourceInfraAPI)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+}
@@ -0,0 +1,44 @@
+package access
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/secrets"
+)
+
+// BackupDatabase archives the server's state. Secret fields are sealed with a data key generated from the root key
+// of the provider, which the server restoring the archive needs access to.
+func BackupDatabase(c *gin.Context, provider string, kp secrets.SymmetricKeyProvider, rootKeyID string) (*data.Archive, error) {
+	db, err := RequirePermission(c, models.PermissionBackupsCreate, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := kp.GenerateDataKey(rootKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Backup(db, provider, key)
+}
+
+// RestoreDatabase replaces the server's state with an archive's. The archive key is decrypted by the provider it
+// was generated by.
+func RestoreDatabase(c *gin.Context, archive *data.Archive, kp secrets.SymmetricKeyProvider) error {
+	db, err := RequirePermission(c, models.PermissionBackupsRestore, ResourceInfraAPI)
+	if err != nil {
+		return err
+	}
+
+	key, err := kp.DecryptDataKey(archive.Key.RootKeyID, archive.Key.Encrypted)
+	if err != nil {
+		return fmt.Errorf("%w: decrypting archive key: %s", internal.ErrBadRequest, err)
+	}
+
+	return data.Restore(db, archive, key)
+}
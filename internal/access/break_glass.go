@@ -0,0 +1,409 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/generate"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/resource"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// DefaultBreakGlassDuration is how long a break-glass account stays unlocked, unless it is created with another
+// duration. MaxBreakGlassDuration is the longest it may be.
+const (
+	DefaultBreakGlassDuration = time.Hour
+	MaxBreakGlassDuration     = 24 * time.Hour
+)
+
+// breakGlassSecretLength is the length of each half of the secret of a break-glass account
+const breakGlassSecretLength = 24
+
+// CreateBreakGlass creates a break-glass account, and the machine identity in the Infra provider it logs in as. The
+// halves of its secret are returned for the holders, in their order, and can not be read again.
+func CreateBreakGlass(c *gin.Context, breakGlass *models.BreakGlass) ([]string, error) {
+	db, err := RequirePermission(c, models.PermissionBreakGlassCreate, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	if breakGlass.Privilege == "" {
+		breakGlass.Privilege = models.InfraAdminRole
+	}
+
+	if breakGlass.Resource == "" {
+		breakGlass.Resource = ResourceInfraAPI
+	}
+
+	if breakGlass.Duration == 0 {
+		breakGlass.Duration = DefaultBreakGlassDuration
+	}
+
+	if err := resource.Validate(breakGlass.Resource); err != nil {
+		return nil, fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	if err := models.ValidatePermission(breakGlass.Privilege); err != nil {
+		return nil, fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	if breakGlass.Duration < 0 || breakGlass.Duration > MaxBreakGlassDuration {
+		return nil, fmt.Errorf("%w: break-glass accounts can be unlocked for at most %s", internal.ErrBadRequest, MaxBreakGlassDuration)
+	}
+
+	if len(breakGlass.Holders) != models.BreakGlassHolders {
+		return nil, fmt.Errorf("%w: the secret is split between %d holders", internal.ErrBadRequest, models.BreakGlassHolders)
+	}
+
+	for _, holder := range breakGlass.Holders {
+		if holder == "" || strings.Contains(holder, ",") {
+			return nil, fmt.Errorf("%w: invalid holder %q", internal.ErrBadRequest, holder)
+		}
+	}
+
+	identity := &models.Identity{Name: breakGlass.Name, Kind: models.MachineKind}
+
+	if err := data.CreateIdentity(db, identity); err != nil {
+		return nil, fmt.Errorf("break-glass identity: %w", err)
+	}
+
+	if _, err := data.CreateProviderUser(db, data.InfraProvider(db), identity); err != nil {
+		return nil, fmt.Errorf("break-glass identity: %w", err)
+	}
+
+	secrets := make([]string, models.BreakGlassHolders)
+
+	for i := range secrets {
+		secrets[i], err = generate.CryptoRandom(breakGlassSecretLength)
+		if err != nil {
+			return nil, fmt.Errorf("generate: %w", err)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(secrets[i]), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("hash: %w", err)
+		}
+
+		breakGlass.SecretHashes = append(breakGlass.SecretHashes, string(hash))
+	}
+
+	breakGlass.IdentityID = identity.ID
+	breakGlass.CreatedBy = CurrentIdentity(c).ID
+
+	if err := data.CreateBreakGlass(db, breakGlass); err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+func ListBreakGlass(c *gin.Context, name string) ([]models.BreakGlass, error) {
+	db, err := RequirePermission(c, models.PermissionBreakGlassRead, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.ListBreakGlass(db, data.ByOptionalName(name))
+}
+
+func GetBreakGlass(c *gin.Context, id uid.ID) (*models.BreakGlass, error) {
+	db, err := RequirePermission(c, models.PermissionBreakGlassRead, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.GetBreakGlass(db, data.ByID(id))
+}
+
+// ListBreakGlassEvents lists the audit events of a break-glass account, newest first
+func ListBreakGlassEvents(c *gin.Context, id uid.ID) ([]models.BreakGlassEvent, error) {
+	db, err := RequirePermission(c, models.PermissionBreakGlassRead, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.ListBreakGlassEvents(db, data.ByBreakGlassID(id), data.MostRecent(0))
+}
+
+// DeleteBreakGlass deletes a break-glass account and its identity, locking it first when it is unlocked. Its audit
+// events are kept.
+func DeleteBreakGlass(c *gin.Context, id uid.ID) error {
+	db, err := RequirePermission(c, models.PermissionBreakGlassDelete, ResourceInfraAPI)
+	if err != nil {
+		return err
+	}
+
+	breakGlass, err := data.GetBreakGlass(db, data.ByID(id))
+	if err != nil {
+		return err
+	}
+
+	if !breakGlass.ExpiresAt.IsZero() {
+		event := &models.BreakGlassEvent{Kind: models.BreakGlassLocked, SourceIP: c.ClientIP(), Detail: "deleted by " + CurrentIdentity(c).Name}
+		if err := lockBreakGlass(db, breakGlass, event); err != nil {
+			return err
+		}
+	}
+
+	if err := data.DeleteGrants(db, data.BySubject(uid.NewIdentityPolymorphicID(breakGlass.IdentityID))); err != nil {
+		return err
+	}
+
+	if err := data.DeleteProviderUsers(db, data.ByIdentityID(breakGlass.IdentityID)); err != nil {
+		return err
+	}
+
+	if err := data.DeleteIdentity(db, breakGlass.IdentityID); err != nil {
+		return err
+	}
+
+	return data.DeleteBreakGlass(db, breakGlass.ID)
+}
+
+// UnlockBreakGlass checks both halves of the secret of a break-glass account, and grants its identity the elevated
+// privilege until its time is up. Unlocking an unlocked account issues another key, without extending its time.
+// Every attempt is audited and notified, whether it succeeds or not.
+func UnlockBreakGlass(c *gin.Context, name string, secrets []string) (string, *models.Identity, time.Time, error) {
+	db := getDB(c)
+
+	event := &models.BreakGlassEvent{Name: name, Kind: models.BreakGlassUnlockFailed, SourceIP: c.ClientIP()}
+
+	fail := func(reason string) error {
+		event.Detail = reason
+		if err := recordBreakGlassEvent(db, event); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w: invalid break-glass account or secrets", internal.ErrUnauthorized)
+	}
+
+	breakGlass, err := data.GetBreakGlass(db, data.ByName(name))
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return "", nil, time.Time{}, fail("unknown account")
+		}
+
+		return "", nil, time.Time{}, err
+	}
+
+	event.BreakGlassID = breakGlass.ID
+
+	if !matchBreakGlassSecrets(breakGlass.SecretHashes, secrets) {
+		return "", nil, time.Time{}, fail("invalid secrets")
+	}
+
+	identity, err := data.GetIdentity(db, data.ByID(breakGlass.IdentityID))
+	if err != nil {
+		return "", nil, time.Time{}, fmt.Errorf("break-glass identity: %w", err)
+	}
+
+	now := time.Now()
+
+	if !breakGlass.ExpiresAt.IsZero() && !breakGlass.IsUnlocked(now) {
+		// its time is up, but it has not been locked yet
+		if err := lockBreakGlass(db, breakGlass, &models.BreakGlassEvent{Kind: models.BreakGlassExpired}); err != nil {
+			return "", nil, time.Time{}, err
+		}
+	}
+
+	if !breakGlass.IsUnlocked(now) {
+		grant := &models.Grant{
+			Subject:   identity.PolyID(),
+			Privilege: breakGlass.Privilege,
+			Resource:  breakGlass.Resource,
+			CreatedBy: identity.ID,
+		}
+
+		if err := data.CreateGrant(db, grant); err != nil {
+			return "", nil, time.Time{}, err
+		}
+
+		breakGlass.UnlockedAt = now
+		breakGlass.ExpiresAt = now.Add(breakGlass.Duration)
+		breakGlass.GrantID = grant.ID
+
+		if err := data.SaveBreakGlass(db, breakGlass); err != nil {
+			return "", nil, time.Time{}, err
+		}
+	}
+
+	key := &models.AccessKey{
+		IssuedFor:    identity.ID,
+		ProviderID:   data.InfraProvider(db).ID,
+		ExpiresAt:    breakGlass.ExpiresAt,
+		BreakGlassID: breakGlass.ID,
+	}
+
+	raw, err := data.CreateAccessKey(db, key)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+
+	event.Kind = models.BreakGlassUnlocked
+	event.Detail = fmt.Sprintf("%s on %s until %s", breakGlass.Privilege, breakGlass.Resource, breakGlass.ExpiresAt.UTC().Format(time.RFC3339))
+
+	if err := recordBreakGlassEvent(db, event); err != nil {
+		return "", nil, time.Time{}, err
+	}
+
+	return raw, identity, breakGlass.ExpiresAt, nil
+}
+
+// matchBreakGlassSecrets checks each hash matches a different one of the secrets
+func matchBreakGlassSecrets(hashes []string, secrets []string) bool {
+	if len(secrets) != len(hashes) {
+		return false
+	}
+
+	used := make([]bool, len(secrets))
+
+	for _, hash := range hashes {
+		matched := false
+
+		for i, secret := range secrets {
+			if !used[i] && bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil {
+				used[i] = true
+				matched = true
+
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// LockBreakGlass revokes the grant and access keys of an unlocked break-glass account before its time is up
+func LockBreakGlass(c *gin.Context, id uid.ID) (*models.BreakGlass, error) {
+	db, err := RequirePermission(c, models.PermissionBreakGlassLock, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	breakGlass, err := data.GetBreakGlass(db, data.ByID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if breakGlass.ExpiresAt.IsZero() {
+		return nil, fmt.Errorf("%w: break-glass account %s is not unlocked", internal.ErrBadRequest, breakGlass.Name)
+	}
+
+	event := &models.BreakGlassEvent{Kind: models.BreakGlassLocked, SourceIP: c.ClientIP(), Detail: "by " + CurrentIdentity(c).Name}
+	if err := lockBreakGlass(db, breakGlass, event); err != nil {
+		return nil, err
+	}
+
+	return breakGlass, nil
+}
+
+// ExpireBreakGlass locks the break-glass accounts whose time is up. The access keys they issued expire on their own,
+// and this revokes their grants.
+func ExpireBreakGlass(db *gorm.DB) error {
+	expired, err := data.ListBreakGlass(db, data.ByExpiredBefore(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	for i := range expired {
+		event := &models.BreakGlassEvent{Kind: models.BreakGlassExpired}
+		if err := lockBreakGlass(db, &expired[i], event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockBreakGlass revokes the grants, access keys, and sessions of a break-glass account's identity, and records the
+// event
+func lockBreakGlass(db *gorm.DB, breakGlass *models.BreakGlass, event *models.BreakGlassEvent) error {
+	subject := uid.NewIdentityPolymorphicID(breakGlass.IdentityID)
+
+	if err := data.DeleteGrants(db, data.BySubject(subject)); err != nil {
+		return fmt.Errorf("revoke break-glass grant: %w", err)
+	}
+
+	if err := data.DeleteAccessKeys(db, data.ByIssuedFor(breakGlass.IdentityID)); err != nil {
+		return fmt.Errorf("revoke break-glass access keys: %w", err)
+	}
+
+	if err := data.DeleteRefreshTokens(db, data.ByIssuedFor(breakGlass.IdentityID)); err != nil {
+		return fmt.Errorf("revoke break-glass sessions: %w", err)
+	}
+
+	breakGlass.ExpiresAt = time.Time{}
+	breakGlass.GrantID = 0
+
+	if err := data.SaveBreakGlass(db, breakGlass); err != nil {
+		return err
+	}
+
+	event.BreakGlassID = breakGlass.ID
+	event.Name = breakGlass.Name
+
+	return recordBreakGlassEvent(db, event)
+}
+
+// AuditBreakGlassUse records a request made with an access key issued by unlocking a break-glass account
+func AuditBreakGlassUse(c *gin.Context, key *models.AccessKey) error {
+	db := getDB(c)
+
+	breakGlass, err := data.GetBreakGlass(db, data.ByID(key.BreakGlassID))
+	if err != nil {
+		return fmt.Errorf("break-glass account: %w", err)
+	}
+
+	// every request is audited, but only the first with each key is notified, so a busy session does not flood them
+	used, err := data.Count[models.BreakGlassEvent](db, data.ByAccessKeyID(key.ID))
+	if err != nil {
+		return fmt.Errorf("break-glass events: %w", err)
+	}
+
+	event := &models.BreakGlassEvent{
+		BreakGlassID: breakGlass.ID,
+		Name:         breakGlass.Name,
+		Kind:         models.BreakGlassUsed,
+		SourceIP:     c.ClientIP(),
+		Detail:       c.Request.Method + " " + c.Request.URL.Path,
+		AccessKeyID:  key.ID,
+		Pending:      *used == 0,
+	}
+
+	return recordBreakGlassEvent(db, event)
+}
+
+// recordBreakGlassEvent stores an audit event. Events other than requests are always pending, to be sent to the
+// notifications once the transaction is committed. Every event is logged as a warning too, so they are seen when no
+// notifications are configured or they fail.
+func recordBreakGlassEvent(db *gorm.DB, event *models.BreakGlassEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	if event.Kind != models.BreakGlassUsed {
+		event.Pending = true
+	}
+
+	if err := data.CreateBreakGlassEvent(db, event); err != nil {
+		return fmt.Errorf("break-glass event: %w", err)
+	}
+
+	logging.S.Warn(event.Summary())
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package access
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestBreakGlass(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/break-glass", nil)
+
+	_, err := data.InitializeSettings(db, false)
+	assert.NilError(t, err)
+
+	_, err = CreateBreakGlass(c, &models.BreakGlass{Name: "emergency", Holders: []string{"alice@example.com"}})
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+	_, err = CreateBreakGlass(c, &models.BreakGlass{Name: "emergency", Holders: []string{"alice@example.com", "bob@example.com"}, Duration: 48 * time.Hour})
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+	breakGlass := &models.BreakGlass{Name: "emergency", Holders: []string{"alice@example.com", "bob@example.com"}}
+	secrets, err := CreateBreakGlass(c, breakGlass)
+	assert.NilError(t, err)
+	assert.Equal(t, len(secrets), 2)
+	assert.Assert(t, secrets[0] != secrets[1])
+	assert.Equal(t, breakGlass.Privilege, models.InfraAdminRole)
+	assert.Equal(t, breakGlass.Resource, ResourceInfraAPI)
+	assert.Equal(t, breakGlass.Duration, DefaultBreakGlassDuration)
+
+	identity, err := data.GetIdentity(db, data.ByID(breakGlass.IdentityID))
+	assert.NilError(t, err)
+	assert.Equal(t, identity.Name, "emergency")
+
+	// pending lists the kinds of the events waiting to be sent to the notifications, and marks them sent
+	pending := func(t *testing.T) []string {
+		events, err := data.ListBreakGlassEvents(db, data.ByPendingNotification())
+		assert.NilError(t, err)
+
+		kinds := []string{}
+		for _, event := range events {
+			kinds = append(kinds, event.Kind)
+
+			err := data.MarkBreakGlassEventSent(db, event.ID)
+			assert.NilError(t, err)
+		}
+
+		return kinds
+	}
+
+	request := func() *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/login", nil)
+		c.Request.RemoteAddr = "10.1.2.3:42312"
+		c.Set("db", db)
+
+		return c
+	}
+
+	t.Run("one half of the secret does not unlock", func(t *testing.T) {
+		_, _, _, err := UnlockBreakGlass(request(), "emergency", []string{secrets[0], secrets[0]})
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+
+		_, _, _, err = UnlockBreakGlass(request(), "unknown", secrets)
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+
+		assert.DeepEqual(t, pending(t), []string{models.BreakGlassUnlockFailed, models.BreakGlassUnlockFailed})
+		cant(t, db, identity.PolyID(), models.InfraAdminRole, ResourceInfraAPI)
+	})
+
+	// the halves can be given in any order
+	key, unlocked, expires, err := UnlockBreakGlass(request(), "emergency", []string{secrets[1], secrets[0]})
+	assert.NilError(t, err)
+	assert.Equal(t, unlocked.ID, identity.ID)
+	assert.DeepEqual(t, pending(t), []string{models.BreakGlassUnlocked})
+	can(t, db, identity.PolyID(), models.InfraAdminRole, ResourceInfraAPI)
+
+	accessKey, err := data.ValidateAccessKey(db, key)
+	assert.NilError(t, err)
+	assert.Equal(t, accessKey.BreakGlassID, breakGlass.ID)
+	assert.Assert(t, accessKey.ExpiresAt.Equal(expires))
+
+	_, err = CreateRefreshToken(request(), key, "cli", expires)
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+	for i := 0; i < 2; i++ {
+		use := request()
+		use.Request = httptest.NewRequest(http.MethodGet, "/v1/identities", nil)
+		err = AuditBreakGlassUse(use, accessKey)
+		assert.NilError(t, err)
+	}
+
+	// every request is audited, but only the first with the key is notified
+	assert.DeepEqual(t, pending(t), []string{models.BreakGlassUsed})
+
+	t.Run("not expired yet", func(t *testing.T) {
+		err := ExpireBreakGlass(db)
+		assert.NilError(t, err)
+		can(t, db, identity.PolyID(), models.InfraAdminRole, ResourceInfraAPI)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		breakGlass, err := data.GetBreakGlass(db, data.ByID(breakGlass.ID))
+		assert.NilError(t, err)
+
+		breakGlass.ExpiresAt = time.Now().Add(-time.Minute)
+		err = data.SaveBreakGlass(db, breakGlass)
+		assert.NilError(t, err)
+
+		err = ExpireBreakGlass(db)
+		assert.NilError(t, err)
+
+		cant(t, db, identity.PolyID(), models.InfraAdminRole, ResourceInfraAPI)
+
+		_, err = data.ValidateAccessKey(db, key)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+
+		locked, err := data.GetBreakGlass(db, data.ByID(breakGlass.ID))
+		assert.NilError(t, err)
+		assert.Assert(t, locked.ExpiresAt.IsZero())
+		assert.Equal(t, locked.GrantID, uid.ID(0))
+	})
+
+	t.Run("locked early", func(t *testing.T) {
+		_, _, _, err := UnlockBreakGlass(request(), "emergency", secrets)
+		assert.NilError(t, err)
+		can(t, db, identity.PolyID(), models.InfraAdminRole, ResourceInfraAPI)
+
+		_, err = LockBreakGlass(c, breakGlass.ID)
+		assert.NilError(t, err)
+		cant(t, db, identity.PolyID(), models.InfraAdminRole, ResourceInfraAPI)
+
+		_, err = LockBreakGlass(c, breakGlass.ID)
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+	})
+
+	assert.DeepEqual(t, pending(t), []string{models.BreakGlassExpired, models.BreakGlassUnlocked, models.BreakGlassLocked})
+
+	events, err := ListBreakGlassEvents(c, breakGlass.ID)
+	assert.NilError(t, err)
+
+	kinds := make([]string, len(events))
+	for i, event := range events {
+		kinds[i] = event.Kind
+	}
+
+	// newest first, with the failed unlock of an unknown account not among them
+	expected := []string{
+		models.BreakGlassLocked,
+		models.BreakGlassUnlocked,
+		models.BreakGlassExpired,
+		models.BreakGlassUsed,
+		models.BreakGlassUsed,
+		models.BreakGlassUnlocked,
+		models.BreakGlassUnlockFailed,
+	}
+	assert.DeepEqual(t, kinds, expected)
+
+	err = DeleteBreakGlass(c, breakGlass.ID)
+	assert.NilError(t, err)
+
+	_, err = data.GetIdentity(db, data.ByID(identity.ID))
+	assert.ErrorIs(t, err, internal.ErrNotFound)
+}
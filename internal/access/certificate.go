@@ -0,0 +1,53 @@
+package access
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/pki"
+)
+
+// CreateClientCertificate signs a client certificate for the calling identity. The certificate expires with the access
+// key the request was authenticated with, and is revoked with it.
+func CreateClientCertificate(c *gin.Context, csr *x509.CertificateRequest, cp pki.CertificateProvider) (*x509.Certificate, []byte, error) {
+	identity := CurrentIdentity(c)
+	if identity == nil {
+		return nil, nil, fmt.Errorf("no active identity")
+	}
+
+	key := currentAccessKey(c)
+	if key == nil {
+		return nil, nil, fmt.Errorf("%w: request was not authenticated with an access key", internal.ErrBadRequest)
+	}
+
+	// break-glass use is audited by the access key, so the key can not be exchanged for a certificate
+	if key.BreakGlassID != 0 {
+		return nil, nil, fmt.Errorf("%w: break-glass access keys can not be exchanged for client certificates", internal.ErrBadRequest)
+	}
+
+	// does not need authorization check, the certificate is limited to the calling identity
+	db := getDB(c)
+
+	cert, pemBytes, err := pki.SignClientCert(cp, csr, identity, key.ExpiresAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	issued := &models.ClientCertificate{
+		SerialNumber: cert.SerialNumber.String(),
+		IdentityID:   identity.ID,
+		AccessKeyID:  key.ID,
+		ExpiresAt:    cert.NotAfter,
+	}
+
+	if err := data.CreateClientCertificate(db, issued); err != nil {
+		return nil, nil, fmt.Errorf("create client certificate: %w", err)
+	}
+
+	return cert, pemBytes, nil
+}
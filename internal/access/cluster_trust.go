@@ -0,0 +1,202 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+func CreateClusterTrust(c *gin.Context, trust *models.ClusterTrust) error {
+	db, err := RequirePermission(c, models.PermissionClusterTrustsCreate, ResourceInfraAPI)
+	if err != nil {
+		return err
+	}
+
+	return data.CreateClusterTrust(db, trust)
+}
+
+func ListClusterTrusts(c *gin.Context, name string) ([]models.ClusterTrust, error) {
+	db, err := RequirePermission(c, models.PermissionClusterTrustsRead, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.ListClusterTrusts(db, data.ByOptionalName(name))
+}
+
+func DeleteClusterTrust(c *gin.Context, id uid.ID) error {
+	db, err := RequirePermission(c, models.PermissionClusterTrustsDelete, ResourceInfraAPI)
+	if err != nil {
+		return err
+	}
+
+	return data.DeleteClusterTrust(db, id)
+}
+
+// GetClusterTrustForRegistration finds the trust for the destination a connector is registering
+func GetClusterTrustForRegistration(c *gin.Context, name string) (*models.ClusterTrust, error) {
+	// does not need authorization check, the connector proves its identity with the trust
+	db := getDB(c)
+
+	trust, err := data.GetClusterTrust(db, data.ByName(name))
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return nil, fmt.Errorf("%w: no cluster trust for destination %q", internal.ErrUnauthorized, name)
+		}
+
+		return nil, err
+	}
+
+	return trust, nil
+}
+
+// RegisterDestination creates or updates the destination of a trusted cluster, and issues an access key to its
+// connector. username is the reviewed service account of the connector. The first registration binds the
+// destination's unique ID to the trust, later registrations must present the same unique ID.
+func RegisterDestination(c *gin.Context, trust *models.ClusterTrust, username string, destination *models.Destination, expires time.Time) (string, error) {
+	// does not need authorization check, the cluster reviewed the connector's token
+	db := getDB(c)
+
+	if username != serviceAccountUsernamePrefix+trust.ServiceAccount {
+		return "", fmt.Errorf("%w: service account %q is not trusted to register %q", internal.ErrUnauthorized, username, trust.Name)
+	}
+
+	switch trust.UniqueID {
+	case "":
+		trust.UniqueID = destination.UniqueID
+	case destination.UniqueID:
+	default:
+		return "", fmt.Errorf("%w: %q is registered to another cluster", internal.ErrUnauthorized, trust.Name)
+	}
+
+	if trust.IdentityID == 0 {
+		machine, err := trustedConnectorIdentity(db, trust)
+		if err != nil {
+			return "", err
+		}
+
+		trust.IdentityID = machine.ID
+	}
+
+	if err := data.SaveClusterTrust(db, trust); err != nil {
+		return "", fmt.Errorf("bind cluster trust: %w", err)
+	}
+
+	existing, err := data.GetDestination(db, data.ByUniqueID(destination.UniqueID))
+	if errors.Is(err, internal.ErrNotFound) {
+		// the trust owns the name, so a destination registered with a shared access key is taken over
+		existing, err = data.GetDestination(db, data.ByName(destination.Name))
+	}
+
+	switch {
+	case err == nil:
+		destination.ID = existing.ID
+		destination.CreatedAt = existing.CreatedAt
+		destination.Labels = existing.Labels
+		keepHeartbeat(destination, existing)
+
+		if err := data.SaveDestination(db, destination); err != nil {
+			return "", fmt.Errorf("update trusted destination: %w", err)
+		}
+	case errors.Is(err, internal.ErrNotFound):
+		if err := data.CreateDestination(db, destination); err != nil {
+			return "", fmt.Errorf("create trusted destination: %w", err)
+		}
+	default:
+		return "", err
+	}
+
+	key := &models.AccessKey{
+		IssuedFor:  trust.IdentityID,
+		ProviderID: data.InfraProvider(db).ID,
+		ExpiresAt:  expires,
+	}
+
+	return data.CreateAccessKey(db, key)
+}
+
+// trustedConnectorIdentity returns the machine a trusted cluster's connector logs in as, with the connector role
+func trustedConnectorIdentity(db *gorm.DB, trust *models.ClusterTrust) (*models.Identity, error) {
+	name := fmt.Sprintf("connector.%s", trust.Name)
+
+	machine, err := data.GetIdentity(db, data.ByName(name))
+	if err != nil {
+		if !errors.Is(err, internal.ErrNotFound) {
+			return nil, err
+		}
+
+		machine = &models.Identity{Name: name, Kind: models.MachineKind}
+		if err := data.CreateIdentity(db, machine); err != nil {
+			return nil, fmt.Errorf("create trusted connector: %w", err)
+		}
+	}
+
+	_, err = data.GetGrant(db, data.BySubject(machine.PolyID()), data.ByPrivilege(models.InfraConnectorRole), data.ByResource(ResourceInfraAPI))
+	if errors.Is(err, internal.ErrNotFound) {
+		grant := &models.Grant{Subject: machine.PolyID(), Privilege: models.InfraConnectorRole, Resource: ResourceInfraAPI}
+		if err := data.CreateGrant(db, grant); err != nil {
+			return nil, fmt.Errorf("trusted connector grant: %w", err)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return machine, nil
+}
+
+// authorizeTrustedDestination checks that a destination can be changed by the caller. Connectors registered through a
+// cluster trust can only change their own destination, and other connectors can not change the name or unique ID of a
+// trusted cluster.
+func authorizeTrustedDestination(c *gin.Context, db *gorm.DB, destinations ...*models.Destination) error {
+	if _, err := RequirePermission(c, models.PermissionClusterTrustsCreate, ResourceInfraAPI); err == nil {
+		return nil
+	}
+
+	identity := CurrentIdentity(c)
+	if identity == nil {
+		return fmt.Errorf("no active identity")
+	}
+
+	bound, err := data.GetClusterTrust(db, data.ByIdentityID(identity.ID))
+	if err != nil && !errors.Is(err, internal.ErrNotFound) {
+		return err
+	}
+
+	for _, destination := range destinations {
+		if bound != nil {
+			if destination.Name != bound.Name || destination.UniqueID != bound.UniqueID {
+				return fmt.Errorf("%w: connector can only register its own cluster", internal.ErrForbidden)
+			}
+
+			continue
+		}
+
+		selectors := []data.SelectorFunc{data.ByName(destination.Name)}
+		if destination.UniqueID != "" {
+			selectors = append(selectors, data.ByUniqueID(destination.UniqueID))
+		}
+
+		for _, selector := range selectors {
+			_, err := data.GetClusterTrust(db, selector)
+			if err == nil {
+				return fmt.Errorf("%w: destination %q is registered through a cluster trust", internal.ErrForbidden, destination.Name)
+			}
+
+			if !errors.Is(err, internal.ErrNotFound) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -14,7 +14,7 @@ import (
 )
 
 func CreateCredential(c *gin.Context, user models.Identity) (string, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequirePermission(c, models.PermissionCredentialsCreate, ResourceInfraAPI)
 	if err != nil {
 		return "", err
 	}
@@ -44,7 +44,7 @@ func CreateCredential(c *gin.Context, user models.Identity) (string, error) {
 }
 
 func UpdateCredential(c *gin.Context, user *models.Identity, newPassword string) error {
-	db, err := hasAuthorization(c, user.ID, isIdentitySelf, models.InfraAdminRole)
+	db, err := hasAuthorization(c, user.ID, isIdentitySelf, models.PermissionCredentialsUpdate)
 	if err != nil {
 		return err
 	}
@@ -1,51 +1,277 @@
 package access
 
 import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/goware/urlx"
+	"gorm.io/gorm"
 
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/resource"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/pki"
 	"github.com/infrahq/infra/uid"
 )
 
 func CreateDestination(c *gin.Context, destination *models.Destination) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole, models.InfraConnectorRole)
+	db, err := RequirePermission(c, models.PermissionDestinationsCreate, destination.Name)
 	if err != nil {
 		return err
 	}
 
+	if err := authorizeTrustedDestination(c, db, destination); err != nil {
+		return err
+	}
+
+	if err := resource.ValidateLabels(destination.Labels); err != nil {
+		return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
 	return data.CreateDestination(db, destination)
 }
 
 func SaveDestination(c *gin.Context, destination *models.Destination) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole, models.InfraConnectorRole)
+	a, err := newAuthorizer(c)
 	if err != nil {
 		return err
 	}
 
+	existing, err := data.GetDestination(a.db, data.ByID(destination.ID))
+	if err != nil {
+		return err
+	}
+
+	// renaming a destination needs the permission on both names
+	for _, name := range []string{existing.Name, destination.Name} {
+		if err := a.require(models.PermissionDestinationsUpdate, name); err != nil {
+			return err
+		}
+	}
+
+	db := a.db
+
+	if err := authorizeTrustedDestination(c, db, existing, destination); err != nil {
+		return err
+	}
+
+	keepHeartbeat(destination, existing)
+
+	// labels are replaced when they are given, an empty set of labels removes them all
+	if destination.Labels == nil {
+		destination.Labels = existing.Labels
+	}
+
+	if err := resource.ValidateLabels(destination.Labels); err != nil {
+		return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
 	return data.SaveDestination(db, destination)
 }
 
-func GetDestination(c *gin.Context, id uid.ID) (*models.Destination, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole, models.InfraUserRole)
+// RecordDestinationHeartbeat stores the status reported by a destination's connector. The time the
+// heartbeat was received is recorded as when the destination was last seen. Labels reported by the connector
+// are set on the destination, other labels are kept.
+func RecordDestinationHeartbeat(c *gin.Context, id uid.ID, heartbeat *models.Destination) (*models.Destination, error) {
+	db, destination, err := authorizeDestination(c, id, models.PermissionDestinationsUpdate)
 	if err != nil {
 		return nil, err
 	}
 
-	return data.GetDestination(db, data.ByID(id))
+	if err := authorizeTrustedDestination(c, db, destination); err != nil {
+		return nil, err
+	}
+
+	if err := resource.ValidateLabels(heartbeat.Labels); err != nil {
+		return nil, fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	for key, value := range heartbeat.Labels {
+		if destination.Labels == nil {
+			destination.Labels = models.Labels{}
+		}
+
+		destination.Labels[key] = value
+	}
+
+	destination.LastSeenAt = time.Now().UTC()
+	destination.Version = heartbeat.Version
+	destination.SyncError = heartbeat.SyncError
+	destination.RoleBindings = heartbeat.RoleBindings
+	destination.SkippedGrants = heartbeat.SkippedGrants
+
+	if !heartbeat.LastSyncAt.IsZero() {
+		destination.LastSyncAt = heartbeat.LastSyncAt
+	}
+
+	if err := data.SaveDestination(db, destination); err != nil {
+		return nil, err
+	}
+
+	return destination, nil
 }
 
-func ListDestinations(c *gin.Context, uniqueID, name string) ([]models.Destination, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole, models.InfraUserRole)
+// AuthorizeDestinationTunnel checks that the caller can open a tunnel for a destination, which requests for the
+// destination are sent through. Connectors registered through a cluster trust can only open one for their own cluster.
+func AuthorizeDestinationTunnel(c *gin.Context, id uid.ID) (*models.Destination, error) {
+	db, destination, err := authorizeDestination(c, id, models.PermissionDestinationsUpdate)
 	if err != nil {
 		return nil, err
 	}
 
-	return data.ListDestinations(db, data.ByOptionalUniqueID(uniqueID), data.ByOptionalName(name))
+	if err := authorizeTrustedDestination(c, db, destination); err != nil {
+		return nil, err
+	}
+
+	if !destination.ConnectionTunnel {
+		return nil, fmt.Errorf("%w: destination %q is not reached through a tunnel", internal.ErrBadRequest, destination.Name)
+	}
+
+	return destination, nil
+}
+
+// SignDestinationCertificate signs the serving certificate a connector requested, for the destination and the host
+// it is reached at
+func SignDestinationCertificate(c *gin.Context, id uid.ID, csr *x509.CertificateRequest, cp pki.CertificateProvider) (*x509.Certificate, []byte, error) {
+	db, destination, err := authorizeDestination(c, id, models.PermissionDestinationsUpdate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := authorizeTrustedDestination(c, db, destination); err != nil {
+		return nil, nil, err
+	}
+
+	if destination.ConnectionURL == "" {
+		return nil, nil, fmt.Errorf("%w: destination %q has no URL to issue a certificate for", internal.ErrBadRequest, destination.Name)
+	}
+
+	u, err := urlx.Parse(destination.ConnectionURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("destination url: %w", err)
+	}
+
+	// clients verify the certificate against the host, so a host reached by another destination can not be claimed
+	others, err := data.ListDestinations(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, other := range others {
+		if other.ID == destination.ID || other.ConnectionURL == "" {
+			continue
+		}
+
+		if o, err := urlx.Parse(other.ConnectionURL); err == nil && strings.EqualFold(o.Hostname(), u.Hostname()) {
+			return nil, nil, fmt.Errorf("%w: %q is the host of destination %q", internal.ErrBadRequest, u.Hostname(), other.Name)
+		}
+	}
+
+	cert, pemBytes, err := pki.SignConnectorCert(cp, csr, destination.Name, []string{u.Hostname()})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	return cert, pemBytes, nil
+}
+
+// keepHeartbeat copies the fields only changed by heartbeats, when a destination is updated
+func keepHeartbeat(destination, existing *models.Destination) {
+	destination.Version = existing.Version
+	destination.LastSeenAt = existing.LastSeenAt
+	destination.LastSyncAt = existing.LastSyncAt
+	destination.SyncError = existing.SyncError
+	destination.RoleBindings = existing.RoleBindings
+	destination.SkippedGrants = existing.SkippedGrants
+}
+
+func GetDestination(c *gin.Context, id uid.ID) (*models.Destination, error) {
+	_, destination, err := authorizeDestination(c, id, models.PermissionDestinationsRead)
+	return destination, err
+}
+
+// authorizeDestination gets a destination the caller has a permission on
+func authorizeDestination(c *gin.Context, id uid.ID, permission models.Permission) (*gorm.DB, *models.Destination, error) {
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	destination, err := data.GetDestination(a.db, data.ByID(id))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := a.require(permission, destination.Name); err != nil {
+		return nil, nil, err
+	}
+
+	return a.db, destination, nil
+}
+
+// ListDestinations lists the destinations the caller can read by unique ID, name, and a label selector, e.g.
+// env=prod,region!=us-east-1
+func ListDestinations(c *gin.Context, uniqueID, name, selector string) ([]models.Destination, error) {
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if !a.canAny(models.PermissionDestinationsRead) {
+		return nil, a.require(models.PermissionDestinationsRead, ResourceInfraAPI)
+	}
+
+	sel, err := resource.ParseSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	destinations, err := data.ListDestinations(a.db, data.ByOptionalUniqueID(uniqueID), data.ByOptionalName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	// labels are stored as JSON, so they are matched here rather than in the query
+	matched := make([]models.Destination, 0, len(destinations))
+
+	for _, d := range destinations {
+		if sel.Matches(d.Labels) && a.can(models.PermissionDestinationsRead, d.Name) {
+			matched = append(matched, d)
+		}
+	}
+
+	return matched, nil
+}
+
+// destinationLabels looks up the labels of destinations by name, to match the label selectors of grants.
+// Resources that are not destinations, such as namespaces, have no labels.
+func destinationLabels(db *gorm.DB) resource.Labels {
+	cache := make(map[string]map[string]string)
+
+	return func(name string) map[string]string {
+		if labels, ok := cache[name]; ok {
+			return labels
+		}
+
+		var labels map[string]string
+
+		destination, err := data.GetDestination(db, data.ByName(name))
+		if err == nil {
+			labels = destination.Labels
+		}
+
+		cache[name] = labels
+
+		return labels
+	}
 }
 
 func DeleteDestination(c *gin.Context, id uid.ID) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, _, err := authorizeDestination(c, id, models.PermissionDestinationsDelete)
 	if err != nil {
 		return err
 	}
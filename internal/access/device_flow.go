@@ -0,0 +1,288 @@
+package access
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/generate"
+	"github.com/infrahq/infra/internal/server/authn"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+const (
+	// DeviceFlowPollInterval is the minimum time a device must wait between polls
+	DeviceFlowPollInterval = 5 * time.Second
+	// DeviceFlowLifetime is how long a user has to approve a device
+	DeviceFlowLifetime = 10 * time.Minute
+
+	// user codes avoid vowels and look-alike characters, as recommended by RFC 8628
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+)
+
+// These are the pending states of a device authorization request, as named in RFC 8628
+var (
+	ErrDeviceFlowPending  = errors.New("authorization_pending")
+	ErrDeviceFlowSlowDown = errors.New("slow_down")
+	ErrDeviceFlowDenied   = errors.New("access_denied")
+	ErrDeviceFlowExpired  = errors.New("expired_token")
+)
+
+// CreateDeviceFlowAuthRequest starts a device authorization request for an OIDC provider.
+// It returns the device code, which is only known to the device.
+func CreateDeviceFlowAuthRequest(c *gin.Context, providerID uid.ID, clientID string) (*models.DeviceFlowAuthRequest, string, error) {
+	// does not need authorization check, this starts a login
+	db := getDB(c)
+
+	provider, err := data.GetProvider(db, data.ByID(providerID))
+	if err != nil {
+		return nil, "", fmt.Errorf("device flow provider: %w", err)
+	}
+
+	if provider.Name == models.InternalInfraProviderName {
+		return nil, "", fmt.Errorf("%w: device login requires an OIDC provider", internal.ErrBadRequest)
+	}
+
+	deviceCode, err := generate.CryptoRandom(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	state, err := generate.CryptoRandom(12)
+	if err != nil {
+		return nil, "", err
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, "", err
+	}
+
+	chksm := sha256.Sum256([]byte(deviceCode))
+
+	req := &models.DeviceFlowAuthRequest{
+		ProviderID:         provider.ID,
+		ClientID:           clientID,
+		UserCode:           userCode,
+		DeviceCodeChecksum: chksm[:],
+		State:              state,
+		ExpiresAt:          time.Now().Add(DeviceFlowLifetime).UTC(),
+		SourceIP:           c.ClientIP(),
+		UserAgent:          c.Request.UserAgent(),
+	}
+
+	if err := data.CreateDeviceFlowAuthRequest(db, req); err != nil {
+		return nil, "", fmt.Errorf("create device flow request: %w", err)
+	}
+
+	return req, deviceCode, nil
+}
+
+func generateUserCode() (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			sb.WriteRune('-')
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeCharset))))
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteByte(userCodeCharset[n.Int64()])
+	}
+
+	return sb.String(), nil
+}
+
+// normalizeUserCode accepts user codes as typed by a person, in any case and with or without the dash
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	if len(code) != userCodeLength {
+		return code
+	}
+
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// GetDeviceFlowAuthRequest finds the pending device authorization request for a user code
+func GetDeviceFlowAuthRequest(c *gin.Context, userCode string) (*models.DeviceFlowAuthRequest, error) {
+	// does not need authorization check, the user code is only known to the device and its user
+	db := getDB(c)
+
+	req, err := data.GetDeviceFlowAuthRequest(db, data.ByUserCode(normalizeUserCode(userCode)))
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(req.ExpiresAt) || req.Denied || req.IdentityID != 0 {
+		return nil, fmt.Errorf("%w: device code is no longer valid", internal.ErrNotFound)
+	}
+
+	return req, nil
+}
+
+// GetDeviceFlowAuthRequestByState finds the device authorization request the identity provider is responding to
+func GetDeviceFlowAuthRequestByState(c *gin.Context, state string) (*models.DeviceFlowAuthRequest, error) {
+	// does not need authorization check, the state is only known to the server and the identity provider
+	db := getDB(c)
+
+	req, err := data.GetDeviceFlowAuthRequest(db, data.ByState(state))
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(req.ExpiresAt) || req.Denied || req.IdentityID != 0 {
+		return nil, fmt.Errorf("%w: device code is no longer valid", internal.ErrNotFound)
+	}
+
+	return req, nil
+}
+
+// ConfirmDeviceFlowAuthRequest records that the user checked the details of the request, and is logging in to
+// approve it
+func ConfirmDeviceFlowAuthRequest(c *gin.Context, req *models.DeviceFlowAuthRequest) error {
+	// does not need authorization check, the identity provider authenticates the user before the request is approved
+	db := getDB(c)
+
+	req.Confirmed = true
+
+	return data.SaveDeviceFlowAuthRequest(db, req)
+}
+
+// ApproveDeviceFlowAuthRequest completes the user's login with the identity provider and holds the resulting
+// access key until the device collects it.
+func ApproveDeviceFlowAuthRequest(c *gin.Context, req *models.DeviceFlowAuthRequest, code string, provider *models.Provider, oidc authn.OIDC, keyExpires, sessionExpires time.Time, redirectURL string) (*models.Identity, error) {
+	// does not need authorization check, the identity provider authenticates the user
+	db := getDB(c)
+
+	if !req.Confirmed {
+		return nil, fmt.Errorf("%w: device login was not confirmed", internal.ErrBadRequest)
+	}
+
+	identity, key, err := ExchangeAuthCodeForAccessKey(c, code, provider, oidc, keyExpires, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ClientID != "" {
+		refreshToken, err := CreateRefreshToken(c, key, req.ClientID, sessionExpires)
+		if err != nil {
+			return nil, err
+		}
+
+		req.RefreshToken = models.EncryptedAtRest(refreshToken)
+	}
+
+	req.IdentityID = identity.ID
+	req.AccessKey = models.EncryptedAtRest(key)
+	req.AccessKeyExpires = keyExpires
+
+	if err := data.SaveDeviceFlowAuthRequest(db, req); err != nil {
+		return nil, fmt.Errorf("approve device flow request: %w", err)
+	}
+
+	return identity, nil
+}
+
+// DenyDeviceFlowAuthRequest records that the user, or their identity provider, refused the device
+func DenyDeviceFlowAuthRequest(c *gin.Context, req *models.DeviceFlowAuthRequest) error {
+	// does not need authorization check, denying only ends the login
+	db := getDB(c)
+
+	req.Denied = true
+
+	return data.SaveDeviceFlowAuthRequest(db, req)
+}
+
+// PollDeviceFlowAuthRequest is called by the device until the user approves the request. Once approved it
+// returns the credentials, which can only be collected once. Pending states are reported as ErrDeviceFlow errors.
+func PollDeviceFlowAuthRequest(c *gin.Context, deviceCode string) (*models.DeviceFlowAuthRequest, *models.Identity, error) {
+	// does not need authorization check, the device code is proof of the request
+	db := getDB(c)
+
+	chksm := sha256.Sum256([]byte(deviceCode))
+
+	req, err := data.GetDeviceFlowAuthRequest(db, data.ByDeviceCodeChecksum(chksm[:]))
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return nil, nil, fmt.Errorf("%w: unknown device code", internal.ErrBadRequest)
+		}
+
+		return nil, nil, err
+	}
+
+	switch {
+	case req.Denied:
+		return nil, nil, finishDeviceFlowAuthRequest(db, req, ErrDeviceFlowDenied)
+	case time.Now().After(req.ExpiresAt):
+		return nil, nil, finishDeviceFlowAuthRequest(db, req, ErrDeviceFlowExpired)
+	case time.Since(req.LastPolledAt) < DeviceFlowPollInterval:
+		return nil, nil, ErrDeviceFlowSlowDown
+	}
+
+	if req.IdentityID == 0 {
+		req.LastPolledAt = time.Now().UTC()
+		if err := data.SaveDeviceFlowAuthRequest(db, req); err != nil {
+			return nil, nil, fmt.Errorf("poll device flow request: %w", err)
+		}
+
+		return nil, nil, ErrDeviceFlowPending
+	}
+
+	// the credentials are only claimed if they still are unclaimed, so of concurrent polls only one collects them
+	collected, err := data.CollectDeviceFlowAuthRequest(db, req.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("collect device flow request: %w", err)
+	}
+
+	if !collected {
+		return nil, nil, fmt.Errorf("%w: device credentials were already collected", internal.ErrBadRequest)
+	}
+
+	req.Collected = true
+
+	identity, err := data.GetIdentity(db, data.ByID(req.IdentityID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("device flow identity: %w", err)
+	}
+
+	approved := *req
+
+	if err := finishDeviceFlowAuthRequest(db, req, nil); err != nil {
+		return nil, nil, err
+	}
+
+	return &approved, identity, nil
+}
+
+// finishDeviceFlowAuthRequest clears the held credentials so they can not be collected again
+func finishDeviceFlowAuthRequest(db *gorm.DB, req *models.DeviceFlowAuthRequest, result error) error {
+	req.AccessKey = ""
+	req.RefreshToken = ""
+
+	if err := data.SaveDeviceFlowAuthRequest(db, req); err != nil {
+		return fmt.Errorf("clear device flow request: %w", err)
+	}
+
+	if err := data.DeleteDeviceFlowAuthRequest(db, req.ID); err != nil {
+		return fmt.Errorf("delete device flow request: %w", err)
+	}
+
+	return result
+}
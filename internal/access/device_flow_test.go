@@ -0,0 +1,132 @@
+package access
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestDeviceFlowAuthRequest(t *testing.T) {
+	c, db, internalProvider := setupAccessTestContext(t)
+
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/device", nil)
+	c.Request.Header.Set("User-Agent", "Infra CLI")
+
+	provider := &models.Provider{Name: "mokta", URL: "example.com", ClientID: "aaa"}
+	err := data.CreateProvider(db, provider)
+	assert.NilError(t, err)
+
+	oidc := &mockOIDCImplementation{UserEmailResp: "device@example.com"}
+
+	t.Run("requires an OIDC provider", func(t *testing.T) {
+		_, _, err := CreateDeviceFlowAuthRequest(c, internalProvider.ID, "the-client")
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+	})
+
+	t.Run("approved", func(t *testing.T) {
+		req, deviceCode, err := CreateDeviceFlowAuthRequest(c, provider.ID, "the-client")
+		assert.NilError(t, err)
+		assert.Equal(t, len(req.UserCode), 9)
+
+		// users may type the code without the dash, in any case
+		found, err := GetDeviceFlowAuthRequest(c, " "+req.UserCode[:4]+req.UserCode[5:])
+		assert.NilError(t, err)
+		assert.Equal(t, found.ID, req.ID)
+
+		// the user sees where the request is from before they log in
+		assert.Equal(t, found.SourceIP, "192.0.2.1")
+		assert.Equal(t, found.UserAgent, "Infra CLI")
+
+		found, err = GetDeviceFlowAuthRequestByState(c, req.State)
+		assert.NilError(t, err)
+
+		_, err = ApproveDeviceFlowAuthRequest(c, found, "code", provider, oidc, time.Now().Add(time.Minute), time.Now().Add(time.Hour), "https://example.com/device/callback")
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+		err = ConfirmDeviceFlowAuthRequest(c, found)
+		assert.NilError(t, err)
+
+		identity, err := ApproveDeviceFlowAuthRequest(c, found, "code", provider, oidc, time.Now().Add(time.Minute), time.Now().Add(time.Hour), "https://example.com/device/callback")
+		assert.NilError(t, err)
+		assert.Equal(t, identity.Name, "device@example.com")
+
+		// the user code can not be reused once approved
+		_, err = GetDeviceFlowAuthRequest(c, req.UserCode)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+
+		approved, polled, err := PollDeviceFlowAuthRequest(c, deviceCode)
+		assert.NilError(t, err)
+		assert.Equal(t, polled.ID, identity.ID)
+		assert.Assert(t, approved.RefreshToken != "")
+
+		_, err = data.ValidateAccessKey(db, string(approved.AccessKey))
+		assert.NilError(t, err)
+
+		// credentials can only be collected once
+		_, _, err = PollDeviceFlowAuthRequest(c, deviceCode)
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+	})
+
+	t.Run("collected by another poll", func(t *testing.T) {
+		req, deviceCode, err := CreateDeviceFlowAuthRequest(c, provider.ID, "the-client")
+		assert.NilError(t, err)
+
+		err = ConfirmDeviceFlowAuthRequest(c, req)
+		assert.NilError(t, err)
+
+		_, err = ApproveDeviceFlowAuthRequest(c, req, "code", provider, oidc, time.Now().Add(time.Minute), time.Now().Add(time.Hour), "https://example.com/device/callback")
+		assert.NilError(t, err)
+
+		// a concurrent poll claims the credentials between this poll's read and its claim
+		collected, err := data.CollectDeviceFlowAuthRequest(db, req.ID)
+		assert.NilError(t, err)
+		assert.Assert(t, collected)
+
+		_, _, err = PollDeviceFlowAuthRequest(c, deviceCode)
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		_, deviceCode, err := CreateDeviceFlowAuthRequest(c, provider.ID, "")
+		assert.NilError(t, err)
+
+		_, _, err = PollDeviceFlowAuthRequest(c, deviceCode)
+		assert.ErrorIs(t, err, ErrDeviceFlowPending)
+
+		_, _, err = PollDeviceFlowAuthRequest(c, deviceCode)
+		assert.ErrorIs(t, err, ErrDeviceFlowSlowDown)
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		req, deviceCode, err := CreateDeviceFlowAuthRequest(c, provider.ID, "")
+		assert.NilError(t, err)
+
+		err = DenyDeviceFlowAuthRequest(c, req)
+		assert.NilError(t, err)
+
+		_, _, err = PollDeviceFlowAuthRequest(c, deviceCode)
+		assert.ErrorIs(t, err, ErrDeviceFlowDenied)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		req, deviceCode, err := CreateDeviceFlowAuthRequest(c, provider.ID, "")
+		assert.NilError(t, err)
+
+		req.ExpiresAt = time.Now().Add(-time.Minute)
+		err = data.SaveDeviceFlowAuthRequest(db, req)
+		assert.NilError(t, err)
+
+		_, err = GetDeviceFlowAuthRequest(c, req.UserCode)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+
+		_, _, err = PollDeviceFlowAuthRequest(c, deviceCode)
+		assert.ErrorIs(t, err, ErrDeviceFlowExpired)
+	})
+}
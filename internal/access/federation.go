@@ -0,0 +1,50 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/authn"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// LoginWithFederatedIdentity issues an access key to the machine a trusted issuer's token was mapped to
+func LoginWithFederatedIdentity(c *gin.Context, federated *authn.FederatedIdentity, expires time.Time) (string, *models.Identity, error) {
+	// does not need authorization check, the trusted issuer authenticates the machine
+	db := getDB(c)
+
+	machine, err := data.GetIdentity(db, data.ByName(federated.Machine))
+	if err != nil {
+		if !errors.Is(err, internal.ErrNotFound) {
+			return "", nil, fmt.Errorf("get federated machine: %w", err)
+		}
+
+		machine = &models.Identity{Name: federated.Machine, Kind: models.MachineKind}
+
+		if err := data.CreateIdentity(db, machine); err != nil {
+			return "", nil, fmt.Errorf("create federated machine: %w", err)
+		}
+	}
+
+	if machine.Kind != models.MachineKind {
+		return "", nil, fmt.Errorf("%w: federated tokens can only log in as machines", internal.ErrUnauthorized)
+	}
+
+	key := &models.AccessKey{
+		IssuedFor:  machine.ID,
+		ProviderID: data.InfraProvider(db).ID,
+		ExpiresAt:  expires,
+	}
+
+	body, err := data.CreateAccessKey(db, key)
+	if err != nil {
+		return "", nil, fmt.Errorf("create federated access key: %w", err)
+	}
+
+	return body, machine, nil
+}
@@ -1,33 +1,64 @@
 package access
 
 import (
+	"fmt"
+
 	"github.com/gin-gonic/gin"
 
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/resource"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
 )
 
 func GetGrant(c *gin.Context, id uid.ID) (*models.Grant, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	grant, err := data.GetGrant(a.db, data.ByID(id), data.NotCreatedBy(models.CreatedBySystem))
 	if err != nil {
 		return nil, err
 	}
 
-	return data.GetGrant(db, data.ByID(id), data.NotCreatedBy(models.CreatedBySystem))
+	if err := a.require(models.PermissionGrantsRead, grant.Resource); err != nil {
+		return nil, err
+	}
+
+	return grant, nil
 }
 
+// ListGrants lists the grants on the resources the caller can read the grants of
 func ListGrants(c *gin.Context, subject uid.PolymorphicID, resource string, privilege string) ([]models.Grant, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole)
+	a, err := newAuthorizer(c)
 	if err != nil {
 		return nil, err
 	}
 
-	return data.ListGrants(db, data.ByOptionalSubject(subject), data.ByOptionalResource(resource), data.ByOptionalPrivilege(privilege), data.NotCreatedBy(models.CreatedBySystem))
+	if !a.canAny(models.PermissionGrantsRead) {
+		return nil, a.require(models.PermissionGrantsRead, ResourceInfraAPI)
+	}
+
+	grants, err := data.ListGrants(a.db, data.ByOptionalSubject(subject), data.ByOptionalResource(resource), data.ByOptionalPrivilege(privilege), data.NotCreatedBy(models.CreatedBySystem))
+	if err != nil {
+		return nil, err
+	}
+
+	readable := make([]models.Grant, 0, len(grants))
+
+	for _, g := range grants {
+		if a.can(models.PermissionGrantsRead, g.Resource) {
+			readable = append(readable, g)
+		}
+	}
+
+	return readable, nil
 }
 
 func ListIdentityGrants(c *gin.Context, identityID uid.ID) ([]models.Grant, error) {
-	db, err := hasAuthorization(c, identityID, isIdentitySelf, models.InfraAdminRole, models.InfraViewRole)
+	db, err := hasAuthorization(c, identityID, isIdentitySelf, models.PermissionGrantsRead)
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +67,7 @@ func ListIdentityGrants(c *gin.Context, identityID uid.ID) ([]models.Grant, erro
 }
 
 func ListGroupGrants(c *gin.Context, groupID uid.ID) ([]models.Grant, error) {
-	db, err := hasAuthorization(c, groupID, isUserInGroup, models.InfraAdminRole, models.InfraViewRole)
+	db, err := hasAuthorization(c, groupID, isUserInGroup, models.PermissionGrantsRead)
 	if err != nil {
 		return nil, err
 	}
@@ -44,24 +75,61 @@ func ListGroupGrants(c *gin.Context, groupID uid.ID) ([]models.Grant, error) {
 	return data.ListGroupGrants(db, groupID)
 }
 
-func CreateGrant(c *gin.Context, grant *models.Grant) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+// CreateGrant creates a grant on a resource the caller can create grants on. Owners of the resource can only grant
+// ownerPrivileges, nil allows the default privileges.
+func CreateGrant(c *gin.Context, grant *models.Grant, ownerPrivileges []string) error {
+	a, err := newAuthorizer(c)
 	if err != nil {
 		return err
 	}
 
+	if err := a.requireGrant(models.PermissionGrantsCreate, grant, ownerPrivileges); err != nil {
+		return err
+	}
+
+	if err := resource.Validate(grant.Resource); err != nil {
+		return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	if err := models.ValidatePermission(grant.Privilege); err != nil {
+		return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	if grant.Privilege == models.DenyAllPrivileges && !grant.Deny {
+		return fmt.Errorf("%w: only deny grants can be of every privilege", internal.ErrBadRequest)
+	}
+
+	if err := grant.Conditions.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	if grant.Deny && !grant.Conditions.IsEmpty() {
+		return fmt.Errorf("%w: deny grants can not have conditions", internal.ErrBadRequest)
+	}
+
 	creator := CurrentIdentity(c)
 
 	grant.CreatedBy = creator.ID
 
-	return data.CreateGrant(db, grant)
+	return data.CreateGrant(a.db, grant)
 }
 
-func DeleteGrant(c *gin.Context, id uid.ID) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+// DeleteGrant deletes a grant on a resource the caller can delete grants on. Owners of the resource can only delete
+// the grants of ownerPrivileges, nil allows the default privileges.
+func DeleteGrant(c *gin.Context, id uid.ID, ownerPrivileges []string) error {
+	a, err := newAuthorizer(c)
 	if err != nil {
 		return err
 	}
 
-	return data.DeleteGrants(db, data.ByID(id), data.NotCreatedBy(models.CreatedBySystem))
+	grant, err := data.GetGrant(a.db, data.ByID(id), data.NotCreatedBy(models.CreatedBySystem))
+	if err != nil {
+		return err
+	}
+
+	if err := a.requireGrant(models.PermissionGrantsDelete, grant, ownerPrivileges); err != nil {
+		return err
+	}
+
+	return data.DeleteGrants(a.db, data.ByID(id), data.NotCreatedBy(models.CreatedBySystem))
 }
@@ -1,8 +1,12 @@
 package access
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/gin-gonic/gin"
 
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
@@ -31,7 +35,7 @@ func isUserInGroup(c *gin.Context, requestedResourceID uid.ID) (bool, error) {
 }
 
 func ListGroups(c *gin.Context, name string) ([]models.Group, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole)
+	db, err := RequirePermission(c, models.PermissionGroupsRead, ResourceInfraAPI)
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +44,7 @@ func ListGroups(c *gin.Context, name string) ([]models.Group, error) {
 }
 
 func CreateGroup(c *gin.Context, group *models.Group) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequirePermission(c, models.PermissionGroupsCreate, ResourceInfraAPI)
 	if err != nil {
 		return err
 	}
@@ -49,7 +53,7 @@ func CreateGroup(c *gin.Context, group *models.Group) error {
 }
 
 func GetGroup(c *gin.Context, id uid.ID) (*models.Group, error) {
-	db, err := hasAuthorization(c, id, isUserInGroup, models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole)
+	db, err := hasAuthorization(c, id, isUserInGroup, models.PermissionGroupsRead)
 	if err != nil {
 		return nil, err
 	}
@@ -58,10 +62,62 @@ func GetGroup(c *gin.Context, id uid.ID) (*models.Group, error) {
 }
 
 func ListIdentityGroups(c *gin.Context, userID uid.ID) ([]models.Group, error) {
-	db, err := hasAuthorization(c, userID, isIdentitySelf, models.InfraAdminRole, models.InfraViewRole)
+	db, err := hasAuthorization(c, userID, isIdentitySelf, models.PermissionGroupsRead)
 	if err != nil {
 		return nil, err
 	}
 
 	return data.ListIdentityGroups(db, userID)
 }
+
+// ListGroupGroups lists the groups a group belongs to, directly or through other groups
+func ListGroupGroups(c *gin.Context, id uid.ID) ([]models.Group, error) {
+	db, err := hasAuthorization(c, id, isUserInGroup, models.PermissionGroupsRead)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.ListGroupAncestors(db, id)
+}
+
+// ListGroupMembers lists the groups that are direct members of a group
+func ListGroupMembers(c *gin.Context, id uid.ID) ([]models.Group, error) {
+	db, err := hasAuthorization(c, id, isUserInGroup, models.PermissionGroupsRead)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.ListGroupMembers(db, id)
+}
+
+// AddGroupMember makes a group a member of another group, so its members inherit the group's grants
+func AddGroupMember(c *gin.Context, groupID, memberID uid.ID) error {
+	db, err := RequirePermission(c, models.PermissionGroupsUpdate, ResourceInfraAPI)
+	if err != nil {
+		return err
+	}
+
+	if _, err := data.GetGroup(db, data.ByID(groupID)); err != nil {
+		return err
+	}
+
+	if _, err := data.GetGroup(db, data.ByID(memberID)); err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return fmt.Errorf("%w: member group %s does not exist", internal.ErrBadRequest, memberID)
+		}
+
+		return err
+	}
+
+	return data.AddGroupMember(db, groupID, memberID)
+}
+
+// RemoveGroupMember removes a group from the members of another group
+func RemoveGroupMember(c *gin.Context, groupID, memberID uid.ID) error {
+	db, err := RequirePermission(c, models.PermissionGroupsUpdate, ResourceInfraAPI)
+	if err != nil {
+		return err
+	}
+
+	return data.RemoveGroupMember(db, groupID, memberID)
+}
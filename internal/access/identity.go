@@ -29,7 +29,7 @@ func CurrentIdentity(c *gin.Context) *models.Identity {
 }
 
 func GetIdentity(c *gin.Context, id uid.ID) (*models.Identity, error) {
-	db, err := hasAuthorization(c, id, isIdentitySelf, models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole)
+	db, err := hasAuthorization(c, id, isIdentitySelf, models.PermissionIdentitiesRead)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +38,7 @@ func GetIdentity(c *gin.Context, id uid.ID) (*models.Identity, error) {
 }
 
 func CreateIdentity(c *gin.Context, identity *models.Identity) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequirePermission(c, models.PermissionIdentitiesCreate, ResourceInfraAPI)
 	if err != nil {
 		return err
 	}
@@ -56,7 +56,7 @@ func DeleteIdentity(c *gin.Context, id uid.ID) error {
 		return fmt.Errorf("cannot delete self: %w", internal.ErrForbidden)
 	}
 
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequirePermission(c, models.PermissionIdentitiesDelete, ResourceInfraAPI)
 	if err != nil {
 		return err
 	}
@@ -65,6 +65,10 @@ func DeleteIdentity(c *gin.Context, id uid.ID) error {
 		return fmt.Errorf("delete identity access keys: %w", err)
 	}
 
+	if err := data.DeleteRefreshTokens(db, data.ByIssuedFor(id)); err != nil {
+		return fmt.Errorf("delete identity refresh tokens: %w", err)
+	}
+
 	// if an identity does not have credentials in the Infra provider this won't be found, but we can proceed
 	credential, err := data.GetCredential(db, data.ByIdentityID(id))
 	if err != nil && !errors.Is(err, internal.ErrNotFound) {
@@ -86,13 +90,13 @@ func DeleteIdentity(c *gin.Context, id uid.ID) error {
 	return data.DeleteIdentity(db, id)
 }
 
-func ListIdentities(c *gin.Context, name string) ([]models.Identity, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole)
+func ListIdentities(c *gin.Context, name string, groupID uid.ID) ([]models.Identity, error) {
+	db, err := RequirePermission(c, models.PermissionIdentitiesRead, ResourceInfraAPI)
 	if err != nil {
 		return nil, err
 	}
 
-	return data.ListIdentities(db, data.ByOptionalName(name))
+	return data.ListIdentities(db, data.ByOptionalName(name), data.ByOptionalGroupMember(groupID))
 }
 
 // UpdateUserInfoFromProvider calls the user info endpoint of an external identity provider to see a user's current attributes
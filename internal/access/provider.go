@@ -16,7 +16,7 @@ import (
 )
 
 func CreateProvider(c *gin.Context, provider *models.Provider) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequirePermission(c, models.PermissionProvidersCreate, ResourceInfraAPI)
 	if err != nil {
 		return err
 	}
@@ -45,7 +45,7 @@ func ListProviders(c *gin.Context, name string, excludeByName []string) ([]model
 }
 
 func SaveProvider(c *gin.Context, provider *models.Provider) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequirePermission(c, models.PermissionProvidersUpdate, ResourceInfraAPI)
 	if err != nil {
 		return err
 	}
@@ -54,7 +54,7 @@ func SaveProvider(c *gin.Context, provider *models.Provider) error {
 }
 
 func DeleteProvider(c *gin.Context, id uid.ID) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequirePermission(c, models.PermissionProvidersDelete, ResourceInfraAPI)
 	if err != nil {
 		return err
 	}
@@ -74,6 +74,9 @@ func RetrieveUserProviderTokens(c *gin.Context) (*models.ProviderUser, error) {
 	db := getDB(c)
 
 	accessKey := currentAccessKey(c)
+	if accessKey == nil {
+		return nil, fmt.Errorf("%w: request was not authenticated with an access key", internal.ErrBadRequest)
+	}
 
 	return data.GetProviderUser(db, accessKey.ProviderID, identity.ID)
 }
@@ -89,7 +92,7 @@ func ExchangeAuthCodeForAccessKey(c *gin.Context, code string, provider *models.
 	db := getDB(c)
 
 	// exchange code for tokens from identity provider (these tokens are for the IDP, not Infra)
-	accessToken, refreshToken, expiry, email, err := oidc.ExchangeAuthCodeForProviderTokens(code)
+	accessToken, refreshToken, expiry, email, amr, err := oidc.ExchangeAuthCodeForProviderTokens(code)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			return nil, "", fmt.Errorf("%w: %s", internal.ErrBadGateway, err.Error())
@@ -151,6 +154,7 @@ func ExchangeAuthCodeForAccessKey(c *gin.Context, code string, provider *models.
 		IssuedFor:  user.ID,
 		ProviderID: provider.ID,
 		ExpiresAt:  expires,
+		MFALevel:   models.MFALevel(amr),
 	}
 
 	body, err := data.CreateAccessKey(db, key)
@@ -0,0 +1,73 @@
+package access
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/secrets"
+	"github.com/infrahq/infra/uid"
+)
+
+// CreateSessionRecording stores a session recorded by the connector of a destination. The recording is kept in
+// storage, and only its metadata in the database.
+func CreateSessionRecording(c *gin.Context, recording *models.SessionRecording, storage secrets.SecretStorage, cast []byte) error {
+	db, err := RequirePermission(c, models.PermissionRecordingsCreate, ResourceInfraAPI)
+	if err != nil {
+		return err
+	}
+
+	destination, err := data.GetDestination(db, data.ByName(recording.Destination))
+	if err != nil {
+		return err
+	}
+
+	if err := authorizeTrustedDestination(c, db, destination); err != nil {
+		return err
+	}
+
+	recording.ID = uid.New()
+	recording.Size = len(cast)
+	recording.StorageKey = fmt.Sprintf("recordings/%s.cast", recording.ID)
+
+	if err := storage.SetSecret(recording.StorageKey, cast); err != nil {
+		return fmt.Errorf("store session recording: %w", err)
+	}
+
+	return data.CreateSessionRecording(db, recording)
+}
+
+func ListSessionRecordings(c *gin.Context, destination, identity string) ([]models.SessionRecording, error) {
+	db, err := RequirePermission(c, models.PermissionRecordingsRead, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.ListSessionRecordings(db, data.ByExample(models.SessionRecording{Destination: destination, Identity: identity}))
+}
+
+func GetSessionRecording(c *gin.Context, id uid.ID) (*models.SessionRecording, error) {
+	db, err := RequirePermission(c, models.PermissionRecordingsRead, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.GetSessionRecording(db, data.ByID(id))
+}
+
+// GetSessionRecordingCast reads a recording from storage
+func GetSessionRecordingCast(c *gin.Context, id uid.ID, storage secrets.SecretStorage) (*models.SessionRecording, []byte, error) {
+	recording, err := GetSessionRecording(c, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cast, err := storage.GetSecret(recording.StorageKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read session recording: %w", err)
+	}
+
+	return recording, cast, nil
+}
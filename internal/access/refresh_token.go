@@ -0,0 +1,150 @@
+package access
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// CreateRefreshToken turns the session of a freshly issued access key into a refreshable
+// session bound to clientID. The session cannot be refreshed past sessionExpiry.
+func CreateRefreshToken(c *gin.Context, accessKey string, clientID string, sessionExpiry time.Time) (string, error) {
+	// does not need authorization check, the caller has just been issued this access key
+	db := getDB(c)
+
+	key, err := data.ValidateAccessKey(db, accessKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid access key for refresh token: %v", internal.ErrUnauthorized, err)
+	}
+
+	if key.BreakGlassID != 0 {
+		return "", fmt.Errorf("%w: break-glass sessions can not be refreshed", internal.ErrBadRequest)
+	}
+
+	if key.FamilyID == 0 {
+		key.FamilyID = uid.New()
+		if err := data.SaveAccessKey(db, key); err != nil {
+			return "", fmt.Errorf("save refreshable access key: %w", err)
+		}
+	}
+
+	token := &models.RefreshToken{
+		FamilyID:   key.FamilyID,
+		IssuedFor:  key.IssuedFor,
+		ProviderID: key.ProviderID,
+		ClientID:   clientID,
+		ExpiresAt:  sessionExpiry,
+		MFALevel:   key.MFALevel,
+	}
+
+	body, err := data.CreateRefreshToken(db, token)
+	if err != nil {
+		return "", fmt.Errorf("create refresh token: %w", err)
+	}
+
+	return body, nil
+}
+
+// RefreshAccessKey exchanges a refresh token for a new access key and the next refresh token in the session.
+// Refresh tokens are single use; presenting one that was already used revokes every key in the session.
+func RefreshAccessKey(c *gin.Context, refreshToken string, clientID string, expiry time.Time) (accessKey string, nextRefreshToken string, identity *models.Identity, err error) {
+	// does not need authorization check, the refresh token is the proof of authentication
+	db := getDB(c)
+
+	token, err := data.ValidateRefreshToken(db, refreshToken)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("%w: invalid refresh token: %v", internal.ErrUnauthorized, err)
+	}
+
+	if token.ClientID != clientID {
+		return "", "", nil, fmt.Errorf("%w: refresh token was issued to a different client", internal.ErrUnauthorized)
+	}
+
+	if !token.UsedAt.IsZero() {
+		return "", "", nil, refreshTokenReused(db, token)
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return "", "", nil, fmt.Errorf("%w: session expired", internal.ErrUnauthorized)
+	}
+
+	// the token is only marked used if it still is unused, so of concurrent refreshes with it only one succeeds
+	used, err := data.UseRefreshToken(db, token.ID, time.Now().UTC())
+	if err != nil {
+		return "", "", nil, fmt.Errorf("use refresh token: %w", err)
+	}
+
+	if !used {
+		return "", "", nil, refreshTokenReused(db, token)
+	}
+
+	identity, err = data.GetIdentity(db, data.ByID(token.IssuedFor))
+	if err != nil {
+		return "", "", nil, fmt.Errorf("get refresh token identity: %w", err)
+	}
+
+	if expiry.After(token.ExpiresAt) {
+		expiry = token.ExpiresAt
+	}
+
+	key := &models.AccessKey{
+		IssuedFor:  token.IssuedFor,
+		ProviderID: token.ProviderID,
+		ExpiresAt:  expiry,
+		FamilyID:   token.FamilyID,
+		MFALevel:   token.MFALevel,
+	}
+
+	accessKey, err = data.CreateAccessKey(db, key)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("create refreshed access key: %w", err)
+	}
+
+	next := &models.RefreshToken{
+		FamilyID:   token.FamilyID,
+		IssuedFor:  token.IssuedFor,
+		ProviderID: token.ProviderID,
+		ClientID:   token.ClientID,
+		ExpiresAt:  token.ExpiresAt,
+		MFALevel:   token.MFALevel,
+	}
+
+	nextRefreshToken, err = data.CreateRefreshToken(db, next)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("create refresh token: %w", err)
+	}
+
+	return accessKey, nextRefreshToken, identity, nil
+}
+
+// refreshTokenReused revokes the session of a refresh token that was presented again after it was used
+func refreshTokenReused(db *gorm.DB, token *models.RefreshToken) error {
+	logging.S.Warnf("refresh token %s was reused, revoking session %s", token.KeyID, token.FamilyID)
+
+	if err := revokeSession(db, token.FamilyID); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: refresh token was already used, the session has been revoked", internal.ErrUnauthorized)
+}
+
+// revokeSession removes every access key and refresh token issued to a refreshable session
+func revokeSession(db *gorm.DB, familyID uid.ID) error {
+	if err := data.DeleteAccessKeys(db, data.ByFamilyID(familyID)); err != nil {
+		return fmt.Errorf("revoke session access keys: %w", err)
+	}
+
+	if err := data.DeleteRefreshTokens(db, data.ByFamilyID(familyID)); err != nil {
+		return fmt.Errorf("revoke session refresh tokens: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package access
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestRefreshAccessKey(t *testing.T) {
+	c, db, provider := setupAccessTestContext(t)
+
+	user := &models.Identity{Name: "refresh@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, user)
+	assert.NilError(t, err)
+
+	startSession := func(t *testing.T) (string, string) {
+		key, err := data.CreateAccessKey(db, &models.AccessKey{IssuedFor: user.ID, ProviderID: provider.ID, ExpiresAt: time.Now().Add(time.Minute)})
+		assert.NilError(t, err)
+
+		refreshToken, err := CreateRefreshToken(c, key, "client-one", time.Now().Add(time.Hour))
+		assert.NilError(t, err)
+
+		return key, refreshToken
+	}
+
+	t.Run("rotates the refresh token", func(t *testing.T) {
+		_, refreshToken := startSession(t)
+
+		key, next, identity, err := RefreshAccessKey(c, refreshToken, "client-one", time.Now().Add(time.Minute))
+		assert.NilError(t, err)
+		assert.Equal(t, identity.ID, user.ID)
+		assert.Assert(t, next != refreshToken)
+
+		_, err = data.ValidateAccessKey(db, key)
+		assert.NilError(t, err)
+
+		_, _, _, err = RefreshAccessKey(c, next, "client-one", time.Now().Add(time.Minute))
+		assert.NilError(t, err)
+	})
+
+	t.Run("access key lifetime is limited to the session", func(t *testing.T) {
+		_, refreshToken := startSession(t)
+
+		key, _, _, err := RefreshAccessKey(c, refreshToken, "client-one", time.Now().Add(24*time.Hour))
+		assert.NilError(t, err)
+
+		validated, err := data.ValidateAccessKey(db, key)
+		assert.NilError(t, err)
+		assert.Assert(t, validated.ExpiresAt.Before(time.Now().Add(time.Hour+time.Second)))
+	})
+
+	t.Run("bound to the client", func(t *testing.T) {
+		_, refreshToken := startSession(t)
+
+		_, _, _, err := RefreshAccessKey(c, refreshToken, "client-two", time.Now().Add(time.Minute))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	})
+
+	t.Run("reuse revokes the session", func(t *testing.T) {
+		first, refreshToken := startSession(t)
+
+		second, next, _, err := RefreshAccessKey(c, refreshToken, "client-one", time.Now().Add(time.Minute))
+		assert.NilError(t, err)
+
+		_, _, _, err = RefreshAccessKey(c, refreshToken, "client-one", time.Now().Add(time.Minute))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+
+		for _, key := range []string{first, second} {
+			_, err = data.ValidateAccessKey(db, key)
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+		}
+
+		_, _, _, err = RefreshAccessKey(c, next, "client-one", time.Now().Add(time.Minute))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	})
+
+	t.Run("concurrent refreshes", func(t *testing.T) {
+		first, refreshToken := startSession(t)
+
+		token, err := data.ValidateRefreshToken(db, refreshToken)
+		assert.NilError(t, err)
+
+		// another request uses the token after this one checked it was unused
+		var other bool
+		err = db.Callback().Update().Before("gorm:update").Register("test:use_refresh_token", func(tx *gorm.DB) {
+			if other {
+				return
+			}
+
+			other = true
+
+			err := tx.Session(&gorm.Session{NewDB: true}).Exec("update refresh_tokens set used_at = ? where id = ?", time.Now().UTC(), token.ID).Error
+			assert.NilError(t, err)
+		})
+		assert.NilError(t, err)
+
+		t.Cleanup(func() {
+			_ = db.Callback().Update().Remove("test:use_refresh_token")
+		})
+
+		_, _, _, err = RefreshAccessKey(c, refreshToken, "client-one", time.Now().Add(time.Minute))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+
+		_, err = data.ValidateAccessKey(db, first)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+	})
+
+	t.Run("expired session", func(t *testing.T) {
+		key, err := data.CreateAccessKey(db, &models.AccessKey{IssuedFor: user.ID, ProviderID: provider.ID, ExpiresAt: time.Now().Add(time.Minute)})
+		assert.NilError(t, err)
+
+		refreshToken, err := CreateRefreshToken(c, key, "client-one", time.Now().Add(-time.Minute))
+		assert.NilError(t, err)
+
+		_, _, _, err = RefreshAccessKey(c, refreshToken, "client-one", time.Now().Add(time.Minute))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	})
+}
+
+func TestDeleteRequestAccessKeyRevokesSession(t *testing.T) {
+	c, db, provider := setupAccessTestContext(t)
+
+	user := &models.Identity{Name: "logout@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, user)
+	assert.NilError(t, err)
+
+	body, err := data.CreateAccessKey(db, &models.AccessKey{IssuedFor: user.ID, ProviderID: provider.ID, ExpiresAt: time.Now().Add(time.Minute)})
+	assert.NilError(t, err)
+
+	refreshToken, err := CreateRefreshToken(c, body, "client-one", time.Now().Add(time.Hour))
+	assert.NilError(t, err)
+
+	key, err := data.ValidateAccessKey(db, body)
+	assert.NilError(t, err)
+	c.Set("key", key)
+
+	err = DeleteRequestAccessKey(c)
+	assert.NilError(t, err)
+
+	_, _, _, err = RefreshAccessKey(c, refreshToken, "client-one", time.Now().Add(time.Minute))
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+}
@@ -0,0 +1,273 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/resource"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// CreateReview creates a review of the grants that match its filter, and snapshots them as its items
+func CreateReview(c *gin.Context, review *models.Review, reviewers []uid.ID) error {
+	db, err := RequirePermission(c, models.PermissionReviewsCreate, ResourceInfraAPI)
+	if err != nil {
+		return err
+	}
+
+	if review.Resource != "" {
+		if err := resource.Validate(review.Resource); err != nil {
+			return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+		}
+	}
+
+	switch review.SubjectKind {
+	case "", models.ReviewSubjectIdentity, models.ReviewSubjectGroup:
+	default:
+		return fmt.Errorf("%w: unknown subject kind %q", internal.ErrBadRequest, review.SubjectKind)
+	}
+
+	if len(reviewers) == 0 {
+		return fmt.Errorf("%w: a review needs reviewers", internal.ErrBadRequest)
+	}
+
+	review.Reviewers, err = data.ListIdentities(db, data.ByIDs(reviewers))
+	if err != nil {
+		return err
+	}
+
+	if len(review.Reviewers) != len(reviewers) {
+		return fmt.Errorf("%w: reviewers must be identities", internal.ErrBadRequest)
+	}
+
+	grants, err := data.ListGrants(db, data.ByOptionalPrivilege(review.Privilege), data.NotCreatedBy(models.CreatedBySystem))
+	if err != nil {
+		return err
+	}
+
+	review.Status = models.ReviewOpen
+	review.CreatedBy = CurrentIdentity(c).ID
+
+	if err := data.CreateReview(db, review); err != nil {
+		return err
+	}
+
+	for _, g := range grants {
+		if !review.Includes(g) {
+			continue
+		}
+
+		name, err := subjectName(db, g.Subject)
+		if err != nil {
+			return err
+		}
+
+		item := &models.ReviewItem{
+			ReviewID:    review.ID,
+			GrantID:     g.ID,
+			Subject:     g.Subject,
+			SubjectName: name,
+			Privilege:   g.Privilege,
+			Resource:    g.Resource,
+			Decision:    models.ReviewPending,
+		}
+
+		if err := data.CreateReviewItem(db, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListReviews lists every review for callers that can read reviews, and otherwise the reviews the caller reviews
+func ListReviews(c *gin.Context, name, status string) ([]models.Review, error) {
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews, err := data.ListReviews(a.db, data.ByOptionalName(name), data.ByOptionalStatus(status))
+	if err != nil {
+		return nil, err
+	}
+
+	if a.can(models.PermissionReviewsRead, ResourceInfraAPI) {
+		return reviews, nil
+	}
+
+	identity := CurrentIdentity(c)
+	reviewing := make([]models.Review, 0, len(reviews))
+
+	for _, r := range reviews {
+		if r.IsReviewer(identity.ID) {
+			reviewing = append(reviewing, r)
+		}
+	}
+
+	return reviewing, nil
+}
+
+// GetReview gets a review the caller can read reviews or is a reviewer of
+func GetReview(c *gin.Context, id uid.ID) (*models.Review, error) {
+	a, err := newAuthorizer(c)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := data.GetReview(a.db, data.ByID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if review.IsReviewer(CurrentIdentity(c).ID) {
+		return review, nil
+	}
+
+	if err := a.require(models.PermissionReviewsRead, ResourceInfraAPI); err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+// ListReviewItems lists the grants in a review, and the decisions on them
+func ListReviewItems(c *gin.Context, reviewID uid.ID) ([]models.ReviewItem, error) {
+	review, err := GetReview(c, reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.ListReviewItems(getDB(c), data.ByReviewID(review.ID))
+}
+
+// DecideReviewItem records a reviewer's decision to keep or revoke a grant. Decisions can be changed until the
+// review closes. Reviewers can not decide on their own grants.
+func DecideReviewItem(c *gin.Context, reviewID, itemID uid.ID, decision, comment string) (*models.ReviewItem, error) {
+	if decision != models.ReviewKeep && decision != models.ReviewRevoke {
+		return nil, fmt.Errorf("%w: grants can only be kept or revoked", internal.ErrBadRequest)
+	}
+
+	review, err := GetReview(c, reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := CurrentIdentity(c)
+	if !review.IsReviewer(identity.ID) {
+		return nil, fmt.Errorf("%w: requestor is not a reviewer of %s", internal.ErrForbidden, review.Name)
+	}
+
+	db := getDB(c)
+
+	item, err := data.GetReviewItem(db, data.ByID(itemID), data.ByReviewID(review.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Subject == identity.PolyID() {
+		return nil, fmt.Errorf("%w: cannot review own grant", internal.ErrForbidden)
+	}
+
+	if review.Status != models.ReviewOpen {
+		return nil, fmt.Errorf("%w: review %s is %s", internal.ErrBadRequest, review.Name, review.Status)
+	}
+
+	item.Decision = decision
+	item.Comment = comment
+	item.DecidedBy = identity.ID
+	item.DecidedAt = time.Now().UTC()
+
+	if err := data.SaveReviewItem(db, item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// CloseReview closes a review, and revokes the grants its reviewers decided to revoke. Grants without a decision
+// are kept.
+func CloseReview(c *gin.Context, id uid.ID) (*models.Review, error) {
+	db, err := RequirePermission(c, models.PermissionReviewsClose, ResourceInfraAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := data.GetReview(db, data.ByID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if review.Status != models.ReviewOpen {
+		return nil, fmt.Errorf("%w: review %s is already %s", internal.ErrBadRequest, review.Name, review.Status)
+	}
+
+	items, err := data.ListReviewItems(db, data.ByReviewID(review.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	for i := range items {
+		if items[i].Decision != models.ReviewRevoke {
+			continue
+		}
+
+		if err := data.DeleteGrants(db, data.ByID(items[i].GrantID)); err != nil {
+			return nil, fmt.Errorf("revoke grant %s: %w", items[i].GrantID, err)
+		}
+
+		items[i].RevokedAt = now
+
+		if err := data.SaveReviewItem(db, &items[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	review.Status = models.ReviewClosed
+	review.ClosedBy = CurrentIdentity(c).ID
+	review.ClosedAt = now
+
+	if err := data.SaveReview(db, review); err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+// subjectName is the name of the identity or group a grant is for, or empty if it no longer exists
+func subjectName(db *gorm.DB, subject uid.PolymorphicID) (string, error) {
+	id, err := subject.ID()
+	if err != nil {
+		return "", nil
+	}
+
+	var name string
+
+	switch {
+	case subject.IsIdentity():
+		var identity *models.Identity
+		if identity, err = data.GetIdentity(db, data.ByID(id)); err == nil {
+			name = identity.Name
+		}
+	case subject.IsGroup():
+		var group *models.Group
+		if group, err = data.GetGroup(db, data.ByID(id)); err == nil {
+			name = group.Name
+		}
+	}
+
+	if err != nil && !errors.Is(err, internal.ErrNotFound) {
+		return "", err
+	}
+
+	return name, nil
+}
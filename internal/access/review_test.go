@@ -0,0 +1,151 @@
+package access
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestReviews(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+	admin := CurrentIdentity(c)
+
+	manager := &models.Identity{Name: "manager@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(db, manager)
+	assert.NilError(t, err)
+
+	dev := &models.Identity{Name: "dev@example.com", Kind: models.UserKind}
+	err = data.CreateIdentity(db, dev)
+	assert.NilError(t, err)
+
+	grant := func(subject uid.PolymorphicID, privilege, resource string) *models.Grant {
+		g := &models.Grant{Subject: subject, Privilege: privilege, Resource: resource, CreatedBy: admin.ID}
+		err := data.CreateGrant(db, g)
+		assert.NilError(t, err)
+
+		return g
+	}
+
+	devEdit := grant(dev.PolyID(), "edit", "kubernetes.production.web")
+	devView := grant(dev.PolyID(), "view", "kubernetes.production")
+	managerView := grant(manager.PolyID(), "view", "kubernetes.production")
+	grant(dev.PolyID(), "edit", "kubernetes.production-eu")
+	grant(dev.PolyID(), "edit", "kubernetes.staging")
+
+	review := &models.Review{Name: "2022-q3", Resource: "kubernetes.production"}
+	err = CreateReview(c, review, []uid.ID{manager.ID})
+	assert.NilError(t, err)
+	assert.Equal(t, review.Status, models.ReviewOpen)
+
+	items, err := ListReviewItems(c, review.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(items), 3)
+
+	itemOf := func(g *models.Grant) models.ReviewItem {
+		for _, item := range items {
+			if item.GrantID == g.ID {
+				return item
+			}
+		}
+
+		t.Fatalf("grant %s is not in the review", g.ID)
+
+		return models.ReviewItem{}
+	}
+
+	assert.Equal(t, itemOf(devEdit).SubjectName, dev.Name)
+	assert.Equal(t, itemOf(devEdit).Decision, models.ReviewPending)
+
+	t.Run("filters", func(t *testing.T) {
+		filtered := &models.Review{Name: "edits", Privilege: "edit", SubjectKind: models.ReviewSubjectIdentity}
+		err := CreateReview(c, filtered, []uid.ID{manager.ID})
+		assert.NilError(t, err)
+
+		items, err := ListReviewItems(c, filtered.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, len(items), 3)
+
+		err = CreateReview(c, &models.Review{Name: "groups", SubjectKind: "robots"}, []uid.ID{manager.ID})
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+		err = CreateReview(c, &models.Review{Name: "nobody"}, []uid.ID{uid.New()})
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+	})
+
+	c.Set("identity", dev)
+
+	t.Run("only reviewers see and decide", func(t *testing.T) {
+		_, err := GetReview(c, review.ID)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		reviews, err := ListReviews(c, "", "")
+		assert.NilError(t, err)
+		assert.Equal(t, len(reviews), 0)
+
+		_, err = DecideReviewItem(c, review.ID, itemOf(devEdit).ID, models.ReviewKeep, "")
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		err = CreateReview(c, &models.Review{Name: "mine"}, []uid.ID{dev.ID})
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	c.Set("identity", manager)
+
+	t.Run("reviewers decide", func(t *testing.T) {
+		reviews, err := ListReviews(c, "", models.ReviewOpen)
+		assert.NilError(t, err)
+		assert.Equal(t, len(reviews), 2)
+
+		item, err := DecideReviewItem(c, review.ID, itemOf(devEdit).ID, models.ReviewRevoke, "left the team")
+		assert.NilError(t, err)
+		assert.Equal(t, item.DecidedBy, manager.ID)
+
+		_, err = DecideReviewItem(c, review.ID, itemOf(devView).ID, models.ReviewKeep, "")
+		assert.NilError(t, err)
+
+		// reviewers can not keep their own access
+		_, err = DecideReviewItem(c, review.ID, itemOf(managerView).ID, models.ReviewKeep, "")
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+
+		_, err = DecideReviewItem(c, review.ID, itemOf(devView).ID, "maybe", "")
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+		_, err = CloseReview(c, review.ID)
+		assert.ErrorIs(t, err, internal.ErrForbidden)
+	})
+
+	c.Set("identity", admin)
+
+	closed, err := CloseReview(c, review.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, closed.Status, models.ReviewClosed)
+	assert.Equal(t, closed.ClosedBy, admin.ID)
+
+	_, err = data.GetGrant(db, data.ByID(devEdit.ID))
+	assert.ErrorIs(t, err, internal.ErrNotFound)
+
+	_, err = data.GetGrant(db, data.ByID(devView.ID))
+	assert.NilError(t, err)
+
+	// undecided grants are kept
+	_, err = data.GetGrant(db, data.ByID(managerView.ID))
+	assert.NilError(t, err)
+
+	items, err = ListReviewItems(c, review.ID)
+	assert.NilError(t, err)
+	assert.Assert(t, !itemOf(devEdit).RevokedAt.IsZero())
+	assert.Assert(t, itemOf(devView).RevokedAt.IsZero())
+
+	_, err = CloseReview(c, review.ID)
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+	c.Set("identity", manager)
+
+	_, err = DecideReviewItem(c, review.ID, itemOf(devView).ID, models.ReviewRevoke, "")
+	assert.ErrorIs(t, err, internal.ErrBadRequest)
+}
@@ -4,11 +4,16 @@ import (
 	"fmt"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
+	"github.com/infrahq/infra/internal/claims"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
 )
 
+// CreateToken issues a token for the identity in the context. The destination grants with conditions that are met by
+// the request are included in the token, for the destinations to check its source address and time window again.
 func CreateToken(c *gin.Context) (token *models.Token, err error) {
 	identity := CurrentIdentity(c)
 	if identity == nil {
@@ -18,5 +23,41 @@ func CreateToken(c *gin.Context) (token *models.Token, err error) {
 	// does not need authorization check, limited to calling identity
 	db := getDB(c)
 
-	return data.CreateIdentityToken(db, identity.ID)
+	grants, err := conditionalGrants(db, identity.PolyID(), requestConditions(c))
+	if err != nil {
+		return nil, err
+	}
+
+	return data.CreateIdentityToken(db, identity.ID, grants)
+}
+
+// conditionalGrants lists the destination grants with conditions of a subject and its groups that the conditions are
+// met for
+func conditionalGrants(db *gorm.DB, subject uid.PolymorphicID, conditions models.ConditionContext) ([]claims.Grant, error) {
+	a, err := newSubjectAuthorizer(db, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []claims.Grant
+
+	for _, g := range a.grants {
+		if g.Deny || g.Conditions.IsEmpty() || g.Resource == ResourceInfraAPI || models.IsInfraPrivilege(g.Privilege) {
+			continue
+		}
+
+		if g.Conditions.Check(conditions) != nil {
+			continue
+		}
+
+		grant := claims.Grant{ID: g.ID.String(), CIDRs: g.Conditions.CIDRs}
+
+		if len(g.Conditions.Windows) > 0 {
+			grant.Until = g.Conditions.WindowEnd(conditions.Time).Unix()
+		}
+
+		result = append(result, grant)
+	}
+
+	return result, nil
 }
@@ -4,4 +4,20 @@ type Custom struct {
 	Name   string   `json:"name" validate:"required"`
 	Groups []string `json:"groups"`
 	Nonce  string   `json:"nonce" validate:"required"`
+
+	// Grants are the grants with conditions whose conditions were met when the token was issued
+	Grants []Grant `json:"grants,omitempty"`
+}
+
+// Grant is a grant with conditions, which destinations apply while it is in its time window, to requests from its
+// source addresses
+type Grant struct {
+	ID    string   `json:"id"`
+	CIDRs []string `json:"cidrs,omitempty"`
+	Until int64    `json:"until,omitempty"` // unix time its time window ends, zero when it has no time windows
+}
+
+// GrantGroup is the group destinations give the privileges of a grant with conditions to
+func GrantGroup(id string) string {
+	return "infra:grant:" + id
 }
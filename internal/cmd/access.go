@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/infrahq/infra/api"
+)
+
+func newAccessCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "access",
+		Short: "Explain access to destinations and Infra",
+		Group: "Management commands:",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return mustBeLoggedIn()
+		},
+	}
+
+	cmd.AddCommand(newAccessExplainCmd())
+
+	return cmd
+}
+
+type accessExplainOptions struct {
+	IsGroup bool   `mapstructure:"group"`
+	Role    string `mapstructure:"role"`
+}
+
+func newAccessExplainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "explain IDENTITY RESOURCE",
+		Short: "Explain why an identity does or does not have access to a resource",
+		Long: `Explain why an identity does or does not have access to a resource.
+
+Lists the grants that give the identity access, directly or through its groups,
+and where the connector could not apply them.
+
+Without [--role], explains any access the identity has to the resource.`,
+		Example: `
+# Explain a user's access to a namespace
+$ infra access explain alice@example.com kubernetes.production.web
+
+# Explain why a user can or can not create grants
+$ infra access explain alice@example.com infra --role grants:create
+
+# Explain a group's access to a cluster
+$ infra access explain devGroup kubernetes.staging --group --role edit
+`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var options accessExplainOptions
+			if err := parseOptions(cmd, &options, "INFRA_ACCESS"); err != nil {
+				return err
+			}
+
+			return explainAccess(args[0], args[1], options)
+		},
+	}
+
+	cmd.Flags().BoolP("group", "g", false, "Required if identity is of type 'group'")
+	cmd.Flags().String("role", "", "Role or permission to explain")
+
+	return cmd
+}
+
+func explainAccess(name, resource string, options accessExplainOptions) error {
+	client, err := defaultAPIClient()
+	if err != nil {
+		return err
+	}
+
+	identityType, err := getIdentityType(name, options.IsGroup)
+	if err != nil {
+		return err
+	}
+
+	subject, err := getIDByName(client, name, identityType)
+	if err != nil {
+		return err
+	}
+
+	decision, err := client.CheckAuthz(api.AuthzCheckRequest{Subject: subject, Privilege: options.Role, Resource: resource})
+	if err != nil {
+		return err
+	}
+
+	access := "access"
+	if options.Role != "" {
+		access = options.Role
+	}
+
+	if decision.Allowed {
+		fmt.Printf("%s has %s on %s\n", name, access, resource)
+	} else {
+		fmt.Printf("%s does not have %s on %s: %s\n", name, access, resource, decision.Reason)
+	}
+
+	if len(decision.Grants) > 0 {
+		fmt.Println()
+		fmt.Println("Granted by:")
+		printAppliedGrants(decision.Grants)
+	}
+
+	if len(decision.Denials) > 0 {
+		fmt.Println()
+		fmt.Println("Denied by:")
+		printAppliedGrants(decision.Denials)
+	}
+
+	if len(decision.Related) > 0 {
+		fmt.Println()
+		fmt.Println("Other grants of the role, or on the resource:")
+		printAppliedGrants(decision.Related)
+	}
+
+	return nil
+}
+
+func printAppliedGrants(grants []api.AppliedGrant) {
+	type row struct {
+		Access   string `header:"ACCESS"`
+		Resource string `header:"RESOURCE"`
+		Effect   string `header:"EFFECT"`
+		Via      string `header:"VIA"`
+		Note     string `header:"NOTE"`
+	}
+
+	rows := make([]row, len(grants))
+	for i, g := range grants {
+		rows[i] = row{Access: g.Grant.Privilege, Resource: g.Grant.Resource, Effect: grantEffect(g.Grant), Via: "direct"}
+
+		if g.GroupName != "" {
+			rows[i].Via = "group " + g.GroupName
+		}
+
+		var notes []string
+		for _, s := range g.Skipped {
+			notes = append(notes, fmt.Sprintf("not applied to %s: %s", s.Resource, s.Reason))
+		}
+
+		if len(g.DeniedBy) > 0 {
+			notes = append(notes, "denied by a deny grant")
+		}
+
+		if g.Grant.Conditions != nil {
+			notes = append(notes, "only applies "+formatConditions(g.Grant.Conditions))
+		}
+
+		rows[i].Note = strings.Join(notes, "; ")
+	}
+
+	printTable(rows)
+}
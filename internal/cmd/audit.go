@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+func newAuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Review activity in destinations",
+		Group: "Management commands:",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return mustBeLoggedIn()
+		},
+	}
+
+	cmd.AddCommand(newAuditKubernetesCmd())
+	cmd.AddCommand(newAuditRecordingsCmd())
+
+	return cmd
+}
+
+type auditKubernetesOptions struct {
+	Destination string `mapstructure:"destination"`
+	Identity    string `mapstructure:"identity"`
+	Namespace   string `mapstructure:"namespace"`
+	Verb        string `mapstructure:"verb"`
+	Resource    string `mapstructure:"resource"`
+	Since       string `mapstructure:"since"`
+	Limit       int    `mapstructure:"limit"`
+}
+
+func newAuditKubernetesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kubernetes",
+		Short: "List requests made to Kubernetes destinations through Infra",
+		Example: `
+# List the most recent requests to a cluster
+$ infra audit kubernetes --destination kubernetes.production
+
+# List what a user deleted in the last day
+$ infra audit kubernetes --identity alice@example.com --verb delete --since 24h
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var options auditKubernetesOptions
+			if err := parseOptions(cmd, &options, "INFRA_AUDIT"); err != nil {
+				return err
+			}
+
+			req := api.ListKubernetesAuditRecordsRequest{
+				Destination: options.Destination,
+				Identity:    options.Identity,
+				Namespace:   options.Namespace,
+				Verb:        options.Verb,
+				Resource:    options.Resource,
+				Limit:       options.Limit,
+			}
+
+			if options.Since != "" {
+				since, err := time.ParseDuration(options.Since)
+				if err != nil {
+					return fmt.Errorf("parsing since: %w", err)
+				}
+
+				req.Since = time.Now().Add(-since)
+			}
+
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			records, err := client.ListKubernetesAuditRecords(req)
+			if err != nil {
+				return err
+			}
+
+			type row struct {
+				Time        string `header:"TIME"`
+				Identity    string `header:"IDENTITY"`
+				Verb        string `header:"VERB"`
+				Resource    string `header:"RESOURCE"`
+				Namespace   string `header:"NAMESPACE"`
+				Code        int    `header:"CODE"`
+				Latency     string `header:"LATENCY"`
+				Destination string `header:"DESTINATION"`
+			}
+
+			var rows []row
+			for _, r := range records {
+				rows = append(rows, row{
+					Time:        time.Time(r.Time).Local().Format(time.RFC3339),
+					Identity:    r.Identity,
+					Verb:        r.Verb,
+					Resource:    auditResourceName(r),
+					Namespace:   r.Namespace,
+					Code:        r.Code,
+					Latency:     time.Duration(r.Latency).Round(time.Millisecond).String(),
+					Destination: r.Destination,
+				})
+			}
+
+			if len(rows) > 0 {
+				printTable(rows)
+			} else {
+				fmt.Println("No audit records found")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("destination", "", "Filter by destination")
+	cmd.Flags().String("identity", "", "Filter by the identity that made the request")
+	cmd.Flags().String("namespace", "", "Filter by namespace")
+	cmd.Flags().String("verb", "", "Filter by verb, e.g. get, list, create, delete")
+	cmd.Flags().String("resource", "", "Filter by resource type, e.g. pods")
+	cmd.Flags().String("since", "", "Only list requests made within this duration, e.g. 1h")
+	cmd.Flags().Int("limit", 100, "Maximum number of requests to list")
+
+	return cmd
+}
+
+// auditResourceName formats the resource of a request the way kubectl does, e.g. deployments.apps/web
+func auditResourceName(r api.KubernetesAuditRecord) string {
+	if r.Resource == "" {
+		return r.Path
+	}
+
+	name := r.Resource
+	if r.APIGroup != "" {
+		name += "." + r.APIGroup
+	}
+
+	if r.Name != "" {
+		name += "/" + r.Name
+	}
+
+	if r.Subresource != "" {
+		name += "/" + r.Subresource
+	}
+
+	return name
+}
+
+func newAuditRecordingsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recordings",
+		Short: "Review interactive sessions, such as kubectl exec, recorded in destinations",
+	}
+
+	cmd.AddCommand(newAuditRecordingsListCmd())
+	cmd.AddCommand(newAuditRecordingsDownloadCmd())
+
+	return cmd
+}
+
+type auditRecordingsOptions struct {
+	Destination string `mapstructure:"destination"`
+	Identity    string `mapstructure:"identity"`
+}
+
+func newAuditRecordingsListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List recorded sessions",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var options auditRecordingsOptions
+			if err := parseOptions(cmd, &options, "INFRA_AUDIT"); err != nil {
+				return err
+			}
+
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			recordings, err := client.ListSessionRecordings(api.ListSessionRecordingsRequest{Destination: options.Destination, Identity: options.Identity})
+			if err != nil {
+				return err
+			}
+
+			type row struct {
+				ID          string `header:"ID"`
+				Started     string `header:"STARTED"`
+				Duration    string `header:"DURATION"`
+				Identity    string `header:"IDENTITY"`
+				Kind        string `header:"KIND"`
+				Pod         string `header:"POD"`
+				Command     string `header:"COMMAND"`
+				Destination string `header:"DESTINATION"`
+			}
+
+			var rows []row
+			for _, r := range recordings {
+				rows = append(rows, row{
+					ID:          r.ID.String(),
+					Started:     time.Time(r.Started).Local().Format(time.RFC3339),
+					Duration:    time.Time(r.Ended).Sub(time.Time(r.Started)).Round(time.Second).String(),
+					Identity:    r.Identity,
+					Kind:        r.Kind,
+					Pod:         r.Namespace + "/" + r.Pod,
+					Command:     r.Command,
+					Destination: r.Destination,
+				})
+			}
+
+			if len(rows) > 0 {
+				printTable(rows)
+			} else {
+				fmt.Println("No session recordings found")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("destination", "", "Filter by destination")
+	cmd.Flags().String("identity", "", "Filter by the identity that started the session")
+
+	return cmd
+}
+
+func newAuditRecordingsDownloadCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "download ID",
+		Short: "Download a recorded session in asciicast format",
+		Example: `
+# Download a recording and play it back with asciinema
+$ infra audit recordings download 4yJ3n3D8E2 --output session.cast
+$ asciinema play session.cast
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var options struct {
+				Output string `mapstructure:"output"`
+			}
+
+			if err := parseOptions(cmd, &options, "INFRA_AUDIT"); err != nil {
+				return err
+			}
+
+			id, err := uid.ParseString(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid recording ID: %w", err)
+			}
+
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			cast, err := client.GetSessionRecordingCast(id)
+			if err != nil {
+				return err
+			}
+
+			if options.Output == "" {
+				_, err := os.Stdout.Write(cast)
+				return err
+			}
+
+			return os.WriteFile(options.Output, cast, 0o600)
+		},
+	}
+
+	cmd.Flags().StringP("output", "o", "", "File to write the recording to, instead of stdout")
+
+	return cmd
+}
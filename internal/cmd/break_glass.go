@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/infrahq/infra/api"
+)
+
+func newBreakGlassCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "break-glass",
+		Short:   "Manage emergency accounts for when identity providers are down",
+		Aliases: []string{"breakglass"},
+		Group:   "Management commands:",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return mustBeLoggedIn()
+		},
+	}
+
+	cmd.AddCommand(newBreakGlassListCmd())
+	cmd.AddCommand(newBreakGlassCreateCmd())
+	cmd.AddCommand(newBreakGlassLockCmd())
+	cmd.AddCommand(newBreakGlassEventsCmd())
+	cmd.AddCommand(newBreakGlassRemoveCmd())
+
+	return cmd
+}
+
+func newBreakGlassListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List break-glass accounts",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			accounts, err := client.ListBreakGlass(api.ListBreakGlassRequest{})
+			if err != nil {
+				return err
+			}
+
+			type row struct {
+				Name     string `header:"NAME"`
+				Access   string `header:"ACCESS"`
+				Resource string `header:"RESOURCE"`
+				Duration string `header:"DURATION"`
+				Holders  string `header:"HOLDERS"`
+				Status   string `header:"STATUS"`
+			}
+
+			var rows []row
+			for _, b := range accounts {
+				status := "locked"
+				if expires := time.Time(b.Expires); !expires.IsZero() {
+					status = "unlocked until " + expires.Local().Format(time.RFC1123)
+				}
+
+				rows = append(rows, row{
+					Name:     b.Name,
+					Access:   b.Privilege,
+					Resource: b.Resource,
+					Duration: time.Duration(b.Duration).String(),
+					Holders:  strings.Join(b.Holders, ", "),
+					Status:   status,
+				})
+			}
+
+			if len(rows) > 0 {
+				printTable(rows)
+			} else {
+				fmt.Println("No break-glass accounts found")
+			}
+
+			return nil
+		},
+	}
+}
+
+type breakGlassCreateOptions struct {
+	Holders  []string `mapstructure:"holder"`
+	Role     string   `mapstructure:"role"`
+	Resource string   `mapstructure:"resource"`
+	Duration string   `mapstructure:"duration"`
+}
+
+func newBreakGlassCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create a break-glass account",
+		Long: `Create a break-glass account, for when the identity providers are down.
+
+Its secret is split in two halves, one for each holder, and is only shown
+once. Logging in with both halves unlocks the account, granting it the role
+until its time is up. Every unlock is sent to the notifications the server is
+configured with, so the server must have at least one.`,
+		Example: `
+# Create an account that is an Infra admin for an hour once unlocked
+$ infra break-glass create emergency --holder alice@example.com --holder bob@example.com
+
+# Create an account for the production cluster
+$ infra break-glass create production --holder alice@example.com --holder bob@example.com --role cluster-admin --resource kubernetes.production --duration 30m
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var options breakGlassCreateOptions
+			if err := parseOptions(cmd, &options, "INFRA_BREAK_GLASS"); err != nil {
+				return err
+			}
+
+			var duration time.Duration
+			if options.Duration != "" {
+				var err error
+
+				duration, err = time.ParseDuration(options.Duration)
+				if err != nil {
+					return fmt.Errorf("parsing duration: %w", err)
+				}
+			}
+
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			resp, err := client.CreateBreakGlass(&api.CreateBreakGlassRequest{
+				Name:      args[0],
+				Holders:   options.Holders,
+				Privilege: options.Role,
+				Resource:  options.Resource,
+				Duration:  api.Duration(duration),
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created break-glass account %s, with %s on %s for %s once unlocked\n\n", resp.BreakGlass.Name, resp.BreakGlass.Privilege, resp.BreakGlass.Resource, time.Duration(resp.BreakGlass.Duration))
+
+			for i, holder := range resp.BreakGlass.Holders {
+				fmt.Printf("Secret for %s: %s\n", holder, resp.Secrets[i])
+			}
+
+			fmt.Println("\nGive each holder only their half. The secrets will not be shown again.")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSlice("holder", nil, "Who holds a half of the secret, given twice")
+	cmd.Flags().String("role", "", "Role granted while the account is unlocked, defaults to admin")
+	cmd.Flags().String("resource", "", "Resource of the grant, defaults to infra")
+	cmd.Flags().String("duration", "", "How long the account stays unlocked, defaults to an hour")
+
+	if err := cmd.MarkFlagRequired("holder"); err != nil {
+		panic("cannot set flag [--holder] as required")
+	}
+
+	return cmd
+}
+
+func newBreakGlassLockCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lock NAME",
+		Short: "Lock an unlocked break-glass account before its time is up",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			breakGlass, err := getBreakGlassByName(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			if _, err := client.LockBreakGlass(breakGlass.ID); err != nil {
+				return err
+			}
+
+			fmt.Printf("Locked break-glass account %s\n", breakGlass.Name)
+
+			return nil
+		},
+	}
+}
+
+func newBreakGlassEventsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "events NAME",
+		Short: "List when a break-glass account was unlocked, used, and locked",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			breakGlass, err := getBreakGlassByName(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			events, err := client.ListBreakGlassEvents(breakGlass.ID)
+			if err != nil {
+				return err
+			}
+
+			type row struct {
+				Time     string `header:"TIME"`
+				Event    string `header:"EVENT"`
+				SourceIP string `header:"SOURCE"`
+				Detail   string `header:"DETAIL"`
+			}
+
+			var rows []row
+			for _, e := range events {
+				rows = append(rows, row{
+					Time:     time.Time(e.Time).Local().Format(time.RFC1123),
+					Event:    e.Kind,
+					SourceIP: e.SourceIP,
+					Detail:   e.Detail,
+				})
+			}
+
+			if len(rows) > 0 {
+				printTable(rows)
+			} else {
+				fmt.Println("No events found")
+			}
+
+			return nil
+		},
+	}
+}
+
+func newBreakGlassRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "remove NAME",
+		Aliases: []string{"rm"},
+		Short:   "Delete a break-glass account",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			breakGlass, err := getBreakGlassByName(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := client.DeleteBreakGlass(breakGlass.ID); err != nil {
+				return err
+			}
+
+			fmt.Printf("Removed break-glass account %s\n", breakGlass.Name)
+
+			return nil
+		},
+	}
+}
+
+func getBreakGlassByName(client *api.Client, name string) (*api.BreakGlass, error) {
+	accounts, err := client.ListBreakGlass(api.ListBreakGlassRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("No break-glass account of name %s exists", name)
+	}
+
+	return &accounts[0], nil
+}
@@ -32,7 +32,7 @@ func mustBeLoggedIn() error {
 		return fmt.Errorf("Not logged in. Run 'infra login' before running this command.")
 	}
 
-	if config.isExpired() {
+	if config.isExpired() && !config.isRefreshable() {
 		return fmt.Errorf("Session expired. Run 'infra login' to start a new session.")
 	}
 
@@ -141,9 +141,39 @@ func defaultAPIClient() (*api.Client, error) {
 		return nil, err
 	}
 
+	if config.isLoggedIn() && config.isExpired() && config.isRefreshable() {
+		if err := refreshSession(config); err != nil {
+			logging.S.Debugf("refresh session: %v", err)
+			return nil, fmt.Errorf("Session expired. Run 'infra login' to start a new session.")
+		}
+
+		if err := saveHostConfig(*config); err != nil {
+			return nil, err
+		}
+	}
+
 	return apiClient(config.Host, config.AccessKey, config.SkipTLSVerify)
 }
 
+// refreshSession exchanges the refresh token of a session for a new access key
+func refreshSession(config *ClientHostConfig) error {
+	client, err := apiClient(config.Host, "", config.SkipTLSVerify)
+	if err != nil {
+		return err
+	}
+
+	loginRes, err := client.Login(&api.LoginRequest{RefreshToken: config.RefreshToken, ClientID: config.ClientID})
+	if err != nil {
+		return err
+	}
+
+	config.AccessKey = loginRes.AccessKey
+	config.RefreshToken = loginRes.RefreshToken
+	config.Expires = loginRes.Expires
+
+	return nil
+}
+
 func apiClient(host string, accessKey string, skipTLSVerify bool) (*api.Client, error) {
 	u, err := urlx.Parse(host)
 	if err != nil {
@@ -259,6 +289,22 @@ func newConnectorCmd() *cobra.Command {
 
 			options.TLSCache = tlsCache
 
+			if options.AuditSpool != "" {
+				auditSpool, err := canonicalPath(options.AuditSpool)
+				if err != nil {
+					return err
+				}
+
+				options.AuditSpool = auditSpool
+			}
+
+			recordingSpool, err := canonicalPath(options.RecordingSpool)
+			if err != nil {
+				return err
+			}
+
+			options.RecordingSpool = recordingSpool
+
 			return connector.Run(options)
 		},
 	}
@@ -267,10 +313,22 @@ func newConnectorCmd() *cobra.Command {
 	cmd.Flags().StringP("server", "s", "", "Infra server hostname")
 	cmd.Flags().StringP("access-key", "a", "", "Infra access key (use file:// to load from a file)")
 	cmd.Flags().StringP("name", "n", "", "Destination name")
+	cmd.Flags().StringToString("labels", nil, "Labels to set on the destination, e.g. env=production,team=platform")
 	cmd.Flags().String("tls-cert", "$HOME/.infra/cache/tls.crt", "Path to TLS certificate file")
 	cmd.Flags().String("tls-key", "$HOME/.infra/cache/tls.key", "Path to TLS key file")
 	cmd.Flags().String("tls-cache", "$HOME/.infra/cache", "Directory to cache TLS certificates")
+	cmd.Flags().String("audit-spool", "$HOME/.infra/cache/audit.spool", "File to keep audit records in while the server is unreachable")
+	cmd.Flags().Bool("record-sessions", true, "Record kubectl exec, attach, and port-forward sessions")
+	cmd.Flags().String("recording-spool", "$HOME/.infra/cache/recordings", "Directory to keep session recordings in until they are uploaded")
+	cmd.Flags().String("authorization-mode", connector.AuthorizationModeRoleBinding, "How grants are enforced, one of rolebinding or webhook")
+	cmd.Flags().String("authorization-webhook-token", "", "Token the API server authenticates to the authorization webhook with (use file:// to load from a file)")
+	cmd.Flags().Bool("leader-election", true, "Elect a leader among connector replicas to maintain the destination and its role bindings")
+	cmd.Flags().String("lease-name", "infra-connector", "Name of the Lease connector replicas elect a leader with")
+	cmd.Flags().String("certificate-issuer", connector.CertificateIssuerSelfSigned, "Issuer of the connector's serving certificate, one of self-signed or infra")
+	cmd.Flags().Bool("client-certificate", false, "Authenticate to the server with a client certificate issued by the server, instead of the access key")
+	cmd.Flags().Bool("tunnel", false, "Open a tunnel to the server to be reached through, for clusters that accept no inbound connections")
 	cmd.Flags().Bool("skip-tls-verify", false, "Skip verifying server TLS certificates")
+	cmd.Flags().StringSlice("trusted-proxies", nil, "Addresses or CIDRs of proxies trusted to forward the client address")
 
 	return cmd
 }
@@ -326,6 +384,10 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(newIdentitiesCmd())
 	rootCmd.AddCommand(newKeysCmd())
 	rootCmd.AddCommand(newProvidersCmd())
+	rootCmd.AddCommand(newAuditCmd())
+	rootCmd.AddCommand(newAccessCmd())
+	rootCmd.AddCommand(newReviewsCmd())
+	rootCmd.AddCommand(newBreakGlassCmd())
 
 	// Hidden
 	rootCmd.AddCommand(newTokensCmd())
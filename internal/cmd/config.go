@@ -29,6 +29,8 @@ type ClientHostConfig struct {
 	ProviderID    uid.ID            `json:"provider-id"`
 	Expires       api.Time          `json:"expires"`
 	Current       bool              `json:"current"`
+	RefreshToken  string            `json:"refresh-token,omitempty"`
+	ClientID      string            `json:"client-id,omitempty"` // identifies this client to refresh the session
 }
 
 // checks if user is logged in to the given session (ClientHostConfig)
@@ -63,6 +65,11 @@ func (c *ClientHostConfig) isExpired() bool {
 	return time.Now().After(time.Time(c.Expires))
 }
 
+// checks if the session can be renewed without logging in again
+func (c *ClientHostConfig) isRefreshable() bool {
+	return c.RefreshToken != "" && c.ClientID != ""
+}
+
 func (c ClientConfig) HostNames() []string {
 	var hosts []string
 	for _, h := range c.Hosts {
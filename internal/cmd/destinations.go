@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -20,37 +23,59 @@ func newDestinationsCmd() *cobra.Command {
 	}
 
 	cmd.AddCommand(newDestinationsListCmd())
+	cmd.AddCommand(newDestinationsLabelCmd())
 	cmd.AddCommand(newDestinationsRemoveCmd())
 
 	return cmd
 }
 
+type destinationsListOptions struct {
+	Selector string `mapstructure:"selector"`
+}
+
 func newDestinationsListCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"ls"},
 		Short:   "List connected destinations",
+		Example: `
+# List the destinations in production, outside of us-east-1
+$ infra destinations list --selector env=production,topology.kubernetes.io/region!=us-east-1
+`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			var options destinationsListOptions
+			if err := parseOptions(cmd, &options, "INFRA_DESTINATIONS"); err != nil {
+				return err
+			}
+
 			client, err := defaultAPIClient()
 			if err != nil {
 				return err
 			}
 
-			destinations, err := client.ListDestinations(api.ListDestinationsRequest{})
+			destinations, err := client.ListDestinations(api.ListDestinationsRequest{Selector: options.Selector})
 			if err != nil {
 				return err
 			}
 
 			type row struct {
-				Name string `header:"NAME"`
-				URL  string `header:"URL"`
+				Name     string `header:"NAME"`
+				URL      string `header:"URL"`
+				Status   string `header:"STATUS"`
+				LastSeen string `header:"LAST SEEN"`
+				Version  string `header:"VERSION"`
+				Labels   string `header:"LABELS"`
 			}
 
 			var rows []row
 			for _, d := range destinations {
 				rows = append(rows, row{
-					Name: d.Name,
-					URL:  d.Connection.URL,
+					Name:     d.Name,
+					URL:      d.Connection.URL,
+					Status:   d.Status,
+					LastSeen: d.LastSeen.Relative("never"),
+					Version:  d.Version,
+					Labels:   formatLabels(d.Labels),
 				})
 			}
 
@@ -60,9 +85,110 @@ func newDestinationsListCmd() *cobra.Command {
 				fmt.Println("No destinations found")
 			}
 
+			for _, d := range destinations {
+				for _, g := range d.SkippedGrants {
+					fmt.Fprintf(os.Stderr, "Warning: grant of %s to %s has no effect: %s\n", g.Privilege, g.Resource, g.Reason)
+				}
+			}
+
 			return nil
 		},
 	}
+
+	cmd.Flags().StringP("selector", "l", "", "Only list destinations with matching labels, e.g. env=production,team!=web")
+
+	return cmd
+}
+
+func newDestinationsLabelCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "label DESTINATION KEY=VALUE... [KEY-]...",
+		Short: "Update the labels of a destination",
+		Long: `Update the labels of a destination. KEY=VALUE sets a label, and KEY- removes it.
+
+Labels set by the destination's connector, such as topology.kubernetes.io/region, are set again by the connector.
+Change those with the connector's labels option instead.`,
+		Example: `
+# Label a destination as production, owned by the platform team
+$ infra destinations label kubernetes.production env=production team=platform
+
+# Remove a label
+$ infra destinations label kubernetes.production team-
+`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			destinations, err := client.ListDestinations(api.ListDestinationsRequest{Name: args[0]})
+			if err != nil {
+				return err
+			}
+
+			if len(destinations) == 0 {
+				return fmt.Errorf("no destinations named %s", args[0])
+			}
+
+			for _, d := range destinations {
+				labels, err := updateLabels(d.Labels, args[1:])
+				if err != nil {
+					return err
+				}
+
+				_, err = client.UpdateDestination(api.UpdateDestinationRequest{
+					ID:         d.ID,
+					Name:       d.Name,
+					UniqueID:   d.UniqueID,
+					Connection: d.Connection,
+					Labels:     labels,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// updateLabels applies KEY=VALUE and KEY- arguments to labels. The result is never nil, so removing the last
+// label clears the labels of a destination.
+func updateLabels(labels map[string]string, args []string) (map[string]string, error) {
+	updated := make(map[string]string, len(labels))
+	for key, value := range labels {
+		updated[key] = value
+	}
+
+	for _, arg := range args {
+		if key, value, ok := strings.Cut(arg, "="); ok {
+			updated[key] = value
+			continue
+		}
+
+		if strings.HasSuffix(arg, "-") {
+			delete(updated, strings.TrimSuffix(arg, "-"))
+			continue
+		}
+
+		return nil, fmt.Errorf("invalid label %q, use KEY=VALUE to set a label or KEY- to remove it", arg)
+	}
+
+	return updated, nil
+}
+
+// formatLabels formats labels as key=value pairs, sorted by key
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
 }
 
 func newDestinationsRemoveCmd() *cobra.Command {
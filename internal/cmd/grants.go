@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"net/mail"
 	"regexp"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/resource"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
 )
@@ -17,6 +19,11 @@ type grantsCmdOptions struct {
 	Destination string `mapstructure:"destination"`
 	IsGroup     bool   `mapstructure:"group"`
 	Role        string `mapstructure:"role"`
+	Deny        bool   `mapstructure:"deny"`
+
+	CIDRs   []string `mapstructure:"cidr"`
+	Windows []string `mapstructure:"window"`
+	MFA     int      `mapstructure:"mfa"`
 }
 
 func newGrantsCmd() *cobra.Command {
@@ -59,9 +66,11 @@ func newGrantsListCmd() *cobra.Command {
 			}
 
 			type row struct {
-				Identity string `header:"IDENTITY"`
-				Access   string `header:"ACCESS"`
-				Resource string `header:"DESTINATION"`
+				Identity   string `header:"IDENTITY"`
+				Access     string `header:"ACCESS"`
+				Resource   string `header:"DESTINATION"`
+				Effect     string `header:"EFFECT"`
+				Conditions string `header:"CONDITIONS"`
 			}
 
 			var rows []row
@@ -72,9 +81,11 @@ func newGrantsListCmd() *cobra.Command {
 				}
 
 				rows = append(rows, row{
-					Identity: identity,
-					Access:   g.Privilege,
-					Resource: g.Resource,
+					Identity:   identity,
+					Access:     g.Privilege,
+					Resource:   g.Resource,
+					Effect:     grantEffect(g),
+					Conditions: formatConditions(g.Conditions),
 				})
 			}
 
@@ -105,6 +116,9 @@ DESTINATION is what the identity will lose access to.
 Use [--role] to specify the exact grant being deleted. 
 If not specified, it will revoke all roles for that user within the destination. 
 
+Use [--deny] to remove deny grants instead. 
+$ infra grants remove contractors -g kubernetes.production --role '*' --deny
+
 Use [--group] or [-g] if identity is of type group. 
 $ infra grants remove devGroup -g ...
 `,
@@ -124,6 +138,7 @@ $ infra grants remove devGroup -g ...
 
 	cmd.Flags().BoolP("group", "g", false, "Group to revoke access from")
 	cmd.Flags().String("role", "", "Role to revoke")
+	cmd.Flags().Bool("deny", false, "Remove deny grants instead of grants that give access")
 
 	return cmd
 }
@@ -154,6 +169,10 @@ func removeGrant(cmdOptions grantsCmdOptions) error {
 	}
 
 	for _, g := range grants {
+		if g.Deny != cmdOptions.Deny {
+			continue
+		}
+
 		err := client.DeleteGrant(g.ID)
 		if err != nil {
 			return err
@@ -181,6 +200,14 @@ Use [--group] or [-g] if identity is of type group.
 $ infra grants add devGroup -group ...
 $ infra grants add devGroup -g ...
 
+Use [--deny] to deny the role instead, even when other grants give it. 
+A deny of the role '*' denies every role on the destination and the namespaces in it. 
+$ infra grants add contractors -g kubernetes.production --role '*' --deny
+
+Use [--cidr], [--window] and [--mfa] to only give access while conditions are met. 
+Windows are days, a time range, and a time zone, which is UTC when omitted. 
+$ infra grants add oncall -g kubernetes.production --role admin --cidr 10.0.0.0/8 --window 'mon-fri 09:00-17:00 Europe/London' --mfa 1
+
 For full documentation on grants with more examples, see: 
   https://github.com/infrahq/infra/blob/main/docs/guides
 `,
@@ -200,6 +227,10 @@ For full documentation on grants with more examples, see:
 
 	cmd.Flags().BoolP("group", "g", false, "Required if identity is of type 'group'")
 	cmd.Flags().String("role", models.BasePermissionConnect, "Type of access that identity will be given")
+	cmd.Flags().Bool("deny", false, "Deny the role instead of granting it")
+	cmd.Flags().StringSlice("cidr", nil, "Source addresses the grant applies from, may be repeated")
+	cmd.Flags().StringArray("window", nil, "Recurring time the grant applies in, e.g. 'mon-fri 09:00-17:00 Europe/London', may be repeated")
+	cmd.Flags().Int("mfa", 0, "MFA level the identity must have logged in with: 1 for a second factor, 2 for a hardware key")
 	return cmd
 }
 
@@ -219,20 +250,188 @@ func addGrant(cmdOptions grantsCmdOptions) error {
 		return err
 	}
 
+	conditions := &api.GrantConditions{CIDRs: cmdOptions.CIDRs, MFALevel: cmdOptions.MFA}
+
+	for _, w := range cmdOptions.Windows {
+		window, err := parseTimeWindow(w)
+		if err != nil {
+			return err
+		}
+
+		conditions.Windows = append(conditions.Windows, *window)
+	}
+
+	if len(conditions.CIDRs) == 0 && len(conditions.Windows) == 0 && conditions.MFALevel == 0 {
+		conditions = nil
+	}
+
 	_, err = client.CreateGrant(&api.CreateGrantRequest{
-		Subject:   id,
-		Privilege: cmdOptions.Role,
-		Resource:  cmdOptions.Destination,
+		Subject:    id,
+		Privilege:  cmdOptions.Role,
+		Resource:   cmdOptions.Destination,
+		Deny:       cmdOptions.Deny,
+		Conditions: conditions,
 	})
 	if err != nil {
 		return err
 	}
 
+	if cmdOptions.Deny {
+		fmt.Println("Deny grant added!")
+		return nil
+	}
+
 	fmt.Println("Access granted!")
 
 	return nil
 }
 
+// grantEffect shows whether a grant gives access, or is a deny grant that takes it away
+func grantEffect(g api.Grant) string {
+	if g.Deny {
+		return "deny"
+	}
+
+	return "allow"
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseTimeWindow parses a time window of days, a time range, and a time zone, such as
+// 'mon-fri,sun 09:00-17:00 Europe/London'. The days and time zone are optional.
+func parseTimeWindow(s string) (*api.TimeWindow, error) {
+	fields := strings.Fields(s)
+
+	var window api.TimeWindow
+
+	for i, field := range fields {
+		start, end, ok := strings.Cut(field, "-")
+		if !ok || !strings.Contains(start, ":") {
+			continue
+		}
+
+		window.Start, window.End = start, end
+
+		if i > 1 || len(fields) > i+2 {
+			return nil, fmt.Errorf("invalid window %q, windows are [DAYS] HH:MM-HH:MM [TIMEZONE]", s)
+		}
+
+		if i == 1 {
+			days, err := parseDays(fields[0])
+			if err != nil {
+				return nil, err
+			}
+
+			window.Days = days
+		}
+
+		if len(fields) == i+2 {
+			window.Timezone = fields[i+1]
+		}
+
+		return &window, nil
+	}
+
+	return nil, fmt.Errorf("invalid window %q, windows are [DAYS] HH:MM-HH:MM [TIMEZONE]", s)
+}
+
+// parseDays parses days of the week and ranges of them, such as 'mon-fri,sun'. Ranges may wrap around the week.
+func parseDays(s string) ([]string, error) {
+	var days []string
+
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+
+		first, last := dayIndex(from), dayIndex(to)
+		if first < 0 || last < 0 {
+			return nil, fmt.Errorf("invalid days %q, days are mon, tue, wed, thu, fri, sat or sun", part)
+		}
+
+		for i := first; ; i = (i + 1) % len(weekdays) {
+			days = append(days, weekdays[i])
+
+			if i == last {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+func dayIndex(day string) int {
+	for i, d := range weekdays {
+		if d == strings.ToLower(day) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// formatConditions shows the conditions of a grant in a table cell
+func formatConditions(conditions *api.GrantConditions) string {
+	if conditions == nil {
+		return ""
+	}
+
+	var parts []string
+
+	if len(conditions.CIDRs) > 0 {
+		parts = append(parts, "from "+strings.Join(conditions.CIDRs, ", "))
+	}
+
+	for _, w := range conditions.Windows {
+		window := w.Start + "-" + w.End
+		if len(w.Days) > 0 {
+			window = strings.Join(w.Days, ",") + " " + window
+		}
+
+		if w.Timezone != "" {
+			window += " " + w.Timezone
+		}
+
+		parts = append(parts, window)
+	}
+
+	if conditions.MFALevel > 0 {
+		parts = append(parts, fmt.Sprintf("mfa %d", conditions.MFALevel))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// withoutDenied removes the deny grants, and the grants they take away entirely: grants of the privilege they deny,
+// or of any privilege for denies of *, on resources the deny is known to contain. Selectors of denies are matched
+// against the labels of destinations.
+func withoutDenied(grants []api.Grant, labels resource.Labels) []api.Grant {
+	var allowed []api.Grant
+
+	for _, g := range grants {
+		if g.Deny {
+			continue
+		}
+
+		denied := false
+
+		for _, d := range grants {
+			if d.Deny && (d.Privilege == models.DenyAllPrivileges || d.Privilege == g.Privilege) && resource.ContainsPattern(d.Resource, g.Resource, labels) {
+				denied = true
+				break
+			}
+		}
+
+		if !denied {
+			allowed = append(allowed, g)
+		}
+	}
+
+	return allowed
+}
+
 type identityType int8
 
 const (
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected *api.TimeWindow
+		err      string
+	}{
+		{input: "09:00-17:00", expected: &api.TimeWindow{Start: "09:00", End: "17:00"}},
+		{input: "mon-fri 09:00-17:00", expected: &api.TimeWindow{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}},
+		{input: "fri-mon,wed 22:00-06:00 Europe/London", expected: &api.TimeWindow{Days: []string{"fri", "sat", "sun", "mon", "wed"}, Start: "22:00", End: "06:00", Timezone: "Europe/London"}},
+		{input: "09:00-17:00 UTC", expected: &api.TimeWindow{Start: "09:00", End: "17:00", Timezone: "UTC"}},
+		{input: "weekdays 09:00-17:00", err: `invalid days "weekdays", days are mon, tue, wed, thu, fri, sat or sun`},
+		{input: "mon-fri", err: `invalid window "mon-fri", windows are [DAYS] HH:MM-HH:MM [TIMEZONE]`},
+		{input: "mon 09:00-17:00 UTC extra", err: `invalid window "mon 09:00-17:00 UTC extra", windows are [DAYS] HH:MM-HH:MM [TIMEZONE]`},
+	}
+
+	for _, test := range tests {
+		window, err := parseTimeWindow(test.input)
+		if test.err != "" {
+			assert.Error(t, err, test.err)
+			continue
+		}
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, window, test.expected)
+	}
+}
+
+func TestFormatConditions(t *testing.T) {
+	assert.Equal(t, formatConditions(nil), "")
+
+	conditions := &api.GrantConditions{
+		CIDRs:    []string{"10.0.0.0/8"},
+		Windows:  []api.TimeWindow{{Days: []string{"mon", "tue"}, Start: "09:00", End: "17:00", Timezone: "Europe/London"}},
+		MFALevel: 2,
+	}
+
+	assert.Equal(t, formatConditions(conditions), "from 10.0.0.0/8; mon,tue 09:00-17:00 Europe/London; mfa 2")
+}
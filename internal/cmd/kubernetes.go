@@ -13,6 +13,7 @@ import (
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/resource"
 	"github.com/infrahq/infra/uid"
 )
 
@@ -76,7 +77,7 @@ func updateKubeconfig(client *api.Client, identityPolymorphicID uid.PolymorphicI
 		grants = append(grants, groupGrants...)
 	}
 
-	return writeKubeconfig(destinations, grants)
+	return writeKubeconfig(destinations, withoutDenied(grants, destinationLabels(destinations)))
 }
 
 func writeKubeconfig(destinations []api.Destination, grants []api.Grant) error {
@@ -88,113 +89,57 @@ func writeKubeconfig(destinations []api.Destination, grants []api.Grant) error {
 	}
 
 	keep := make(map[string]bool)
+	warned := make(map[string]bool)
 
 	for _, g := range grants {
-		parts := strings.Split(g.Resource, ".")
+		for _, target := range kubernetesTargets(destinations, g) {
+			d := target.destination
 
-		kind := parts[0]
+			cluster := strings.TrimPrefix(d.Name, "kubernetes.")
+			namespace := target.namespace
 
-		if kind != "kubernetes" {
-			continue
-		}
-
-		if len(parts) < 2 {
-			continue
-		}
-
-		cluster := parts[1]
-
-		var namespace string
-		if len(parts) > 2 {
-			namespace = parts[2]
-		}
-
-		context := "infra:" + cluster
-
-		if namespace != "" {
-			context += ":" + namespace
-		}
-
-		var (
-			url, ca string
-			exists  bool
-		)
+			context := "infra:" + cluster
 
-		for _, d := range destinations {
-			// eg resource:  "kubernetes.foo.bar"
-			// eg dest name: "kubernetes.foo"
-			if strings.HasPrefix(g.Resource, d.Name) {
-				url = d.Connection.URL
-				ca = d.Connection.CA
-				exists = true
-
-				break
+			if namespace != "" {
+				context += ":" + namespace
 			}
-		}
-
-		if !exists {
-			continue
-		}
-
-		u, err := urlx.Parse(url)
-		if err != nil {
-			return err
-		}
-
-		u.Scheme = "https"
-
-		logging.S.Debugf("creating kubeconfig for %s", context)
 
-		// get TLS server name from the certificate
-		block, _ := pem.Decode([]byte(ca))
-		if block == nil {
-			return fmt.Errorf("unknown certificate format")
-		}
+			if d.Status == api.DestinationStatusStale && !warned[d.Name] {
+				fmt.Fprintf(os.Stderr, "Warning: destination %q has not been seen since %s, its connector may be down\n", d.Name, d.LastSeen.Relative("never"))
+				warned[d.Name] = true
+			}
 
-		certs, err := x509.ParseCertificates(block.Bytes)
-		if err != nil {
-			return err
-		}
+			logging.S.Debugf("creating kubeconfig for %s", context)
 
-		if len(certs) == 0 {
-			return fmt.Errorf("no certficates found")
-		}
+			kubeCluster, err := destinationCluster(d)
+			if err != nil {
+				return err
+			}
 
-		tlsServerName := ""
-		switch {
-		case len(certs[0].DNSNames) > 0:
-			tlsServerName = certs[0].DNSNames[0]
-		case len(certs[0].IPAddresses) > 0:
-			tlsServerName = certs[0].IPAddresses[0].String()
-		}
+			kubeConfig.Clusters[context] = kubeCluster
 
-		kubeConfig.Clusters[context] = &clientcmdapi.Cluster{
-			Server:                   u.String(),
-			TLSServerName:            tlsServerName,
-			CertificateAuthorityData: []byte(ca),
-		}
+			kubeConfig.Contexts[context] = &clientcmdapi.Context{
+				Cluster:   context,
+				AuthInfo:  context,
+				Namespace: namespace,
+			}
 
-		kubeConfig.Contexts[context] = &clientcmdapi.Context{
-			Cluster:   context,
-			AuthInfo:  context,
-			Namespace: namespace,
-		}
+			executable, err := os.Executable()
+			if err != nil {
+				return err
+			}
 
-		executable, err := os.Executable()
-		if err != nil {
-			return err
-		}
+			kubeConfig.AuthInfos[context] = &clientcmdapi.AuthInfo{
+				Exec: &clientcmdapi.ExecConfig{
+					Command:         executable,
+					Args:            []string{"tokens", "add"},
+					APIVersion:      "client.authentication.k8s.io/v1beta1",
+					InteractiveMode: clientcmdapi.IfAvailableExecInteractiveMode,
+				},
+			}
 
-		kubeConfig.AuthInfos[context] = &clientcmdapi.AuthInfo{
-			Exec: &clientcmdapi.ExecConfig{
-				Command:         executable,
-				Args:            []string{"tokens", "add"},
-				APIVersion:      "client.authentication.k8s.io/v1beta1",
-				InteractiveMode: clientcmdapi.IfAvailableExecInteractiveMode,
-			},
+			keep[context] = true
 		}
-
-		keep[context] = true
 	}
 
 	// cleanup others
@@ -225,6 +170,68 @@ func writeKubeconfig(destinations []api.Destination, grants []api.Grant) error {
 	return nil
 }
 
+// destinationCluster is the cluster kubectl connects to for a destination. Destinations reached through a tunnel are
+// connected to through the server, which kubectl verifies like the CLI does.
+func destinationCluster(d api.Destination) (*clientcmdapi.Cluster, error) {
+	if d.Connection.Tunnel {
+		config, err := currentHostConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		u, err := urlx.Parse(config.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		return &clientcmdapi.Cluster{
+			Server:                fmt.Sprintf("https://%s/v1/destinations/%s/proxy", u.Host, d.ID),
+			InsecureSkipTLSVerify: config.SkipTLSVerify,
+		}, nil
+	}
+
+	ca := d.Connection.CA
+
+	u, err := urlx.Parse(d.Connection.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Scheme = "https"
+
+	// get TLS server name from the certificate
+	block, _ := pem.Decode([]byte(ca))
+	if block == nil {
+		return nil, fmt.Errorf("unknown certificate format")
+	}
+
+	certs, err := x509.ParseCertificates(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certficates found")
+	}
+
+	// certificates issued by Infra are verified against the URL host with the Infra CAs, otherwise the
+	// connector's own certificate is trusted, for the name it was issued to
+	tlsServerName := ""
+	switch {
+	case certs[0].IsCA:
+	case len(certs[0].DNSNames) > 0:
+		tlsServerName = certs[0].DNSNames[0]
+	case len(certs[0].IPAddresses) > 0:
+		tlsServerName = certs[0].IPAddresses[0].String()
+	}
+
+	return &clientcmdapi.Cluster{
+		Server:                   u.String(),
+		TLSServerName:            tlsServerName,
+		CertificateAuthorityData: []byte(ca),
+	}, nil
+}
+
 func clearKubeconfig() error {
 	defaultConfig := clientConfig()
 
@@ -255,3 +262,56 @@ func clearKubeconfig() error {
 	}
 	return nil
 }
+
+// kubernetesTarget is a cluster, or a namespace in it, that a grant gives access to
+type kubernetesTarget struct {
+	destination api.Destination
+	namespace   string
+}
+
+// destinationLabels looks up the labels of destinations by name, to match the label selectors of grants
+func destinationLabels(destinations []api.Destination) resource.Labels {
+	labels := make(map[string]map[string]string, len(destinations))
+	for _, d := range destinations {
+		labels[d.Name] = d.Labels
+	}
+
+	return func(name string) map[string]string {
+		return labels[name]
+	}
+}
+
+// kubernetesTargets finds the destinations a grant's resource pattern gives access to. The namespaces of a
+// destination are not known, so a grant on a namespace pattern, e.g. kubernetes.*.team-a-*, gives a target
+// for the whole destination.
+func kubernetesTargets(destinations []api.Destination, g api.Grant) []kubernetesTarget {
+	pattern, err := resource.Parse(g.Resource)
+	if err != nil {
+		logging.S.Debugf("skipping grant with invalid resource %q: %v", g.Resource, err)
+		return nil
+	}
+
+	if len(pattern.Segments) < 2 || len(pattern.Segments) > 3 || pattern.Kind() != "kubernetes" {
+		return nil
+	}
+
+	var targets []kubernetesTarget
+
+	labels := destinationLabels(destinations)
+
+	for _, d := range destinations {
+		if !strings.HasPrefix(d.Name, "kubernetes.") || !pattern.MatchPrefix(d.Name, labels) {
+			continue
+		}
+
+		target := kubernetesTarget{destination: d}
+
+		if len(pattern.Segments) == 3 && pattern.Segments[2].IsLiteral() {
+			target.namespace = pattern.Segments[2].Glob
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets
+}
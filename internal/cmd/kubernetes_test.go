@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/resource"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestKubernetesTargets(t *testing.T) {
+	destinations := []api.Destination{
+		{Name: "kubernetes.production", Labels: map[string]string{"env": "production"}},
+		{Name: "kubernetes.production-eu", Labels: map[string]string{"env": "production", "region": "eu"}},
+		{Name: "kubernetes.staging", Labels: map[string]string{"env": "staging"}},
+	}
+
+	targets := func(resource string) []string {
+		var names []string
+
+		for _, target := range kubernetesTargets(destinations, api.Grant{Resource: resource}) {
+			names = append(names, target.destination.Name+":"+target.namespace)
+		}
+
+		return names
+	}
+
+	assert.DeepEqual(t, targets("kubernetes.production"), []string{"kubernetes.production:"})
+	assert.DeepEqual(t, targets("kubernetes.production.default"), []string{"kubernetes.production:default"})
+	assert.DeepEqual(t, targets("kubernetes.production*"), []string{"kubernetes.production:", "kubernetes.production-eu:"})
+
+	// the namespaces a pattern matches are not known, so the whole cluster is targeted
+	assert.DeepEqual(t, targets("kubernetes.*.team-a-*"), []string{"kubernetes.production:", "kubernetes.production-eu:", "kubernetes.staging:"})
+
+	assert.DeepEqual(t, targets("kubernetes.*[env=production,region!=eu]"), []string{"kubernetes.production:"})
+	assert.DeepEqual(t, targets("kubernetes[env=staging].*.default"), []string{"kubernetes.staging:default"})
+
+	assert.Assert(t, targets("kubernetes.unknown") == nil)
+	assert.Assert(t, targets("infra") == nil)
+	assert.Assert(t, targets("kubernetes[") == nil)
+}
+
+func TestWithoutDenied(t *testing.T) {
+	grants := []api.Grant{
+		{ID: 1, Privilege: "edit", Resource: "kubernetes.production.web"},
+		{ID: 2, Privilege: "view", Resource: "kubernetes.production"},
+		{ID: 3, Privilege: "edit", Resource: "kubernetes.production-eu"},
+		{ID: 4, Privilege: "view", Resource: "kubernetes.staging"},
+		{ID: 5, Privilege: "*", Resource: "kubernetes.production", Deny: true},
+		{ID: 6, Privilege: "edit", Resource: "kubernetes.staging", Deny: true},
+	}
+
+	ids := func(grants []api.Grant, labels resource.Labels) []uid.ID {
+		var ids []uid.ID
+		for _, g := range withoutDenied(grants, labels) {
+			ids = append(ids, g.ID)
+		}
+
+		return ids
+	}
+
+	assert.DeepEqual(t, ids(grants, nil), []uid.ID{3, 4})
+
+	t.Run("patterns", func(t *testing.T) {
+		labels := destinationLabels([]api.Destination{
+			{Name: "kubernetes.production", Labels: map[string]string{"env": "production"}},
+			{Name: "kubernetes.staging", Labels: map[string]string{"env": "staging"}},
+		})
+
+		grants := []api.Grant{
+			{ID: 1, Privilege: "edit", Resource: "kubernetes.production.web"},
+			{ID: 2, Privilege: "view", Resource: "kubernetes.staging"},
+			{ID: 3, Privilege: "view", Resource: "kubernetes.*"},
+			{ID: 4, Privilege: "edit", Resource: "kubernetes.staging.*"},
+			{ID: 5, Privilege: "admin", Resource: "kubernetes.staging"},
+			{ID: 6, Privilege: "admin", Resource: "kubernetes.production"},
+			{ID: 7, Privilege: "view", Resource: "kubernetes.*[env!=production]", Deny: true},
+			{ID: 8, Privilege: "*", Resource: "kubernetes[env=production]", Deny: true},
+			{ID: 9, Privilege: "edit", Resource: "kubernetes.*.*", Deny: true},
+		}
+
+		// view on every cluster is only denied on some of them, so it is kept
+		assert.DeepEqual(t, ids(grants, labels), []uid.ID{3, 5})
+	})
+}
+
+func TestUpdateLabels(t *testing.T) {
+	labels, err := updateLabels(map[string]string{"env": "staging", "team": "web"}, []string{"env=production", "team-", "tier="})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, labels, map[string]string{"env": "production", "tier": ""})
+	assert.Equal(t, formatLabels(labels), "env=production,tier=")
+
+	labels, err = updateLabels(nil, []string{"env-"})
+	assert.NilError(t, err)
+	assert.Assert(t, labels != nil)
+
+	_, err = updateLabels(nil, []string{"env"})
+	assert.ErrorContains(t, err, "invalid label")
+}
+
+func TestDestinationCluster_Tunnel(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("USERPROFILE", homeDir) // for windows
+
+	err := writeConfig(&ClientConfig{
+		Version: "0.3",
+		Hosts: []ClientHostConfig{
+			{Name: "admin", Host: "https://infra.example.com", SkipTLSVerify: true, Current: true},
+		},
+	})
+	assert.NilError(t, err)
+
+	destination := api.Destination{
+		ID:         uid.ID(12345),
+		Name:       "kubernetes.private",
+		Connection: api.DestinationConnection{Tunnel: true},
+	}
+
+	cluster, err := destinationCluster(destination)
+	assert.NilError(t, err)
+	assert.Equal(t, cluster.Server, "https://infra.example.com/v1/destinations/"+destination.ID.String()+"/proxy")
+	assert.Assert(t, cluster.InsecureSkipTLSVerify)
+	assert.Assert(t, cluster.CertificateAuthorityData == nil)
+}
+
+func TestDestinationCluster_InfraIssued(t *testing.T) {
+	public, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Infra Root CA"},
+		DNSNames:              []string{"root.infrahq.com"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caBytes, err := x509.CreateCertificate(rand.Reader, template, template, public, key)
+	assert.NilError(t, err)
+
+	destination := api.Destination{
+		Name: "kubernetes.production",
+		Connection: api.DestinationConnection{
+			URL: "10.0.0.1:443",
+			CA:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caBytes})),
+		},
+	}
+
+	// the connector's certificate is verified against the URL host, not a name from the CA
+	cluster, err := destinationCluster(destination)
+	assert.NilError(t, err)
+	assert.Equal(t, cluster.Server, "https://10.0.0.1:443")
+	assert.Equal(t, cluster.TLSServerName, "")
+	assert.Equal(t, string(cluster.CertificateAuthorityData), destination.Connection.CA)
+}
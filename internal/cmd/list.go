@@ -7,6 +7,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/resource"
 )
 
 func newListCmd() *cobra.Command {
@@ -64,8 +65,15 @@ func list() error {
 		grants = append(grants, groupGrants...)
 	}
 
+	destinations, err := client.ListDestinations(api.ListDestinationsRequest{})
+	if err != nil {
+		return err
+	}
+
+	labels := destinationLabels(destinations)
+
 	gs := make(map[string]map[string]struct{})
-	for _, g := range grants {
+	for _, g := range withoutDenied(grants, labels) {
 		// aggregate privileges
 		if gs[g.Resource] == nil {
 			gs[g.Resource] = make(map[string]struct{})
@@ -74,14 +82,10 @@ func list() error {
 		gs[g.Resource][g.Privilege] = struct{}{}
 	}
 
-	destinations, err := client.ListDestinations(api.ListDestinationsRequest{})
-	if err != nil {
-		return err
-	}
-
 	type row struct {
 		Name   string `header:"RESOURCE"`
 		Access string `header:"ACCESS"`
+		Labels string `header:"LABELS"`
 	}
 
 	var rows []row
@@ -91,10 +95,15 @@ func list() error {
 			continue
 		}
 
+		pattern, err := resource.Parse(k)
+		if err != nil {
+			continue
+		}
+
 		var exists bool
 
 		for _, d := range destinations {
-			if strings.HasPrefix(k, d.Name) {
+			if pattern.MatchPrefix(d.Name, labels) {
 				exists = true
 				break
 			}
@@ -109,9 +118,16 @@ func list() error {
 			access = append(access, vk)
 		}
 
+		// patterns may match many destinations, so only the labels of a single destination are shown
+		var resourceLabels map[string]string
+		if pattern.IsLiteral() && len(pattern.Segments) >= 2 {
+			resourceLabels = labels(pattern.Segments[0].Glob + "." + pattern.Segments[1].Glob)
+		}
+
 		rows = append(rows, row{
 			Name:   k,
 			Access: strings.Join(access, ", "),
+			Labels: formatLabels(resourceLabels),
 		})
 	}
 
@@ -30,6 +30,9 @@ type loginCmdOptions struct {
 	Server        string `mapstructure:"server"`
 	AccessKey     string `mapstructure:"key"`
 	Provider      string `mapstructure:"provider"`
+	Device        bool   `mapstructure:"device"`
+	TokenFile     string `mapstructure:"tokenFile"`
+	BreakGlass    string `mapstructure:"breakGlass"`
 	SkipTLSVerify bool   `mapstructure:"skipTLSVerify"`
 }
 
@@ -61,6 +64,15 @@ $ infra login --key KEY
 # Login with a specified provider
 $ infra login --provider NAME
 
+# Login from a machine without a browser, by approving the login on another device
+$ infra login --device --provider NAME
+
+# Login as a machine with a token from a trusted issuer, such as a CI OIDC token
+$ infra login --token-file /var/run/secrets/tokens/infra
+
+# Unlock a break-glass account in an emergency, with the halves of its secret from both holders
+$ infra login --break-glass NAME
+
 # Use the '--non-interactive' flag to error out instead of prompting.
 `,
 		Args:  cobra.MaximumNArgs(1),
@@ -87,6 +99,9 @@ $ infra login --provider NAME
 	cmd.Flags().String("key", "", "Login with an access key")
 	cmd.Flags().String("server", "", "Infra server to login to")
 	cmd.Flags().String("provider", "", "Login with an identity provider")
+	cmd.Flags().Bool("device", false, "Login by approving a code from another device")
+	cmd.Flags().String("token-file", "", "Login with a token from an issuer trusted by the server")
+	cmd.Flags().String("break-glass", "", "Unlock a break-glass account and login as it")
 	cmd.Flags().Bool("skip-tls-verify", false, "Skip verifying server TLS certificates")
 	return cmd
 }
@@ -118,9 +133,38 @@ func login(options loginCmdOptions) error {
 		}
 	}
 
-	loginReq := &api.LoginRequest{}
+	clientID, err := loginClientID(options.Server)
+	if err != nil {
+		return err
+	}
+
+	loginReq := &api.LoginRequest{ClientID: clientID}
 
 	switch {
+	case options.Device:
+		provider, err := promptDeviceLoginProvider(client, options.Provider)
+		if err != nil {
+			return err
+		}
+
+		loginRes, err := loginWithDevice(client, provider, clientID)
+		if err != nil {
+			return err
+		}
+
+		return completeLogin(client, loginReq, loginRes, provider.ID)
+	case options.TokenFile != "":
+		token, err := os.ReadFile(options.TokenFile)
+		if err != nil {
+			return fmt.Errorf("read token file: %w", err)
+		}
+
+		loginReq.Federation = &api.LoginRequestFederation{Token: strings.TrimSpace(string(token))}
+	case options.BreakGlass != "":
+		loginReq.BreakGlass, err = promptBreakGlassLogin(options.BreakGlass)
+		if err != nil {
+			return err
+		}
 	case options.AccessKey != "":
 		loginReq.AccessKey = options.AccessKey
 	case options.Provider != "":
@@ -187,12 +231,18 @@ func relogin() error {
 		return err
 	}
 
+	clientID, err := loginClientID(currentConfig.Host)
+	if err != nil {
+		return err
+	}
+
 	loginReq := &api.LoginRequest{
 		OIDC: &api.LoginRequestOIDC{
 			ProviderID:  provider.ID,
 			RedirectURL: cliLoginRedirectURL,
 			Code:        code,
 		},
+		ClientID: clientID,
 	}
 
 	loginRes, err := client.Login(loginReq)
@@ -200,7 +250,7 @@ func relogin() error {
 		return err
 	}
 
-	return finishLogin(currentConfig.Host, currentConfig.SkipTLSVerify, provider.ID, loginRes)
+	return finishLogin(currentConfig.Host, currentConfig.SkipTLSVerify, provider.ID, clientID, loginRes)
 }
 
 func loginToInfra(client *api.Client, loginReq *api.LoginRequest) error {
@@ -219,12 +269,24 @@ func loginToInfra(client *api.Client, loginReq *api.LoginRequest) error {
 		return err
 	}
 
+	var providerID uid.ID
+	if loginReq.OIDC != nil {
+		providerID = loginReq.OIDC.ProviderID
+	}
+
+	return completeLogin(client, loginReq, loginRes, providerID)
+}
+
+// completeLogin saves the new session and updates the kubeconfig for it
+func completeLogin(client *api.Client, loginReq *api.LoginRequest, loginRes *api.LoginResponse, providerID uid.ID) error {
 	fmt.Fprintf(os.Stderr, "  Logged in as %s\n", termenv.String(loginRes.Name).Bold().String())
 
-	if err := updateInfraConfig(client, loginReq, loginRes); err != nil {
+	if err := updateInfraConfig(client, loginReq, loginRes, providerID); err != nil {
 		return err
 	}
 
+	var err error
+
 	// Client needs to be refreshed from here onwards, based on the newly saved infra configuration.
 	client, err = defaultAPIClient()
 	if err != nil {
@@ -245,13 +307,16 @@ func loginToInfra(client *api.Client, loginReq *api.LoginRequest) error {
 }
 
 // Updates all configs with the current logged in session
-func updateInfraConfig(client *api.Client, loginReq *api.LoginRequest, loginRes *api.LoginResponse) error {
+func updateInfraConfig(client *api.Client, loginReq *api.LoginRequest, loginRes *api.LoginResponse, providerID uid.ID) error {
 	clientHostConfig := ClientHostConfig{
 		Current:       true,
+		ProviderID:    providerID,
 		PolymorphicID: loginRes.PolymorphicID,
 		Name:          loginRes.Name,
 		AccessKey:     loginRes.AccessKey,
 		Expires:       loginRes.Expires,
+		RefreshToken:  loginRes.RefreshToken,
+		ClientID:      loginReq.ClientID,
 	}
 
 	t, ok := client.HTTP.Transport.(*http.Transport)
@@ -260,10 +325,6 @@ func updateInfraConfig(client *api.Client, loginReq *api.LoginRequest, loginRes
 	}
 	clientHostConfig.SkipTLSVerify = t.TLSClientConfig.InsecureSkipVerify
 
-	if loginReq.OIDC != nil {
-		clientHostConfig.ProviderID = loginReq.OIDC.ProviderID
-	}
-
 	u, err := urlx.Parse(client.URL)
 	if err != nil {
 		return err
@@ -278,7 +339,7 @@ func updateInfraConfig(client *api.Client, loginReq *api.LoginRequest, loginRes
 }
 
 // TODO relogin(): Once relogin is revisited, delete finishLogin and use loginToInfra() instead
-func finishLogin(host string, skipTLSVerify bool, providerID uid.ID, loginRes *api.LoginResponse) error {
+func finishLogin(host string, skipTLSVerify bool, providerID uid.ID, clientID string, loginRes *api.LoginResponse) error {
 	fmt.Fprintf(os.Stderr, "  Logged in as %s\n", termenv.String(loginRes.Name).Bold().String())
 
 	config, err := readConfig()
@@ -298,6 +359,9 @@ func finishLogin(host string, skipTLSVerify bool, providerID uid.ID, loginRes *a
 	hostConfig.Name = loginRes.Name
 	hostConfig.ProviderID = providerID
 	hostConfig.AccessKey = loginRes.AccessKey
+	hostConfig.Expires = loginRes.Expires
+	hostConfig.RefreshToken = loginRes.RefreshToken
+	hostConfig.ClientID = clientID
 	hostConfig.SkipTLSVerify = skipTLSVerify
 
 	var found bool
@@ -334,6 +398,18 @@ func finishLogin(host string, skipTLSVerify bool, providerID uid.ID, loginRes *a
 	return nil
 }
 
+// loginClientID returns the identifier this client uses to refresh sessions with the server,
+// reusing the one from a previous login to the same server.
+func loginClientID(server string) (string, error) {
+	if u, err := urlx.Parse(server); err == nil {
+		if hostConfig, err := readHostConfig(u.Host); err == nil && hostConfig.ClientID != "" {
+			return hostConfig.ClientID, nil
+		}
+	}
+
+	return generate.CryptoRandom(32)
+}
+
 func isNonInteractiveMode() bool {
 	return rootOptions.NonInteractive || os.Stdin == nil || !term.IsTerminal(int(os.Stdin.Fd()))
 }
@@ -418,6 +494,82 @@ func loginToProvider(provider *api.Provider) (*api.LoginRequestOIDC, error) {
 	}, nil
 }
 
+// Asks the server for a device code, then waits for the user to approve it from another device
+func loginWithDevice(client *api.Client, provider *api.Provider, clientID string) (*api.LoginResponse, error) {
+	deviceFlow, err := client.StartDeviceFlow(&api.StartDeviceFlowRequest{ProviderID: provider.ID, ClientID: clientID})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "  Logging in with %s...\n", termenv.String(provider.Name).Bold().String())
+	fmt.Fprintf(os.Stderr, "  On any device, visit %s and enter the code %s\n", deviceFlow.VerificationURI, termenv.String(deviceFlow.UserCode).Bold().String())
+	fmt.Fprintf(os.Stderr, "  or open %s\n", deviceFlow.VerificationURIComplete)
+
+	interval := time.Duration(deviceFlow.Interval) * time.Second
+
+	for {
+		time.Sleep(interval)
+
+		status, err := client.GetDeviceFlowStatus(&api.DeviceFlowStatusRequest{DeviceCode: deviceFlow.DeviceCode})
+		if err != nil {
+			return nil, err
+		}
+
+		switch status.Status {
+		case api.DeviceFlowStatusPending:
+		case api.DeviceFlowStatusSlowDown:
+			interval += 5 * time.Second
+		case api.DeviceFlowStatusDenied:
+			//lint:ignore ST1005, user facing error
+			return nil, fmt.Errorf("Login was denied")
+		case api.DeviceFlowStatusExpired:
+			//lint:ignore ST1005, user facing error
+			return nil, fmt.Errorf("Login code expired, run 'infra login --device' to try again")
+		case api.DeviceFlowStatusApproved:
+			return status.Login, nil
+		default:
+			return nil, fmt.Errorf("unexpected device login status %q", status.Status)
+		}
+	}
+}
+
+// Returns the named provider, or asks the user to pick one to approve a device login with
+func promptDeviceLoginProvider(client *api.Client, providerName string) (*api.Provider, error) {
+	if providerName != "" {
+		return GetProviderByName(client, providerName)
+	}
+
+	if isNonInteractiveMode() {
+		return nil, fmt.Errorf("Non-interactive device login requires a provider, instead run: 'infra login SERVER --device --provider NAME'")
+	}
+
+	providers, err := listProviders(client)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("Device login requires an identity provider, none are configured")
+	}
+
+	var options []string
+	for _, p := range providers {
+		options = append(options, fmt.Sprintf("%s (%s)", p.Name, p.URL))
+	}
+
+	var i int
+	selectPrompt := &survey.Select{
+		Message: "Select an identity provider:",
+		Options: options,
+	}
+
+	if err := survey.AskOne(selectPrompt, &i, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr)); err != nil {
+		return nil, err
+	}
+
+	return &providers[i], nil
+}
+
 func runSetupForLogin(client *api.Client) (string, error) {
 	setupRes, err := client.Setup()
 	if err != nil {
@@ -526,6 +678,40 @@ func promptAccessKeyLogin() (string, error) {
 	return accessKey, nil
 }
 
+// promptBreakGlassLogin asks for both halves of the secret of a break-glass account. Unlocking it alerts everyone
+// the server notifies, so this is only for emergencies.
+func promptBreakGlassLogin(name string) (*api.LoginRequestBreakGlass, error) {
+	if isNonInteractiveMode() {
+		return nil, fmt.Errorf("Non-interactive login is not supported for break-glass accounts")
+	}
+
+	fmt.Fprintf(os.Stderr, "  Unlocking break-glass account %s. Every use of it is audited and alerted.\n", termenv.String(name).Bold().String())
+
+	var secrets struct {
+		First  string
+		Second string
+	}
+
+	questionPrompt := []*survey.Question{
+		{
+			Name:     "First",
+			Prompt:   &survey.Password{Message: " First half of the secret:"},
+			Validate: survey.Required,
+		},
+		{
+			Name:     "Second",
+			Prompt:   &survey.Password{Message: "Second half of the secret:"},
+			Validate: survey.Required,
+		},
+	}
+
+	if err := survey.Ask(questionPrompt, &secrets, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr)); err != nil {
+		return nil, err
+	}
+
+	return &api.LoginRequestBreakGlass{Name: name, Secrets: []string{secrets.First, secrets.Second}}, nil
+}
+
 func listProviders(client *api.Client) ([]api.Provider, error) {
 	providers, err := client.ListProviders("")
 	if err != nil {
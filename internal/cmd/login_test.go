@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+)
+
+func TestDefaultAPIClientRefreshesSession(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("USERPROFILE", homeDir) // for windows
+
+	expires := time.Now().Add(15 * time.Minute).UTC().Truncate(time.Second)
+
+	handler := func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/login" {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var loginReq api.LoginRequest
+		if err := json.NewDecoder(req.Body).Decode(&loginReq); err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if loginReq.RefreshToken != "the-refresh-token" || loginReq.ClientID != "the-client" {
+			resp.WriteHeader(http.StatusUnauthorized)
+			_, _ = resp.Write([]byte(`{}`))
+			return
+		}
+
+		resp.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(resp).Encode(&api.LoginResponse{
+			Name:         "alice@example.com",
+			AccessKey:    "the-new-access-key",
+			RefreshToken: "the-next-refresh-token",
+			Expires:      api.Time(expires),
+		})
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(handler))
+	t.Cleanup(srv.Close)
+
+	writeHost := func(t *testing.T, refreshToken string) {
+		err := writeConfig(&ClientConfig{
+			Version: "0.3",
+			Hosts: []ClientHostConfig{
+				{
+					Name:          "alice@example.com",
+					Host:          srv.Listener.Addr().String(),
+					AccessKey:     "the-expired-access-key",
+					SkipTLSVerify: true,
+					Expires:       api.Time(time.Now().Add(-time.Minute)),
+					Current:       true,
+					RefreshToken:  refreshToken,
+					ClientID:      "the-client",
+				},
+			},
+		})
+		assert.NilError(t, err)
+	}
+
+	t.Run("refreshed", func(t *testing.T) {
+		writeHost(t, "the-refresh-token")
+
+		assert.NilError(t, mustBeLoggedIn())
+
+		client, err := defaultAPIClient()
+		assert.NilError(t, err)
+		assert.Equal(t, client.AccessKey, "the-new-access-key")
+
+		hostConfig, err := currentHostConfig()
+		assert.NilError(t, err)
+		assert.Equal(t, hostConfig.AccessKey, "the-new-access-key")
+		assert.Equal(t, hostConfig.RefreshToken, "the-next-refresh-token")
+		assert.Equal(t, time.Time(hostConfig.Expires).UTC(), expires)
+	})
+
+	t.Run("refresh rejected", func(t *testing.T) {
+		writeHost(t, "a-revoked-refresh-token")
+
+		_, err := defaultAPIClient()
+		assert.ErrorContains(t, err, "Session expired")
+	})
+}
@@ -38,6 +38,14 @@ func logout(purge bool) error {
 
 	for i, hostConfig := range config.Hosts {
 		config.Hosts[i].AccessKey = ""
+		config.Hosts[i].RefreshToken = ""
+
+		if hostConfig.isExpired() && hostConfig.isRefreshable() {
+			// the session needs a valid access key to be revoked
+			if err := refreshSession(&hostConfig); err != nil {
+				logging.S.Debugf("refresh session before logout: %v", err)
+			}
+		}
 
 		client, err := apiClient(hostConfig.Host, hostConfig.AccessKey, hostConfig.SkipTLSVerify)
 		if err != nil {
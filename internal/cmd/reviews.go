@@ -0,0 +1,377 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+func newReviewsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "reviews",
+		Short:   "Review and recertify access",
+		Aliases: []string{"review"},
+		Group:   "Management commands:",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return mustBeLoggedIn()
+		},
+	}
+
+	cmd.AddCommand(newReviewsListCmd())
+	cmd.AddCommand(newReviewsCreateCmd())
+	cmd.AddCommand(newReviewsItemsCmd())
+	cmd.AddCommand(newReviewsDecideCmd())
+	cmd.AddCommand(newReviewsCloseCmd())
+	cmd.AddCommand(newReviewsExportCmd())
+
+	return cmd
+}
+
+func newReviewsListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List access reviews",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var options struct {
+				Status string `mapstructure:"status"`
+			}
+
+			if err := parseOptions(cmd, &options, "INFRA_REVIEWS"); err != nil {
+				return err
+			}
+
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			reviews, err := client.ListReviews(api.ListReviewsRequest{Status: options.Status})
+			if err != nil {
+				return err
+			}
+
+			type row struct {
+				Name      string `header:"NAME"`
+				Status    string `header:"STATUS"`
+				Resource  string `header:"RESOURCE"`
+				Privilege string `header:"ACCESS"`
+				Subjects  string `header:"SUBJECTS"`
+			}
+
+			var rows []row
+			for _, r := range reviews {
+				rows = append(rows, row{
+					Name:      r.Name,
+					Status:    r.Status,
+					Resource:  valueOr(r.Resource, "all"),
+					Privilege: valueOr(r.Privilege, "all"),
+					Subjects:  valueOr(r.SubjectKind, "all"),
+				})
+			}
+
+			if len(rows) > 0 {
+				printTable(rows)
+			} else {
+				fmt.Println("No reviews found")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("status", "", "Filter by status, open or closed")
+
+	return cmd
+}
+
+type reviewsCreateOptions struct {
+	Reviewers   []string `mapstructure:"reviewer"`
+	Resource    string   `mapstructure:"resource"`
+	Role        string   `mapstructure:"role"`
+	SubjectKind string   `mapstructure:"subjectKind"`
+}
+
+func newReviewsCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Start a review of grants",
+		Long: `Start a review of the grants that match the filters.
+
+The grants are copied into the review as they are now. Reviewers decide to keep
+or revoke each of them, and the grants they revoke are deleted when the review
+is closed.`,
+		Example: `
+# Review every grant on the production cluster
+$ infra reviews create 2022-q3 --resource kubernetes.production --reviewer manager@example.com
+
+# Review the admins of Infra
+$ infra reviews create admins-2022-q3 --resource infra --role admin --reviewer security@example.com
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var options reviewsCreateOptions
+			if err := parseOptions(cmd, &options, "INFRA_REVIEWS"); err != nil {
+				return err
+			}
+
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			req := &api.CreateReviewRequest{
+				Name:        args[0],
+				Resource:    options.Resource,
+				Privilege:   options.Role,
+				SubjectKind: options.SubjectKind,
+			}
+
+			for _, name := range options.Reviewers {
+				identityType, err := getIdentityType(name, false)
+				if err != nil {
+					return err
+				}
+
+				subject, err := getIDByName(client, name, identityType)
+				if err != nil {
+					return err
+				}
+
+				id, err := subject.ID()
+				if err != nil {
+					return err
+				}
+
+				req.Reviewers = append(req.Reviewers, id)
+			}
+
+			review, err := client.CreateReview(req)
+			if err != nil {
+				return err
+			}
+
+			items, err := client.ListReviewItems(review.ID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Started review %s of %d grants\n", review.Name, len(items))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSlice("reviewer", nil, "Identity that reviews the grants, may be repeated")
+	cmd.Flags().String("resource", "", "Review the grants on the resource and the resources under it")
+	cmd.Flags().String("role", "", "Review the grants of the role")
+	cmd.Flags().String("subject-kind", "", "Review the grants to identities or to groups")
+
+	if err := cmd.MarkFlagRequired("reviewer"); err != nil {
+		panic("cannot set flag [--reviewer] as required")
+	}
+
+	return cmd
+}
+
+func newReviewsItemsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "items REVIEW",
+		Short: "List the grants in a review, and the decisions on them",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			review, err := getReviewByName(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			items, err := client.ListReviewItems(review.ID)
+			if err != nil {
+				return err
+			}
+
+			type row struct {
+				ID       string `header:"ITEM"`
+				Identity string `header:"IDENTITY"`
+				Access   string `header:"ACCESS"`
+				Resource string `header:"RESOURCE"`
+				Decision string `header:"DECISION"`
+				Comment  string `header:"COMMENT"`
+			}
+
+			var rows []row
+			for _, item := range items {
+				rows = append(rows, row{
+					ID:       item.ID.String(),
+					Identity: valueOr(item.SubjectName, item.Subject.String()),
+					Access:   item.Privilege,
+					Resource: item.Resource,
+					Decision: item.Decision,
+					Comment:  item.Comment,
+				})
+			}
+
+			if len(rows) > 0 {
+				printTable(rows)
+			} else {
+				fmt.Println("No grants in review")
+			}
+
+			return nil
+		},
+	}
+}
+
+func newReviewsDecideCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "decide REVIEW ITEM DECISION",
+		Short: "Decide to keep or revoke a grant in a review",
+		Example: `
+# Keep a grant
+$ infra reviews decide 2022-q3 5dUVtjrNcF keep
+
+# Revoke a grant when the review closes
+$ infra reviews decide 2022-q3 6hjkPQrsTu revoke --comment "left the team"
+`,
+		Args: cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var options struct {
+				Comment string `mapstructure:"comment"`
+			}
+
+			if err := parseOptions(cmd, &options, "INFRA_REVIEWS"); err != nil {
+				return err
+			}
+
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			review, err := getReviewByName(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			id, err := uid.Parse([]byte(args[1]))
+			if err != nil {
+				return fmt.Errorf("invalid item %q: %w", args[1], err)
+			}
+
+			item, err := client.UpdateReviewItem(api.UpdateReviewItemRequest{ReviewID: review.ID, ID: id, Decision: args[2], Comment: options.Comment})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Decided to %s %s on %s for %s\n", item.Decision, item.Privilege, item.Resource, valueOr(item.SubjectName, item.Subject.String()))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("comment", "", "Reason for the decision")
+
+	return cmd
+}
+
+func newReviewsCloseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "close REVIEW",
+		Short: "Close a review, revoking the grants decided to be revoked",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			review, err := getReviewByName(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			if _, err := client.UpdateReview(api.UpdateReviewRequest{ID: review.ID, Status: "closed"}); err != nil {
+				return err
+			}
+
+			fmt.Printf("Closed review %s\n", review.Name)
+
+			return nil
+		},
+	}
+}
+
+func newReviewsExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export REVIEW",
+		Short: "Export a review and its decisions as evidence",
+		Example: `
+# Export a review as csv
+$ infra reviews export 2022-q3 --format csv > 2022-q3.csv
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var options struct {
+				Format string `mapstructure:"format"`
+			}
+
+			if err := parseOptions(cmd, &options, "INFRA_REVIEWS"); err != nil {
+				return err
+			}
+
+			client, err := defaultAPIClient()
+			if err != nil {
+				return err
+			}
+
+			review, err := getReviewByName(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			evidence, err := client.ExportReview(review.ID, options.Format)
+			if err != nil {
+				return err
+			}
+
+			_, err = os.Stdout.Write(evidence)
+
+			return err
+		},
+	}
+
+	cmd.Flags().String("format", "json", "Format of the evidence, json or csv")
+
+	return cmd
+}
+
+func getReviewByName(client *api.Client, name string) (*api.Review, error) {
+	reviews, err := client.ListReviews(api.ListReviewsRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reviews) == 0 {
+		return nil, fmt.Errorf("No review of name %s exists", name)
+	}
+
+	return &reviews[0], nil
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
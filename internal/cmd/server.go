@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"os"
 	"time"
 
 	"github.com/iancoleman/strcase"
@@ -19,65 +20,139 @@ func newServerCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			logging.SetServerLogger()
 
-			// override default strcase.ToLowerCamel behaviour
-			strcase.ConfigureAcronym("enable-ui", "enableUI")
-			strcase.ConfigureAcronym("ui-proxy-url", "uiProxyURL")
-
-			options := defaultServerOptions()
-			if err := parseOptions(cmd, &options, "INFRA_SERVER"); err != nil {
+			options, err := serverOptions(cmd)
+			if err != nil {
 				return err
 			}
 
-			tlsCache, err := canonicalPath(options.TLSCache)
+			srv, err := server.New(options)
 			if err != nil {
 				return err
 			}
+			return srv.Run(context.Background())
+		},
+	}
+
+	// the subcommands open the server's database, so they take the same options
+	cmd.PersistentFlags().StringP("config-file", "f", "", "Server configuration file")
+	cmd.PersistentFlags().String("admin-access-key", "", "Admin access key (secret)")
+	cmd.PersistentFlags().String("access-key", "", "Access key (secret)")
+	cmd.PersistentFlags().String("tls-cache", "$HOME/.infra/cache", "Directory to cache TLS certificates")
+	cmd.PersistentFlags().String("db-file", "$HOME/.infra/sqlite3.db", "Path to SQLite 3 database")
+	cmd.PersistentFlags().String("db-name", "", "Database name")
+	cmd.PersistentFlags().String("db-host", "", "Database host")
+	cmd.PersistentFlags().Int("db-port", 0, "Database port")
+	cmd.PersistentFlags().String("db-username", "", "Database username")
+	cmd.PersistentFlags().String("db-password", "", "Database password (secret)")
+	cmd.PersistentFlags().String("db-parameters", "", "Database additional connection parameters")
+	cmd.PersistentFlags().String("db-encryption-key", "$HOME/.infra/sqlite3.db.key", "Database encryption key")
+	cmd.PersistentFlags().String("db-encryption-key-provider", "native", "Database encryption key provider")
+	cmd.PersistentFlags().Bool("enable-telemetry", true, "Enable telemetry")
+	cmd.PersistentFlags().Bool("enable-crash-reporting", true, "Enable crash reporting")
+	cmd.PersistentFlags().Bool("enable-ui", false, "Enable Infra server UI")
+	cmd.PersistentFlags().String("ui-proxy-url", "", "Proxy upstream UI requests to this url")
+	cmd.PersistentFlags().Duration("session-duration", time.Hour*12, "User session duration")
+	cmd.PersistentFlags().Duration("access-key-duration", time.Minute*15, "Access key duration for refreshable sessions")
+	cmd.PersistentFlags().Bool("enable-setup", true, "Enable one-time setup")
+	cmd.PersistentFlags().StringSlice("trusted-proxies", nil, "Addresses or CIDRs of proxies trusted to forward the client address")
+	cmd.PersistentFlags().String("recordings-dir", "$HOME/.infra/recordings", "Directory to store session recordings")
+
+	cmd.AddCommand(newServerBackupCmd())
+	cmd.AddCommand(newServerRestoreCmd())
+
+	return cmd
+}
+
+func newServerBackupCmd() *cobra.Command {
+	var keyProvider, rootKeyID string
 
-			options.TLSCache = tlsCache
+	cmd := &cobra.Command{
+		Use:   "backup FILE",
+		Short: "Back up the Infra server database",
+		Long: `Back up the Infra server database to an archive, which can be restored to a database of either driver.
+
+Secret fields are sealed with a key generated from the root key of the key provider, which default
+to the database encryption key. The server restoring the archive needs access to the same root key.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logging.SetServerLogger()
 
-			dbFile, err := canonicalPath(options.DBFile)
+			options, err := serverOptions(cmd)
 			if err != nil {
 				return err
 			}
 
-			options.DBFile = dbFile
-
-			dbEncryptionKey, err := canonicalPath(options.DBEncryptionKey)
+			// the archive holds access key checksums and sealed secrets
+			f, err := os.OpenFile(args[0], os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
 			if err != nil {
 				return err
 			}
+			defer f.Close()
 
-			options.DBEncryptionKey = dbEncryptionKey
+			if err := server.Backup(options, f, keyProvider, rootKeyID); err != nil {
+				return err
+			}
 
-			srv, err := server.New(options)
+			return f.Close()
+		},
+	}
+
+	cmd.Flags().StringVar(&keyProvider, "key-provider", "", "Key provider to seal secret fields for, defaults to the database encryption key provider")
+	cmd.Flags().StringVar(&rootKeyID, "root-key-id", "", "Root key to seal secret fields for, defaults to the database encryption key")
+
+	return cmd
+}
+
+func newServerRestoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore FILE",
+		Short: "Restore the Infra server database from a backup",
+		Long: `Restore the Infra server database from a backup, replacing its contents.
+
+The database may use a different driver than the one the backup was made from, to move from SQLite to
+Postgres. Restore while the server is stopped, or restart it after.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logging.SetServerLogger()
+
+			options, err := serverOptions(cmd)
 			if err != nil {
 				return err
 			}
-			return srv.Run(context.Background())
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			return server.Restore(options, f)
 		},
 	}
+}
 
-	cmd.Flags().StringP("config-file", "f", "", "Server configuration file")
-	cmd.Flags().String("admin-access-key", "", "Admin access key (secret)")
-	cmd.Flags().String("access-key", "", "Access key (secret)")
-	cmd.Flags().String("tls-cache", "$HOME/.infra/cache", "Directory to cache TLS certificates")
-	cmd.Flags().String("db-file", "$HOME/.infra/sqlite3.db", "Path to SQLite 3 database")
-	cmd.Flags().String("db-name", "", "Database name")
-	cmd.Flags().String("db-host", "", "Database host")
-	cmd.Flags().Int("db-port", 0, "Database port")
-	cmd.Flags().String("db-username", "", "Database username")
-	cmd.Flags().String("db-password", "", "Database password (secret)")
-	cmd.Flags().String("db-parameters", "", "Database additional connection parameters")
-	cmd.Flags().String("db-encryption-key", "$HOME/.infra/sqlite3.db.key", "Database encryption key")
-	cmd.Flags().String("db-encryption-key-provider", "native", "Database encryption key provider")
-	cmd.Flags().Bool("enable-telemetry", true, "Enable telemetry")
-	cmd.Flags().Bool("enable-crash-reporting", true, "Enable crash reporting")
-	cmd.Flags().Bool("enable-ui", false, "Enable Infra server UI")
-	cmd.Flags().String("ui-proxy-url", "", "Proxy upstream UI requests to this url")
-	cmd.Flags().Duration("session-duration", time.Hour*12, "User session duration")
-	cmd.Flags().Bool("enable-setup", true, "Enable one-time setup")
+// serverOptions reads the server's options from its flags, environment and configuration file
+func serverOptions(cmd *cobra.Command) (server.Options, error) {
+	// override default strcase.ToLowerCamel behaviour
+	strcase.ConfigureAcronym("enable-ui", "enableUI")
+	strcase.ConfigureAcronym("ui-proxy-url", "uiProxyURL")
 
-	return cmd
+	options := defaultServerOptions()
+	if err := parseOptions(cmd, &options, "INFRA_SERVER"); err != nil {
+		return options, err
+	}
+
+	paths := []*string{&options.TLSCache, &options.DBFile, &options.DBEncryptionKey, &options.RecordingsDir}
+	for _, p := range paths {
+		path, err := canonicalPath(*p)
+		if err != nil {
+			return options, err
+		}
+
+		*p = path
+	}
+
+	return options, nil
 }
 
 func defaultServerOptions() server.Options {
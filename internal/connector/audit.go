@@ -0,0 +1,286 @@
+package connector
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/logging"
+)
+
+const (
+	// auditBatchSize is the most records shipped to the server in one request
+	auditBatchSize = 500
+	// auditMaxBuffered is how many records are kept in memory before they are written to the spool
+	auditMaxBuffered = 5000
+	// auditMaxSpooled is how many records the spool keeps while the server is unreachable, the oldest are dropped first
+	auditMaxSpooled = 100000
+)
+
+// auditor collects a record of each request proxied to the Kubernetes API server, and ships them to the
+// server in batches. Records that can not be shipped are written to a spool file, and sent with the next batch.
+type auditor struct {
+	mu          sync.Mutex
+	destination string
+	spool       string
+	records     []api.KubernetesAuditRecord
+}
+
+func newAuditor(destination, spool string) *auditor {
+	return &auditor{destination: destination, spool: spool}
+}
+
+func (a *auditor) add(record api.KubernetesAuditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.records = append(a.records, record)
+
+	if len(a.records) >= auditMaxBuffered {
+		a.records = a.keep(a.records)
+	}
+}
+
+// keep writes records to the spool, and returns the records that must stay buffered because the spool
+// could not be written. Only the most recent records are buffered. The caller must hold the lock.
+func (a *auditor) keep(records []api.KubernetesAuditRecord) []api.KubernetesAuditRecord {
+	err := a.writeSpool(records)
+	if err == nil {
+		return nil
+	}
+
+	if len(records) >= auditMaxBuffered {
+		logging.S.Errorf("spooling audit records, dropping %d records: %v", len(records)-auditMaxBuffered+1, err)
+		records = records[len(records)-auditMaxBuffered+1:]
+	}
+
+	return records
+}
+
+// flush ships the spooled and buffered records, and spools whatever could not be shipped
+func (a *auditor) flush(client *api.Client) error {
+	a.mu.Lock()
+	records, err := a.takeSpool()
+	if err != nil {
+		a.mu.Unlock()
+		return fmt.Errorf("read audit spool: %w", err)
+	}
+
+	records = append(records, a.records...)
+	a.records = nil
+	a.mu.Unlock()
+
+	for len(records) > 0 {
+		n := len(records)
+		if n > auditBatchSize {
+			n = auditBatchSize
+		}
+
+		err := client.CreateKubernetesAuditRecords(&api.CreateKubernetesAuditRecordsRequest{
+			Destination: a.destination,
+			Records:     records[:n],
+		})
+		if err != nil {
+			a.mu.Lock()
+			a.records = a.keep(append(records, a.records...))
+			a.mu.Unlock()
+
+			return fmt.Errorf("ship audit records: %w", err)
+		}
+
+		records = records[n:]
+	}
+
+	return nil
+}
+
+// writeSpool appends records to the spool. The caller must hold the lock.
+func (a *auditor) writeSpool(records []api.KubernetesAuditRecord) error {
+	if a.spool == "" {
+		return errors.New("no audit spool configured")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.spool), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(a.spool, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// takeSpool reads and removes the spooled records, keeping only the most recent when the spool is full.
+// The caller must hold the lock.
+func (a *auditor) takeSpool() ([]api.KubernetesAuditRecord, error) {
+	if a.spool == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(a.spool)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []api.KubernetesAuditRecord
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var record api.KubernetesAuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logging.S.Warnf("skipping invalid spooled audit record: %v", err)
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(a.spool); err != nil {
+		return nil, err
+	}
+
+	if len(records) > auditMaxSpooled {
+		logging.S.Warnf("audit spool is full, dropping %d records", len(records)-auditMaxSpooled)
+		records = records[len(records)-auditMaxSpooled:]
+	}
+
+	return records, nil
+}
+
+// auditMiddleware records each request after it was proxied
+func auditMiddleware(a *auditor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		name, _ := c.Value("name").(string)
+		if name == "" {
+			// the request was rejected before it was proxied
+			return
+		}
+
+		groups, _ := c.Value("groups").([]string)
+
+		record := kubernetesRequestInfo(c.Request.Method, c.Request.URL)
+		record.Time = api.Time(start.UTC())
+		record.Destination = a.destination
+		record.Identity = name
+		record.Groups = groups
+		record.Code = c.Writer.Status()
+		record.Latency = api.Duration(time.Since(start))
+
+		a.add(record)
+	}
+}
+
+// kubernetesRequestInfo parses the verb and resource of a Kubernetes API request from its path, e.g.
+// /apis/apps/v1/namespaces/default/deployments/web/scale. Requests that are not for a resource, such as
+// discovery, only have a verb and path.
+func kubernetesRequestInfo(method string, u *url.URL) api.KubernetesAuditRecord {
+	info := api.KubernetesAuditRecord{
+		Verb: strings.ToLower(method),
+		Path: u.Path,
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	var rest []string
+
+	switch {
+	case parts[0] == "api" && len(parts) > 2:
+		rest = parts[2:]
+	case parts[0] == "apis" && len(parts) > 3:
+		info.APIGroup = parts[1]
+		rest = parts[3:]
+	default:
+		return info
+	}
+
+	watch := false
+	if rest[0] == "watch" {
+		watch = true
+		rest = rest[1:]
+	}
+
+	if len(rest) > 2 && rest[0] == "namespaces" {
+		info.Namespace = rest[1]
+		rest = rest[2:]
+	}
+
+	if len(rest) == 0 {
+		return info
+	}
+
+	info.Resource = rest[0]
+
+	if len(rest) > 1 {
+		info.Name = rest[1]
+	}
+
+	if len(rest) > 2 {
+		info.Subresource = strings.Join(rest[2:], "/")
+	}
+
+	if query := u.Query().Get("watch"); query == "true" || query == "1" {
+		watch = true
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		switch {
+		case watch:
+			info.Verb = "watch"
+		case info.Name != "":
+			info.Verb = "get"
+		default:
+			info.Verb = "list"
+		}
+	case http.MethodPost:
+		info.Verb = "create"
+	case http.MethodPut:
+		info.Verb = "update"
+	case http.MethodPatch:
+		info.Verb = "patch"
+	case http.MethodDelete:
+		if info.Name != "" {
+			info.Verb = "delete"
+		} else {
+			info.Verb = "deletecollection"
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,138 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+)
+
+func TestKubernetesRequestInfo(t *testing.T) {
+	type testCase struct {
+		method   string
+		path     string
+		expected api.KubernetesAuditRecord
+	}
+
+	testCases := []testCase{
+		{
+			method:   http.MethodGet,
+			path:     "/api/v1/namespaces/default/pods",
+			expected: api.KubernetesAuditRecord{Verb: "list", Resource: "pods", Namespace: "default"},
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/v1/namespaces/default/pods/web/log",
+			expected: api.KubernetesAuditRecord{Verb: "get", Resource: "pods", Subresource: "log", Namespace: "default", Name: "web"},
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/v1/namespaces/default/pods?watch=true",
+			expected: api.KubernetesAuditRecord{Verb: "watch", Resource: "pods", Namespace: "default"},
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/v1/watch/namespaces/default/pods",
+			expected: api.KubernetesAuditRecord{Verb: "watch", Resource: "pods", Namespace: "default"},
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/v1/namespaces/kube-system",
+			expected: api.KubernetesAuditRecord{Verb: "get", Resource: "namespaces", Name: "kube-system"},
+		},
+		{
+			method:   http.MethodPatch,
+			path:     "/apis/apps/v1/namespaces/default/deployments/web/scale",
+			expected: api.KubernetesAuditRecord{Verb: "patch", APIGroup: "apps", Resource: "deployments", Subresource: "scale", Namespace: "default", Name: "web"},
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/apis/rbac.authorization.k8s.io/v1/clusterroles",
+			expected: api.KubernetesAuditRecord{Verb: "create", APIGroup: "rbac.authorization.k8s.io", Resource: "clusterroles"},
+		},
+		{
+			method:   http.MethodDelete,
+			path:     "/api/v1/namespaces/default/configmaps",
+			expected: api.KubernetesAuditRecord{Verb: "deletecollection", Resource: "configmaps", Namespace: "default"},
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/apis/apps/v1",
+			expected: api.KubernetesAuditRecord{Verb: "get"},
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/version",
+			expected: api.KubernetesAuditRecord{Verb: "get"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			u, err := url.Parse(tc.path)
+			assert.NilError(t, err)
+
+			tc.expected.Path = u.Path
+
+			assert.DeepEqual(t, kubernetesRequestInfo(tc.method, u), tc.expected)
+		})
+	}
+}
+
+func TestAuditorSpoolsWhenServerUnreachable(t *testing.T) {
+	available := false
+	var received []api.KubernetesAuditRecord
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		req := &api.CreateKubernetesAuditRecordsRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		assert.Equal(t, req.Destination, "kubernetes.test")
+		received = append(received, req.Records...)
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := &api.Client{URL: srv.URL}
+	spool := filepath.Join(t.TempDir(), "audit.spool")
+
+	a := newAuditor("kubernetes.test", spool)
+	a.add(api.KubernetesAuditRecord{Identity: "alice@example.com", Verb: "get"})
+
+	err := a.flush(client)
+	assert.ErrorContains(t, err, "ship audit records")
+	assert.Assert(t, a.records == nil)
+
+	_, err = os.Stat(spool)
+	assert.NilError(t, err)
+
+	available = true
+
+	a.add(api.KubernetesAuditRecord{Identity: "bob@example.com", Verb: "delete"})
+
+	err = a.flush(client)
+	assert.NilError(t, err)
+	assert.Equal(t, len(received), 2)
+	assert.Equal(t, received[0].Identity, "alice@example.com")
+	assert.Equal(t, received[1].Identity, "bob@example.com")
+
+	_, err = os.Stat(spool)
+	assert.Assert(t, os.IsNotExist(err))
+}
@@ -0,0 +1,298 @@
+package connector
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/kubernetes"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// Modes the connector enforces grants in
+const (
+	// AuthorizationModeRoleBinding writes a role binding in the cluster for each grant
+	AuthorizationModeRoleBinding = "rolebinding"
+	// AuthorizationModeWebhook answers the API server's SubjectAccessReview webhook requests
+	AuthorizationModeWebhook = "webhook"
+)
+
+// authorizationGrant is a grant of a role, with the name of its subject resolved. In a namespace, the role is a
+// Role in the namespace when one exists by that name, or a ClusterRole otherwise.
+type authorizationGrant struct {
+	subject     rbacv1.Subject
+	clusterRole string
+	namespace   string // empty for grants to the whole cluster
+
+	// deny grants deny the requests their role covers, or every request for a role of *
+	deny bool
+}
+
+// authorizer decides SubjectAccessReviews from a snapshot of the grants for the destination, and the rules of
+// the roles they grant. The snapshot is refreshed by the connector, and kept while the server is unreachable.
+type authorizer struct {
+	mu        sync.RWMutex
+	loaded    bool
+	grants    []authorizationGrant
+	rules     map[string][]rbacv1.PolicyRule
+	roleRules map[string]map[string][]rbacv1.PolicyRule // by namespace and role
+}
+
+// refresh replaces the snapshot with the current grants and roles, and returns the grants that have no effect
+func (a *authorizer) refresh(client *api.Client, k8s *kubernetes.Kubernetes, destination *api.Destination) ([]api.SkippedGrant, error) {
+	grants, err := listGrants(client, k8s, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := k8s.ClusterRoleRules()
+	if err != nil {
+		return nil, fmt.Errorf("list cluster roles: %w", err)
+	}
+
+	roleRules, err := k8s.RoleRules()
+	if err != nil {
+		return nil, fmt.Errorf("list roles: %w", err)
+	}
+
+	var (
+		snapshot []authorizationGrant
+		skipped  []api.SkippedGrant
+	)
+
+	for _, g := range grants {
+		if g.Privilege == "connect" {
+			continue
+		}
+
+		subj, err := grantSubject(client, g)
+		if err != nil {
+			return nil, err
+		}
+
+		grant := authorizationGrant{subject: subj, clusterRole: g.Privilege, deny: g.Deny}
+
+		parts := strings.Split(g.Resource, ".")
+
+		switch len(parts) {
+		// kubernetes.<cluster>
+		case 2:
+			if _, ok := rules[g.Privilege]; !ok && !g.Deny {
+				skipped = append(skipped, skippedGrant(g, fmt.Sprintf("cluster role %q does not exist", g.Privilege)))
+				continue
+			}
+		// kubernetes.<cluster>.<namespace>
+		case 3:
+			grant.namespace = parts[2]
+
+			_, isRole := roleRules[grant.namespace][g.Privilege]
+			if _, ok := rules[g.Privilege]; !ok && !isRole && !g.Deny {
+				skipped = append(skipped, skippedGrant(g, fmt.Sprintf("no role %q exists in namespace %q, and no cluster role by that name", g.Privilege, grant.namespace)))
+				continue
+			}
+		default:
+			logging.S.Warnf("invalid grant resource: %s", g.Resource)
+			skipped = append(skipped, skippedGrant(g, "invalid resource"))
+
+			continue
+		}
+
+		snapshot = append(snapshot, grant)
+	}
+
+	a.update(snapshot, rules, roleRules)
+
+	sortSkippedGrants(skipped)
+
+	return skipped, nil
+}
+
+func (a *authorizer) update(grants []authorizationGrant, rules map[string][]rbacv1.PolicyRule, roleRules map[string]map[string][]rbacv1.PolicyRule) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.loaded = true
+	a.grants = grants
+	a.rules = rules
+	a.roleRules = roleRules
+}
+
+// grantRules are the rules of the role a grant is for, which like a role binding is a Role in the grant's namespace
+// when one exists by that name
+func (a *authorizer) grantRules(g authorizationGrant) []rbacv1.PolicyRule {
+	if g.namespace != "" {
+		if rules, ok := a.roleRules[g.namespace][g.clusterRole]; ok {
+			return rules
+		}
+	}
+
+	return a.rules[g.clusterRole]
+}
+
+// authorize denies a request when a deny grant to the user, or one of their groups, covers it, and otherwise allows
+// it when a grant to them has a rule that covers it. Deny beats allow. Other requests get no opinion, so the API
+// server can consult its other authorizers.
+func (a *authorizer) authorize(spec authorizationv1.SubjectAccessReviewSpec) authorizationv1.SubjectAccessReviewStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if !a.loaded {
+		return authorizationv1.SubjectAccessReviewStatus{EvaluationError: "grants have not been loaded from the server yet"}
+	}
+
+	for _, g := range a.grants {
+		if g.deny && a.covers(g, spec) {
+			return authorizationv1.SubjectAccessReviewStatus{
+				Denied: true,
+				Reason: fmt.Sprintf("infra deny grant of %s to %s %s", g.clusterRole, strings.ToLower(g.subject.Kind), g.subject.Name),
+			}
+		}
+	}
+
+	for _, g := range a.grants {
+		if !g.deny && a.covers(g, spec) {
+			return authorizationv1.SubjectAccessReviewStatus{
+				Allowed: true,
+				Reason:  fmt.Sprintf("infra grant of %s to %s %s", g.clusterRole, strings.ToLower(g.subject.Kind), g.subject.Name),
+			}
+		}
+	}
+
+	return authorizationv1.SubjectAccessReviewStatus{}
+}
+
+// covers checks if a grant is for the user of a request, or one of their groups, and its role has a rule that covers
+// the request. A deny of * covers every request in its namespace, or in the cluster.
+func (a *authorizer) covers(g authorizationGrant, spec authorizationv1.SubjectAccessReviewSpec) bool {
+	if !subjectMatches(g.subject, spec) {
+		return false
+	}
+
+	if g.namespace != "" {
+		// like a role binding, a namespace grant only covers resources in its namespace
+		if spec.ResourceAttributes == nil || spec.ResourceAttributes.Namespace != g.namespace {
+			return false
+		}
+	}
+
+	if g.deny && g.clusterRole == models.DenyAllPrivileges {
+		return true
+	}
+
+	for _, rule := range a.grantRules(g) {
+		if ruleAllows(rule, spec) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func subjectMatches(subject rbacv1.Subject, spec authorizationv1.SubjectAccessReviewSpec) bool {
+	switch subject.Kind {
+	case rbacv1.UserKind:
+		return subject.Name == spec.User
+	case rbacv1.GroupKind:
+		for _, g := range spec.Groups {
+			if g == subject.Name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ruleAllows matches a request against a policy rule the way Kubernetes RBAC does
+func ruleAllows(rule rbacv1.PolicyRule, spec authorizationv1.SubjectAccessReviewSpec) bool {
+	if attrs := spec.ResourceAttributes; attrs != nil {
+		resource := attrs.Resource
+		if attrs.Subresource != "" {
+			resource += "/" + attrs.Subresource
+		}
+
+		return matchesAny(rule.Verbs, attrs.Verb) &&
+			matchesAny(rule.APIGroups, attrs.Group) &&
+			resourceMatches(rule.Resources, resource, attrs.Subresource) &&
+			(len(rule.ResourceNames) == 0 || matchesAny(rule.ResourceNames, attrs.Name))
+	}
+
+	if attrs := spec.NonResourceAttributes; attrs != nil {
+		return matchesAny(rule.Verbs, attrs.Verb) && nonResourceURLMatches(rule.NonResourceURLs, attrs.Path)
+	}
+
+	return false
+}
+
+func matchesAny(values []string, value string) bool {
+	for _, v := range values {
+		if v == rbacv1.VerbAll || v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func resourceMatches(resources []string, resource, subresource string) bool {
+	for _, r := range resources {
+		switch {
+		case r == rbacv1.ResourceAll, r == resource:
+			return true
+		case subresource != "" && r == "*/"+subresource:
+			return true
+		}
+	}
+
+	return false
+}
+
+func nonResourceURLMatches(urls []string, path string) bool {
+	for _, u := range urls {
+		switch {
+		case u == rbacv1.NonResourceAll, u == path:
+			return true
+		case strings.HasSuffix(u, "*") && strings.HasPrefix(path, strings.TrimSuffix(u, "*")):
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorizationWebhook serves the SubjectAccessReview webhook the API server calls to authorize requests.
+// The API server authenticates with a bearer token in its webhook kubeconfig.
+func authorizationWebhook(a *authorizer, token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearer := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		review := &authorizationv1.SubjectAccessReview{}
+		if err := c.ShouldBindJSON(review); err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		if review.APIVersion != authorizationv1.SchemeGroupVersion.String() {
+			logging.S.Warnf("unsupported SubjectAccessReview version %q, configure the API server with --authorization-webhook-version=v1", review.APIVersion)
+			c.AbortWithStatus(http.StatusBadRequest)
+
+			return
+		}
+
+		review.Status = a.authorize(review.Spec)
+
+		c.JSON(http.StatusOK, review)
+	}
+}
@@ -0,0 +1,219 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gotest.tools/v3/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// subjectAccessReview is a request recorded from a kube-apiserver started with --authorization-webhook-version=v1
+func subjectAccessReview(user string, groups []string, attributes string) string {
+	raw, _ := json.Marshal(groups)
+
+	return `{"kind":"SubjectAccessReview","apiVersion":"authorization.k8s.io/v1","metadata":{"creationTimestamp":null},` +
+		`"spec":{` + attributes + `,"user":"` + user + `","groups":` + string(raw) + `},"status":{"allowed":false}}`
+}
+
+func TestAuthorizationWebhook(t *testing.T) {
+	authz := &authorizer{}
+
+	router := gin.New()
+	router.POST("/authorize", authorizationWebhook(authz, "webhook-token"))
+
+	review := func(t *testing.T, token, body string) (int, authorizationv1.SubjectAccessReviewStatus) {
+		req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusOK {
+			return resp.Code, authorizationv1.SubjectAccessReviewStatus{}
+		}
+
+		result := &authorizationv1.SubjectAccessReview{}
+		err := json.Unmarshal(resp.Body.Bytes(), result)
+		assert.NilError(t, err)
+		assert.Equal(t, result.Kind, "SubjectAccessReview")
+
+		return resp.Code, result.Status
+	}
+
+	listPods := subjectAccessReview("alice@example.com", []string{"system:authenticated"},
+		`"resourceAttributes":{"namespace":"default","verb":"list","version":"v1","resource":"pods"}`)
+
+	t.Run("grants not loaded", func(t *testing.T) {
+		code, status := review(t, "webhook-token", listPods)
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, status.Allowed, false)
+		assert.Assert(t, status.EvaluationError != "")
+	})
+
+	authz.update(
+		[]authorizationGrant{
+			{subject: rbacv1.Subject{Kind: rbacv1.UserKind, Name: "alice@example.com"}, clusterRole: "view"},
+			{subject: rbacv1.Subject{Kind: rbacv1.GroupKind, Name: "developers"}, clusterRole: "edit", namespace: "web"},
+			{subject: rbacv1.Subject{Kind: rbacv1.UserKind, Name: "carol@example.com"}, clusterRole: "cluster-admin"},
+			{subject: rbacv1.Subject{Kind: rbacv1.GroupKind, Name: "release"}, clusterRole: "deployer", namespace: "web"},
+			{subject: rbacv1.Subject{Kind: rbacv1.GroupKind, Name: "release"}, clusterRole: "deployer", namespace: "default"},
+			{subject: rbacv1.Subject{Kind: rbacv1.GroupKind, Name: "contractors"}, clusterRole: "*", namespace: "web", deny: true},
+			{subject: rbacv1.Subject{Kind: rbacv1.UserKind, Name: "carol@example.com"}, clusterRole: "view", deny: true},
+		},
+		map[string][]rbacv1.PolicyRule{
+			"view": {
+				{Verbs: []string{"get", "list", "watch"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}},
+				{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"settings"}},
+			},
+			"edit": {
+				{Verbs: []string{"*"}, APIGroups: []string{"apps"}, Resources: []string{"deployments", "*/scale"}},
+			},
+			"cluster-admin": {
+				{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}},
+				{Verbs: []string{"*"}, NonResourceURLs: []string{"*"}},
+			},
+		},
+		map[string]map[string][]rbacv1.PolicyRule{
+			"web": {
+				"deployer": {
+					{Verbs: []string{"update"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}},
+				},
+			},
+		},
+	)
+
+	type testCase struct {
+		name    string
+		body    string
+		allowed bool
+		denied  bool
+	}
+
+	testCases := []testCase{
+		{
+			name:    "cluster grant",
+			body:    listPods,
+			allowed: true,
+		},
+		{
+			name: "subresource",
+			body: subjectAccessReview("alice@example.com", nil,
+				`"resourceAttributes":{"namespace":"kube-system","verb":"get","version":"v1","resource":"pods","subresource":"log","name":"coredns"}`),
+			allowed: true,
+		},
+		{
+			name: "verb not in role",
+			body: subjectAccessReview("alice@example.com", nil,
+				`"resourceAttributes":{"namespace":"default","verb":"delete","version":"v1","resource":"pods","name":"web"}`),
+		},
+		{
+			name: "resource name",
+			body: subjectAccessReview("alice@example.com", nil,
+				`"resourceAttributes":{"namespace":"default","verb":"get","version":"v1","resource":"configmaps","name":"settings"}`),
+			allowed: true,
+		},
+		{
+			name: "other resource name",
+			body: subjectAccessReview("alice@example.com", nil,
+				`"resourceAttributes":{"namespace":"default","verb":"get","version":"v1","resource":"configmaps","name":"other"}`),
+		},
+		{
+			name: "group grant in namespace",
+			body: subjectAccessReview("bob@example.com", []string{"developers", "system:authenticated"},
+				`"resourceAttributes":{"namespace":"web","verb":"patch","group":"apps","version":"v1","resource":"deployments","name":"web"}`),
+			allowed: true,
+		},
+		{
+			name: "wildcard subresource",
+			body: subjectAccessReview("bob@example.com", []string{"developers"},
+				`"resourceAttributes":{"namespace":"web","verb":"update","group":"apps","version":"v1","resource":"deployments","subresource":"scale","name":"web"}`),
+			allowed: true,
+		},
+		{
+			name: "group grant in other namespace",
+			body: subjectAccessReview("bob@example.com", []string{"developers"},
+				`"resourceAttributes":{"namespace":"default","verb":"patch","group":"apps","version":"v1","resource":"deployments","name":"web"}`),
+		},
+		{
+			name: "namespace grant for cluster resource",
+			body: subjectAccessReview("bob@example.com", []string{"developers"},
+				`"resourceAttributes":{"verb":"list","group":"apps","version":"v1","resource":"deployments"}`),
+		},
+		{
+			name: "role in namespace",
+			body: subjectAccessReview("dave@example.com", []string{"release"},
+				`"resourceAttributes":{"namespace":"web","verb":"update","group":"apps","version":"v1","resource":"deployments","name":"web"}`),
+			allowed: true,
+		},
+		{
+			name: "role in other namespace",
+			body: subjectAccessReview("dave@example.com", []string{"release"},
+				`"resourceAttributes":{"namespace":"default","verb":"update","group":"apps","version":"v1","resource":"deployments","name":"web"}`),
+		},
+		{
+			name:    "non-resource url",
+			body:    subjectAccessReview("carol@example.com", nil, `"nonResourceAttributes":{"path":"/metrics","verb":"get"}`),
+			allowed: true,
+		},
+		{
+			name: "non-resource url not granted",
+			body: subjectAccessReview("alice@example.com", nil, `"nonResourceAttributes":{"path":"/metrics","verb":"get"}`),
+		},
+		{
+			name: "denied in namespace",
+			body: subjectAccessReview("bob@example.com", []string{"developers", "contractors"},
+				`"resourceAttributes":{"namespace":"web","verb":"patch","group":"apps","version":"v1","resource":"deployments","name":"web"}`),
+			denied: true,
+		},
+		{
+			name: "denied in other namespace",
+			body: subjectAccessReview("bob@example.com", []string{"developers", "contractors"},
+				`"resourceAttributes":{"namespace":"default","verb":"list","version":"v1","resource":"pods"}`),
+		},
+		{
+			name: "denied role",
+			body: subjectAccessReview("carol@example.com", nil,
+				`"resourceAttributes":{"namespace":"default","verb":"list","version":"v1","resource":"pods"}`),
+			denied: true,
+		},
+		{
+			name: "not in denied role",
+			body: subjectAccessReview("carol@example.com", nil,
+				`"resourceAttributes":{"namespace":"default","verb":"delete","version":"v1","resource":"pods","name":"web"}`),
+			allowed: true,
+		},
+		{
+			name: "no grants",
+			body: subjectAccessReview("system:serviceaccount:default:default", []string{"system:serviceaccounts"},
+				`"resourceAttributes":{"namespace":"default","verb":"list","version":"v1","resource":"pods"}`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, status := review(t, "webhook-token", tc.body)
+			assert.Equal(t, code, http.StatusOK)
+			assert.Equal(t, status.Allowed, tc.allowed)
+
+			// requests that are not granted or denied get no opinion, so other authorizers are consulted
+			assert.Equal(t, status.Denied, tc.denied)
+		})
+	}
+
+	t.Run("invalid token", func(t *testing.T) {
+		code, _ := review(t, "other-token", listPods)
+		assert.Equal(t, code, http.StatusUnauthorized)
+	})
+
+	t.Run("v1beta1", func(t *testing.T) {
+		code, _ := review(t, "webhook-token", strings.Replace(listPods, "authorization.k8s.io/v1", "authorization.k8s.io/v1beta1", 1))
+		assert.Equal(t, code, http.StatusBadRequest)
+	})
+}
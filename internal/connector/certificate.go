@@ -0,0 +1,211 @@
+package connector
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/logging"
+)
+
+// Issuers of the connector's serving certificate
+const (
+	// CertificateIssuerSelfSigned serves a self-signed or Let's Encrypt certificate, or the one configured, and
+	// clients trust it with a CA for each destination
+	CertificateIssuerSelfSigned = "self-signed"
+	// CertificateIssuerInfra serves a certificate signed by the Infra server, and clients trust it with the Infra CAs
+	CertificateIssuerInfra = "infra"
+)
+
+// certificateIssuer keeps the serving certificate issued by the Infra server, and renews it before it expires
+type certificateIssuer struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	ca   string
+	host string
+}
+
+func (i *certificateIssuer) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.cert == nil {
+		return nil, errors.New("serving certificate has not been issued yet")
+	}
+
+	return i.cert, nil
+}
+
+// caBundle is the bundle of Infra CAs clients trust the serving certificate with
+func (i *certificateIssuer) caBundle() string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.ca
+}
+
+// renew requests a certificate for the destination when there is none, it is past two thirds of its lifetime, or
+// the endpoint the destination is reached at changed
+func (i *certificateIssuer) renew(client *api.Client, destination *api.Destination, endpoint string) error {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return err
+	}
+
+	i.mu.RLock()
+	current, currentHost := i.cert, i.host
+	i.mu.RUnlock()
+
+	if current != nil && host == currentHost && time.Now().Before(renewAt(current.Leaf)) {
+		return nil
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "Connector " + destination.Name},
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	var ca string
+
+	cert, err := requestCertificate(template, func(csr string) (string, error) {
+		res, err := client.SignDestinationCertificate(&api.SignDestinationCertificateRequest{ID: destination.ID, CSR: csr})
+		if err != nil {
+			return "", err
+		}
+
+		ca = res.CA
+
+		return res.Certificate, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.cert = cert
+	i.ca = ca
+	i.host = host
+	i.mu.Unlock()
+
+	logging.S.Infof("serving certificate issued for %s, expires %s", host, cert.Leaf.NotAfter.Format(time.RFC3339))
+
+	return nil
+}
+
+// clientCertificate keeps the client certificate the connector authenticates to the Infra server with, instead of its
+// access key. The certificate is requested with the access key, and renewed before it expires.
+type clientCertificate struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func (c *clientCertificate) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.cert == nil {
+		// no certificate is sent, and the access key authenticates the connector
+		return &tls.Certificate{}, nil
+	}
+
+	return c.cert, nil
+}
+
+// renew requests a certificate for the connector's identity when there is none, or it is past two thirds of its
+// lifetime. Connections made before are closed once they are idle, so the certificate is used for new ones.
+func (c *clientCertificate) renew(client *api.Client, transport *http.Transport) error {
+	c.mu.RLock()
+	current := c.cert
+	c.mu.RUnlock()
+
+	if current != nil && time.Now().Before(renewAt(current.Leaf)) {
+		return nil
+	}
+
+	identity, err := client.Introspect()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "User " + identity.ID.String()},
+	}
+
+	cert, err := requestCertificate(template, func(csr string) (string, error) {
+		res, err := client.CreateClientCertificate(&api.CreateClientCertificateRequest{CSR: csr})
+		if err != nil {
+			return "", err
+		}
+
+		return res.Certificate, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.cert = cert
+	c.mu.Unlock()
+
+	transport.CloseIdleConnections()
+
+	logging.S.Infof("client certificate issued, expires %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+
+	return nil
+}
+
+// requestCertificate generates a key, and has the server sign a certificate for it as requested by the template.
+// The private key never leaves the connector.
+func requestCertificate(template *x509.CertificateRequest, sign func(csr string) (string, error)) (*tls.Certificate, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate request: %w", err)
+	}
+
+	certPEM, err := sign(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})))
+	if err != nil {
+		return nil, err
+	}
+
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair([]byte(certPEM), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}))
+	if err != nil {
+		return nil, fmt.Errorf("issued certificate: %w", err)
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("issued certificate: %w", err)
+	}
+
+	return &cert, nil
+}
+
+// renewAt is when two thirds of the certificate's lifetime have passed
+func renewAt(cert *x509.Certificate) time.Time {
+	return cert.NotBefore.Add(cert.NotAfter.Sub(cert.NotBefore) * 2 / 3)
+}
@@ -0,0 +1,204 @@
+package connector
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+// testCA creates a CA, which signs certificates like the Infra server for the test
+type testCA struct {
+	cert *x509.Certificate
+	key  ed25519.PrivateKey
+	pem  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	public, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Infra Root CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, public, key)
+	assert.NilError(t, err)
+
+	cert, err := x509.ParseCertificate(raw)
+	assert.NilError(t, err)
+
+	return &testCA{cert: cert, key: key, pem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}))}
+}
+
+// sign signs the PEM encoded request, for the certificate to be valid for the lifetime around now
+func (ca *testCA) sign(t *testing.T, csrPEM string, lifetime time.Duration) (*x509.CertificateRequest, *x509.Certificate, string) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	assert.Assert(t, block != nil)
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	assert.NilError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		IPAddresses:  csr.IPAddresses,
+		NotBefore:    time.Now().Add(-lifetime / 2),
+		NotAfter:     time.Now().Add(lifetime / 2),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	assert.NilError(t, err)
+
+	return csr, template, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}))
+}
+
+func TestCertificateIssuer(t *testing.T) {
+	ca := newTestCA(t)
+
+	var lifetime time.Duration
+	var signed []*x509.CertificateRequest
+
+	// the server signs the request with its CA, for as long as the test sets
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.SignDestinationCertificateRequest
+		assert.NilError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		csr, cert, certPEM := ca.sign(t, req.CSR, lifetime)
+		signed = append(signed, csr)
+
+		w.WriteHeader(http.StatusCreated)
+		assert.NilError(t, json.NewEncoder(w).Encode(&api.DestinationCertificate{
+			Certificate: certPEM,
+			CA:          ca.pem,
+			Expires:     api.Time(cert.NotAfter),
+		}))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := &api.Client{URL: srv.URL, AccessKey: "the-access-key"}
+	destination := &api.Destination{ID: uid.New(), Name: "kubernetes.production"}
+
+	issuer := &certificateIssuer{}
+
+	_, err := issuer.getCertificate(nil)
+	assert.ErrorContains(t, err, "has not been issued yet")
+
+	lifetime = 24 * time.Hour
+
+	err = issuer.renew(client, destination, "connector.example.com:443")
+	assert.NilError(t, err)
+	assert.Equal(t, len(signed), 1)
+	assert.Equal(t, signed[0].Subject.CommonName, "Connector kubernetes.production")
+	assert.DeepEqual(t, signed[0].DNSNames, []string{"connector.example.com"})
+	assert.Equal(t, issuer.caBundle(), ca.pem)
+
+	cert, err := issuer.getCertificate(nil)
+	assert.NilError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: "connector.example.com", Roots: pool})
+	assert.NilError(t, err)
+
+	t.Run("valid certificate is kept", func(t *testing.T) {
+		err := issuer.renew(client, destination, "connector.example.com:443")
+		assert.NilError(t, err)
+		assert.Equal(t, len(signed), 1)
+	})
+
+	t.Run("endpoint changed", func(t *testing.T) {
+		err := issuer.renew(client, destination, "10.0.0.1:443")
+		assert.NilError(t, err)
+		assert.Equal(t, len(signed), 2)
+		assert.Equal(t, signed[1].IPAddresses[0].String(), "10.0.0.1")
+	})
+
+	t.Run("renewed before it expires", func(t *testing.T) {
+		// the certificate issued is past two thirds of its lifetime, so it is renewed right away
+		lifetime = -time.Hour
+		err := issuer.renew(client, destination, "connector.example.com:443")
+		assert.NilError(t, err)
+		assert.Equal(t, len(signed), 3)
+
+		lifetime = 24 * time.Hour
+		err = issuer.renew(client, destination, "connector.example.com:443")
+		assert.NilError(t, err)
+		assert.Equal(t, len(signed), 4)
+	})
+}
+
+func TestClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	identityID := uid.New()
+	signed := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/introspect":
+			assert.NilError(t, json.NewEncoder(w).Encode(&api.Introspect{ID: identityID, Name: "connector"}))
+		case "/v1/certificates":
+			var req api.CreateClientCertificateRequest
+			assert.NilError(t, json.NewDecoder(r.Body).Decode(&req))
+
+			csr, cert, certPEM := ca.sign(t, req.CSR, 24*time.Hour)
+			assert.Equal(t, csr.Subject.CommonName, "User "+identityID.String())
+			signed++
+
+			w.WriteHeader(http.StatusCreated)
+			assert.NilError(t, json.NewEncoder(w).Encode(&api.ClientCertificate{
+				Certificate: certPEM,
+				CA:          ca.pem,
+				Expires:     api.Time(cert.NotAfter),
+			}))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := &api.Client{URL: srv.URL, AccessKey: "the-access-key"}
+	clientCert := &clientCertificate{}
+
+	// until the certificate is issued, none is sent
+	cert, err := clientCert.getClientCertificate(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(cert.Certificate), 0)
+
+	err = clientCert.renew(client, &http.Transport{})
+	assert.NilError(t, err)
+	assert.Equal(t, signed, 1)
+
+	cert, err = clientCert.getClientCertificate(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, cert.Leaf.Subject.CommonName, "User "+identityID.String())
+
+	// the certificate is kept until it is due to be renewed
+	err = clientCert.renew(client, &http.Transport{})
+	assert.NilError(t, err)
+	assert.Equal(t, signed, 1)
+}
@@ -11,8 +11,13 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -32,18 +37,35 @@ import (
 	"github.com/infrahq/infra/internal/kubernetes"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/repeat"
+	"github.com/infrahq/infra/internal/resource"
+	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/metrics"
 	"github.com/infrahq/infra/secrets"
+	"github.com/infrahq/infra/uid"
 )
 
 type Options struct {
-	Server        string `mapstructure:"server"`
-	Name          string `mapstructure:"name"`
-	AccessKey     string `mapstructure:"accessKey"`
-	TLSCache      string `mapstructure:"tlsCache"`
-	TLSCert       string `mapstructure:"tlsCert"`
-	TLSKey        string `mapstructure:"tlsKey"`
-	SkipTLSVerify bool   `mapstructure:"skipTLSVerify"`
+	Server                    string            `mapstructure:"server"`
+	Name                      string            `mapstructure:"name"`
+	AccessKey                 string            `mapstructure:"accessKey"`
+	TokenFile                 string            `mapstructure:"tokenFile"`      // token from a trusted issuer, used instead of an access key
+	Register                  bool              `mapstructure:"register"`       // register through a cluster trust, using the service account token
+	Labels                    map[string]string `mapstructure:"labels"`         // set on the destination, in addition to labels from cloud metadata
+	LeaderElection            bool              `mapstructure:"leaderElection"` // elect a leader among replicas to maintain the destination
+	LeaseName                 string            `mapstructure:"leaseName"`      // name of the Lease replicas elect the leader with
+	Tunnel                    bool              `mapstructure:"tunnel"`         // reached through a tunnel to the server, for clusters that accept no inbound connections
+	TLSCache                  string            `mapstructure:"tlsCache"`
+	AuditSpool                string            `mapstructure:"auditSpool"`                // file for audit records that could not be shipped to the server yet
+	RecordSessions            bool              `mapstructure:"recordSessions"`            // record kubectl exec, attach, and port-forward sessions
+	RecordingSpool            string            `mapstructure:"recordingSpool"`            // directory for session recordings waiting to be uploaded
+	AuthorizationMode         string            `mapstructure:"authorizationMode"`         // rolebinding or webhook
+	AuthorizationWebhookToken string            `mapstructure:"authorizationWebhookToken"` // authenticates the API server to the webhook
+	CertificateIssuer         string            `mapstructure:"certificateIssuer"`         // self-signed or infra
+	ClientCertificate         bool              `mapstructure:"clientCertificate"`         // authenticate to the server with a client certificate
+	TLSCert                   string            `mapstructure:"tlsCert"`
+	TLSKey                    string            `mapstructure:"tlsKey"`
+	SkipTLSVerify             bool              `mapstructure:"skipTLSVerify"`
+	TrustedProxies            []string          `mapstructure:"trustedProxies"` // proxies trusted to forward the client address, none by default
 }
 
 type jwkCache struct {
@@ -180,13 +202,50 @@ func jwtMiddleware(getJWK getJWKFunc) gin.HandlerFunc {
 			return
 		}
 
+		groups := append(claims.Groups, grantGroups(claims.Grants, net.ParseIP(c.ClientIP()), time.Now())...)
+
 		c.Set("name", claims.Name)
-		c.Set("groups", claims.Groups)
+		c.Set("groups", groups)
 
 		c.Next()
 	}
 }
 
+// grantGroups are the groups of the grants with conditions in a token that apply to a request, from one of their
+// source addresses and in their time window
+func grantGroups(grants []claims.Grant, source net.IP, now time.Time) []string {
+	var groups []string
+
+	for _, g := range grants {
+		if g.Until != 0 && !now.Before(time.Unix(g.Until, 0)) {
+			continue
+		}
+
+		if !fromCIDRs(g.CIDRs, source) {
+			continue
+		}
+
+		groups = append(groups, claims.GrantGroup(g.ID))
+	}
+
+	return groups
+}
+
+// fromCIDRs checks if a source address is in one of the CIDRs, or there are none
+func fromCIDRs(cidrs []string, source net.IP) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+
+	for _, cidr := range cidrs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && source != nil && network.Contains(source) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func proxyMiddleware(proxy *httputil.ReverseProxy, bearerToken string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		name, ok := c.MustGet("name").(string)
@@ -223,48 +282,176 @@ func proxyMiddleware(proxy *httputil.ReverseProxy, bearerToken string) gin.Handl
 	}
 }
 
-// UpdateRoles converts infra grants to role-bindings in the current cluster
-func updateRoles(c *api.Client, k *kubernetes.Kubernetes, grants []api.Grant) error {
-	logging.L.Debug("syncing local grants from infra configuration")
+// syncGrants updates the role bindings in the cluster to match the grants for the destination and its namespaces,
+// and returns the number of role bindings managed, and the grants that could not be applied
+func syncGrants(client *api.Client, k8s *kubernetes.Kubernetes, destination *api.Destination) (int, []api.SkippedGrant, error) {
+	grants, err := listGrants(client, k8s, destination)
+	if err != nil {
+		return 0, nil, err
+	}
 
-	crSubjects := make(map[string][]rbacv1.Subject)                           // cluster-role: subject
-	crnSubjects := make(map[kubernetes.ClusterRoleNamespace][]rbacv1.Subject) // cluster-role+namespace: subject
+	return updateRoles(client, k8s, grants)
+}
 
-	for _, g := range grants {
-		var name, kind string
+// listGrants lists the grants for the destination and its namespaces. Grants with resource patterns, such as
+// kubernetes.*.team-a-*, are returned once for each namespace, or the destination, they match. Label selectors
+// are matched against the labels of the destination and of its namespaces.
+func listGrants(client *api.Client, k8s *kubernetes.Kubernetes, destination *api.Destination) ([]api.Grant, error) {
+	name := destination.Name
 
-		if g.Privilege == "connect" {
+	all, err := client.ListGrants(api.ListGrantsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("list grants: %w", err)
+	}
+
+	namespaceLabels, err := k8s.NamespaceLabels()
+	if err != nil {
+		return nil, fmt.Errorf("list namespaces: %w", err)
+	}
+
+	namespaces := make([]string, 0, len(namespaceLabels))
+	for n := range namespaceLabels {
+		namespaces = append(namespaces, n)
+	}
+
+	sort.Strings(namespaces)
+
+	labels := func(object string) map[string]string {
+		if object == name {
+			return destination.Labels
+		}
+
+		return namespaceLabels[strings.TrimPrefix(object, name+".")]
+	}
+
+	var grants []api.Grant
+
+	for _, g := range all {
+		// permissions on the Infra API and owners are not roles in the cluster
+		if models.IsInfraPrivilege(g.Privilege) {
 			continue
 		}
 
-		id, err := g.Subject.ID()
+		pattern, err := resource.Parse(g.Resource)
 		if err != nil {
-			return err
+			logging.S.Warnf("invalid grant resource: %s", g.Resource)
+			continue
 		}
 
-		switch {
-		case g.Subject.IsGroup():
-			group, err := c.GetGroup(id)
-			if err != nil {
-				return err
+		for _, r := range grantResources(pattern, g.Deny, name, namespaces, labels) {
+			g.Resource = r
+			grants = append(grants, g)
+		}
+	}
+
+	return grants, nil
+}
+
+// grantResources lists the destination or namespaces a grant's resource pattern is for. Allows are for those it
+// matches. Denies are for everything they contain, as they are on the server: the destination, which denies it in
+// its namespaces too, or otherwise the namespaces, so denies such as kubernetes[env=prod] or kubernetes.* apply.
+func grantResources(pattern *resource.Pattern, deny bool, name string, namespaces []string, labels resource.Labels) []string {
+	if deny {
+		if pattern.Contains(name, labels) {
+			return []string{name}
+		}
+
+		var resources []string
+
+		for _, n := range namespaces {
+			if namespace := name + "." + n; pattern.Contains(namespace, labels) {
+				resources = append(resources, namespace)
 			}
+		}
 
-			name = group.Name
-			kind = rbacv1.GroupKind
-		case g.Subject.IsIdentity():
-			identity, err := c.GetIdentity(id)
-			if err != nil {
-				return err
+		return resources
+	}
+
+	switch len(pattern.Segments) {
+	// kubernetes.<cluster>
+	case 2:
+		if pattern.Match(name, labels) {
+			return []string{name}
+		}
+
+	// kubernetes.<cluster>.<namespace>
+	case 3:
+		var resources []string
+
+		for _, n := range namespaces {
+			if namespace := name + "." + n; pattern.Match(namespace, labels) {
+				resources = append(resources, namespace)
 			}
+		}
+
+		return resources
+	}
+
+	return nil
+}
+
+// grantSubject looks up the name of the identity or group a grant is for
+func grantSubject(c *api.Client, g api.Grant) (rbacv1.Subject, error) {
+	subj := rbacv1.Subject{APIGroup: "rbac.authorization.k8s.io"}
+
+	id, err := g.Subject.ID()
+	if err != nil {
+		return subj, err
+	}
+
+	switch {
+	case g.Conditions != nil:
+		// identities are given the privileges of grants with conditions by the group of the grant in their token,
+		// while its conditions are met
+		subj.Name = claims.GrantGroup(g.ID.String())
+		subj.Kind = rbacv1.GroupKind
+	case g.Subject.IsGroup():
+		group, err := c.GetGroup(id)
+		if err != nil {
+			return subj, err
+		}
+
+		subj.Name = group.Name
+		subj.Kind = rbacv1.GroupKind
+	case g.Subject.IsIdentity():
+		identity, err := c.GetIdentity(id)
+		if err != nil {
+			return subj, err
+		}
+
+		subj.Name = identity.Name
+		subj.Kind = rbacv1.UserKind
+	}
 
-			name = identity.Name
-			kind = rbacv1.UserKind
+	return subj, nil
+}
+
+// UpdateRoles converts infra grants to role-bindings in the current cluster, and returns the grants skipped
+func updateRoles(c *api.Client, k *kubernetes.Kubernetes, grants []api.Grant) (int, []api.SkippedGrant, error) {
+	logging.L.Debug("syncing local grants from infra configuration")
+
+	crSubjects := make(map[string][]rbacv1.Subject)                           // cluster-role: subject
+	crnSubjects := make(map[kubernetes.ClusterRoleNamespace][]rbacv1.Subject) // cluster-role+namespace: subject
+	crnGrants := make(map[kubernetes.ClusterRoleNamespace][]api.Grant)        // the grants each binding is for
+
+	namespaces, err := deniedNamespaces(k, grants)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	grants, skipped, err := applyDenies(c, grants, namespaces)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, g := range grants {
+		if g.Privilege == "connect" {
+			continue
 		}
 
-		subj := rbacv1.Subject{
-			APIGroup: "rbac.authorization.k8s.io",
-			Kind:     kind,
-			Name:     name,
+		subj, err := grantSubject(c, g)
+		if err != nil {
+			return 0, nil, err
 		}
 
 		parts := strings.Split(g.Resource, ".")
@@ -285,22 +472,353 @@ func updateRoles(c *api.Client, k *kubernetes.Kubernetes, grants []api.Grant) er
 
 		default:
 			logging.S.Warnf("invalid grant resource: %s", g.Resource)
+			skipped = append(skipped, skippedGrant(g, "invalid resource"))
+
 			continue
 		}
+
+		// grants to a group that are bound to its members instead are only reported once
+		if n := len(crnGrants[crn]); n == 0 || crnGrants[crn][n-1].ID != g.ID {
+			crnGrants[crn] = append(crnGrants[crn], g)
+		}
 	}
 
-	if err := k.UpdateClusterRoleBindings(crSubjects); err != nil {
-		return fmt.Errorf("update cluster role bindings: %w", err)
+	skippedCRBs, err := k.UpdateClusterRoleBindings(crSubjects)
+	if err != nil {
+		return 0, nil, fmt.Errorf("update cluster role bindings: %w", err)
 	}
 
-	if err := k.UpdateRoleBindings(crnSubjects); err != nil {
-		return fmt.Errorf("update cluster role bindings: %w", err)
+	skippedRBs, err := k.UpdateRoleBindings(crnSubjects)
+	if err != nil {
+		return 0, nil, fmt.Errorf("update cluster role bindings: %w", err)
 	}
 
-	return nil
+	for _, binding := range append(skippedCRBs, skippedRBs...) {
+		for _, g := range crnGrants[binding.ClusterRoleNamespace] {
+			skipped = append(skipped, skippedGrant(g, binding.Reason))
+		}
+	}
+
+	sortSkippedGrants(skipped)
+
+	// one binding is managed for each cluster role, and each role in a namespace
+	return len(crSubjects) + len(crnSubjects) - len(skippedCRBs) - len(skippedRBs), skipped, nil
+}
+
+// deniedNamespaces lists the namespaces of the cluster when any grant is a deny, which grants on the destination are
+// given in instead when they are denied in some of them
+func deniedNamespaces(k *kubernetes.Kubernetes, grants []api.Grant) ([]string, error) {
+	for _, g := range grants {
+		if !g.Deny {
+			continue
+		}
+
+		labels, err := k.NamespaceLabels()
+		if err != nil {
+			return nil, fmt.Errorf("list namespaces: %w", err)
+		}
+
+		namespaces := make([]string, 0, len(labels))
+		for n := range labels {
+			namespaces = append(namespaces, n)
+		}
+
+		sort.Strings(namespaces)
+
+		return namespaces, nil
+	}
+
+	return nil, nil
+}
+
+// applyDenies removes the deny grants, and the grants they deny to the same identity or group, or to a group it
+// belongs to, which are returned as skipped. Deny grants of a role on a destination also deny it in the namespaces
+// of the destination. Role bindings can only add access, so a grant to a group with members that are denied it
+// some other way, such as by a deny to another group they are in, is given to the members that are not denied
+// instead. Grants with conditions are bound to a group of their own, which can not leave members out, so those
+// are skipped. Likewise a grant on a destination that is denied in some of its namespaces is given in each of the
+// other namespaces instead, and its cluster-wide binding is skipped.
+func applyDenies(c *api.Client, grants []api.Grant, namespaces []string) ([]api.Grant, []api.SkippedGrant, error) {
+	var allows, denies []api.Grant
+
+	for _, g := range grants {
+		if g.Deny {
+			denies = append(denies, g)
+		} else {
+			allows = append(allows, g)
+		}
+	}
+
+	if len(denies) == 0 {
+		return allows, nil, nil
+	}
+
+	var (
+		kept    []api.Grant
+		skipped []api.SkippedGrant
+	)
+
+	subjects := make(map[uid.PolymorphicID][]uid.PolymorphicID)
+
+	for _, g := range allows {
+		if d, ok := namespaceDenyOf(g, denies); ok {
+			split, splitSkipped, denied, err := applyDeniesInNamespaces(c, g, namespaces, denies, subjects)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if denied {
+				kept = append(kept, split...)
+				skipped = append(skipped, splitSkipped...)
+				skipped = append(skipped, skippedGrant(g, fmt.Sprintf("given in each namespace instead, as it is denied in %s by grant %s of %s", d.Resource, d.ID, d.Privilege)))
+
+				continue
+			}
+		}
+
+		grantKept, grantSkipped, err := applyDeniesToGrant(c, g, denies, subjects)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		kept = append(kept, grantKept...)
+		skipped = append(skipped, grantSkipped...)
+	}
+
+	return kept, skipped, nil
+}
+
+// applyDeniesInNamespaces gives a grant on a destination in each of its namespaces, leaving out those it is denied in.
+// It reports whether any of them are denied, when the grant can be bound to the destination as it is instead.
+func applyDeniesInNamespaces(c *api.Client, g api.Grant, namespaces []string, denies []api.Grant, subjects map[uid.PolymorphicID][]uid.PolymorphicID) ([]api.Grant, []api.SkippedGrant, bool, error) {
+	var (
+		kept    []api.Grant
+		skipped []api.SkippedGrant
+		denied  bool
+	)
+
+	for _, n := range namespaces {
+		namespaced := g
+		namespaced.Resource = g.Resource + "." + n
+
+		grantKept, grantSkipped, err := applyDeniesToGrant(c, namespaced, denies, subjects)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		if len(grantSkipped) > 0 || len(grantKept) != 1 || grantKept[0].Subject != g.Subject {
+			denied = true
+		}
+
+		kept = append(kept, grantKept...)
+		skipped = append(skipped, grantSkipped...)
+	}
+
+	return kept, skipped, denied, nil
+}
+
+// applyDeniesToGrant returns the grant, or the grants to the members of its group it is given to instead, unless it is
+// denied
+func applyDeniesToGrant(c *api.Client, g api.Grant, denies []api.Grant, subjects map[uid.PolymorphicID][]uid.PolymorphicID) ([]api.Grant, []api.SkippedGrant, error) {
+	if _, ok := subjects[g.Subject]; !ok {
+		groups, err := subjectGroups(c, g.Subject)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		subjects[g.Subject] = append(groups, g.Subject)
+	}
+
+	if d, ok := denyOf(g, subjects[g.Subject], denies); ok {
+		return nil, []api.SkippedGrant{skippedGrant(g, fmt.Sprintf("denied by grant %s of %s on %s", d.ID, d.Privilege, d.Resource))}, nil
+	}
+
+	if !g.Subject.IsGroup() || !deniedToAny(g, denies) {
+		return []api.Grant{g}, nil, nil
+	}
+
+	members, d, err := undeniedMembers(c, g, denies, subjects)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case d == nil:
+		return []api.Grant{g}, nil, nil
+	case g.Conditions != nil:
+		return nil, []api.SkippedGrant{skippedGrant(g, fmt.Sprintf("denied to some members of the group by grant %s of %s on %s, which role bindings can not leave out of grants with conditions", d.ID, d.Privilege, d.Resource))}, nil
+	default:
+		return members, nil, nil
+	}
+}
+
+// undeniedMembers gives a grant to a group to each identity in the group that is not denied it. The deny that
+// denies it to a member is returned too, or nil when no member is denied it.
+func undeniedMembers(c *api.Client, g api.Grant, denies []api.Grant, subjects map[uid.PolymorphicID][]uid.PolymorphicID) ([]api.Grant, *api.Grant, error) {
+	id, err := g.Subject.ID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identities, err := c.ListIdentities(api.ListIdentitiesRequest{Group: id})
+	if err != nil {
+		return nil, nil, fmt.Errorf("list identities of %s: %w", g.Subject, err)
+	}
+
+	var (
+		members []api.Grant
+		denied  *api.Grant
+	)
+
+	for _, identity := range identities {
+		subject := uid.NewIdentityPolymorphicID(identity.ID)
+
+		if _, ok := subjects[subject]; !ok {
+			groups, err := subjectGroups(c, subject)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			subjects[subject] = append(groups, subject)
+		}
+
+		if d, ok := denyOf(g, subjects[subject], denies); ok {
+			denied = &d
+			continue
+		}
+
+		member := g
+		member.Subject = subject
+		members = append(members, member)
+	}
+
+	return members, denied, nil
+}
+
+// subjectGroups lists the groups an identity or group belongs to, directly or through other groups
+func subjectGroups(c *api.Client, subject uid.PolymorphicID) ([]uid.PolymorphicID, error) {
+	id, err := subject.ID()
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []api.Group
+
+	switch {
+	case subject.IsIdentity():
+		groups, err = c.ListIdentityGroups(id)
+	case subject.IsGroup():
+		groups, err = c.ListGroupGroups(id)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("list groups of %s: %w", subject, err)
+	}
+
+	ids := make([]uid.PolymorphicID, len(groups))
+	for i, group := range groups {
+		ids[i] = uid.NewGroupPolymorphicID(group.ID)
+	}
+
+	return ids, nil
+}
+
+// denyOf finds a deny grant of a grant's role, or of every role, to one of its subjects, on its resource or the
+// destination of its namespace
+func denyOf(g api.Grant, subjects []uid.PolymorphicID, denies []api.Grant) (api.Grant, bool) {
+	for _, d := range denies {
+		if !isDeniedBy(g, d) {
+			continue
+		}
+
+		for _, s := range subjects {
+			if s == d.Subject {
+				return d, true
+			}
+		}
+	}
+
+	return api.Grant{}, false
+}
+
+// namespaceDenyOf finds a deny grant of a grant's role, or of every role, in a namespace of the destination the grant
+// is on
+func namespaceDenyOf(g api.Grant, denies []api.Grant) (api.Grant, bool) {
+	if strings.Count(g.Resource, ".") != 1 {
+		return api.Grant{}, false
+	}
+
+	for _, d := range denies {
+		if d.Privilege != models.DenyAllPrivileges && d.Privilege != g.Privilege {
+			continue
+		}
+
+		if strings.Count(d.Resource, ".") == 2 && strings.HasPrefix(d.Resource, g.Resource+".") {
+			return d, true
+		}
+	}
+
+	return api.Grant{}, false
+}
+
+// deniedToAny checks whether a grant's role on its resource is denied to anyone
+func deniedToAny(g api.Grant, denies []api.Grant) bool {
+	for _, d := range denies {
+		if isDeniedBy(g, d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDeniedBy checks whether a deny grant is of a grant's role, or of every role, on its resource or the destination
+// of its namespace
+func isDeniedBy(g, d api.Grant) bool {
+	if d.Privilege != models.DenyAllPrivileges && d.Privilege != g.Privilege {
+		return false
+	}
+
+	// both are the destination or one of its namespaces by now, see grantResources
+	return resource.Contains(d.Resource, g.Resource, nil)
+}
+
+func skippedGrant(g api.Grant, reason string) api.SkippedGrant {
+	return api.SkippedGrant{Grant: g.ID, Resource: g.Resource, Privilege: g.Privilege, Reason: reason}
+}
+
+// sortSkippedGrants orders skipped grants, so they are reported the same way each sync
+func sortSkippedGrants(skipped []api.SkippedGrant) {
+	sort.Slice(skipped, func(i, j int) bool {
+		if skipped[i].Resource != skipped[j].Resource {
+			return skipped[i].Resource < skipped[j].Resource
+		}
+
+		if skipped[i].Privilege != skipped[j].Privilege {
+			return skipped[i].Privilege < skipped[j].Privilege
+		}
+
+		return skipped[i].Grant < skipped[j].Grant
+	})
 }
 
 func Run(options Options) error {
+	switch options.AuthorizationMode {
+	case "":
+		options.AuthorizationMode = AuthorizationModeRoleBinding
+	case AuthorizationModeRoleBinding, AuthorizationModeWebhook:
+	default:
+		return fmt.Errorf("unknown authorization mode %q, must be one of rolebinding or webhook", options.AuthorizationMode)
+	}
+
+	switch options.CertificateIssuer {
+	case "":
+		options.CertificateIssuer = CertificateIssuerSelfSigned
+	case CertificateIssuerSelfSigned, CertificateIssuerInfra:
+	default:
+		return fmt.Errorf("unknown certificate issuer %q, must be one of self-signed or infra", options.CertificateIssuer)
+	}
+
 	k8s, err := kubernetes.NewKubernetes()
 	if err != nil {
 		return err
@@ -320,6 +838,20 @@ func Run(options Options) error {
 		options.Name = fmt.Sprintf("kubernetes.%s", options.Name)
 	}
 
+	// labels from flags take precedence over the ones found in cloud metadata
+	labels := k8s.CloudLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+
+	for key, value := range options.Labels {
+		labels[key] = value
+	}
+
+	if err := resource.ValidateLabels(labels); err != nil {
+		return err
+	}
+
 	serverName := "infra-connector"
 
 	manager := &autocert.Manager{
@@ -327,9 +859,18 @@ func Run(options Options) error {
 		Cache:  autocert.DirCache(options.TLSCache),
 	}
 
+	issuer := &certificateIssuer{}
+
 	var tlsConfig *tls.Config
 
-	if options.TLSCert != "" || options.TLSKey != "" {
+	switch {
+	case options.CertificateIssuer == CertificateIssuerInfra:
+		// the certificate is issued once the destination is created, for the endpoint it is reached at
+		tlsConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: issuer.getCertificate,
+		}
+	case options.TLSCert != "" || options.TLSKey != "":
 		certBytes, err := ioutil.ReadFile(options.TLSCert)
 		if err != nil {
 			return err
@@ -348,7 +889,7 @@ func Run(options Options) error {
 		if err := manager.Cache.Put(context.TODO(), serverName, certBytes); err != nil {
 			return err
 		}
-	} else {
+	default:
 		tlsConfig := manager.TLSConfig()
 		tlsConfig.GetCertificate = certs.SelfSignedOrLetsEncryptCert(manager, serverName)
 	}
@@ -378,9 +919,12 @@ func Run(options Options) error {
 
 	u.Scheme = "https"
 
+	// the labels of the destination are replaced with the ones on the server, which may have more, after
+	// each heartbeat
 	destination := &api.Destination{
 		Name:     options.Name,
 		UniqueID: chksm,
+		Labels:   labels,
 	}
 
 	// clone the default http transport which sets reasonable defaults
@@ -389,120 +933,274 @@ func Run(options Options) error {
 		return errors.New("unexpected type for http.DefaultTransport")
 	}
 
+	clientCert := &clientCertificate{}
+
 	transport := defaultHTTPTransport.Clone()
 	transport.TLSClientConfig = &tls.Config{
 		//nolint:gosec // We may purposely set InsecureSkipVerify via a flag
 		InsecureSkipVerify: options.SkipTLSVerify,
 	}
 
-	accessKey, err := secrets.GetSecret(options.AccessKey, basicSecretStorage)
-	if err != nil {
-		return err
+	if options.ClientCertificate {
+		transport.TLSClientConfig.GetClientCertificate = clientCert.getClientCertificate
 	}
 
 	client := &api.Client{
-		URL:       u.String(),
-		AccessKey: accessKey,
+		URL: u.String(),
 		HTTP: http.Client{
 			Transport: transport,
 		},
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	var session *federatedSession
+
+	switch {
+	case options.Register:
+		// the access key is issued when the destination is registered
+	case options.TokenFile != "":
+		session = &federatedSession{tokenFile: options.TokenFile}
+		if err := session.renew(client); err != nil {
+			return err
+		}
+	default:
+		client.AccessKey, err = secrets.GetSecret(options.AccessKey, basicSecretStorage)
+		if err != nil {
+			return err
+		}
+	}
+
+	var webhookToken string
+
+	if options.AuthorizationMode == AuthorizationModeWebhook {
+		webhookToken, err = secrets.GetSecret(options.AuthorizationWebhookToken, basicSecretStorage)
+		if err != nil {
+			return fmt.Errorf("authorization webhook token: %w", err)
+		}
+
+		if webhookToken == "" {
+			return errors.New("the webhook authorization mode requires an authorization webhook token")
+		}
+	}
+
+	var registeredUntil time.Time
+
+	status := &destinationStatus{labels: labels}
+	authz := &authorizer{}
+	bindingsRemoved := false
+	audit := newAuditor(options.Name, options.AuditSpool)
+	sessions := newRecorder(options.Name, options.RecordingSpool)
+	serverTunnel := newTunnel(transport)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	repeat.Start(ctx, 5*time.Second, func(context.Context) {
-		caBytes, err := manager.Cache.Get(context.TODO(), serverName)
+	promRegistry := prometheus.NewRegistry()
+	leader := newLeadership(promRegistry)
+
+	campaigned := make(chan struct{})
+
+	if options.LeaderElection {
+		hostname, err := os.Hostname()
 		if err != nil {
-			if errors.Is(err, autocert.ErrCacheMiss) {
-				logging.S.Debugf("failed loading CA: %v", err)
-				return
-			} else {
-				logging.S.Errorf("cache get: %v", err)
-				return
-			}
+			return err
 		}
 
-		host, port, err := k8s.Endpoint()
+		if options.LeaseName == "" {
+			options.LeaseName = "infra-connector"
+		}
+
+		campaign, err := k8s.LeaderElection(options.LeaseName, hostname+"_"+uid.New().String(), leader.set)
 		if err != nil {
-			logging.S.Errorf("failed to lookup endpoint: %v", err)
-			return
+			return fmt.Errorf("leader election: %w", err)
 		}
 
-		if ipv4 := net.ParseIP(host); ipv4 == nil {
-			// wait for DNS resolution if endpoint is not an IPv4 address
-			if _, err := net.LookupIP(host); err != nil {
-				logging.L.Error("host could not be resolved")
+		go func() {
+			defer close(campaigned)
+			campaign(ctx)
+		}()
+	} else {
+		leader.set(true)
+		close(campaigned)
+	}
+
+	repeat.Start(ctx, 5*time.Second, func(context.Context) {
+		if session != nil {
+			if err := session.renew(client); err != nil {
+				logging.S.Errorf("federated login: %v", err)
 				return
 			}
 		}
 
-		endpoint := fmt.Sprintf("%s:%d", host, port)
-		logging.S.Debugf("connector serving on %s", endpoint)
+		if options.ClientCertificate {
+			// the access key still authenticates the connector until a certificate is issued
+			if err := clientCert.renew(client, transport); err != nil {
+				logging.S.Errorf("client certificate: %v", err)
+			}
+		}
+
+		leading := leader.isLeader()
 
-		if destination.ID == 0 {
-			destination.Connection.CA = string(caBytes)
-			destination.Connection.URL = endpoint
+		var connection *api.DestinationConnection
 
-			isClusterIP, err := k8s.IsServiceTypeClusterIP()
+		switch {
+		case options.Tunnel:
+			// the server reaches the connector through the tunnel, so it needs no URL or CA
+			connection = &api.DestinationConnection{Tunnel: true}
+		case options.CertificateIssuer == CertificateIssuerInfra:
+			// every replica is issued a certificate for the endpoint, which clients trust with the Infra CAs
+			endpoint, err := destinationEndpoint(k8s)
 			if err != nil {
-				logging.S.Debugf("could not check destination service type: %v", err)
+				logging.S.Errorf("destination connection: %v", err)
+				return
 			}
 
-			if isClusterIP {
-				logging.S.Warn("registering with cluster IP, it may not be externally accessible without an ingress or load balancer")
-			}
+			connection = &api.DestinationConnection{URL: endpoint, CA: issuer.caBundle()}
+		case options.Register || leading:
+			var err error
 
-			err = createDestination(client, destination)
+			connection, err = destinationConnection(manager, serverName, k8s)
 			if err != nil {
-				logging.S.Errorf("initializing destination: %v", err)
+				if errors.Is(err, autocert.ErrCacheMiss) {
+					logging.S.Debugf("failed loading CA: %v", err)
+				} else {
+					logging.S.Errorf("destination connection: %v", err)
+				}
+
 				return
 			}
-		} else if destination.Connection.URL != endpoint || destination.Connection.CA != string(caBytes) {
-			destination.Connection.CA = string(caBytes)
-			destination.Connection.URL = endpoint
+		}
 
-			err = updateDestination(client, destination)
-			if err != nil {
-				logging.S.Errorf("refreshing destination: %v", err)
+		switch {
+		// registering issues the connector's access key, so every replica registers. The server keeps one
+		// destination for the cluster's unique ID.
+		case options.Register:
+			changed := destination.Connection != *connection
+			destination.Connection = *connection
+
+			if changed || time.Until(registeredUntil) < accessKeyRenewBefore {
+				expires, err := registerDestination(client, destination)
+				if err != nil {
+					logging.S.Errorf("registering destination: %v", err)
+					return
+				}
+
+				registeredUntil = expires
+			}
+		case leading:
+			if destination.ID == 0 {
+				destination.Connection = *connection
+
+				if !options.Tunnel {
+					isClusterIP, err := k8s.IsServiceTypeClusterIP()
+					if err != nil {
+						logging.S.Debugf("could not check destination service type: %v", err)
+					}
+
+					if isClusterIP {
+						logging.S.Warn("registering with cluster IP, it may not be externally accessible without an ingress or load balancer, or a tunnel")
+					}
+				}
+
+				err := createDestination(client, destination)
+				if err != nil {
+					logging.S.Errorf("initializing destination: %v", err)
+					return
+				}
+			} else if destination.Connection != *connection {
+				destination.Connection = *connection
+
+				if err := updateDestination(client, destination); err != nil {
+					logging.S.Errorf("refreshing destination: %v", err)
+					return
+				}
+			}
+		}
+
+		// the leader learns the labels of the destination from its heartbeats
+		if !leading {
+			if err := lookupDestination(client, destination); err != nil {
+				logging.S.Errorf("looking up destination: %v", err)
 				return
 			}
 		}
 
-		grants, err := client.ListGrants(api.ListGrantsRequest{Resource: options.Name})
-		if err != nil {
-			logging.S.Errorf("error listing grants: %v", err)
-			return
+		if connection != nil && !connection.Tunnel && options.CertificateIssuer == CertificateIssuerInfra && destination.ID != 0 {
+			if err := issuer.renew(client, destination, connection.URL); err != nil {
+				logging.S.Errorf("issuing serving certificate: %v", err)
+			}
 		}
 
-		namespaces, err := k8s.Namespaces()
-		if err != nil {
-			logging.S.Errorf("error listing namespaces: %v", err)
-			return
+		// every replica opens a tunnel, so requests keep being served when one stops
+		if options.Tunnel && destination.ID != 0 {
+			if err := serverTunnel.connect(client, destination.ID); err != nil {
+				logging.S.Errorf("opening tunnel: %v", err)
+			}
 		}
 
-		for _, n := range namespaces {
-			g, err := client.ListGrants(api.ListGrantsRequest{Resource: fmt.Sprintf("%s.%s", options.Name, n)})
+		var (
+			roleBindings int
+			skipped      []api.SkippedGrant
+			err          error
+		)
+
+		switch {
+		case options.AuthorizationMode == AuthorizationModeWebhook:
+			// role bindings from the rolebinding mode would keep granting access the webhook no longer does
+			if leading && !bindingsRemoved {
+				if _, _, err := updateRoles(client, k8s, nil); err != nil {
+					logging.S.Errorf("removing role bindings: %v", err)
+				} else {
+					bindingsRemoved = true
+				}
+			}
+
+			// every replica answers webhook requests
+			skipped, err = authz.refresh(client, k8s, destination)
 			if err != nil {
-				logging.S.Errorf("error listing grants: %v", err)
-				return
+				logging.S.Errorf("error refreshing grants: %v", err)
+			}
+		case leading:
+			roleBindings, skipped, err = syncGrants(client, k8s, destination)
+			if err != nil {
+				logging.S.Errorf("error syncing grants: %v", err)
 			}
+		}
+
+		if leading {
+			status.record(roleBindings, skipped, err)
 
-			grants = append(grants, g...)
+			if err := status.send(client, destination); err != nil {
+				logging.S.Errorf("sending heartbeat: %v", err)
+			}
 		}
 
-		err = updateRoles(client, k8s, grants)
-		if err != nil {
-			logging.S.Errorf("error updating grants: %v", err)
-			return
+		// audit records and recordings are spooled by the replica that proxied the request
+		if err := audit.flush(client); err != nil {
+			logging.S.Errorf("shipping audit records: %v", err)
+		}
+
+		if options.RecordSessions {
+			if err := sessions.upload(client); err != nil {
+				logging.S.Errorf("uploading session recordings: %v", err)
+			}
 		}
 	})
 
 	ginutil.SetMode()
 	router := gin.New()
-	router.GET("/healthz", func(c *gin.Context) {
-		c.Status(http.StatusOK)
-	})
+
+	// grant conditions on source addresses rely on the client address, so forwarded headers are only trusted from
+	// the configured proxies
+	if err := router.SetTrustedProxies(options.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted proxies: %w", err)
+	}
+
+	router.GET("/healthz", healthHandler(leader))
+
+	if options.AuthorizationMode == AuthorizationModeWebhook {
+		// registered before the middleware below, the API server authenticates with the webhook token instead
+		router.POST("/authorize", authorizationWebhook(authz, webhookToken))
+	}
 
 	cache := jwkCache{
 		client: &http.Client{
@@ -539,7 +1237,6 @@ func Run(options Options) error {
 	proxy := httputil.NewSingleHostReverseProxy(proxyHost)
 	proxy.Transport = proxyTransport
 
-	promRegistry := prometheus.NewRegistry()
 	metricsServer := &http.Server{
 		Addr:     ":9090",
 		Handler:  metrics.NewHandler(promRegistry),
@@ -552,11 +1249,20 @@ func Run(options Options) error {
 		}
 	}()
 
-	router.Use(
+	middleware := []gin.HandlerFunc{
 		metrics.Middleware(promRegistry),
 		jwtMiddleware(cache.getJWK),
-		proxyMiddleware(proxy, k8s.Config.BearerToken),
-	)
+		auditMiddleware(audit),
+	}
+
+	if options.RecordSessions {
+		proxy.ModifyResponse = recordUpgradedConnection
+		middleware = append(middleware, recordingMiddleware(sessions))
+	}
+
+	router.Use(append(middleware, proxyMiddleware(proxy, k8s.Config.BearerToken))...)
+	serverTunnel.serve(router)
+
 	tlsServer := &http.Server{
 		Addr:      ":443",
 		TLSConfig: tlsConfig,
@@ -564,9 +1270,195 @@ func Run(options Options) error {
 		ErrorLog:  logging.StandardErrorLog(),
 	}
 
+	go func() {
+		<-ctx.Done()
+
+		// wait for the lease to be released, so another replica takes over as soon as this one stops
+		<-campaigned
+
+		serverTunnel.close()
+
+		if err := tlsServer.Shutdown(context.Background()); err != nil {
+			logging.S.Errorf("shutdown: %v", err)
+		}
+	}()
+
 	logging.S.Infof("starting infra (%s) - https:%s metrics:%s", internal.Version, tlsServer.Addr, metricsServer.Addr)
 
-	return tlsServer.ListenAndServeTLS("", "")
+	if err := tlsServer.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// accessKeyRenewBefore is how long before its access key expires the connector logs in again
+const accessKeyRenewBefore = time.Minute
+
+// federatedSession exchanges a token from a trusted issuer, such as a projected service account
+// token, for short-lived access keys. The token file is read again for each login, as it is rotated.
+type federatedSession struct {
+	tokenFile string
+	expires   time.Time
+}
+
+func (f *federatedSession) renew(client *api.Client) error {
+	if time.Until(f.expires) > accessKeyRenewBefore {
+		return nil
+	}
+
+	token, err := ioutil.ReadFile(f.tokenFile)
+	if err != nil {
+		return fmt.Errorf("read token file: %w", err)
+	}
+
+	// the expiring access key must not be sent with the login
+	client.AccessKey = ""
+
+	res, err := client.Login(&api.LoginRequest{Federation: &api.LoginRequestFederation{Token: strings.TrimSpace(string(token))}})
+	if err != nil {
+		return err
+	}
+
+	client.AccessKey = res.AccessKey
+	f.expires = time.Time(res.Expires)
+
+	return nil
+}
+
+// heartbeatInterval is how often the connector reports its status, when it has not changed
+const heartbeatInterval = 30 * time.Second
+
+// destinationStatus is the status the connector reports to the server with heartbeats
+type destinationStatus struct {
+	labels        map[string]string
+	lastSent      time.Time
+	lastSync      time.Time
+	syncError     string
+	roleBindings  int
+	skippedGrants []api.SkippedGrant
+	changed       bool
+}
+
+func (s *destinationStatus) record(roleBindings int, skippedGrants []api.SkippedGrant, syncErr error) {
+	syncError := ""
+	if syncErr != nil {
+		syncError = syncErr.Error()
+	} else {
+		s.lastSync = time.Now()
+		s.changed = s.changed || s.roleBindings != roleBindings || !reflect.DeepEqual(s.skippedGrants, skippedGrants)
+		s.roleBindings = roleBindings
+		s.skippedGrants = skippedGrants
+	}
+
+	s.changed = s.changed || s.syncError != syncError
+	s.syncError = syncError
+}
+
+// send reports the status when it changed, or when the heartbeat interval has passed. The destination is
+// updated with the labels the server has for it.
+func (s *destinationStatus) send(client *api.Client, destination *api.Destination) error {
+	if !s.changed && time.Since(s.lastSent) < heartbeatInterval {
+		return nil
+	}
+
+	res, err := client.DestinationHeartbeat(&api.DestinationHeartbeatRequest{
+		ID:            destination.ID,
+		Version:       internal.Version,
+		LastSync:      api.Time(s.lastSync),
+		SyncError:     s.syncError,
+		RoleBindings:  s.roleBindings,
+		SkippedGrants: s.skippedGrants,
+		Labels:        s.labels,
+	})
+	if err != nil {
+		return err
+	}
+
+	destination.Labels = res.Labels
+	s.lastSent = time.Now()
+	s.changed = false
+
+	return nil
+}
+
+// destinationConnection is the address and CA certificate clients connect to the destination with
+func destinationConnection(manager *autocert.Manager, serverName string, k8s *kubernetes.Kubernetes) (*api.DestinationConnection, error) {
+	caBytes, err := manager.Cache.Get(context.TODO(), serverName)
+	if err != nil {
+		return nil, fmt.Errorf("load CA: %w", err)
+	}
+
+	endpoint, err := destinationEndpoint(k8s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.DestinationConnection{URL: endpoint, CA: string(caBytes)}, nil
+}
+
+// destinationEndpoint looks up the host and port the connector is reached at
+func destinationEndpoint(k8s *kubernetes.Kubernetes) (string, error) {
+	host, port, err := k8s.Endpoint()
+	if err != nil {
+		return "", fmt.Errorf("lookup endpoint: %w", err)
+	}
+
+	if ipv4 := net.ParseIP(host); ipv4 == nil {
+		// wait for DNS resolution if endpoint is not an IPv4 address
+		if _, err := net.LookupIP(host); err != nil {
+			return "", fmt.Errorf("host %q could not be resolved", host)
+		}
+	}
+
+	endpoint := fmt.Sprintf("%s:%d", host, port)
+	logging.S.Debugf("connector serving on %s", endpoint)
+
+	return endpoint, nil
+}
+
+// lookupDestination updates the destination with the ID and labels of the one the leader maintains
+func lookupDestination(client *api.Client, local *api.Destination) error {
+	destinations, err := client.ListDestinations(api.ListDestinationsRequest{UniqueID: local.UniqueID})
+	if err != nil {
+		return err
+	}
+
+	// the leader has not created the destination yet
+	if len(destinations) == 0 {
+		return nil
+	}
+
+	local.ID = destinations[0].ID
+	local.Labels = destinations[0].Labels
+
+	return nil
+}
+
+// registerDestination proves the connector's identity with its service account token, which the server
+// reviews against a pre-registered cluster trust. The server issues a short-lived access key in return.
+func registerDestination(client *api.Client, local *api.Destination) (time.Time, error) {
+	token, err := kubernetes.ServiceAccountToken()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read service account token: %w", err)
+	}
+
+	client.AccessKey = ""
+
+	res, err := client.RegisterDestination(&api.RegisterDestinationRequest{
+		Name:       local.Name,
+		UniqueID:   local.UniqueID,
+		Connection: local.Connection,
+		Token:      token,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	client.AccessKey = res.AccessKey
+	local.ID = res.Destination.ID
+
+	return time.Time(res.Expires), nil
 }
 
 // createDestination creates a destination in the infra server if it does not exist
@@ -585,6 +1477,7 @@ func createDestination(client *api.Client, local *api.Destination) error {
 		Name:       local.Name,
 		UniqueID:   local.UniqueID,
 		Connection: local.Connection,
+		Labels:     local.Labels,
 	}
 
 	destination, err := client.CreateDestination(request)
@@ -5,10 +5,13 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,7 +20,10 @@ import (
 	"gopkg.in/square/go-jose.v2/jwt"
 	"gotest.tools/v3/assert"
 
+	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/claims"
+	"github.com/infrahq/infra/internal/resource"
+	"github.com/infrahq/infra/uid"
 )
 
 func TestJWTMiddlewareNoAuthHeader(t *testing.T) {
@@ -183,3 +189,190 @@ func TestJWTMiddlewareValidJWT(t *testing.T) {
 	assert.Assert(t, groupsExists)
 	assert.DeepEqual(t, []string{"developers"}, groups)
 }
+
+func TestGrantGroups(t *testing.T) {
+	now := time.Now()
+
+	grants := []claims.Grant{
+		{ID: "always"},
+		{ID: "office", CIDRs: []string{"10.0.0.0/8", "192.168.1.0/24"}},
+		{ID: "window", Until: now.Add(time.Hour).Unix()},
+		{ID: "ended", Until: now.Add(-time.Minute).Unix()},
+	}
+
+	groups := grantGroups(grants, net.ParseIP("192.168.1.20"), now)
+	assert.DeepEqual(t, groups, []string{"infra:grant:always", "infra:grant:office", "infra:grant:window"})
+
+	groups = grantGroups(grants, net.ParseIP("172.16.0.1"), now)
+	assert.DeepEqual(t, groups, []string{"infra:grant:always", "infra:grant:window"})
+
+	// the window ends while the token is still valid
+	groups = grantGroups(grants, nil, now.Add(2*time.Hour))
+	assert.DeepEqual(t, groups, []string{"infra:grant:always"})
+}
+
+func TestLookupDestination(t *testing.T) {
+	var destinations []api.Destination
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Query().Get("unique_id"), "cluster-checksum")
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(destinations)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := &api.Client{URL: srv.URL}
+	local := &api.Destination{Name: "kubernetes.test", UniqueID: "cluster-checksum", Labels: map[string]string{"env": "prod"}}
+
+	// the leader has not created the destination yet
+	err := lookupDestination(client, local)
+	assert.NilError(t, err)
+	assert.Equal(t, local.ID, uid.ID(0))
+
+	destinations = []api.Destination{{ID: 1234, Name: "kubernetes.test", UniqueID: "cluster-checksum", Labels: map[string]string{"env": "prod", "team": "platform"}}}
+
+	err = lookupDestination(client, local)
+	assert.NilError(t, err)
+	assert.Equal(t, local.ID, uid.ID(1234))
+	assert.DeepEqual(t, local.Labels, map[string]string{"env": "prod", "team": "platform"})
+}
+
+func TestApplyDenies(t *testing.T) {
+	alice := uid.NewIdentityPolymorphicID(1)
+	contractors := uid.NewGroupPolymorphicID(10)
+	platform := uid.NewGroupPolymorphicID(11)
+	engineering := uid.NewGroupPolymorphicID(12)
+
+	oncall := uid.NewGroupPolymorphicID(13)
+	bob := uid.NewIdentityPolymorphicID(2)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body interface{} = []api.Group{}
+
+		switch r.URL.Path {
+		case fmt.Sprintf("/v1/identities/%s/groups", uid.ID(1)):
+			body = []api.Group{{ID: 10, Name: "contractors"}, {ID: 13, Name: "oncall"}}
+		case fmt.Sprintf("/v1/identities/%s/groups", uid.ID(2)):
+			body = []api.Group{{ID: 13, Name: "oncall"}}
+		case fmt.Sprintf("/v1/groups/%s/groups", uid.ID(11)):
+			body = []api.Group{{ID: 12, Name: "engineering"}}
+		case "/v1/identities":
+			identities := []api.Identity{}
+			if r.URL.Query().Get("group") == uid.ID(13).String() {
+				identities = []api.Identity{{ID: 1, Name: "alice@example.com"}, {ID: 2, Name: "bob@example.com"}}
+			}
+
+			body = identities
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := &api.Client{URL: srv.URL}
+
+	grants := []api.Grant{
+		{ID: 100, Subject: alice, Privilege: "edit", Resource: "kubernetes.prod.web"},
+		{ID: 101, Subject: alice, Privilege: "view", Resource: "kubernetes.staging"},
+		{ID: 102, Subject: platform, Privilege: "edit", Resource: "kubernetes.prod"},
+		{ID: 103, Subject: platform, Privilege: "view", Resource: "kubernetes.prod"},
+		{ID: 104, Subject: contractors, Privilege: "*", Resource: "kubernetes.prod", Deny: true},
+		{ID: 105, Subject: engineering, Privilege: "edit", Resource: "kubernetes.prod", Deny: true},
+	}
+
+	kept, skipped, err := applyDenies(client, grants, []string{"web"})
+	assert.NilError(t, err)
+
+	var keptIDs []uid.ID
+	for _, g := range kept {
+		keptIDs = append(keptIDs, g.ID)
+	}
+
+	assert.DeepEqual(t, keptIDs, []uid.ID{101, 103})
+	assert.Equal(t, len(skipped), 2)
+	assert.Equal(t, skipped[0].Grant, uid.ID(100))
+	assert.Equal(t, skipped[0].Reason, fmt.Sprintf("denied by grant %s of * on kubernetes.prod", uid.ID(104)))
+	assert.Equal(t, skipped[1].Grant, uid.ID(102))
+
+	t.Run("group with denied members", func(t *testing.T) {
+		grants := []api.Grant{
+			{ID: 106, Subject: oncall, Privilege: "view", Resource: "kubernetes.prod.web"},
+			{ID: 107, Subject: oncall, Privilege: "view", Resource: "kubernetes.staging"},
+			{ID: 108, Subject: oncall, Privilege: "edit", Resource: "kubernetes.prod", Conditions: &api.GrantConditions{MFALevel: 1}},
+			{ID: 104, Subject: contractors, Privilege: "*", Resource: "kubernetes.prod", Deny: true},
+		}
+
+		kept, skipped, err := applyDenies(client, grants, []string{"web"})
+		assert.NilError(t, err)
+
+		// alice is denied through contractors, so only bob is given the grant to oncall on the namespace
+		assert.DeepEqual(t, kept, []api.Grant{
+			{ID: 106, Subject: bob, Privilege: "view", Resource: "kubernetes.prod.web"},
+			{ID: 107, Subject: oncall, Privilege: "view", Resource: "kubernetes.staging"},
+		})
+
+		assert.Equal(t, len(skipped), 1)
+		assert.Equal(t, skipped[0].Grant, uid.ID(108))
+		assert.Assert(t, strings.Contains(skipped[0].Reason, "denied to some members of the group"))
+	})
+
+	t.Run("deny narrower than the allow", func(t *testing.T) {
+		grants := []api.Grant{
+			{ID: 109, Subject: bob, Privilege: "edit", Resource: "kubernetes.prod"},
+			{ID: 110, Subject: alice, Privilege: "edit", Resource: "kubernetes.prod"},
+			{ID: 111, Subject: bob, Privilege: "*", Resource: "kubernetes.prod.kube-system", Deny: true},
+		}
+
+		kept, skipped, err := applyDenies(client, grants, []string{"default", "kube-system"})
+		assert.NilError(t, err)
+
+		// bob is only given the grant in the namespaces not denied to bob, while alice keeps the cluster-wide grant
+		assert.DeepEqual(t, kept, []api.Grant{
+			{ID: 109, Subject: bob, Privilege: "edit", Resource: "kubernetes.prod.default"},
+			{ID: 110, Subject: alice, Privilege: "edit", Resource: "kubernetes.prod"},
+		})
+
+		assert.Equal(t, len(skipped), 2)
+		assert.Equal(t, skipped[0].Resource, "kubernetes.prod.kube-system")
+		assert.Equal(t, skipped[0].Reason, fmt.Sprintf("denied by grant %s of * on kubernetes.prod.kube-system", uid.ID(111)))
+		assert.Equal(t, skipped[1].Resource, "kubernetes.prod")
+		assert.Assert(t, strings.Contains(skipped[1].Reason, "given in each namespace instead"))
+	})
+}
+
+func TestGrantResources(t *testing.T) {
+	labels := func(name string) map[string]string {
+		switch name {
+		case "kubernetes.prod":
+			return map[string]string{"env": "prod"}
+		case "kubernetes.prod.web":
+			return map[string]string{"team": "web"}
+		}
+
+		return nil
+	}
+
+	namespaces := []string{"default", "web"}
+
+	resources := func(pattern string, deny bool) []string {
+		p, err := resource.Parse(pattern)
+		assert.NilError(t, err)
+
+		return grantResources(p, deny, "kubernetes.prod", namespaces, labels)
+	}
+
+	assert.DeepEqual(t, resources("kubernetes.prod", false), []string{"kubernetes.prod"})
+	assert.DeepEqual(t, resources("kubernetes.*.*", false), []string{"kubernetes.prod.default", "kubernetes.prod.web"})
+	assert.DeepEqual(t, resources("kubernetes.*.*[team=web]", false), []string{"kubernetes.prod.web"})
+	assert.Assert(t, resources("kubernetes[env=prod]", false) == nil)
+
+	// denies are for everything they contain, so the destination denies them in every namespace
+	assert.DeepEqual(t, resources("kubernetes[env=prod]", true), []string{"kubernetes.prod"})
+	assert.DeepEqual(t, resources("kubernetes.*", true), []string{"kubernetes.prod"})
+	assert.DeepEqual(t, resources("kubernetes", true), []string{"kubernetes.prod"})
+	assert.DeepEqual(t, resources("kubernetes.*.*[team=web]", true), []string{"kubernetes.prod.web"})
+	assert.Assert(t, resources("kubernetes[env=staging]", true) == nil)
+	assert.Assert(t, resources("kubernetes.staging", true) == nil)
+}
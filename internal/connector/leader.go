@@ -0,0 +1,59 @@
+package connector
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/infrahq/infra/internal/logging"
+)
+
+// leadership tracks whether this replica is the leader. Every replica proxies requests, but only the leader
+// maintains the destination and reconciles role bindings, so replicas do not race to make the same changes.
+type leadership struct {
+	leading int32
+	gauge   prometheus.Gauge
+}
+
+func newLeadership(reg prometheus.Registerer) *leadership {
+	return &leadership{
+		gauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Namespace: "infra",
+			Subsystem: "connector",
+			Name:      "leader",
+			Help:      "Whether this connector replica is the leader, which reconciles the destination and its role bindings.",
+		}),
+	}
+}
+
+func (l *leadership) set(leading bool) {
+	value := int32(0)
+	if leading {
+		value = 1
+	}
+
+	if atomic.SwapInt32(&l.leading, value) != value {
+		if leading {
+			logging.S.Info("started leading")
+		} else {
+			logging.S.Info("stopped leading")
+		}
+	}
+
+	l.gauge.Set(float64(value))
+}
+
+func (l *leadership) isLeader() bool {
+	return atomic.LoadInt32(&l.leading) == 1
+}
+
+// healthHandler reports the connector is healthy, and whether it is the leader. Every replica serves the
+// proxy, so replicas that are not leading are healthy too.
+func healthHandler(l *leadership) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"leader": l.isLeader()})
+	}
+}
@@ -0,0 +1,49 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestLeadership(t *testing.T) {
+	leader := newLeadership(prometheus.NewRegistry())
+
+	router := gin.New()
+	router.GET("/healthz", healthHandler(leader))
+
+	health := func(t *testing.T) bool {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		// replicas that are not leading still serve the proxy, so they are healthy
+		assert.Equal(t, resp.Code, http.StatusOK)
+
+		var body struct {
+			Leader bool `json:"leader"`
+		}
+
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+
+		return body.Leader
+	}
+
+	assert.Equal(t, leader.isLeader(), false)
+	assert.Equal(t, health(t), false)
+
+	leader.set(true)
+	assert.Equal(t, leader.isLeader(), true)
+	assert.Equal(t, health(t), true)
+	assert.Equal(t, testutil.ToFloat64(leader.gauge), float64(1))
+
+	leader.set(false)
+	assert.Equal(t, leader.isLeader(), false)
+	assert.Equal(t, health(t), false)
+	assert.Equal(t, testutil.ToFloat64(leader.gauge), float64(0))
+}
@@ -0,0 +1,428 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moby/spdystream/spdy"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/uid"
+)
+
+// recordingMaxSize is the largest recording kept of a session, the rest of the session is not recorded
+const recordingMaxSize = 32 << 20
+
+type recordingContextKey struct{}
+
+// recorder records interactive sessions, such as kubectl exec, proxied to the Kubernetes API server. Finished
+// recordings are written to the spool directory, and uploaded to the server from there.
+type recorder struct {
+	destination string
+	spool       string
+}
+
+func newRecorder(destination, spool string) *recorder {
+	return &recorder{destination: destination, spool: spool}
+}
+
+// recordingMiddleware starts a recording for requests that upgrade to an interactive session with a pod
+func recordingMiddleware(r *recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info := kubernetesRequestInfo(c.Request.Method, c.Request.URL)
+
+		kind := info.Subresource
+		if info.Resource != "pods" || !isRecordedSession(kind) || c.Request.Header.Get("Upgrade") == "" {
+			c.Next()
+			return
+		}
+
+		name, _ := c.Value("name").(string)
+		query := c.Request.URL.Query()
+
+		recording := &sessionRecording{
+			recorder: r,
+			info: api.CreateSessionRecordingRequest{
+				Destination: r.destination,
+				Identity:    name,
+				Kind:        kind,
+				Namespace:   info.Namespace,
+				Pod:         info.Name,
+				Container:   query.Get("container"),
+				Command:     strings.Join(query["command"], " "),
+			},
+			streams: make(map[spdy.StreamId]spdyStream),
+		}
+
+		ctx := context.WithValue(c.Request.Context(), recordingContextKey{}, recording)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+func isRecordedSession(subresource string) bool {
+	switch subresource {
+	case api.SessionRecordingExec, api.SessionRecordingAttach, api.SessionRecordingPortForward:
+		return true
+	}
+
+	return false
+}
+
+// recordUpgradedConnection records the streams of a connection once the API server switched protocols. It is
+// used as the ModifyResponse of the proxy, which calls it before copying the upgraded connection.
+func recordUpgradedConnection(res *http.Response) error {
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		return nil
+	}
+
+	recording, ok := res.Request.Context().Value(recordingContextKey{}).(*sessionRecording)
+	if !ok {
+		return nil
+	}
+
+	conn, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		return nil
+	}
+
+	recording.start(strings.EqualFold(res.Header.Get("Upgrade"), "SPDY/3.1"))
+	res.Body = &recordedConn{ReadWriteCloser: conn, recording: recording}
+
+	return nil
+}
+
+// recordedConn copies what is read from the API server and written to it into the recording
+type recordedConn struct {
+	io.ReadWriteCloser
+	recording *sessionRecording
+	closeOnce sync.Once
+}
+
+func (c *recordedConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		c.recording.fromServer(p[:n])
+	}
+
+	return n, err
+}
+
+func (c *recordedConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	if n > 0 {
+		c.recording.fromClient(p[:n])
+	}
+
+	return n, err
+}
+
+func (c *recordedConn) Close() error {
+	err := c.ReadWriteCloser.Close()
+	c.closeOnce.Do(c.recording.finish)
+
+	return err
+}
+
+// spdyStream is a stream of a kubectl exec, attach, or port-forward session
+type spdyStream struct {
+	kind string // stdin, stdout, stderr, resize, error, or data
+	port string // the forwarded port of a data stream
+}
+
+// sessionRecording is an asciicast v2 recording of a session. Terminal output is recorded as "o" events,
+// input as "i" events, terminal resizes as "r" events, and other notable events, such as forwarded
+// connections, as "m" markers.
+type sessionRecording struct {
+	recorder *recorder
+	info     api.CreateSessionRecordingRequest
+
+	mu            sync.Mutex
+	started       time.Time
+	width, height int
+	events        bytes.Buffer
+	truncated     bool
+
+	// only SPDY, which kubectl uses, is parsed, other protocols are recorded without their streams
+	spdy    bool
+	streams map[spdy.StreamId]spdyStream
+	up      *spdyReader
+	down    *spdyReader
+}
+
+func (r *sessionRecording) start(isSPDY bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started = time.Now()
+	r.spdy = isSPDY
+
+	if isSPDY {
+		r.up = newSPDYReader()
+		r.down = newSPDYReader()
+	} else {
+		r.event("m", "session streams are only recorded for SPDY connections")
+	}
+}
+
+func (r *sessionRecording) fromClient(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.spdy || r.up == nil {
+		return
+	}
+
+	frames, err := r.up.write(p)
+	if err != nil {
+		r.stopParsing(err)
+	}
+
+	for _, frame := range frames {
+		switch frame := frame.(type) {
+		case *spdy.SynStreamFrame:
+			stream := spdyStream{kind: frame.Headers.Get("streamType"), port: frame.Headers.Get("port")}
+			r.streams[frame.StreamId] = stream
+
+			if stream.kind == "data" {
+				r.event("m", fmt.Sprintf("connection to port %s", stream.port))
+			}
+		case *spdy.DataFrame:
+			switch r.streams[frame.StreamId].kind {
+			case "stdin":
+				r.event("i", string(frame.Data))
+			case "resize":
+				r.resize(frame.Data)
+			}
+		}
+	}
+}
+
+func (r *sessionRecording) fromServer(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.spdy || r.down == nil {
+		return
+	}
+
+	frames, err := r.down.write(p)
+	if err != nil {
+		r.stopParsing(err)
+	}
+
+	for _, frame := range frames {
+		if frame, ok := frame.(*spdy.DataFrame); ok {
+			switch r.streams[frame.StreamId].kind {
+			case "stdout", "stderr":
+				r.event("o", string(frame.Data))
+			}
+		}
+	}
+}
+
+// stopParsing gives up on recording the streams of a connection that can not be parsed. The connection is
+// still proxied. The caller must hold the lock.
+func (r *sessionRecording) stopParsing(err error) {
+	logging.S.Warnf("recording session of %s: %v", r.info.Identity, err)
+	r.event("m", "the rest of the session could not be recorded")
+	r.up, r.down = nil, nil
+}
+
+// resize records a terminal size message, e.g. {"Width":80,"Height":24}. The caller must hold the lock.
+func (r *sessionRecording) resize(data []byte) {
+	var size struct {
+		Width  int
+		Height int
+	}
+
+	if err := json.Unmarshal(data, &size); err != nil {
+		return
+	}
+
+	if r.width == 0 {
+		r.width, r.height = size.Width, size.Height
+	}
+
+	r.event("r", fmt.Sprintf("%dx%d", size.Width, size.Height))
+}
+
+// event appends an event to the recording. The caller must hold the lock.
+func (r *sessionRecording) event(kind, data string) {
+	if r.truncated {
+		return
+	}
+
+	line, err := json.Marshal([]interface{}{time.Since(r.started).Seconds(), kind, data})
+	if err != nil {
+		return
+	}
+
+	if r.events.Len()+len(line) > recordingMaxSize {
+		r.truncated = true
+		line, _ = json.Marshal([]interface{}{time.Since(r.started).Seconds(), "m", "the recording reached its size limit"})
+	}
+
+	r.events.Write(line)
+	r.events.WriteByte('\n')
+}
+
+// finish writes the recording to the spool, to be uploaded to the server
+func (r *sessionRecording) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	width, height := r.width, r.height
+	if width == 0 {
+		width, height = 80, 24
+	}
+
+	header, err := json.Marshal(map[string]interface{}{
+		"version":   2,
+		"width":     width,
+		"height":    height,
+		"timestamp": r.started.Unix(),
+		"title":     fmt.Sprintf("%s %s/%s %s", r.info.Kind, r.info.Namespace, r.info.Pod, r.info.Command),
+	})
+	if err != nil {
+		logging.S.Errorf("recording session of %s: %v", r.info.Identity, err)
+		return
+	}
+
+	r.info.Started = api.Time(r.started)
+	r.info.Ended = api.Time(time.Now())
+	r.info.Cast = append(append(header, '\n'), r.events.Bytes()...)
+
+	if err := r.recorder.spoolRecording(&r.info); err != nil {
+		logging.S.Errorf("spooling session recording of %s: %v", r.info.Identity, err)
+	}
+}
+
+func (r *recorder) spoolRecording(recording *api.CreateSessionRecordingRequest) error {
+	if err := os.MkdirAll(r.spool, 0o700); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(recording)
+	if err != nil {
+		return err
+	}
+
+	// recordings are named by time, so they are uploaded in the order they finished
+	name := fmt.Sprintf("%d-%s.json", time.Now().UnixNano(), uid.New())
+	tmp := filepath.Join(r.spool, name+".tmp")
+
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(r.spool, name))
+}
+
+// upload sends the spooled recordings to the server, and removes the ones that were uploaded
+func (r *recorder) upload(client *api.Client) error {
+	entries, err := os.ReadDir(r.spool)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	var names []string
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(r.spool, name)
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		recording := &api.CreateSessionRecordingRequest{}
+		if err := json.Unmarshal(raw, recording); err != nil {
+			logging.S.Warnf("removing invalid session recording %s: %v", name, err)
+			_ = os.Remove(path)
+
+			continue
+		}
+
+		if _, err := client.CreateSessionRecording(recording); err != nil {
+			return fmt.Errorf("upload session recording: %w", err)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// spdyReader parses the frames of one direction of a SPDY connection. Frames are parsed once they were read
+// completely, so the framer never blocks on a partial frame.
+type spdyReader struct {
+	pending []byte
+	frames  bytes.Buffer
+	framer  *spdy.Framer
+}
+
+func newSPDYReader() *spdyReader {
+	r := &spdyReader{}
+
+	// the framer only fails to create its header compressor, which has a fixed configuration
+	r.framer, _ = spdy.NewFramer(io.Discard, &r.frames)
+
+	return r
+}
+
+// write adds data read from the connection, and returns the frames it completed
+func (r *spdyReader) write(p []byte) ([]spdy.Frame, error) {
+	r.pending = append(r.pending, p...)
+
+	var frames []spdy.Frame
+
+	// every frame has an 8 byte header, which ends with the 24 bit length of the frame
+	for len(r.pending) >= 8 {
+		length := int(binary.BigEndian.Uint32(r.pending[4:8]) & 0xffffff)
+		if len(r.pending) < 8+length {
+			break
+		}
+
+		r.frames.Write(r.pending[:8+length])
+		r.pending = r.pending[8+length:]
+
+		frame, err := r.framer.ReadFrame()
+		if err != nil {
+			return frames, err
+		}
+
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
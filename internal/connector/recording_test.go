@@ -0,0 +1,149 @@
+package connector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moby/spdystream/spdy"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+)
+
+// spdyFrames encodes frames the way kubectl and the API server write them
+func spdyFrames(t *testing.T, frames ...spdy.Frame) []byte {
+	var buf bytes.Buffer
+
+	framer, err := spdy.NewFramer(&buf, &bytes.Buffer{})
+	assert.NilError(t, err)
+
+	for _, frame := range frames {
+		assert.NilError(t, framer.WriteFrame(frame))
+	}
+
+	return buf.Bytes()
+}
+
+func synStream(id spdy.StreamId, streamType string) *spdy.SynStreamFrame {
+	return &spdy.SynStreamFrame{StreamId: id, Headers: http.Header{"Streamtype": []string{streamType}}}
+}
+
+// writeChunks writes data a few bytes at a time, so frames are split across reads
+func writeChunks(data []byte, write func([]byte)) {
+	for len(data) > 0 {
+		n := 3
+		if n > len(data) {
+			n = len(data)
+		}
+
+		write(data[:n])
+		data = data[n:]
+	}
+}
+
+func TestSessionRecording(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "recordings")
+	r := newRecorder("kubernetes.test", spool)
+
+	recording := &sessionRecording{
+		recorder: r,
+		info:     api.CreateSessionRecordingRequest{Destination: "kubernetes.test", Identity: "alice@example.com", Kind: "exec", Namespace: "default", Pod: "web", Command: "sh"},
+		streams:  make(map[spdy.StreamId]spdyStream),
+	}
+
+	recording.start(true)
+
+	writeChunks(spdyFrames(t,
+		synStream(1, "error"),
+		synStream(3, "stdin"),
+		synStream(5, "stdout"),
+		synStream(7, "resize"),
+		&spdy.DataFrame{StreamId: 7, Data: []byte(`{"Width":120,"Height":40}`)},
+		&spdy.DataFrame{StreamId: 3, Data: []byte("ls\r")},
+	), recording.fromClient)
+
+	writeChunks(spdyFrames(t,
+		&spdy.SynReplyFrame{StreamId: 5, Headers: http.Header{}},
+		&spdy.DataFrame{StreamId: 5, Data: []byte("bin  etc  usr\r\n")},
+	), recording.fromServer)
+
+	recording.finish()
+
+	entries, err := os.ReadDir(spool)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+
+	raw, err := os.ReadFile(filepath.Join(spool, entries[0].Name()))
+	assert.NilError(t, err)
+
+	spooled := &api.CreateSessionRecordingRequest{}
+	assert.NilError(t, json.Unmarshal(raw, spooled))
+	assert.Equal(t, spooled.Identity, "alice@example.com")
+
+	scanner := bufio.NewScanner(bytes.NewReader(spooled.Cast))
+
+	assert.Assert(t, scanner.Scan())
+
+	var header struct {
+		Version int
+		Width   int
+		Height  int
+		Title   string
+	}
+
+	assert.NilError(t, json.Unmarshal(scanner.Bytes(), &header))
+	assert.Equal(t, header.Version, 2)
+	assert.Equal(t, header.Width, 120)
+	assert.Equal(t, header.Height, 40)
+	assert.Equal(t, header.Title, "exec default/web sh")
+
+	var events []string
+
+	for scanner.Scan() {
+		var event []interface{}
+		assert.NilError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event[1].(string)+" "+event[2].(string))
+	}
+
+	assert.DeepEqual(t, events, []string{"r 120x40", "i ls\r", "o bin  etc  usr\r\n"})
+
+	t.Run("upload", func(t *testing.T) {
+		var uploaded []api.CreateSessionRecordingRequest
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := api.CreateSessionRecordingRequest{}
+			assert.NilError(t, json.NewDecoder(r.Body).Decode(&req))
+			uploaded = append(uploaded, req)
+
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("{}"))
+		}))
+		t.Cleanup(srv.Close)
+
+		err := r.upload(&api.Client{URL: srv.URL})
+		assert.NilError(t, err)
+		assert.Equal(t, len(uploaded), 1)
+		assert.Assert(t, strings.Contains(string(uploaded[0].Cast), "bin  etc  usr"))
+
+		entries, err := os.ReadDir(spool)
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 0)
+	})
+}
+
+func TestSessionRecordingNotSPDY(t *testing.T) {
+	r := newRecorder("kubernetes.test", t.TempDir())
+
+	recording := &sessionRecording{recorder: r, streams: make(map[spdy.StreamId]spdyStream)}
+	recording.start(false)
+	recording.fromClient([]byte("not parsed"))
+
+	assert.Assert(t, strings.Contains(recording.events.String(), "only recorded for SPDY"))
+}
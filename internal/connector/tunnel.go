@@ -0,0 +1,122 @@
+package connector
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/hashicorp/yamux"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/uid"
+)
+
+// tunnel is the connection the connector opens to the server when its cluster accepts no inbound connections.
+// The server proxies requests for the destination over the tunnel, opening a stream for each connection, and the
+// connector serves them like the requests it receives directly.
+type tunnel struct {
+	transport *http.Transport
+
+	// requests are served once the handler is set
+	ready   chan struct{}
+	handler http.Handler
+
+	mu      sync.Mutex
+	session *yamux.Session
+}
+
+func newTunnel(transport *http.Transport) *tunnel {
+	// the connection to the server is upgraded to the tunnel, which HTTP/2 does not support
+	transport = transport.Clone()
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+
+	return &tunnel{transport: transport, ready: make(chan struct{})}
+}
+
+// serve sets the handler for the requests proxied through the tunnel
+func (t *tunnel) serve(handler http.Handler) {
+	t.handler = tunnelClientHandler(handler)
+	close(t.ready)
+}
+
+// tunnelClientHandler sets the client address of requests through the tunnel to the one the server passed on. Only
+// the server is at the other end of the tunnel, so its header is trusted, and forwarded headers are not, as they
+// would otherwise be trusted by the address of the server.
+func tunnelClientHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := net.ParseIP(r.Header.Get(api.DestinationTunnelClientHeader)); ip != nil {
+			r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+		}
+
+		r.Header.Del(api.DestinationTunnelClientHeader)
+		r.Header.Del("X-Forwarded-For")
+		r.Header.Del("X-Real-Ip")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// connect opens the tunnel for the destination, unless it is open already
+func (t *tunnel) connect(client *api.Client, id uid.ID) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.session != nil && !t.session.IsClosed() {
+		return nil
+	}
+
+	tunnelClient := *client
+	tunnelClient.HTTP = http.Client{Transport: t.transport}
+
+	conn, err := tunnelClient.OpenDestinationTunnel(id)
+	if err != nil {
+		return err
+	}
+
+	// the server opens the streams, so the connector is the server side of the session
+	session, err := yamux.Server(conn, tunnelConfig())
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	t.session = session
+
+	logging.S.Info("tunnel opened to the server")
+
+	go func() {
+		<-t.ready
+
+		server := &http.Server{
+			Handler:  t.handler,
+			ErrorLog: logging.StandardErrorLog(),
+		}
+
+		// the session stops accepting streams when the tunnel closes, and the connector opens it again
+		err := server.Serve(session)
+		logging.S.Infof("tunnel closed: %v", err)
+	}()
+
+	return nil
+}
+
+func (t *tunnel) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.session != nil {
+		_ = t.session.Close()
+	}
+}
+
+func tunnelConfig() *yamux.Config {
+	config := yamux.DefaultConfig()
+	// the session ending is logged when the tunnel closes
+	config.LogOutput = io.Discard
+
+	return config
+}
@@ -0,0 +1,101 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/yamux"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestTunnel(t *testing.T) {
+	id := uid.New()
+	sessions := make(chan *yamux.Session, 1)
+
+	// the server upgrades the connection, and opens a stream for each request it proxies
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/v1/destinations/%s/tunnel", id) || r.Header.Get("Upgrade") != api.DestinationTunnelProtocol {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer the-access-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		hijacker, ok := w.(http.Hijacker)
+		assert.Assert(t, ok)
+
+		conn, rw, err := hijacker.Hijack()
+		assert.NilError(t, err)
+
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", api.DestinationTunnelProtocol)
+		assert.NilError(t, rw.Flush())
+
+		session, err := yamux.Client(conn, tunnelConfig())
+		assert.NilError(t, err)
+
+		sessions <- session
+	}))
+	t.Cleanup(srv.Close)
+
+	transport, ok := srv.Client().Transport.(*http.Transport)
+	assert.Assert(t, ok)
+
+	client := &api.Client{URL: srv.URL, AccessKey: "the-access-key"}
+
+	tun := newTunnel(transport)
+	tun.serve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		assert.Check(t, err)
+		fmt.Fprintf(w, "proxied %s from %s %s", r.URL.Path, host, r.Header.Get("X-Forwarded-For"))
+	}))
+	t.Cleanup(tun.close)
+
+	t.Run("unauthorized", func(t *testing.T) {
+		err := tun.connect(&api.Client{URL: srv.URL, AccessKey: "wrong"}, id)
+		assert.ErrorIs(t, err, api.ErrUnauthorized)
+	})
+
+	err := tun.connect(client, id)
+	assert.NilError(t, err)
+
+	session := <-sessions
+	t.Cleanup(func() { session.Close() })
+
+	// the tunnel is only opened once
+	err = tun.connect(client, id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(sessions), 0)
+
+	proxied := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return session.Open()
+			},
+		},
+	}
+
+	// the client address is the one the server passed on, forwarded headers are not trusted from the server
+	req, err := http.NewRequest(http.MethodGet, "http://connector/api/v1/namespaces", nil)
+	assert.NilError(t, err)
+	req.Header.Set(api.DestinationTunnelClientHeader, "203.0.113.7")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+
+	resp, err := proxied.Do(req)
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, string(body), "proxied /api/v1/namespaces from 203.0.113.7 ")
+}
@@ -17,12 +17,15 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/jessevdk/go-flags"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	rest "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/secrets"
@@ -31,6 +34,7 @@ import (
 const (
 	namespaceFilePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 	caFilePath        = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	tokenFilePath     = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 )
 
 type Kubernetes struct {
@@ -63,17 +67,24 @@ func NewKubernetes() (*Kubernetes, error) {
 	return k, err
 }
 
-// namespaceRole is used as a tuple to pair namespaces and grants as a map key
+// namespaceRole is used as a tuple to pair namespaces and grants as a map key. In a namespace, ClusterRole names a
+// Role in the namespace when one exists, or a ClusterRole otherwise.
 type ClusterRoleNamespace struct {
 	ClusterRole string
 	Namespace   string
 }
 
-// UpdateClusterRoleBindings generates ClusterRoleBindings for GrantMappings
-func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subject) error {
+// SkippedRoleBinding is a role binding that was not created for the grants of a role, and why
+type SkippedRoleBinding struct {
+	ClusterRoleNamespace
+	Reason string
+}
+
+// UpdateClusterRoleBindings generates ClusterRoleBindings for GrantMappings, and returns the bindings skipped
+func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subject) ([]SkippedRoleBinding, error) {
 	clientset, err := kubernetes.NewForConfig(k.Config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// store which cluster-roles currently exist locally
@@ -81,7 +92,7 @@ func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subj
 
 	crs, err := clientset.RbacV1().ClusterRoles().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, cr := range crs.Items {
@@ -90,9 +101,16 @@ func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subj
 
 	crbs := []*rbacv1.ClusterRoleBinding{}
 
+	var skipped []SkippedRoleBinding
+
 	for cr, subjs := range subjects {
 		if !validClusterRoles[cr] {
 			logging.S.Warnf("cluster role binding %s skipped, it does not exist", cr)
+			skipped = append(skipped, SkippedRoleBinding{
+				ClusterRoleNamespace: ClusterRoleNamespace{ClusterRole: cr},
+				Reason:               fmt.Sprintf("cluster role %q does not exist", cr),
+			})
+
 			continue
 		}
 
@@ -114,7 +132,7 @@ func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subj
 
 	existingInfraCrbs, err := clientset.RbacV1().ClusterRoleBindings().List(context.Background(), metav1.ListOptions{LabelSelector: "app.kubernetes.io/managed-by=infra"})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	toDelete := make(map[string]bool)
@@ -129,10 +147,10 @@ func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subj
 			if k8sErrors.IsNotFound(err) {
 				_, err = clientset.RbacV1().ClusterRoleBindings().Create(context.Background(), crb, metav1.CreateOptions{})
 				if err != nil {
-					return err
+					return nil, err
 				}
 			} else {
-				return err
+				return nil, err
 			}
 		}
 
@@ -142,17 +160,19 @@ func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subj
 	for name := range toDelete {
 		err := clientset.RbacV1().ClusterRoleBindings().Delete(context.Background(), name, metav1.DeleteOptions{})
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return skipped, nil
 }
 
-func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbacv1.Subject) error {
+// UpdateRoleBindings generates RoleBindings for the grants in each namespace, to a Role in the namespace when one
+// exists with the name granted, or to the ClusterRole otherwise. It returns the bindings skipped.
+func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbacv1.Subject) ([]SkippedRoleBinding, error) {
 	clientset, err := kubernetes.NewForConfig(k.Config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// store which cluster-roles currently exist locally
@@ -160,42 +180,62 @@ func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbac
 
 	crs, err := clientset.RbacV1().ClusterRoles().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, cr := range crs.Items {
 		validClusterRoles[cr.Name] = true
 	}
 
+	// and which roles exist in each namespace
+	validRoles := make(map[string]map[string]bool)
+
+	roles, err := clientset.RbacV1().Roles("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range roles.Items {
+		if validRoles[r.Namespace] == nil {
+			validRoles[r.Namespace] = make(map[string]bool)
+		}
+
+		validRoles[r.Namespace][r.Name] = true
+	}
+
 	// create the namespaced role bindings for all the users of each of the role assignments
 	rbs := []*rbacv1.RoleBinding{}
 
+	var skipped []SkippedRoleBinding
+
 	for crn, subjs := range subjects {
-		if !validClusterRoles[crn.ClusterRole] {
-			logging.S.Warnf("cluster role binding %s skipped, it does not exist", crn.ClusterRole)
+		roleRef, ok := namespacedRoleRef(crn, validRoles, validClusterRoles)
+		if !ok {
+			logging.S.Warnf("role binding %s in namespace %s skipped, no role or cluster role exists by that name", crn.ClusterRole, crn.Namespace)
+			skipped = append(skipped, SkippedRoleBinding{
+				ClusterRoleNamespace: crn,
+				Reason:               fmt.Sprintf("no role %q exists in namespace %q, and no cluster role by that name", crn.ClusterRole, crn.Namespace),
+			})
+
 			continue
 		}
 
 		rbs = append(rbs, &rbacv1.RoleBinding{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: fmt.Sprintf("infra:%s", crn.ClusterRole),
+				Name: roleBindingName(roleRef),
 				Labels: map[string]string{
 					"app.kubernetes.io/managed-by": "infra",
 				},
 				Namespace: crn.Namespace,
 			},
 			Subjects: subjs,
-			RoleRef: rbacv1.RoleRef{
-				APIGroup: "rbac.authorization.k8s.io",
-				Kind:     "ClusterRole",
-				Name:     crn.ClusterRole,
-			},
+			RoleRef:  roleRef,
 		})
 	}
 
 	existingInfraRbs, err := clientset.RbacV1().RoleBindings("").List(context.TODO(), metav1.ListOptions{LabelSelector: "app.kubernetes.io/managed-by=infra"})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	type rbIdentifier struct {
@@ -224,13 +264,18 @@ func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbac
 						// the namespace does not exist
 						// we can proceed in this case, the role mapping is just not applicable to this cluster
 						logging.S.Warnf("skipping unapplicable namespace for this cluster: %s %s", rb.Namespace, err.Error())
+						skipped = append(skipped, SkippedRoleBinding{
+							ClusterRoleNamespace: ClusterRoleNamespace{ClusterRole: rb.RoleRef.Name, Namespace: rb.Namespace},
+							Reason:               fmt.Sprintf("namespace %q does not exist", rb.Namespace),
+						})
+
 						continue
 					}
 
-					return err
+					return nil, err
 				}
 			} else {
-				return err
+				return nil, err
 			}
 		}
 		// remove anything we update or create from the previous RoleBindings that will be deleted
@@ -242,11 +287,98 @@ func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbac
 	for _, td := range toDelete {
 		err := clientset.RbacV1().RoleBindings(td.Namespace).Delete(context.TODO(), td.Name, metav1.DeleteOptions{})
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return skipped, nil
+}
+
+// namespacedRoleRef is the role a binding in a namespace refers to. A Role defined in the namespace takes
+// precedence over a ClusterRole with the same name.
+func namespacedRoleRef(crn ClusterRoleNamespace, roles map[string]map[string]bool, clusterRoles map[string]bool) (rbacv1.RoleRef, bool) {
+	switch {
+	case roles[crn.Namespace][crn.ClusterRole]:
+		return rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: crn.ClusterRole}, true
+	case clusterRoles[crn.ClusterRole]:
+		return rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: crn.ClusterRole}, true
+	default:
+		return rbacv1.RoleRef{}, false
+	}
+}
+
+// roleBindingName names bindings to Roles apart from bindings to ClusterRoles, as the role a binding refers to can
+// not be changed
+func roleBindingName(roleRef rbacv1.RoleRef) string {
+	if roleRef.Kind == "Role" {
+		return fmt.Sprintf("infra:role:%s", roleRef.Name)
+	}
+
+	return fmt.Sprintf("infra:%s", roleRef.Name)
+}
+
+// NamespaceLabels returns the labels of each namespace
+func (k *Kubernetes) NamespaceLabels() (map[string]map[string]string, error) {
+	clientset, err := kubernetes.NewForConfig(k.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces, err := clientset.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]map[string]string, len(namespaces.Items))
+	for _, n := range namespaces.Items {
+		results[n.Name] = n.Labels
+	}
+
+	return results, nil
+}
+
+// RoleRules returns the rules of each role, by namespace and name
+func (k *Kubernetes) RoleRules() (map[string]map[string][]rbacv1.PolicyRule, error) {
+	clientset, err := kubernetes.NewForConfig(k.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := clientset.RbacV1().Roles("").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string]map[string][]rbacv1.PolicyRule)
+	for _, r := range roles.Items {
+		if rules[r.Namespace] == nil {
+			rules[r.Namespace] = make(map[string][]rbacv1.PolicyRule)
+		}
+
+		rules[r.Namespace][r.Name] = r.Rules
+	}
+
+	return rules, nil
+}
+
+// ClusterRoleRules returns the rules of each cluster role, including the rules aggregated into it
+func (k *Kubernetes) ClusterRoleRules() (map[string][]rbacv1.PolicyRule, error) {
+	clientset, err := kubernetes.NewForConfig(k.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	crs, err := clientset.RbacV1().ClusterRoles().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string][]rbacv1.PolicyRule, len(crs.Items))
+	for _, cr := range crs.Items {
+		rules[cr.Name] = cr.Rules
+	}
+
+	return rules, nil
 }
 
 func (k *Kubernetes) Namespaces() ([]string, error) {
@@ -460,6 +592,128 @@ func (k *Kubernetes) kubeControllerManagerClusterName() (string, error) {
 	return opts.ClusterName, nil
 }
 
+// Labels set on destinations from the metadata of the cloud the cluster runs in
+const (
+	LabelCloud  = "infrahq.com/cloud"
+	LabelRegion = "topology.kubernetes.io/region"
+	LabelZone   = "topology.kubernetes.io/zone"
+)
+
+// CloudLabels are labels for the cloud, region, and zone of an EKS, GKE, or AKS cluster, read from the instance
+// metadata service. Clusters elsewhere have no cloud labels.
+func (k *Kubernetes) CloudLabels() map[string]string {
+	// 169.254.169.254 is an address used by cloud platforms for instance metadata
+	if _, err := net.DialTimeout("tcp", "169.254.169.254:80", 1*time.Second); err != nil {
+		return nil
+	}
+
+	if labels, err := k.ec2Labels(); err == nil {
+		return labels
+	}
+
+	if labels, err := k.gkeLabels(); err == nil {
+		return labels
+	}
+
+	if labels, err := k.aksLabels(); err == nil {
+		return labels
+	}
+
+	logging.L.Debug("could not read cloud labels from the instance metadata service")
+
+	return nil
+}
+
+func instanceMetadata(url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = header
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("received non-OK code from metadata service")
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+func (k *Kubernetes) ec2Labels() (map[string]string, error) {
+	body, err := instanceMetadata("http://169.254.169.254/latest/dynamic/instance-identity/document", http.Header{})
+	if err != nil {
+		return nil, err
+	}
+
+	var identity struct {
+		Region           string
+		AvailabilityZone string
+	}
+
+	if err := json.Unmarshal(body, &identity); err != nil {
+		return nil, err
+	}
+
+	if identity.Region == "" {
+		return nil, errors.New("no region in instance identity document")
+	}
+
+	return map[string]string{LabelCloud: "aws", LabelRegion: identity.Region, LabelZone: identity.AvailabilityZone}, nil
+}
+
+func (k *Kubernetes) gkeLabels() (map[string]string, error) {
+	// the zone is returned as projects/<project number>/zones/<zone>
+	body, err := instanceMetadata("http://169.254.169.254/computeMetadata/v1/instance/zone", http.Header{"Metadata-Flavor": []string{"Google"}})
+	if err != nil {
+		return nil, err
+	}
+
+	zone := string(body)
+	zone = zone[strings.LastIndexByte(zone, '/')+1:]
+
+	i := strings.LastIndexByte(zone, '-')
+	if i < 0 {
+		return nil, fmt.Errorf("cannot parse the region from zone %q", zone)
+	}
+
+	return map[string]string{LabelCloud: "gcp", LabelRegion: zone[:i], LabelZone: zone}, nil
+}
+
+func (k *Kubernetes) aksLabels() (map[string]string, error) {
+	body, err := instanceMetadata("http://169.254.169.254/metadata/instance/compute?api-version=2021-02-01", http.Header{"Metadata": []string{"true"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var compute struct {
+		Location string
+		Zone     string
+	}
+
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return nil, err
+	}
+
+	if compute.Location == "" {
+		return nil, errors.New("no location in instance metadata")
+	}
+
+	labels := map[string]string{LabelCloud: "azure", LabelRegion: compute.Location}
+	if compute.Zone != "" {
+		labels[LabelZone] = compute.Location + "-" + compute.Zone
+	}
+
+	return labels, nil
+}
+
 func (k *Kubernetes) Name() (string, string, error) {
 	ca, err := CA()
 	if err != nil {
@@ -497,6 +751,65 @@ func (k *Kubernetes) Name() (string, string, error) {
 	return name, chksm, nil
 }
 
+// Timings of leader election, the defaults of Kubernetes controllers. A replica that stops renewing its lease
+// is replaced as the leader after at most LeaseDuration.
+const (
+	LeaseDuration = 15 * time.Second
+	RenewDeadline = 10 * time.Second
+	RetryPeriod   = 2 * time.Second
+)
+
+// LeaderElection prepares to campaign for a Lease in the namespace the process runs in. The returned function
+// campaigns until ctx is done. onChange is called with true when this replica starts leading, and with false when
+// it stops, e.g. because it could not renew the lease in time. A replica that stops leading campaigns again. The
+// lease is released when ctx is done, so another replica takes over without waiting for it to expire.
+func (k *Kubernetes) LeaderElection(lease, identity string, onChange func(leading bool)) (func(ctx context.Context), error) {
+	clientset, err := kubernetes.NewForConfig(k.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err := Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("read namespace: %w", err)
+	}
+
+	config := leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: lease, Namespace: strings.TrimSpace(namespace)},
+			Client:     clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   LeaseDuration,
+		RenewDeadline:   RenewDeadline,
+		RetryPeriod:     RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            lease,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) { onChange(true) },
+			OnStoppedLeading: func() { onChange(false) },
+		},
+	}
+
+	// validates the config before campaigning starts
+	if _, err := leaderelection.NewLeaderElector(config); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context) {
+		for ctx.Err() == nil {
+			elector, err := leaderelection.NewLeaderElector(config)
+			if err != nil {
+				logging.S.Errorf("leader election: %v", err)
+				return
+			}
+
+			// Run returns when this replica stops leading
+			elector.Run(ctx)
+		}
+	}, nil
+}
+
 func Namespace() (string, error) {
 	contents, err := ioutil.ReadFile(namespaceFilePath)
 	if err != nil {
@@ -515,6 +828,54 @@ func CA() ([]byte, error) {
 	return contents, nil
 }
 
+// ServiceAccountToken reads the token of the service account the process runs as. The token is
+// rotated by the kubelet, so it should be read again each time it is used.
+func ServiceAccountToken() (string, error) {
+	contents, err := ioutil.ReadFile(tokenFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// ReviewToken asks a cluster's API server who a service account token belongs to, and returns
+// the username of the service account, e.g. system:serviceaccount:infra:infra-connector.
+// When reviewerToken is empty the token reviews itself, which requires the service account to be
+// bound to the system:auth-delegator cluster role.
+func ReviewToken(ctx context.Context, host string, ca []byte, reviewerToken, token string) (string, error) {
+	if reviewerToken == "" {
+		reviewerToken = token
+	}
+
+	config := &rest.Config{
+		Host:            host,
+		BearerToken:     reviewerToken,
+		TLSClientConfig: rest.TLSClientConfig{CAData: ca},
+		Timeout:         10 * time.Second,
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return "", err
+	}
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}
+
+	review, err = clientset.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("token review: %w", err)
+	}
+
+	if !review.Status.Authenticated {
+		return "", fmt.Errorf("token not authenticated: %s", review.Status.Error)
+	}
+
+	return review.Status.User.Username, nil
+}
+
 // Find the first suitable Service, filtering on infrahq.com/component
 func (k *Kubernetes) Service(component string) (*corev1.Service, error) {
 	clientset, err := kubernetes.NewForConfig(k.Config)
@@ -0,0 +1,43 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestNamespacedRoleRef(t *testing.T) {
+	roles := map[string]map[string]bool{
+		"web": {"deployer": true, "edit": true},
+	}
+
+	clusterRoles := map[string]bool{"edit": true, "view": true}
+
+	type testCase struct {
+		crn      ClusterRoleNamespace
+		kind     string
+		expected string
+	}
+
+	testCases := []testCase{
+		{crn: ClusterRoleNamespace{ClusterRole: "deployer", Namespace: "web"}, kind: "Role", expected: "infra:role:deployer"},
+		// a role in the namespace takes precedence over the cluster role
+		{crn: ClusterRoleNamespace{ClusterRole: "edit", Namespace: "web"}, kind: "Role", expected: "infra:role:edit"},
+		{crn: ClusterRoleNamespace{ClusterRole: "edit", Namespace: "default"}, kind: "ClusterRole", expected: "infra:edit"},
+		{crn: ClusterRoleNamespace{ClusterRole: "view", Namespace: "web"}, kind: "ClusterRole", expected: "infra:view"},
+		{crn: ClusterRoleNamespace{ClusterRole: "deployer", Namespace: "default"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.crn.Namespace+"/"+tc.crn.ClusterRole, func(t *testing.T) {
+			roleRef, ok := namespacedRoleRef(tc.crn, roles, clusterRoles)
+			assert.Equal(t, ok, tc.kind != "")
+
+			if ok {
+				assert.Equal(t, roleRef.Kind, tc.kind)
+				assert.Equal(t, roleRef.Name, tc.crn.ClusterRole)
+				assert.Equal(t, roleBindingName(roleRef), tc.expected)
+			}
+		})
+	}
+}
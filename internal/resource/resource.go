@@ -0,0 +1,531 @@
+// Package resource parses the resource patterns grants are made on, and matches them against the names of
+// resources.
+//
+// A pattern is a dot-separated list of segments, such as kubernetes.production.default. Each segment is
+// matched against the same segment of a resource name, and may contain * to match any characters, e.g.
+// kubernetes.*.team-a-*. A segment may end with a label selector in brackets, which the labels of the resource
+// it names must match, e.g. kubernetes.*[env=prod].*[team=a]. A selector on the first segment, which is only the
+// kind of the resource, applies to the resource named by the first two segments, so kubernetes[env=prod].*.* is
+// every namespace in every cluster labeled env=prod.
+//
+// A pattern only matches names with as many segments as the pattern, so a grant on a cluster does not match
+// its namespaces.
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Pattern is a parsed resource pattern
+type Pattern struct {
+	Segments []Segment
+}
+
+// Segment is one dot-separated part of a pattern
+type Segment struct {
+	// Glob is matched against the segment of a name, * matches any characters
+	Glob string
+	// Selector is matched against the labels of the resource the segment names, it may be empty
+	Selector Selector
+}
+
+// Selector is a list of requirements on labels, all of which must be met
+type Selector []Requirement
+
+// Operators of selector requirements
+const (
+	OperatorEquals       = "="
+	OperatorNotEquals    = "!="
+	OperatorExists       = "exists"
+	OperatorDoesNotExist = "!"
+)
+
+// Requirement is a requirement on one label, e.g. env=prod, env!=prod, env, or !env
+type Requirement struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// Labels looks up the labels of a resource by its name, e.g. kubernetes.production. It returns nil for
+// resources it does not know the labels of.
+type Labels func(name string) map[string]string
+
+var (
+	ErrInvalidPattern  = errors.New("invalid resource pattern")
+	ErrInvalidSelector = errors.New("invalid label selector")
+	ErrInvalidLabels   = errors.New("invalid labels")
+)
+
+// Parse parses a resource pattern. Names without wildcards or selectors, such as kubernetes.production, are
+// patterns that only match themselves.
+func Parse(s string) (*Pattern, error) {
+	if s == "" {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidPattern)
+	}
+
+	var (
+		segments []string
+		start    int
+		depth    int
+	)
+
+	for i, r := range s {
+		switch r {
+		case '[':
+			if depth > 0 {
+				return nil, fmt.Errorf("%w: %q has nested brackets", ErrInvalidPattern, s)
+			}
+
+			depth++
+		case ']':
+			if depth == 0 {
+				return nil, fmt.Errorf("%w: %q has an unopened bracket", ErrInvalidPattern, s)
+			}
+
+			depth--
+		case '.':
+			// label keys and values may contain dots, e.g. topology.kubernetes.io/region=us-east-1
+			if depth == 0 {
+				segments = append(segments, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	if depth > 0 {
+		return nil, fmt.Errorf("%w: %q has an unclosed bracket", ErrInvalidPattern, s)
+	}
+
+	segments = append(segments, s[start:])
+
+	p := &Pattern{}
+
+	for _, raw := range segments {
+		segment, err := parseSegment(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %s", ErrInvalidPattern, s, err)
+		}
+
+		p.Segments = append(p.Segments, segment)
+	}
+
+	return p, nil
+}
+
+func parseSegment(raw string) (Segment, error) {
+	glob := raw
+	segment := Segment{}
+
+	if i := strings.IndexByte(raw, '['); i >= 0 {
+		if !strings.HasSuffix(raw, "]") {
+			return segment, fmt.Errorf("selector in %q must end the segment", raw)
+		}
+
+		selector, err := parseSelector(raw[i+1 : len(raw)-1])
+		if err != nil {
+			return segment, err
+		}
+
+		glob = raw[:i]
+		segment.Selector = selector
+	}
+
+	switch {
+	case glob == "":
+		return segment, errors.New("empty segment")
+	case strings.ContainsAny(glob, " \t\n"):
+		return segment, fmt.Errorf("segment %q contains whitespace", glob)
+	}
+
+	segment.Glob = glob
+
+	return segment, nil
+}
+
+func parseSelector(raw string) (Selector, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, errors.New("empty selector")
+	}
+
+	var selector Selector
+
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+
+		var req Requirement
+
+		switch {
+		case strings.Contains(part, "!="):
+			key, value, _ := strings.Cut(part, "!=")
+			req = Requirement{Key: strings.TrimSpace(key), Operator: OperatorNotEquals, Value: strings.TrimSpace(value)}
+		case strings.Contains(part, "="):
+			key, value, _ := strings.Cut(part, "=")
+			req = Requirement{Key: strings.TrimSpace(key), Operator: OperatorEquals, Value: strings.TrimSpace(value)}
+		case strings.HasPrefix(part, "!"):
+			req = Requirement{Key: strings.TrimSpace(part[1:]), Operator: OperatorDoesNotExist}
+		default:
+			req = Requirement{Key: part, Operator: OperatorExists}
+		}
+
+		if req.Key == "" {
+			return nil, fmt.Errorf("selector requirement %q has no label", part)
+		}
+
+		if strings.ContainsAny(req.Key+req.Value, "=! \t\n") {
+			return nil, fmt.Errorf("invalid selector requirement %q", part)
+		}
+
+		selector = append(selector, req)
+	}
+
+	return selector, nil
+}
+
+// ParseSelector parses a label selector, such as env=prod,region!=us-east-1. An empty selector matches all labels.
+func ParseSelector(s string) (Selector, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	selector, err := parseSelector(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSelector, err)
+	}
+
+	return selector, nil
+}
+
+// labelReserved are the characters of the selector syntax, which labels can not contain
+const labelReserved = "=!,[] \t\n"
+
+// ValidateLabels checks that labels can be matched by selectors. Keys must not be empty, values may be.
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		switch {
+		case key == "":
+			return fmt.Errorf("%w: empty label key", ErrInvalidLabels)
+		case strings.ContainsAny(key, labelReserved):
+			return fmt.Errorf("%w: label key %q must not contain any of %q", ErrInvalidLabels, key, labelReserved)
+		case strings.ContainsAny(value, labelReserved):
+			return fmt.Errorf("%w: value of label %q must not contain any of %q", ErrInvalidLabels, key, labelReserved)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that a pattern can be parsed
+func Validate(s string) error {
+	_, err := Parse(s)
+	return err
+}
+
+// Match reports whether a pattern matches the name of a resource. Patterns that can not be parsed match nothing.
+func Match(pattern, name string, labels Labels) bool {
+	p, err := Parse(pattern)
+	if err != nil {
+		return false
+	}
+
+	return p.Match(name, labels)
+}
+
+// Match reports whether the pattern matches the name of a resource, looking up the labels of the resources its
+// selectors apply to. labels may be nil when no labels are known.
+func (p *Pattern) Match(name string, labels Labels) bool {
+	parts := strings.Split(name, ".")
+	if len(parts) != len(p.Segments) {
+		return false
+	}
+
+	return p.matchSegments(parts, len(parts), labels)
+}
+
+// Contains reports whether a pattern matches the name of a resource or of a resource under it. Patterns that can
+// not be parsed contain nothing.
+func Contains(pattern, name string, labels Labels) bool {
+	p, err := Parse(pattern)
+	if err != nil {
+		return false
+	}
+
+	return p.Contains(name, labels)
+}
+
+// Contains reports whether the pattern matches the leading segments of the name of a resource, e.g. whether
+// kubernetes.staging contains its namespace kubernetes.staging.default
+func (p *Pattern) Contains(name string, labels Labels) bool {
+	parts := strings.Split(name, ".")
+	if len(parts) < len(p.Segments) {
+		return false
+	}
+
+	return p.matchSegments(parts, len(p.Segments), labels)
+}
+
+// MatchPattern reports whether a pattern matches every resource another pattern can match, e.g. whether a grant on
+// kubernetes.* covers a grant on kubernetes.production. Patterns that can not be parsed match nothing.
+func MatchPattern(pattern, target string, labels Labels) bool {
+	p, err := Parse(pattern)
+	if err != nil {
+		return false
+	}
+
+	t, err := Parse(target)
+	if err != nil {
+		return false
+	}
+
+	return len(t.Segments) == len(p.Segments) && p.covers(t, labels)
+}
+
+// ContainsPattern reports whether a pattern contains every resource another pattern can match, or the resources
+// under them. Patterns that can not be parsed contain nothing.
+func ContainsPattern(pattern, target string, labels Labels) bool {
+	p, err := Parse(pattern)
+	if err != nil {
+		return false
+	}
+
+	t, err := Parse(target)
+	if err != nil {
+		return false
+	}
+
+	return len(t.Segments) >= len(p.Segments) && p.covers(t, labels)
+}
+
+// covers reports whether every name the target matches has leading segments the pattern matches. It only says so
+// when it can prove it: a wildcard in the target must be the same glob as the pattern's, a selector in the target
+// must repeat the pattern's selector, and a selector of the pattern must be repeated by the target or be met by the
+// labels of the resource the target names literally.
+func (p *Pattern) covers(t *Pattern, labels Labels) bool {
+	for i, segment := range p.Segments {
+		target := t.Segments[i]
+
+		switch {
+		case target.Glob == segment.Glob:
+		case strings.Contains(target.Glob, "*") || !glob(segment.Glob, target.Glob):
+			return false
+		}
+
+		if len(target.Selector) > 0 {
+			if len(segment.Selector) == 0 || !target.Selector.requires(segment.Selector) {
+				return false
+			}
+
+			continue
+		}
+
+		if len(segment.Selector) == 0 {
+			continue
+		}
+
+		// the first segment is a kind, its selector applies to the resource the next segment names
+		object := i
+		if i == 0 {
+			object = 1
+		}
+
+		if object >= len(t.Segments) || labels == nil {
+			return false
+		}
+
+		parts := make([]string, object+1)
+		for j, s := range t.Segments[:object+1] {
+			if strings.Contains(s.Glob, "*") {
+				return false
+			}
+
+			parts[j] = s.Glob
+		}
+
+		if !segment.Selector.Matches(labels(strings.Join(parts, "."))) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// requires reports whether the selector has every requirement of another, so it only matches labels the other does
+func (s Selector) requires(other Selector) bool {
+	for _, req := range other {
+		found := false
+
+		for _, r := range s {
+			if r == req {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MatchPrefix reports whether the leading segments of the pattern match the name of a resource, e.g. whether
+// kubernetes.*.default grants access to any namespaces of the cluster kubernetes.production
+func (p *Pattern) MatchPrefix(name string, labels Labels) bool {
+	parts := strings.Split(name, ".")
+	if len(parts) > len(p.Segments) {
+		return false
+	}
+
+	return p.matchSegments(parts, len(parts), labels)
+}
+
+// matchSegments matches the first n parts of a name against the segments of the pattern
+func (p *Pattern) matchSegments(parts []string, n int, labels Labels) bool {
+	for i, part := range parts[:n] {
+		segment := p.Segments[i]
+
+		if !glob(segment.Glob, part) {
+			return false
+		}
+
+		if len(segment.Selector) == 0 {
+			continue
+		}
+
+		// the first segment is a kind, its selector applies to the resource the next segment names
+		object := i
+		if i == 0 {
+			object = 1
+		}
+
+		if object >= len(parts) {
+			continue
+		}
+
+		var l map[string]string
+		if labels != nil {
+			l = labels(strings.Join(parts[:object+1], "."))
+		}
+
+		if !segment.Selector.Matches(l) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsLiteral reports whether the segment only matches its own name, with no wildcards or selector
+func (s Segment) IsLiteral() bool {
+	return len(s.Selector) == 0 && !strings.Contains(s.Glob, "*")
+}
+
+// IsLiteral reports whether the pattern only matches its own name
+func (p *Pattern) IsLiteral() bool {
+	for _, s := range p.Segments {
+		if !s.IsLiteral() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Kind is the first segment of the pattern, e.g. kubernetes
+func (p *Pattern) Kind() string {
+	return p.Segments[0].Glob
+}
+
+func (p *Pattern) String() string {
+	segments := make([]string, len(p.Segments))
+	for i, s := range p.Segments {
+		segments[i] = s.String()
+	}
+
+	return strings.Join(segments, ".")
+}
+
+func (s Segment) String() string {
+	if len(s.Selector) == 0 {
+		return s.Glob
+	}
+
+	return s.Glob + "[" + s.Selector.String() + "]"
+}
+
+// Matches reports whether labels meet every requirement of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, ok := labels[req.Key]
+
+		switch req.Operator {
+		case OperatorEquals:
+			if !ok || value != req.Value {
+				return false
+			}
+		case OperatorNotEquals:
+			if ok && value == req.Value {
+				return false
+			}
+		case OperatorExists:
+			if !ok {
+				return false
+			}
+		case OperatorDoesNotExist:
+			if ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (s Selector) String() string {
+	reqs := make([]string, len(s))
+
+	for i, req := range s {
+		switch req.Operator {
+		case OperatorExists:
+			reqs[i] = req.Key
+		case OperatorDoesNotExist:
+			reqs[i] = "!" + req.Key
+		default:
+			reqs[i] = req.Key + req.Operator + req.Value
+		}
+	}
+
+	return strings.Join(reqs, ",")
+}
+
+// glob matches a name against a pattern where * matches any characters
+func glob(pattern, name string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == name
+	}
+
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+
+	name = name[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	middle := parts[1 : len(parts)-1]
+
+	for _, part := range middle {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+
+		name = name[i+len(part):]
+	}
+
+	return len(name) >= len(last) && strings.HasSuffix(name, last)
+}
@@ -0,0 +1,245 @@
+package resource
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParse(t *testing.T) {
+	type testCase struct {
+		pattern  string
+		expected []Segment
+		err      string
+	}
+
+	testCases := []testCase{
+		{
+			pattern:  "kubernetes.production.default",
+			expected: []Segment{{Glob: "kubernetes"}, {Glob: "production"}, {Glob: "default"}},
+		},
+		{
+			pattern:  "kubernetes.*.team-a-*",
+			expected: []Segment{{Glob: "kubernetes"}, {Glob: "*"}, {Glob: "team-a-*"}},
+		},
+		{
+			pattern: "kubernetes[env=prod].*",
+			expected: []Segment{
+				{Glob: "kubernetes", Selector: Selector{{Key: "env", Operator: OperatorEquals, Value: "prod"}}},
+				{Glob: "*"},
+			},
+		},
+		{
+			pattern: "kubernetes.*[topology.kubernetes.io/region=us-east-1, tier!=free].*[team,!legacy]",
+			expected: []Segment{
+				{Glob: "kubernetes"},
+				{Glob: "*", Selector: Selector{
+					{Key: "topology.kubernetes.io/region", Operator: OperatorEquals, Value: "us-east-1"},
+					{Key: "tier", Operator: OperatorNotEquals, Value: "free"},
+				}},
+				{Glob: "*", Selector: Selector{
+					{Key: "team", Operator: OperatorExists},
+					{Key: "legacy", Operator: OperatorDoesNotExist},
+				}},
+			},
+		},
+		{pattern: "", err: "invalid resource pattern: empty"},
+		{pattern: "kubernetes..default", err: "empty segment"},
+		{pattern: "kubernetes.", err: "empty segment"},
+		{pattern: "kubernetes[env=prod", err: "unclosed bracket"},
+		{pattern: "kubernetes]", err: "unopened bracket"},
+		{pattern: "kubernetes[env=[prod]]", err: "nested brackets"},
+		{pattern: "kubernetes[env=prod]x.*", err: "must end the segment"},
+		{pattern: "kubernetes[].*", err: "empty selector"},
+		{pattern: "kubernetes[=prod].*", err: "has no label"},
+		{pattern: "kubernetes.pro duction", err: "contains whitespace"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			p, err := Parse(tc.pattern)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				assert.ErrorIs(t, err, ErrInvalidPattern)
+
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.DeepEqual(t, p.Segments, tc.expected)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	labels := func(name string) map[string]string {
+		return map[string]map[string]string{
+			"kubernetes.production":         {"env": "prod", "region": "us-east-1"},
+			"kubernetes.staging":            {"env": "staging"},
+			"kubernetes.production.team-a":  {"team": "a"},
+			"kubernetes.production.default": {},
+		}[name]
+	}
+
+	type testCase struct {
+		pattern string
+		name    string
+		match   bool
+	}
+
+	testCases := []testCase{
+		{pattern: "kubernetes.production", name: "kubernetes.production", match: true},
+		{pattern: "kubernetes.production", name: "kubernetes.production.default"},
+		{pattern: "kubernetes.production.default", name: "kubernetes.production"},
+		{pattern: "kubernetes.production", name: "kubernetes.productions"},
+		{pattern: "infra", name: "infra", match: true},
+
+		{pattern: "kubernetes.*", name: "kubernetes.production", match: true},
+		{pattern: "kubernetes.*", name: "kubernetes.production.default"},
+		{pattern: "kubernetes.*.team-a-*", name: "kubernetes.staging.team-a-api", match: true},
+		{pattern: "kubernetes.*.team-a-*", name: "kubernetes.staging.team-b-api"},
+		{pattern: "kubernetes.prod*-*-east", name: "kubernetes.production-us-east", match: true},
+		{pattern: "kubernetes.prod*-*-east", name: "kubernetes.production-us-west"},
+		{pattern: "*.production", name: "kubernetes.production", match: true},
+
+		{pattern: "kubernetes[env=prod]", name: "kubernetes.production"},
+		{pattern: "kubernetes[env=prod].*", name: "kubernetes.production", match: true},
+		{pattern: "kubernetes[env=prod].*", name: "kubernetes.staging"},
+		{pattern: "kubernetes[env=prod].*.*", name: "kubernetes.production.default", match: true},
+		{pattern: "kubernetes.*[env!=prod]", name: "kubernetes.staging", match: true},
+		{pattern: "kubernetes.*[env!=prod]", name: "kubernetes.production"},
+		{pattern: "kubernetes.*[region]", name: "kubernetes.production", match: true},
+		{pattern: "kubernetes.*[!region]", name: "kubernetes.staging", match: true},
+		{pattern: "kubernetes.*[env=prod,region=us-east-1]", name: "kubernetes.production", match: true},
+		{pattern: "kubernetes.*[env=prod,region=eu-west-1]", name: "kubernetes.production"},
+		{pattern: "kubernetes.*.*[team=a]", name: "kubernetes.production.team-a", match: true},
+		{pattern: "kubernetes.*.*[team=a]", name: "kubernetes.production.default"},
+		{pattern: "kubernetes.*[env=prod].*[team=a]", name: "kubernetes.staging.team-a"},
+
+		// selectors never match resources without labels
+		{pattern: "kubernetes.*[env=prod]", name: "kubernetes.unknown"},
+
+		{pattern: "kubernetes.[", name: "kubernetes.["},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.name, func(t *testing.T) {
+			assert.Equal(t, Match(tc.pattern, tc.name, labels), tc.match)
+		})
+	}
+
+	t.Run("no labels known", func(t *testing.T) {
+		assert.Assert(t, Match("kubernetes.*", "kubernetes.production", nil))
+		assert.Assert(t, !Match("kubernetes.*[env=prod]", "kubernetes.production", nil))
+	})
+}
+
+func TestMatchPrefix(t *testing.T) {
+	p, err := Parse("kubernetes.prod*.default")
+	assert.NilError(t, err)
+
+	assert.Assert(t, p.MatchPrefix("kubernetes.production", nil))
+	assert.Assert(t, p.MatchPrefix("kubernetes.production.default", nil))
+	assert.Assert(t, !p.MatchPrefix("kubernetes.staging", nil))
+	assert.Assert(t, !p.MatchPrefix("kubernetes.production.default.extra", nil))
+
+	assert.Assert(t, !p.IsLiteral())
+	assert.Assert(t, p.Segments[2].IsLiteral())
+	assert.Equal(t, p.Kind(), "kubernetes")
+}
+
+func TestContains(t *testing.T) {
+	labels := func(name string) map[string]string {
+		if name == "kubernetes.production" {
+			return map[string]string{"env": "prod"}
+		}
+
+		return nil
+	}
+
+	assert.Assert(t, Contains("kubernetes.staging", "kubernetes.staging", nil))
+	assert.Assert(t, Contains("kubernetes.staging", "kubernetes.staging.default", nil))
+	assert.Assert(t, Contains("kubernetes.staging", "kubernetes.staging.*", nil))
+	assert.Assert(t, !Contains("kubernetes.staging", "kubernetes.*", nil))
+	assert.Assert(t, !Contains("kubernetes.staging", "kubernetes.staging-2.default", nil))
+	assert.Assert(t, !Contains("kubernetes.staging", "kubernetes", nil))
+	assert.Assert(t, !Contains("kubernetes.staging", "infra", nil))
+
+	assert.Assert(t, Contains("kubernetes[env=prod]", "kubernetes.production.default", labels))
+	assert.Assert(t, !Contains("kubernetes[env=prod]", "kubernetes.staging.default", labels))
+}
+
+func TestContainsPattern(t *testing.T) {
+	labels := func(name string) map[string]string {
+		switch name {
+		case "kubernetes.production":
+			return map[string]string{"env": "prod", "pci": "true"}
+		case "kubernetes.staging":
+			return map[string]string{"env": "staging"}
+		}
+
+		return nil
+	}
+
+	assert.Assert(t, ContainsPattern("kubernetes.staging", "kubernetes.staging.*", labels))
+	assert.Assert(t, ContainsPattern("kubernetes.*", "kubernetes.*", labels))
+	assert.Assert(t, ContainsPattern("kubernetes.*", "kubernetes.staging.default", labels))
+	assert.Assert(t, !ContainsPattern("kubernetes.staging", "kubernetes.*", labels))
+	assert.Assert(t, !ContainsPattern("kubernetes.team-*", "kubernetes.*", labels))
+
+	// selectors are only known to be met for resources named literally, or when the target repeats them
+	assert.Assert(t, ContainsPattern("kubernetes[env!=prod]", "kubernetes.staging", labels))
+	assert.Assert(t, ContainsPattern("kubernetes[env!=prod]", "kubernetes[env!=prod].*", labels))
+	assert.Assert(t, ContainsPattern("kubernetes[env!=prod]", "kubernetes[env!=prod,team=a].*.default", labels))
+	assert.Assert(t, !ContainsPattern("kubernetes[env!=prod]", "kubernetes.production", labels))
+	assert.Assert(t, !ContainsPattern("kubernetes[env!=prod]", "kubernetes.*", labels))
+	assert.Assert(t, !ContainsPattern("kubernetes[env!=prod]", "kubernetes[env=staging].*", labels))
+	assert.Assert(t, !ContainsPattern("kubernetes[env!=prod]", "kubernetes", labels))
+	assert.Assert(t, !ContainsPattern("kubernetes[!pci]", "kubernetes.*", labels))
+	assert.Assert(t, !ContainsPattern("kubernetes[!pci]", "kubernetes.production", labels))
+	assert.Assert(t, !ContainsPattern("kubernetes[!pci]", "kubernetes.staging", nil))
+
+	assert.Assert(t, MatchPattern("kubernetes.*.*", "kubernetes.staging.*", labels))
+	assert.Assert(t, !MatchPattern("kubernetes.*", "kubernetes.staging.*", labels))
+	assert.Assert(t, !MatchPattern("kubernetes[env!=prod].*", "kubernetes.*.*", labels))
+}
+
+func TestString(t *testing.T) {
+	for _, s := range []string{"kubernetes.production", "kubernetes[env=prod].*", "kubernetes.*[tier!=free,team,!legacy].*"} {
+		p, err := Parse(s)
+		assert.NilError(t, err)
+		assert.Equal(t, p.String(), s)
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	selector, err := ParseSelector("env=prod, region!=us-east-1,team,!legacy")
+	assert.NilError(t, err)
+	assert.Equal(t, selector.String(), "env=prod,region!=us-east-1,team,!legacy")
+
+	assert.Assert(t, selector.Matches(map[string]string{"env": "prod", "region": "eu-west-1", "team": "a"}))
+	assert.Assert(t, !selector.Matches(map[string]string{"env": "prod", "region": "us-east-1", "team": "a"}))
+	assert.Assert(t, !selector.Matches(map[string]string{"env": "prod", "team": "a", "legacy": "true"}))
+
+	selector, err = ParseSelector("")
+	assert.NilError(t, err)
+	assert.Assert(t, selector.Matches(nil))
+
+	_, err = ParseSelector("env=prod,")
+	assert.ErrorIs(t, err, ErrInvalidSelector)
+}
+
+func TestValidateLabels(t *testing.T) {
+	assert.NilError(t, ValidateLabels(map[string]string{"env": "prod", "topology.kubernetes.io/region": "us-east-1", "empty": ""}))
+	assert.NilError(t, ValidateLabels(nil))
+
+	for _, labels := range []map[string]string{
+		{"": "prod"},
+		{"env=": "prod"},
+		{"team": "a,b"},
+		{"env": "prod]"},
+		{"owner": "platform team"},
+	} {
+		assert.ErrorIs(t, ValidateLabels(labels), ErrInvalidLabels)
+	}
+}
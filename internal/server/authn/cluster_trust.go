@@ -0,0 +1,46 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/kubernetes"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// ReviewClusterToken checks that a service account token was issued by a trusted cluster, and
+// returns the username of the service account it belongs to
+func ReviewClusterToken(ctx context.Context, trust *models.ClusterTrust, token string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, oidcProviderRequestTimeout)
+	defer cancel()
+
+	if trust.Server != "" {
+		username, err := kubernetes.ReviewToken(ctx, trust.Server, []byte(trust.CA), string(trust.ReviewerToken), token)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", internal.ErrUnauthorized, err)
+		}
+
+		return username, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, trust.Issuer)
+	if err != nil {
+		return "", fmt.Errorf("%w: discover cluster issuer %q: %v", internal.ErrBadGateway, trust.Issuer, err)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: trust.Audience}).Verify(ctx, token)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", fmt.Errorf("%w: %s", internal.ErrBadGateway, err.Error())
+		}
+
+		return "", fmt.Errorf("%w: verify cluster token: %v", internal.ErrUnauthorized, err)
+	}
+
+	// kubernetes service account tokens use the service account username as the subject
+	return idToken.Subject, nil
+}
@@ -0,0 +1,181 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"github.com/infrahq/infra/internal"
+)
+
+// FederatedIssuer is an external token issuer, such as a Kubernetes cluster or a CI system,
+// that is trusted to vouch for the workloads it runs
+type FederatedIssuer struct {
+	// Issuer must match the "iss" claim of the token
+	Issuer string
+	// JWKSURL is where the issuer's signing keys are published. When empty, the keys are found with OIDC discovery.
+	JWKSURL string
+	// Audience must be one of the "aud" claims of the token
+	Audience string
+	Rules    []FederationRule
+}
+
+// FederationRule maps tokens to a machine identity. A rule matches when every claim matches its
+// pattern, where "*" matches any sequence of characters.
+type FederationRule struct {
+	Claims  map[string]string
+	Machine string
+}
+
+// FederatedIdentity is the result of a successful federated login
+type FederatedIdentity struct {
+	Issuer  string
+	Machine string
+	Expiry  time.Time
+}
+
+type Federation struct {
+	mu        sync.Mutex
+	issuers   map[string]FederatedIssuer
+	verifiers map[string]*oidc.IDTokenVerifier
+}
+
+func NewFederation(issuers []FederatedIssuer) *Federation {
+	f := &Federation{
+		issuers:   make(map[string]FederatedIssuer, len(issuers)),
+		verifiers: make(map[string]*oidc.IDTokenVerifier),
+	}
+
+	for _, issuer := range issuers {
+		f.issuers[issuer.Issuer] = issuer
+	}
+
+	return f
+}
+
+// Authenticate verifies a token signed by a trusted issuer and maps its claims to a machine identity
+func (f *Federation) Authenticate(ctx context.Context, rawToken string) (*FederatedIdentity, error) {
+	tok, err := jwt.ParseSigned(rawToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid federated token: %v", internal.ErrUnauthorized, err)
+	}
+
+	var unverified jwt.Claims
+	if err := tok.UnsafeClaimsWithoutVerification(&unverified); err != nil {
+		return nil, fmt.Errorf("%w: invalid federated token claims: %v", internal.ErrUnauthorized, err)
+	}
+
+	issuer, ok := f.issuers[unverified.Issuer]
+	if !ok {
+		return nil, fmt.Errorf("%w: untrusted token issuer %q", internal.ErrUnauthorized, unverified.Issuer)
+	}
+
+	verifier, err := f.verifier(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := verifier.Verify(ctx, rawToken)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %s", internal.ErrBadGateway, err.Error())
+		}
+
+		return nil, fmt.Errorf("%w: verify federated token: %v", internal.ErrUnauthorized, err)
+	}
+
+	claims := make(map[string]interface{})
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: federated token claims: %v", internal.ErrUnauthorized, err)
+	}
+
+	for _, rule := range issuer.Rules {
+		if matchClaims(rule.Claims, claims) {
+			return &FederatedIdentity{Issuer: issuer.Issuer, Machine: rule.Machine, Expiry: idToken.Expiry}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: federated token from %q does not match any rule", internal.ErrUnauthorized, issuer.Issuer)
+}
+
+// verifier returns the cached verifier for an issuer, discovering its keys on first use
+func (f *Federation) verifier(ctx context.Context, issuer FederatedIssuer) (*oidc.IDTokenVerifier, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if verifier, ok := f.verifiers[issuer.Issuer]; ok {
+		return verifier, nil
+	}
+
+	config := &oidc.Config{ClientID: issuer.Audience}
+
+	var verifier *oidc.IDTokenVerifier
+
+	if issuer.JWKSURL != "" {
+		verifier = oidc.NewVerifier(issuer.Issuer, oidc.NewRemoteKeySet(ctx, issuer.JWKSURL), config)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, oidcProviderRequestTimeout)
+		defer cancel()
+
+		provider, err := oidc.NewProvider(ctx, issuer.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("%w: discover federated issuer %q: %v", internal.ErrBadGateway, issuer.Issuer, err)
+		}
+
+		verifier = provider.Verifier(config)
+	}
+
+	f.verifiers[issuer.Issuer] = verifier
+
+	return verifier, nil
+}
+
+func matchClaims(patterns map[string]string, claims map[string]interface{}) bool {
+	for name, pattern := range patterns {
+		val, ok := claims[name]
+		if !ok {
+			return false
+		}
+
+		claim, ok := val.(string)
+		if !ok {
+			claim = fmt.Sprint(val)
+		}
+
+		if !matchPattern(pattern, claim) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+
+	s = s[len(parts[0]):]
+
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+
+		s = s[i+len(part):]
+	}
+
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
@@ -0,0 +1,134 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+)
+
+type testIssuer struct {
+	URL     string
+	JWKSURL string
+	key     *rsa.PrivateKey
+}
+
+// setupTestIssuer serves the public keys of a fake token issuer
+func setupTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: key.Public(), KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"}}}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(srv.Close)
+
+	return &testIssuer{URL: srv.URL, JWKSURL: srv.URL + "/keys", key: key}
+}
+
+func (i *testIssuer) token(t *testing.T, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: i.key}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+	assert.NilError(t, err)
+
+	raw, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	assert.NilError(t, err)
+
+	return raw
+}
+
+func TestFederationAuthenticate(t *testing.T) {
+	issuer := setupTestIssuer(t)
+
+	federation := NewFederation([]FederatedIssuer{
+		{
+			Issuer:   issuer.URL,
+			JWKSURL:  issuer.JWKSURL,
+			Audience: "infra",
+			Rules: []FederationRule{
+				{Claims: map[string]string{"sub": "system:serviceaccount:infra:connector"}, Machine: "connector"},
+				{Claims: map[string]string{"sub": "repo:infrahq/*", "ref": "refs/heads/main"}, Machine: "deploy"},
+			},
+		},
+	})
+
+	claims := func(sub string, extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": issuer.URL,
+			"aud": "infra",
+			"sub": sub,
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+
+		for k, v := range extra {
+			c[k] = v
+		}
+
+		return c
+	}
+
+	ctx := context.Background()
+
+	t.Run("matches a rule", func(t *testing.T) {
+		identity, err := federation.Authenticate(ctx, issuer.token(t, claims("system:serviceaccount:infra:connector", nil)))
+		assert.NilError(t, err)
+		assert.Equal(t, identity.Machine, "connector")
+		assert.Assert(t, identity.Expiry.After(time.Now()))
+	})
+
+	t.Run("matches every claim of a rule", func(t *testing.T) {
+		identity, err := federation.Authenticate(ctx, issuer.token(t, claims("repo:infrahq/infra:ref:refs/heads/main", map[string]interface{}{"ref": "refs/heads/main"})))
+		assert.NilError(t, err)
+		assert.Equal(t, identity.Machine, "deploy")
+
+		_, err = federation.Authenticate(ctx, issuer.token(t, claims("repo:infrahq/infra:ref:refs/heads/dev", map[string]interface{}{"ref": "refs/heads/dev"})))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	})
+
+	t.Run("no matching rule", func(t *testing.T) {
+		_, err := federation.Authenticate(ctx, issuer.token(t, claims("system:serviceaccount:default:default", nil)))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		c := claims("system:serviceaccount:infra:connector", nil)
+		c["aud"] = "someone-else"
+
+		_, err := federation.Authenticate(ctx, issuer.token(t, c))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		c := claims("system:serviceaccount:infra:connector", nil)
+		c["exp"] = time.Now().Add(-time.Minute).Unix()
+
+		_, err := federation.Authenticate(ctx, issuer.token(t, c))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	})
+
+	t.Run("untrusted issuer", func(t *testing.T) {
+		c := claims("system:serviceaccount:infra:connector", nil)
+		c["iss"] = "https://untrusted.example.com"
+
+		_, err := federation.Authenticate(ctx, issuer.token(t, c))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		other := setupTestIssuer(t)
+
+		_, err := federation.Authenticate(ctx, other.token(t, claims("system:serviceaccount:infra:connector", nil)))
+		assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	})
+}
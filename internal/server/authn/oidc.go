@@ -26,7 +26,10 @@ type UserInfo struct {
 }
 
 type OIDC interface {
-	ExchangeAuthCodeForProviderTokens(code string) (accessToken, refreshToken string, accessTokenExpiry time.Time, email string, err error)
+	AuthorizeURL(state string) (string, error)
+	// ExchangeAuthCodeForProviderTokens returns the tokens of the identity provider, and the email and authentication
+	// methods (amr) from the ID token
+	ExchangeAuthCodeForProviderTokens(code string) (accessToken, refreshToken string, accessTokenExpiry time.Time, email string, amr []string, err error)
 	RefreshAccessToken(providerUser *models.ProviderUser) (accessToken string, expiry *time.Time, err error)
 	GetUserInfo(providerUser *models.ProviderUser) (*UserInfo, error)
 }
@@ -84,23 +87,36 @@ func (o *oidcImplementation) tokenSource(providerTokens *models.ProviderUser) (o
 	return conf.TokenSource(ctx, userToken), nil
 }
 
-func (o *oidcImplementation) ExchangeAuthCodeForProviderTokens(code string) (rawAccessToken, rawRefreshToken string, accessTokenExpiry time.Time, email string, err error) {
+// AuthorizeURL is where a user is sent to sign in with the identity provider and return to the redirect URL
+func (o *oidcImplementation) AuthorizeURL(state string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), oidcProviderRequestTimeout)
+	defer cancel()
+
+	conf, _, err := o.clientConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("client authorize url: %w", err)
+	}
+
+	return conf.AuthCodeURL(state), nil
+}
+
+func (o *oidcImplementation) ExchangeAuthCodeForProviderTokens(code string) (rawAccessToken, rawRefreshToken string, accessTokenExpiry time.Time, email string, amr []string, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), oidcProviderRequestTimeout)
 	defer cancel()
 
 	conf, provider, err := o.clientConfig(ctx)
 	if err != nil {
-		return "", "", time.Time{}, "", fmt.Errorf("client exchange code: %w", err)
+		return "", "", time.Time{}, "", nil, fmt.Errorf("client exchange code: %w", err)
 	}
 
 	exchanged, err := conf.Exchange(ctx, code)
 	if err != nil {
-		return "", "", time.Time{}, "", fmt.Errorf("code exchange: %w", err)
+		return "", "", time.Time{}, "", nil, fmt.Errorf("code exchange: %w", err)
 	}
 
 	rawAccessToken, ok := exchanged.Extra("access_token").(string)
 	if !ok {
-		return "", "", time.Time{}, "", errors.New("could not extract access token from oauth2")
+		return "", "", time.Time{}, "", nil, errors.New("could not extract access token from oauth2")
 	}
 
 	rawRefreshToken, ok = exchanged.Extra("refresh_token").(string)
@@ -111,12 +127,12 @@ func (o *oidcImplementation) ExchangeAuthCodeForProviderTokens(code string) (raw
 
 	rawIDToken, ok := exchanged.Extra("id_token").(string)
 	if !ok {
-		return "", "", time.Time{}, "", errors.New("could not extract id_token from oauth2 token")
+		return "", "", time.Time{}, "", nil, errors.New("could not extract id_token from oauth2 token")
 	}
 
 	exp, err := getAccessTokenExpiry(rawAccessToken)
 	if err != nil {
-		return "", "", time.Time{}, "", fmt.Errorf("get exp: %w", err)
+		return "", "", time.Time{}, "", nil, fmt.Errorf("get exp: %w", err)
 	}
 
 	// we get sensitive claims from the ID token, must validate them
@@ -124,18 +140,19 @@ func (o *oidcImplementation) ExchangeAuthCodeForProviderTokens(code string) (raw
 
 	idToken, err := verifier.Verify(ctx, rawIDToken)
 	if err != nil {
-		return "", "", time.Time{}, "", fmt.Errorf("validate id token: %w", err)
+		return "", "", time.Time{}, "", nil, fmt.Errorf("validate id token: %w", err)
 	}
 
 	var claims struct {
-		Email string `json:"email"`
+		Email string   `json:"email"`
+		AMR   []string `json:"amr"`
 	}
 
 	if err := idToken.Claims(&claims); err != nil {
-		return "", "", time.Time{}, "", fmt.Errorf("id cliams: %w", err)
+		return "", "", time.Time{}, "", nil, fmt.Errorf("id cliams: %w", err)
 	}
 
-	return rawAccessToken, rawRefreshToken, exp, claims.Email, nil
+	return rawAccessToken, rawRefreshToken, exp, claims.Email, claims.AMR, nil
 }
 
 // RefreshAccessToken uses the refresh token to get a new access token if it is expired
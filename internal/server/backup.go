@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/secrets"
+)
+
+// Backup writes an archive of the server's database, without starting the server. Secret fields are sealed for the
+// root key of the key provider, which default to the database encryption key.
+func Backup(options Options, w io.Writer, keyProvider, rootKeyID string) error {
+	s := &Server{options: options}
+	if err := s.openDB(); err != nil {
+		return err
+	}
+
+	keyProvider, kp, err := s.archiveKeyProvider(keyProvider)
+	if err != nil {
+		return err
+	}
+
+	if rootKeyID == "" {
+		rootKeyID = options.DBEncryptionKey
+	}
+
+	key, err := kp.GenerateDataKey(rootKeyID)
+	if err != nil {
+		return fmt.Errorf("archive key: %w", err)
+	}
+
+	archive, err := data.Backup(s.db, keyProvider, key)
+	if err != nil {
+		return err
+	}
+
+	return archive.Write(w)
+}
+
+// Restore replaces the contents of the server's database with an archive, without starting the server. The
+// database may use a different driver than the one the archive was created from.
+func Restore(options Options, r io.Reader) error {
+	s := &Server{options: options}
+	if err := s.openDB(); err != nil {
+		return err
+	}
+
+	archive, err := data.ReadArchive(r)
+	if err != nil {
+		return err
+	}
+
+	_, kp, err := s.archiveKeyProvider(archive.Key.Provider)
+	if err != nil {
+		return err
+	}
+
+	key, err := kp.DecryptDataKey(archive.Key.RootKeyID, archive.Key.Encrypted)
+	if err != nil {
+		return fmt.Errorf("decrypting archive key: %w", err)
+	}
+
+	return data.Restore(s.db, archive, key)
+}
+
+// archiveKeyProvider looks up the key provider an archive is sealed with, which defaults to the one of the
+// database encryption key
+func (s *Server) archiveKeyProvider(name string) (string, secrets.SymmetricKeyProvider, error) {
+	if name == "" {
+		name = s.options.DBEncryptionKeyProvider
+	}
+
+	kp, ok := s.keys[name]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: key provider %q is not configured", internal.ErrBadRequest, name)
+	}
+
+	return name, kp, nil
+}
+
+// backupHandler downloads an archive of the server's database
+func (a *API) backupHandler(c *gin.Context) {
+	keyProvider, kp, err := a.server.archiveKeyProvider(c.Query("keyProvider"))
+	if err != nil {
+		a.sendAPIError(c, err)
+		return
+	}
+
+	rootKeyID := c.Query("rootKeyID")
+	if rootKeyID == "" {
+		rootKeyID = a.server.options.DBEncryptionKey
+	}
+
+	archive, err := access.BackupDatabase(c, keyProvider, kp, rootKeyID)
+	if err != nil {
+		a.sendAPIError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="infra-backup-%s.json"`, archive.Created.Format("20060102150405")))
+	c.Status(http.StatusOK)
+
+	if err := archive.Write(c.Writer); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// restoreHandler replaces the server's database with an uploaded archive. The server needs to be restarted after,
+// to load the restored state it reads when it starts.
+func (a *API) restoreHandler(c *gin.Context) {
+	archive, err := data.ReadArchive(c.Request.Body)
+	if err != nil {
+		a.sendAPIError(c, err)
+		return
+	}
+
+	_, kp, err := a.server.archiveKeyProvider(archive.Key.Provider)
+	if err != nil {
+		a.sendAPIError(c, err)
+		return
+	}
+
+	if err := access.RestoreDatabase(c, archive, kp); err != nil {
+		a.sendAPIError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
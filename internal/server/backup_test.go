@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestBackupRestore(t *testing.T) {
+	setupLogging(t)
+
+	sourceDir, destDir := t.TempDir(), t.TempDir()
+
+	source := Options{
+		DBEncryptionKeyProvider: "native",
+		DBEncryptionKey:         filepath.Join(sourceDir, "sqlite3.db.key"),
+		DBFile:                  filepath.Join(sourceDir, "sqlite3.db"),
+	}
+
+	s := &Server{options: source}
+	err := s.openDB()
+	assert.NilError(t, err)
+
+	provider := &models.Provider{Name: "okta", URL: "example.okta.com", ClientID: "client-id", ClientSecret: "client-secret"}
+	err = data.CreateProvider(s.db, provider)
+	assert.NilError(t, err)
+
+	var archive bytes.Buffer
+	err = Backup(source, &archive, "", "")
+	assert.NilError(t, err)
+
+	// the destination database has its own key
+	dest := Options{
+		DBEncryptionKeyProvider: "native",
+		DBEncryptionKey:         filepath.Join(destDir, "sqlite3.db.key"),
+		DBFile:                  filepath.Join(destDir, "sqlite3.db"),
+	}
+
+	err = Restore(dest, &archive)
+	assert.NilError(t, err)
+
+	restored := &Server{options: dest}
+	err = restored.openDB()
+	assert.NilError(t, err)
+
+	p, err := data.GetProvider(restored.db, data.ByName("okta"))
+	assert.NilError(t, err)
+	assert.Equal(t, p.ID, provider.ID)
+	assert.Equal(t, p.ClientSecret, models.EncryptedAtRest("client-secret"))
+}
+
+func TestBackupHandler(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+
+	s.options = Options{
+		AdminAccessKey:          adminAccessKey,
+		AccessKey:               connectorAccessKey,
+		DBEncryptionKeyProvider: "native",
+		DBEncryptionKey:         filepath.Join(t.TempDir(), "root.key"),
+	}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	err = s.importSecretKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	backup := func(t *testing.T, accessKey string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/v1/backup", nil)
+		assert.NilError(t, err)
+
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessKey))
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	t.Run("not an admin", func(t *testing.T) {
+		resp := backup(t, connectorAccessKey)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+	})
+
+	resp := backup(t, adminAccessKey)
+	assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+	archive, err := data.ReadArchive(bytes.NewReader(resp.Body.Bytes()))
+	assert.NilError(t, err)
+	assert.Equal(t, archive.Key.Provider, "native")
+	assert.Equal(t, len(archive.Identities), 2)
+
+	t.Run("restore", func(t *testing.T) {
+		grant := &models.Grant{Subject: "i:1234", Privilege: "view", Resource: "production"}
+		err := data.CreateGrant(s.db, grant)
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/backup", bytes.NewReader(resp.Body.Bytes()))
+		assert.NilError(t, err)
+
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", adminAccessKey))
+
+		restore := httptest.NewRecorder()
+		routes.ServeHTTP(restore, req)
+		assert.Equal(t, restore.Code, http.StatusNoContent, restore.Body.String())
+
+		// the grant was created after the backup
+		_, err = data.GetGrant(s.db, data.ByID(grant.ID))
+		assert.ErrorContains(t, err, "not found")
+	})
+}
@@ -1,8 +1,12 @@
 package server
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -11,8 +15,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"gotest.tools/v3/assert"
 
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/pki"
 	"github.com/infrahq/infra/uid"
@@ -105,3 +112,116 @@ func requireMutualTLSWorks(t *testing.T, clientKeypair *pki.KeyPair, cp pki.Cert
 	body := strings.TrimSpace(string(respBodyBytes))
 	assert.Equal(t, "success!", body)
 }
+
+func TestClientCertificateAuthentication(t *testing.T) {
+	s := setupServer(t)
+
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+	s.options = Options{AccessKey: connectorAccessKey, NetworkEncryption: "mtls"}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	s.certificateProvider, err = pki.NewNativeCertificateProvider(s.db, pki.NativeCertificateProviderConfig{FullKeyRotationDurationInDays: 365})
+	assert.NilError(t, err)
+
+	err = s.certificateProvider.CreateCA()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	srv := httptest.NewUnstartedServer(routes)
+	srv.TLS, err = s.serverTLSConfig()
+	assert.NilError(t, err)
+
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	roots := x509.NewCertPool()
+	assert.Assert(t, roots.AppendCertsFromPEM(pki.ActiveCAsPEM(s.certificateProvider)))
+
+	var clientCert tls.Certificate
+
+	// the client presents its certificate once it has one
+	client := api.Client{
+		URL:       srv.URL,
+		AccessKey: connectorAccessKey,
+		HTTP: http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:    roots,
+					MinVersion: tls.VersionTLS12,
+					GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						return &clientCert, nil
+					},
+				},
+			},
+		},
+	}
+
+	connector, err := client.Introspect()
+	assert.NilError(t, err)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, commonName string) *api.CreateClientCertificateRequest {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: commonName},
+		}, key)
+		assert.NilError(t, err)
+
+		return &api.CreateClientCertificateRequest{
+			CSR: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		}
+	}
+
+	t.Run("another identity", func(t *testing.T) {
+		_, err := client.CreateClientCertificate(request(t, pki.ClientCertCommonName(s.InternalIdentities["admin"].ID)))
+		assert.ErrorContains(t, err, "invalid certificate common name")
+	})
+
+	res, err := client.CreateClientCertificate(request(t, pki.ClientCertCommonName(connector.ID)))
+	assert.NilError(t, err)
+
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NilError(t, err)
+
+	clientCert, err = tls.X509KeyPair([]byte(res.Certificate), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}))
+	assert.NilError(t, err)
+
+	t.Run("authenticated with the certificate", func(t *testing.T) {
+		client := client
+		client.AccessKey = ""
+		client.HTTP.Transport.(*http.Transport).CloseIdleConnections()
+
+		introspect, err := client.Introspect()
+		assert.NilError(t, err)
+		assert.Equal(t, introspect.ID, connector.ID)
+	})
+
+	t.Run("without a certificate or access key", func(t *testing.T) {
+		client := api.Client{
+			URL: srv.URL,
+			HTTP: http.Client{
+				Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}},
+			},
+		}
+
+		_, err := client.Introspect()
+		assert.ErrorIs(t, err, api.ErrUnauthorized)
+	})
+
+	t.Run("revoked with the access key", func(t *testing.T) {
+		err := data.DeleteAccessKeys(s.db, data.ByKeyID(strings.Split(connectorAccessKey, ".")[0]))
+		assert.NilError(t, err)
+
+		client := client
+		client.AccessKey = ""
+		client.HTTP.Transport.(*http.Transport).CloseIdleConnections()
+
+		_, err = client.Introspect()
+		assert.ErrorIs(t, err, api.ErrUnauthorized)
+	})
+}
@@ -16,6 +16,8 @@ import (
 
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/resource"
+	"github.com/infrahq/infra/internal/server/authn"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/secrets"
@@ -37,9 +39,43 @@ type Grant struct {
 	Resource string `mapstructure:"resource" validate:"required"`
 }
 
+// TrustedIssuer is an external token issuer whose workloads can log in as machines
+type TrustedIssuer struct {
+	Issuer   string           `mapstructure:"issuer" validate:"required"`
+	JWKSURL  string           `mapstructure:"jwksURL"`
+	Audience string           `mapstructure:"audience" validate:"required"`
+	Rules    []FederationRule `mapstructure:"rules" validate:"required,dive"`
+}
+
+type FederationRule struct {
+	Claims  map[string]string `mapstructure:"claims" validate:"required"`
+	Machine string            `mapstructure:"machine" validate:"required"`
+}
+
+// ClusterTrust pre-registers a Kubernetes cluster whose connector can register without an access key
+type ClusterTrust struct {
+	Name           string `mapstructure:"name" validate:"required"`
+	Server         string `mapstructure:"server" validate:"required_without=Issuer,excluded_with=Issuer"`
+	CA             string `mapstructure:"ca" validate:"required_with=Server"`
+	ReviewerToken  string `mapstructure:"reviewerToken"`
+	Issuer         string `mapstructure:"issuer" validate:"required_without=Server"`
+	Audience       string `mapstructure:"audience" validate:"required_with=Issuer"`
+	ServiceAccount string `mapstructure:"serviceAccount" validate:"required"`
+}
+
+// Notification is a webhook that is sent the events people must be alerted of, such as break-glass accounts being
+// unlocked
+type Notification struct {
+	URL     string            `mapstructure:"url" validate:"required,url"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
 type Config struct {
-	Providers []Provider `mapstructure:"providers" validate:"dive"`
-	Grants    []Grant    `mapstructure:"grants" validate:"dive"`
+	Providers      []Provider      `mapstructure:"providers" validate:"dive"`
+	Grants         []Grant         `mapstructure:"grants" validate:"dive"`
+	TrustedIssuers []TrustedIssuer `mapstructure:"trustedIssuers" validate:"dive"`
+	ClusterTrusts  []ClusterTrust  `mapstructure:"clusterTrusts" validate:"dive"`
+	Notifications  []Notification  `mapstructure:"notifications" validate:"dive"`
 }
 
 type KeyProvider struct {
@@ -342,6 +378,21 @@ func (s *Server) importSecrets() error {
 	return nil
 }
 
+// recordingStorage returns where session recordings are kept, either a configured secret storage or files
+// in the recordings directory
+func (s *Server) recordingStorage() (secrets.SecretStorage, error) {
+	if s.options.RecordingStorage != "" {
+		storage, ok := s.secrets[s.options.RecordingStorage]
+		if !ok {
+			return nil, fmt.Errorf("secret storage %q not found", s.options.RecordingStorage)
+		}
+
+		return storage, nil
+	}
+
+	return secrets.NewFileSecretProviderFromConfig(secrets.FileConfig{Path: s.options.RecordingsDir}), nil
+}
+
 // loadDefaultSecretConfig loads configuration for types that should be available,
 // assuming the user didn't override the configuration for them.
 func (s *Server) loadDefaultSecretConfig() error {
@@ -620,10 +671,34 @@ func loadConfig(db *gorm.DB, config Config) error {
 			return err
 		}
 
+		if err := loadClusterTrusts(tx, config.ClusterTrusts); err != nil {
+			return err
+		}
+
 		return nil
 	})
 }
 
+func loadFederation(issuers []TrustedIssuer) *authn.Federation {
+	federated := make([]authn.FederatedIssuer, 0, len(issuers))
+
+	for _, issuer := range issuers {
+		rules := make([]authn.FederationRule, 0, len(issuer.Rules))
+		for _, rule := range issuer.Rules {
+			rules = append(rules, authn.FederationRule{Claims: rule.Claims, Machine: rule.Machine})
+		}
+
+		federated = append(federated, authn.FederatedIssuer{
+			Issuer:   issuer.Issuer,
+			JWKSURL:  issuer.JWKSURL,
+			Audience: issuer.Audience,
+			Rules:    rules,
+		})
+	}
+
+	return authn.NewFederation(federated)
+}
+
 func loadProviders(db *gorm.DB, providers []Provider) error {
 	toKeep := make([]uid.ID, 0)
 
@@ -680,6 +755,55 @@ func loadProvider(db *gorm.DB, input Provider) (*models.Provider, error) {
 	return provider, nil
 }
 
+func loadClusterTrusts(db *gorm.DB, trusts []ClusterTrust) error {
+	toKeep := make([]uid.ID, 0)
+
+	for _, input := range trusts {
+		trust, err := data.GetClusterTrust(db, data.ByName(input.Name))
+		if err != nil {
+			if !errors.Is(err, internal.ErrNotFound) {
+				return err
+			}
+
+			trust = &models.ClusterTrust{Name: input.Name}
+		}
+
+		// the unique ID and identity bound by the cluster's first registration are kept
+		trust.Server = input.Server
+		trust.CA = input.CA
+		trust.ReviewerToken = models.EncryptedAtRest(input.ReviewerToken)
+		trust.Issuer = input.Issuer
+		trust.Audience = input.Audience
+		trust.ServiceAccount = input.ServiceAccount
+		trust.CreatedBy = models.CreatedByConfig
+
+		save := data.SaveClusterTrust
+		if trust.ID == 0 {
+			save = data.CreateClusterTrust
+		}
+
+		if err := save(db, trust); err != nil {
+			return err
+		}
+
+		toKeep = append(toKeep, trust.ID)
+	}
+
+	// remove _all_ cluster trusts previously loaded from config
+	previous, err := data.ListClusterTrusts(db, data.ByNotIDs(toKeep), data.CreatedBy(models.CreatedByConfig))
+	if err != nil {
+		return err
+	}
+
+	for _, trust := range previous {
+		if err := data.DeleteClusterTrust(db, trust.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func loadGrants(db *gorm.DB, grants []Grant) error {
 	toKeep := make([]uid.ID, 0)
 
@@ -702,6 +826,10 @@ func loadGrants(db *gorm.DB, grants []Grant) error {
 }
 
 func loadGrant(db *gorm.DB, input Grant) (*models.Grant, error) {
+	if err := resource.Validate(input.Resource); err != nil {
+		return nil, err
+	}
+
 	var id uid.PolymorphicID
 
 	switch {
@@ -778,6 +906,10 @@ func loadGrant(db *gorm.DB, input Grant) (*models.Grant, error) {
 		input.Role = models.BasePermissionConnect
 	}
 
+	if err := models.ValidatePermission(input.Role); err != nil {
+		return nil, err
+	}
+
 	grant, err := data.GetGrant(db, data.BySubject(id), data.ByResource(input.Resource), data.ByPrivilege(input.Role))
 	if err != nil {
 		if !errors.Is(err, internal.ErrNotFound) {
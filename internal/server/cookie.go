@@ -10,6 +10,7 @@ import (
 var (
 	CookieAuthorizationName = "auth"
 	CookieLoginName         = "login"
+	CookieDeviceConfirmName = "device-confirm"
 	CookieDomain            = ""
 	CookiePath              = "/"
 	// while these vars look goofy, they avoid "magic number" arguments to SetCookie
@@ -35,3 +36,14 @@ func deleteAuthCookie(c *gin.Context) {
 	c.SetCookie(CookieAuthorizationName, "", CookieMaxAgeDeleteImmediately, CookiePath, CookieDomain, CookieSecureHTTPSOnly, CookieHTTPOnlyNotJavascriptAccessible)
 	c.SetCookie(CookieLoginName, "", CookieMaxAgeDeleteImmediately, CookiePath, CookieDomain, CookieSecureHTTPSOnly, CookieHTTPOnlyNotJavascriptAccessible)
 }
+
+// setDeviceConfirmCookie holds the token the device confirmation form is posted with. The cookie is not sent with
+// requests from other sites, so they can not confirm a device login for the user.
+func setDeviceConfirmCookie(c *gin.Context, token string, expires time.Time) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(CookieDeviceConfirmName, token, int(time.Until(expires).Seconds()), "/device", CookieDomain, CookieSecureHTTPSOnly, CookieHTTPOnlyNotJavascriptAccessible)
+}
+
+func deleteDeviceConfirmCookie(c *gin.Context) {
+	c.SetCookie(CookieDeviceConfirmName, "", CookieMaxAgeDeleteImmediately, "/device", CookieDomain, CookieSecureHTTPSOnly, CookieHTTPOnlyNotJavascriptAccessible)
+}
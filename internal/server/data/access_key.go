@@ -109,20 +109,44 @@ func ValidateAccessKey(db *gorm.DB, authnKey string) (*models.AccessKey, error)
 		return nil, fmt.Errorf("access key invalid secret")
 	}
 
+	if err := checkAccessKeyLifetime(db, t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// ValidateAccessKeyByID checks the access key with the ID is still valid, for a request authenticated by a credential
+// issued with the key, such as a client certificate
+func ValidateAccessKeyByID(db *gorm.DB, id uid.ID) (*models.AccessKey, error) {
+	t, err := GetAccessKey(db, ByID(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get access key from database, it may not exist", err)
+	}
+
+	if err := checkAccessKeyLifetime(db, t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// checkAccessKeyLifetime checks the key has not expired, and extends it when it is used before its extension deadline
+func checkAccessKeyLifetime(db *gorm.DB, t *models.AccessKey) error {
 	if time.Now().After(t.ExpiresAt) {
-		return nil, fmt.Errorf("token expired")
+		return fmt.Errorf("token expired")
 	}
 
 	if !t.ExtensionDeadline.IsZero() {
 		if time.Now().After(t.ExtensionDeadline) {
-			return nil, fmt.Errorf("token extension deadline exceeded")
+			return fmt.Errorf("token extension deadline exceeded")
 		}
 
 		t.ExtensionDeadline = time.Now().Add(t.Extension).UTC()
 		if err := SaveAccessKey(db, t); err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	return t, nil
+	return nil
 }
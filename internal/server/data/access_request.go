@@ -0,0 +1,33 @@
+package data
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func ByOptionalStatus(status string) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		if status == "" {
+			return db
+		}
+
+		return db.Where("status = ?", status)
+	}
+}
+
+func CreateAccessRequest(db *gorm.DB, request *models.AccessRequest) error {
+	return add(db, request)
+}
+
+func SaveAccessRequest(db *gorm.DB, request *models.AccessRequest) error {
+	return save(db, request)
+}
+
+func GetAccessRequest(db *gorm.DB, selectors ...SelectorFunc) (*models.AccessRequest, error) {
+	return get[models.AccessRequest](db, selectors...)
+}
+
+func ListAccessRequests(db *gorm.DB, selectors ...SelectorFunc) ([]models.AccessRequest, error) {
+	return list[models.AccessRequest](db, selectors...)
+}
@@ -0,0 +1,47 @@
+package data
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func CreateKubernetesAuditRecords(db *gorm.DB, records []models.KubernetesAuditRecord) error {
+	v := validator.New()
+	for i := range records {
+		if err := v.Struct(records[i]); err != nil {
+			return err
+		}
+	}
+
+	return db.Create(&records).Error
+}
+
+func ListKubernetesAuditRecords(db *gorm.DB, selectors ...SelectorFunc) ([]models.KubernetesAuditRecord, error) {
+	return list[models.KubernetesAuditRecord](db, selectors...)
+}
+
+func ByTimeAfter(t time.Time) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		if !t.IsZero() {
+			return db.Where("time > ?", t)
+		}
+
+		return db
+	}
+}
+
+// MostRecent orders records by time, newest first, and returns at most limit records when limit is set
+func MostRecent(limit int) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Order("time desc")
+		if limit > 0 {
+			db = db.Limit(limit)
+		}
+
+		return db
+	}
+}
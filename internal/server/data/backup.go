@@ -0,0 +1,422 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/secrets"
+	"github.com/infrahq/infra/uid"
+)
+
+// ArchiveVersion is the version of the archive format. It changes when archives written by this version of Infra can
+// no longer be read by earlier ones.
+const ArchiveVersion = 1
+
+// Archive is a portable backup of the server's state, which can be restored to a database of any driver. Secret
+// fields are sealed with the archive key, rather than the key of the database they were read from.
+type Archive struct {
+	Version     int
+	MigrationID string
+	Created     time.Time
+	Key         ArchiveKey
+
+	Settings         []models.Settings
+	Identities       []models.Identity
+	Groups           []models.Group
+	Memberships      []Membership
+	GroupMembers     []models.GroupMember
+	Grants           []models.Grant
+	Providers        []models.Provider
+	ProviderUsers    []models.ProviderUser
+	Credentials      []models.Credential
+	AccessKeys       []models.AccessKey
+	Destinations     []models.Destination
+	ClusterTrusts    []models.ClusterTrust
+	RootCertificates []models.RootCertificate
+	BreakGlasses     []models.BreakGlass
+	BreakGlassEvents []models.BreakGlassEvent
+	AccessRequests   []models.AccessRequest
+	Reviews          []models.Review
+	ReviewReviewers  []ReviewReviewer
+	ReviewItems      []models.ReviewItem
+	AuditRecords     []models.KubernetesAuditRecord
+	Recordings       []models.SessionRecording
+}
+
+// ArchiveKey is the data key secret fields in the archive are sealed with, encrypted by a root key of the provider
+type ArchiveKey struct {
+	Provider  string
+	RootKeyID string
+	Algorithm string
+	Encrypted []byte
+}
+
+// Membership is an identity's membership of a group
+type Membership struct {
+	IdentityID uid.ID
+	GroupID    uid.ID
+}
+
+// ReviewReviewer is an identity's assignment as a reviewer of a review
+type ReviewReviewer struct {
+	ReviewID   uid.ID
+	IdentityID uid.ID
+}
+
+// Backup reads the server's state into an archive. Secret fields are sealed with key, which is generated by the
+// provider named in the archive.
+func Backup(db *gorm.DB, provider string, key *secrets.SymmetricKey) (*Archive, error) {
+	archive := &Archive{
+		Version:     ArchiveVersion,
+		MigrationID: LatestMigrationID(),
+		Created:     time.Now().UTC(),
+		Key: ArchiveKey{
+			Provider:  provider,
+			RootKeyID: key.RootKeyID,
+			Algorithm: key.Algorithm,
+			Encrypted: key.Encrypted,
+		},
+	}
+
+	var err error
+
+	if archive.Settings, err = list[models.Settings](db); err != nil {
+		return nil, err
+	}
+
+	if archive.Identities, err = ListIdentities(db); err != nil {
+		return nil, err
+	}
+
+	if archive.Groups, err = ListGroups(db); err != nil {
+		return nil, err
+	}
+
+	if err := db.Table("identities_groups").Select("identity_id", "group_id").Find(&archive.Memberships).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Find(&archive.GroupMembers).Error; err != nil {
+		return nil, err
+	}
+
+	if archive.Grants, err = ListGrants(db); err != nil {
+		return nil, err
+	}
+
+	if archive.Providers, err = ListProviders(db); err != nil {
+		return nil, err
+	}
+
+	if archive.ProviderUsers, err = list[models.ProviderUser](db); err != nil {
+		return nil, err
+	}
+
+	if archive.Credentials, err = list[models.Credential](db); err != nil {
+		return nil, err
+	}
+
+	if archive.AccessKeys, err = ListAccessKeys(db); err != nil {
+		return nil, err
+	}
+
+	if archive.Destinations, err = ListDestinations(db); err != nil {
+		return nil, err
+	}
+
+	if archive.ClusterTrusts, err = list[models.ClusterTrust](db); err != nil {
+		return nil, err
+	}
+
+	if archive.RootCertificates, err = ListRootCertificates(db); err != nil {
+		return nil, err
+	}
+
+	if archive.BreakGlasses, err = ListBreakGlass(db); err != nil {
+		return nil, err
+	}
+
+	if archive.BreakGlassEvents, err = ListBreakGlassEvents(db); err != nil {
+		return nil, err
+	}
+
+	if archive.AccessRequests, err = ListAccessRequests(db); err != nil {
+		return nil, err
+	}
+
+	if archive.Reviews, err = list[models.Review](db); err != nil {
+		return nil, err
+	}
+
+	if err := db.Table("reviews_reviewers").Select("review_id", "identity_id").Find(&archive.ReviewReviewers).Error; err != nil {
+		return nil, err
+	}
+
+	if archive.ReviewItems, err = ListReviewItems(db); err != nil {
+		return nil, err
+	}
+
+	if archive.AuditRecords, err = ListKubernetesAuditRecords(db); err != nil {
+		return nil, err
+	}
+
+	// the recordings themselves stay in their storage, only the records of them are archived
+	if archive.Recordings, err = ListSessionRecordings(db); err != nil {
+		return nil, err
+	}
+
+	if err := archive.sealSecrets(key, secrets.Seal); err != nil {
+		return nil, fmt.Errorf("sealing secret fields: %w", err)
+	}
+
+	return archive, nil
+}
+
+// ReadArchive reads an archive, and checks this version of Infra can restore it
+func ReadArchive(r io.Reader) (*Archive, error) {
+	var archive Archive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("%w: invalid archive: %s", internal.ErrBadRequest, err)
+	}
+
+	if archive.Version != ArchiveVersion {
+		return nil, fmt.Errorf("%w: archive version %d is not supported, expected %d", internal.ErrBadRequest, archive.Version, ArchiveVersion)
+	}
+
+	if !knownMigrationID(archive.MigrationID) {
+		return nil, fmt.Errorf("%w: archive is at migration %q, which this version of Infra does not have; restore it with the version that created it, or a later one", internal.ErrBadRequest, archive.MigrationID)
+	}
+
+	return &archive, nil
+}
+
+// Write writes the archive as JSON
+func (a *Archive) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(a)
+}
+
+// Restore replaces the server's state with the archive's. Secret fields are unsealed with key, the decrypted archive
+// key, and sealed again with the database key when they are stored. Rows keep their IDs, so references between them,
+// and to them from outside Infra, still hold.
+func Restore(db *gorm.DB, archive *Archive, key *secrets.SymmetricKey) error {
+	if err := archive.sealSecrets(key, secrets.Unseal); err != nil {
+		return fmt.Errorf("%w: unsealing secret fields: %s", internal.ErrBadRequest, err)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		tables := []interface{}{
+			&models.Settings{},
+			&models.Identity{},
+			&models.Group{},
+			&models.Grant{},
+			&models.Provider{},
+			&models.ProviderUser{},
+			&models.Credential{},
+			&models.AccessKey{},
+			&models.Destination{},
+			&models.ClusterTrust{},
+			&models.RootCertificate{},
+			&models.BreakGlass{},
+			&models.BreakGlassEvent{},
+			&models.AccessRequest{},
+			&models.Review{},
+			&models.ReviewItem{},
+			&models.KubernetesAuditRecord{},
+			&models.SessionRecording{},
+			// sessions of the replaced identities end
+			&models.RefreshToken{},
+			&models.ClientCertificate{},
+			&models.DeviceFlowAuthRequest{},
+			// tunnels are connected to the replicas that were running, and reconnect
+			&models.DestinationTunnel{},
+		}
+
+		for _, table := range tables {
+			// rows are removed rather than soft deleted, so the restored ones do not conflict with them
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(table).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("delete from identities_groups").Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec("delete from reviews_reviewers").Error; err != nil {
+			return err
+		}
+
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.Settings); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.Identities); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.Groups); err != nil {
+			return err
+		}
+
+		for _, m := range archive.Memberships {
+			if err := tx.Exec("insert into identities_groups (identity_id, group_id) values (?, ?)", m.IdentityID, m.GroupID).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(archive.GroupMembers) > 0 {
+			if err := tx.Create(&archive.GroupMembers).Error; err != nil {
+				return err
+			}
+		}
+
+		// the cached ancestors are rebuilt from the restored memberships
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.GroupAncestor{}).Error; err != nil {
+			return err
+		}
+
+		members := make([]uid.ID, 0, len(archive.GroupMembers))
+		for _, m := range archive.GroupMembers {
+			members = append(members, m.MemberID)
+		}
+
+		if err := rebuildGroupAncestors(tx, members); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.Grants); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.Providers); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.ProviderUsers); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.Credentials); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.AccessKeys); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.Destinations); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.ClusterTrusts); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.RootCertificates); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.BreakGlasses); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.BreakGlassEvents); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.AccessRequests); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.Reviews); err != nil {
+			return err
+		}
+
+		for _, r := range archive.ReviewReviewers {
+			if err := tx.Exec("insert into reviews_reviewers (review_id, identity_id) values (?, ?)", r.ReviewID, r.IdentityID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := restoreRows(tx, archive.ReviewItems); err != nil {
+			return err
+		}
+
+		if err := restoreRows(tx, archive.AuditRecords); err != nil {
+			return err
+		}
+
+		return restoreRows(tx, archive.Recordings)
+	})
+}
+
+// restoreRows inserts rows as they are in the archive. Associations are restored separately.
+func restoreRows[T models.Modelable](db *gorm.DB, rows []T) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if err := db.Omit(clause.Associations).Create(&rows).Error; err != nil {
+		var t T
+		return fmt.Errorf("restoring %T: %w", t, err)
+	}
+
+	return nil
+}
+
+// sealSecrets seals or unseals the secret fields of the archive with key
+func (a *Archive) sealSecrets(key *secrets.SymmetricKey, seal func(*secrets.SymmetricKey, []byte) ([]byte, error)) error {
+	var err error
+
+	field := func(s *models.EncryptedAtRest) {
+		if *s == "" || err != nil {
+			return
+		}
+
+		var b []byte
+
+		b, err = seal(key, []byte(*s))
+		if err != nil {
+			return
+		}
+
+		*s = models.EncryptedAtRest(b)
+	}
+
+	for i := range a.Settings {
+		jwk := models.EncryptedAtRest(a.Settings[i].PrivateJWK)
+		field(&jwk)
+		a.Settings[i].PrivateJWK = []byte(jwk)
+	}
+
+	for i := range a.Providers {
+		field(&a.Providers[i].ClientSecret)
+	}
+
+	for i := range a.ProviderUsers {
+		field(&a.ProviderUsers[i].AccessToken)
+		field(&a.ProviderUsers[i].RefreshToken)
+	}
+
+	for i := range a.ClusterTrusts {
+		field(&a.ClusterTrusts[i].ReviewerToken)
+	}
+
+	for i := range a.RootCertificates {
+		field(&a.RootCertificates[i].PrivateKey)
+		field(&a.RootCertificates[i].SignedCert)
+	}
+
+	return err
+}
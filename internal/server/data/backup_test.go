@@ -0,0 +1,184 @@
+package data
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/secrets"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestBackupRestore(t *testing.T) {
+	source := setup(t)
+
+	provider := &models.Provider{Name: "okta", URL: "example.okta.com", ClientID: "client-id", ClientSecret: "client-secret"}
+	err := CreateProvider(source, provider)
+	assert.NilError(t, err)
+
+	identity := &models.Identity{Name: "alice@example.com", Kind: models.UserKind}
+	err = CreateIdentity(source, identity)
+	assert.NilError(t, err)
+
+	group := &models.Group{Name: "engineering"}
+	err = CreateGroup(source, group)
+	assert.NilError(t, err)
+
+	err = source.Exec("insert into identities_groups (identity_id, group_id) values (?, ?)", identity.ID, group.ID).Error
+	assert.NilError(t, err)
+
+	platform := &models.Group{Name: "platform"}
+	err = CreateGroup(source, platform)
+	assert.NilError(t, err)
+
+	oncall := &models.Group{Name: "platform-oncall"}
+	err = CreateGroup(source, oncall)
+	assert.NilError(t, err)
+
+	err = AddGroupMember(source, platform.ID, oncall.ID)
+	assert.NilError(t, err)
+
+	grant := &models.Grant{Subject: group.PolyID(), Privilege: "view", Resource: "production"}
+	err = CreateGrant(source, grant)
+	assert.NilError(t, err)
+
+	request := &models.AccessRequest{IdentityID: identity.ID, Privilege: "edit", Resource: "production", Status: models.AccessRequestPending}
+	err = CreateAccessRequest(source, request)
+	assert.NilError(t, err)
+
+	review := &models.Review{Name: "quarterly", Status: models.ReviewOpen, Reviewers: []models.Identity{*identity}}
+	err = CreateReview(source, review)
+	assert.NilError(t, err)
+
+	item := &models.ReviewItem{ReviewID: review.ID, GrantID: grant.ID, Subject: grant.Subject, Privilege: grant.Privilege, Resource: grant.Resource, Decision: models.ReviewPending}
+	err = CreateReviewItem(source, item)
+	assert.NilError(t, err)
+
+	_, err = InitializeSettings(source, false)
+	assert.NilError(t, err)
+
+	kp := secrets.NewNativeSecretProvider(secrets.NewFileSecretProviderFromConfig(secrets.FileConfig{Path: t.TempDir()}))
+
+	archiveKey, err := kp.GenerateDataKey("")
+	assert.NilError(t, err)
+
+	archive, err := Backup(source, "native", archiveKey)
+	assert.NilError(t, err)
+	assert.Equal(t, archive.MigrationID, LatestMigrationID())
+
+	var buf bytes.Buffer
+	err = archive.Write(&buf)
+	assert.NilError(t, err)
+
+	// secrets are sealed in the archive
+	assert.Assert(t, !strings.Contains(buf.String(), "client-secret"))
+
+	// the destination has its own database key
+	dest := setup(t)
+
+	other := &models.Identity{Name: "bob@example.com", Kind: models.UserKind}
+	err = CreateIdentity(dest, other)
+	assert.NilError(t, err)
+
+	// rows of the destination that refer to its identities and grants are replaced along with them
+	err = CreateAccessRequest(dest, &models.AccessRequest{IdentityID: other.ID, Privilege: "admin", Resource: "production", Status: models.AccessRequestPending})
+	assert.NilError(t, err)
+
+	err = CreateDestinationTunnel(dest, &models.DestinationTunnel{DestinationID: 1234, ReplicaURL: "http://10.0.0.1"})
+	assert.NilError(t, err)
+
+	read, err := ReadArchive(&buf)
+	assert.NilError(t, err)
+
+	key, err := kp.DecryptDataKey(read.Key.RootKeyID, read.Key.Encrypted)
+	assert.NilError(t, err)
+
+	err = Restore(dest, read, key)
+	assert.NilError(t, err)
+
+	restored, err := GetProvider(dest, ByName("okta"))
+	assert.NilError(t, err)
+	assert.Equal(t, restored.ID, provider.ID)
+	assert.Equal(t, restored.ClientSecret, models.EncryptedAtRest("client-secret"))
+
+	identities, err := ListIdentities(dest)
+	assert.NilError(t, err)
+	assert.Equal(t, len(identities), 1)
+	assert.Equal(t, identities[0].ID, identity.ID)
+
+	groups, err := ListIdentityGroups(dest, identity.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(groups), 1)
+	assert.Equal(t, groups[0].ID, group.ID)
+
+	ancestors, err := ListGroupAncestors(dest, oncall.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(ancestors), 1)
+	assert.Equal(t, ancestors[0].ID, platform.ID)
+
+	grants, err := ListGrants(dest, BySubject(group.PolyID()))
+	assert.NilError(t, err)
+	assert.Equal(t, len(grants), 1)
+	assert.Equal(t, grants[0].ID, grant.ID)
+
+	requests, err := ListAccessRequests(dest)
+	assert.NilError(t, err)
+	assert.Equal(t, len(requests), 1)
+	assert.Equal(t, requests[0].ID, request.ID)
+
+	restoredReview, err := GetReview(dest, ByID(review.ID))
+	assert.NilError(t, err)
+	assert.Equal(t, len(restoredReview.Reviewers), 1)
+	assert.Equal(t, restoredReview.Reviewers[0].ID, identity.ID)
+
+	items, err := ListReviewItems(dest)
+	assert.NilError(t, err)
+	assert.Equal(t, len(items), 1)
+	assert.Equal(t, items[0].GrantID, grant.ID)
+
+	tunnels, err := list[models.DestinationTunnel](dest)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tunnels), 0)
+
+	sourceSettings, err := GetSettings(source)
+	assert.NilError(t, err)
+
+	settings, err := GetSettings(dest)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, settings.PrivateJWK, sourceSettings.PrivateJWK)
+}
+
+func TestReadArchive(t *testing.T) {
+	t.Run("unknown migration", func(t *testing.T) {
+		_, err := ReadArchive(strings.NewReader(`{"Version": 1, "MigrationID": "209901010000"}`))
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+		assert.ErrorContains(t, err, "does not have")
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		_, err := ReadArchive(strings.NewReader(`{"Version": 2, "MigrationID": "` + LatestMigrationID() + `"}`))
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		kp := secrets.NewNativeSecretProvider(secrets.NewFileSecretProviderFromConfig(secrets.FileConfig{Path: t.TempDir()}))
+
+		key, err := kp.GenerateDataKey("")
+		assert.NilError(t, err)
+
+		other, err := kp.GenerateDataKey("")
+		assert.NilError(t, err)
+
+		sealed, err := secrets.Seal(key, []byte("client-secret"))
+		assert.NilError(t, err)
+
+		archive := &Archive{Providers: []models.Provider{{Model: models.Model{ID: uid.New()}, Name: "okta", ClientSecret: models.EncryptedAtRest(sealed)}}}
+
+		err = Restore(setup(t), archive, other)
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+	})
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func ByBreakGlassID(id uid.ID) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("break_glass_id = ?", id)
+	}
+}
+
+// ByExpiredBefore selects the break-glass accounts that are unlocked until a time before t
+func ByExpiredBefore(t time.Time) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("expires_at > ? AND expires_at <= ?", time.Time{}, t)
+	}
+}
+
+func ByAccessKeyID(id uid.ID) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("access_key_id = ?", id)
+	}
+}
+
+// ByPendingNotification selects the break-glass events waiting to be sent to the notifications, oldest first
+func ByPendingNotification() SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("pending = ?", true).Order("time")
+	}
+}
+
+func CreateBreakGlass(db *gorm.DB, breakGlass *models.BreakGlass) error {
+	return add(db, breakGlass)
+}
+
+func SaveBreakGlass(db *gorm.DB, breakGlass *models.BreakGlass) error {
+	return save(db, breakGlass)
+}
+
+func GetBreakGlass(db *gorm.DB, selectors ...SelectorFunc) (*models.BreakGlass, error) {
+	return get[models.BreakGlass](db, selectors...)
+}
+
+func ListBreakGlass(db *gorm.DB, selectors ...SelectorFunc) ([]models.BreakGlass, error) {
+	return list[models.BreakGlass](db, selectors...)
+}
+
+func DeleteBreakGlass(db *gorm.DB, id uid.ID) error {
+	return delete[models.BreakGlass](db, id)
+}
+
+func CreateBreakGlassEvent(db *gorm.DB, event *models.BreakGlassEvent) error {
+	return add(db, event)
+}
+
+func ListBreakGlassEvents(db *gorm.DB, selectors ...SelectorFunc) ([]models.BreakGlassEvent, error) {
+	return list[models.BreakGlassEvent](db, selectors...)
+}
+
+// MarkBreakGlassEventSent stops a break-glass event from waiting to be sent to the notifications
+func MarkBreakGlassEventSent(db *gorm.DB, id uid.ID) error {
+	return db.Model(&models.BreakGlassEvent{}).Where("id = ?", id).Update("pending", false).Error
+}
@@ -0,0 +1,34 @@
+package data
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func ByUniqueID(uniqueID string) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("unique_id = ?", uniqueID)
+	}
+}
+
+func CreateClusterTrust(db *gorm.DB, trust *models.ClusterTrust) error {
+	return add(db, trust)
+}
+
+func SaveClusterTrust(db *gorm.DB, trust *models.ClusterTrust) error {
+	return save(db, trust)
+}
+
+func GetClusterTrust(db *gorm.DB, selectors ...SelectorFunc) (*models.ClusterTrust, error) {
+	return get[models.ClusterTrust](db, selectors...)
+}
+
+func ListClusterTrusts(db *gorm.DB, selectors ...SelectorFunc) ([]models.ClusterTrust, error) {
+	return list[models.ClusterTrust](db, selectors...)
+}
+
+func DeleteClusterTrust(db *gorm.DB, id uid.ID) error {
+	return delete[models.ClusterTrust](db, id)
+}
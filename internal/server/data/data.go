@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -39,6 +40,18 @@ func NewDB(connection gorm.Dialector) (*gorm.DB, error) {
 		db2.SetMaxOpenConns(1)
 	}
 
+	// servers sharing the database migrate it one at a time
+	lock, err := AcquireLock(context.Background(), db, "migrate")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := lock.Release(); err != nil {
+			logging.S.Warnf("release migration lock: %s", err)
+		}
+	}()
+
 	if err = migrate(db); err != nil {
 		return nil, fmt.Errorf("migration failed: %w", err)
 	}
@@ -166,7 +179,7 @@ func Count[T models.Modelable](db *gorm.DB, selectors ...SelectorFunc) (*int64,
 	}
 
 	var count int64
-	if err := db.Model((*T)(nil)).Count(&count).Error; err != nil {
+	if err := db2.Model((*T)(nil)).Count(&count).Error; err != nil {
 		return nil, err
 	}
 
@@ -45,3 +45,28 @@ func DeleteDestinations(db *gorm.DB, selector SelectorFunc) error {
 
 	return internal.ErrNotFound
 }
+
+func ByDestinationID(id uid.ID) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("destination_id = ?", id)
+	}
+}
+
+func ByReplicaURL(url string) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("replica_url = ?", url)
+	}
+}
+
+func CreateDestinationTunnel(db *gorm.DB, tunnel *models.DestinationTunnel) error {
+	return add(db, tunnel)
+}
+
+func ListDestinationTunnels(db *gorm.DB, selectors ...SelectorFunc) ([]models.DestinationTunnel, error) {
+	return list[models.DestinationTunnel](db, selectors...)
+}
+
+// DeleteDestinationTunnels deletes the records of tunnels, which are not kept once the tunnels close
+func DeleteDestinationTunnels(db *gorm.DB, selectors ...SelectorFunc) error {
+	return deleteAll[models.DestinationTunnel](db.Unscoped(), selectors...)
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func ByUserCode(code string) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_code = ?", code)
+	}
+}
+
+func ByDeviceCodeChecksum(checksum []byte) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("device_code_checksum = ?", checksum)
+	}
+}
+
+func ByState(state string) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("state = ?", state)
+	}
+}
+
+func CreateDeviceFlowAuthRequest(db *gorm.DB, req *models.DeviceFlowAuthRequest) error {
+	return add(db, req)
+}
+
+func GetDeviceFlowAuthRequest(db *gorm.DB, selectors ...SelectorFunc) (*models.DeviceFlowAuthRequest, error) {
+	return get[models.DeviceFlowAuthRequest](db, selectors...)
+}
+
+func SaveDeviceFlowAuthRequest(db *gorm.DB, req *models.DeviceFlowAuthRequest) error {
+	return save(db, req)
+}
+
+// CollectDeviceFlowAuthRequest claims the credentials of an approved request, unless another poll claimed them first.
+// It reports whether this call claimed them.
+func CollectDeviceFlowAuthRequest(db *gorm.DB, id uid.ID) (bool, error) {
+	result := db.Model(&models.DeviceFlowAuthRequest{}).Where("id = ? and collected = ?", id, false).Update("collected", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func DeleteDeviceFlowAuthRequest(db *gorm.DB, id uid.ID) error {
+	return delete[models.DeviceFlowAuthRequest](db, id)
+}
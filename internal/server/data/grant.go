@@ -15,7 +15,7 @@ func CreateGrant(db *gorm.DB, grant *models.Grant) error {
 	}
 
 	for _, existingGrant := range grants {
-		if existingGrant.Privilege == grant.Privilege {
+		if existingGrant.Privilege == grant.Privilege && existingGrant.Deny == grant.Deny && existingGrant.Conditions.Equal(grant.Conditions) {
 			// exact match exists, no need to store it twice.
 			return nil
 		}
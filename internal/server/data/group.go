@@ -1,8 +1,12 @@
 package data
 
 import (
+	"fmt"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
 )
@@ -27,6 +31,7 @@ func ListGroups(db *gorm.DB, selectors ...SelectorFunc) ([]models.Group, error)
 	return list[models.Group](db, selectors...)
 }
 
+// ListIdentityGroups lists the groups an identity belongs to, directly or through the groups it is a member of
 func ListIdentityGroups(db *gorm.DB, userID uid.ID) (result []models.Group, err error) {
 	user := &models.Identity{Model: models.Model{ID: userID}, Kind: models.UserKind}
 
@@ -34,7 +39,207 @@ func ListIdentityGroups(db *gorm.DB, userID uid.ID) (result []models.Group, err
 		return nil, err
 	}
 
-	return result, nil
+	if len(result) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uid.ID, len(result))
+	for i, g := range result {
+		ids[i] = g.ID
+	}
+
+	var ancestors []uid.ID
+	if err := db.Model(&models.GroupAncestor{}).Where("group_id in (?) and ancestor_id not in (?)", ids, ids).Distinct().Pluck("ancestor_id", &ancestors).Error; err != nil {
+		return nil, err
+	}
+
+	if len(ancestors) == 0 {
+		return result, nil
+	}
+
+	inherited, err := ListGroups(db, ByIDs(ancestors))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(result, inherited...), nil
+}
+
+// ListGroupAncestors lists the groups a group belongs to, directly or through other groups
+func ListGroupAncestors(db *gorm.DB, groupID uid.ID) ([]models.Group, error) {
+	var ancestors []uid.ID
+	if err := db.Model(&models.GroupAncestor{}).Where("group_id = ?", groupID).Pluck("ancestor_id", &ancestors).Error; err != nil {
+		return nil, err
+	}
+
+	if len(ancestors) == 0 {
+		return []models.Group{}, nil
+	}
+
+	return ListGroups(db, ByIDs(ancestors))
+}
+
+// ListGroupMembers lists the groups that are direct members of a group
+func ListGroupMembers(db *gorm.DB, groupID uid.ID) ([]models.Group, error) {
+	var members []uid.ID
+	if err := db.Model(&models.GroupMember{}).Where("group_id = ?", groupID).Pluck("member_id", &members).Error; err != nil {
+		return nil, err
+	}
+
+	if len(members) == 0 {
+		return []models.Group{}, nil
+	}
+
+	return ListGroups(db, ByIDs(members))
+}
+
+// groupMembersLock serializes changes to group memberships, so concurrent changes can not create a cycle between them
+// or leave stale ancestors
+const groupMembersLock = "group-members"
+
+// AddGroupMember makes a group a member of another group. A group can not be a member of itself, directly or through
+// other groups.
+func AddGroupMember(db *gorm.DB, groupID, memberID uid.ID) error {
+	if groupID == memberID {
+		return fmt.Errorf("%w: a group can not be a member of itself", internal.ErrBadRequest)
+	}
+
+	if err := lockTransaction(db, groupMembersLock); err != nil {
+		return err
+	}
+
+	var cycles int64
+	if err := db.Model(&models.GroupAncestor{}).Where("group_id = ? and ancestor_id = ?", groupID, memberID).Count(&cycles).Error; err != nil {
+		return err
+	}
+
+	if cycles > 0 {
+		return fmt.Errorf("%w: the group is already a member of the group it would contain, which would create a cycle", internal.ErrBadRequest)
+	}
+
+	if err := db.Create(&models.GroupMember{GroupID: groupID, MemberID: memberID}).Error; err != nil {
+		if isUniqueConstraintViolation(err) {
+			return fmt.Errorf("%w: %s", internal.ErrDuplicate, err)
+		}
+
+		return err
+	}
+
+	// the member, and the groups in it, belong to the group and the groups it belongs to
+	var descendants, ancestors []uid.ID
+	if err := db.Model(&models.GroupAncestor{}).Where("ancestor_id = ?", memberID).Pluck("group_id", &descendants).Error; err != nil {
+		return err
+	}
+
+	if err := db.Model(&models.GroupAncestor{}).Where("group_id = ?", groupID).Pluck("ancestor_id", &ancestors).Error; err != nil {
+		return err
+	}
+
+	descendants = append(descendants, memberID)
+	ancestors = append(ancestors, groupID)
+
+	var rows []models.GroupAncestor
+	for _, descendant := range descendants {
+		for _, ancestor := range ancestors {
+			rows = append(rows, models.GroupAncestor{GroupID: descendant, AncestorID: ancestor})
+		}
+	}
+
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+// RemoveGroupMember removes a group from the members of another group
+func RemoveGroupMember(db *gorm.DB, groupID, memberID uid.ID) error {
+	if err := lockTransaction(db, groupMembersLock); err != nil {
+		return err
+	}
+
+	result := db.Where("group_id = ? and member_id = ?", groupID, memberID).Delete(&models.GroupMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return internal.ErrNotFound
+	}
+
+	// only the member, and the groups in it, can lose ancestors
+	var descendants []uid.ID
+	if err := db.Model(&models.GroupAncestor{}).Where("ancestor_id = ?", memberID).Pluck("group_id", &descendants).Error; err != nil {
+		return err
+	}
+
+	return rebuildGroupAncestors(db, append(descendants, memberID))
+}
+
+// rebuildGroupAncestors rebuilds the cached ancestors of the groups from the group memberships
+func rebuildGroupAncestors(db *gorm.DB, groups []uid.ID) error {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	// parents is loaded a level at a time, up from the groups
+	parents := make(map[uid.ID][]uid.ID)
+	next := groups
+
+	for len(next) > 0 {
+		var members []models.GroupMember
+		if err := db.Where("member_id in (?)", next).Find(&members).Error; err != nil {
+			return err
+		}
+
+		for _, id := range next {
+			parents[id] = []uid.ID{}
+		}
+
+		next = nil
+
+		for _, m := range members {
+			parents[m.MemberID] = append(parents[m.MemberID], m.GroupID)
+
+			if _, ok := parents[m.GroupID]; !ok {
+				next = append(next, m.GroupID)
+			}
+		}
+	}
+
+	var rows []models.GroupAncestor
+
+	rebuilt := map[uid.ID]bool{}
+
+	for _, group := range groups {
+		if rebuilt[group] {
+			continue
+		}
+
+		rebuilt[group] = true
+
+		seen := map[uid.ID]bool{}
+		queue := append([]uid.ID{}, parents[group]...)
+
+		for len(queue) > 0 {
+			ancestor := queue[0]
+			queue = queue[1:]
+
+			if seen[ancestor] {
+				continue
+			}
+
+			seen[ancestor] = true
+			rows = append(rows, models.GroupAncestor{GroupID: group, AncestorID: ancestor})
+			queue = append(queue, parents[ancestor]...)
+		}
+	}
+
+	if err := db.Where("group_id in (?)", groups).Delete(&models.GroupAncestor{}).Error; err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return db.Create(&rows).Error
 }
 
 func DeleteGroups(db *gorm.DB, selectors ...SelectorFunc) error {
@@ -53,5 +258,29 @@ func DeleteGroups(db *gorm.DB, selectors ...SelectorFunc) error {
 		}
 	}
 
+	if len(ids) > 0 {
+		if err := lockTransaction(db, groupMembersLock); err != nil {
+			return err
+		}
+
+		// the groups in the deleted groups lose the ancestors they had through them
+		var descendants []uid.ID
+		if err := db.Model(&models.GroupAncestor{}).Where("ancestor_id in (?) and group_id not in (?)", ids, ids).Distinct().Pluck("group_id", &descendants).Error; err != nil {
+			return err
+		}
+
+		if err := db.Where("group_id in (?) or member_id in (?)", ids, ids).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+
+		if err := db.Where("group_id in (?)", ids).Delete(&models.GroupAncestor{}).Error; err != nil {
+			return err
+		}
+
+		if err := rebuildGroupAncestors(db, descendants); err != nil {
+			return err
+		}
+	}
+
 	return deleteAll[models.Group](db, ByIDs(ids))
 }
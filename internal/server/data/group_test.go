@@ -8,6 +8,7 @@ import (
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/models"
 )
 
@@ -253,3 +254,101 @@ func TestRecreateGroupSameName(t *testing.T) {
 	err = CreateGroup(db, &models.Group{Name: everyone.Name})
 	assert.NilError(t, err)
 }
+
+func TestNestedGroups(t *testing.T) {
+	db := setup(t)
+
+	var (
+		platform = models.Group{Name: "platform"}
+		oncall   = models.Group{Name: "platform-oncall"}
+		primary  = models.Group{Name: "platform-oncall-primary"}
+		design   = models.Group{Name: "design"}
+	)
+
+	for _, g := range []*models.Group{&platform, &oncall, &primary, &design} {
+		err := CreateGroup(db, g)
+		assert.NilError(t, err)
+	}
+
+	alice := &models.Identity{Name: "alice@example.com", Kind: models.UserKind}
+	err := CreateIdentity(db, alice)
+	assert.NilError(t, err)
+
+	err = db.Model(alice).Association("Groups").Append([]models.Group{primary})
+	assert.NilError(t, err)
+
+	// groupNames returns the error instead, so comparing them fails with it
+	groupNames := func(groups []models.Group, err error) []string {
+		if err != nil {
+			return []string{err.Error()}
+		}
+
+		names := make([]string, 0, len(groups))
+		for _, g := range groups {
+			names = append(names, g.Name)
+		}
+
+		sort.Strings(names)
+
+		return names
+	}
+
+	// members are added from the bottom up, so the cached ancestors of the members' members are updated
+	err = AddGroupMember(db, oncall.ID, primary.ID)
+	assert.NilError(t, err)
+
+	err = AddGroupMember(db, platform.ID, oncall.ID)
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, groupNames(ListIdentityGroups(db, alice.ID)), []string{"platform", "platform-oncall", "platform-oncall-primary"})
+	assert.DeepEqual(t, groupNames(ListGroupAncestors(db, primary.ID)), []string{"platform", "platform-oncall"})
+	assert.DeepEqual(t, groupNames(ListGroupMembers(db, platform.ID)), []string{"platform-oncall"})
+
+	t.Run("identities in a group", func(t *testing.T) {
+		for _, g := range []models.Group{platform, oncall, primary} {
+			identities, err := ListIdentities(db, ByOptionalGroupMember(g.ID))
+			assert.NilError(t, err)
+			assert.Equal(t, len(identities), 1)
+			assert.Equal(t, identities[0].Name, "alice@example.com")
+		}
+
+		identities, err := ListIdentities(db, ByOptionalGroupMember(design.ID))
+		assert.NilError(t, err)
+		assert.Equal(t, len(identities), 0)
+	})
+
+	t.Run("cycles", func(t *testing.T) {
+		err := AddGroupMember(db, primary.ID, platform.ID)
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+		err = AddGroupMember(db, oncall.ID, oncall.ID)
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+		err = AddGroupMember(db, oncall.ID, primary.ID)
+		assert.ErrorIs(t, err, internal.ErrDuplicate)
+	})
+
+	t.Run("a group in two groups", func(t *testing.T) {
+		err := AddGroupMember(db, design.ID, oncall.ID)
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, groupNames(ListIdentityGroups(db, alice.ID)), []string{"design", "platform", "platform-oncall", "platform-oncall-primary"})
+
+		err = RemoveGroupMember(db, design.ID, oncall.ID)
+		assert.NilError(t, err)
+
+		// the members keep the ancestors they have through the other group
+		assert.DeepEqual(t, groupNames(ListIdentityGroups(db, alice.ID)), []string{"platform", "platform-oncall", "platform-oncall-primary"})
+		assert.DeepEqual(t, groupNames(ListGroupAncestors(db, oncall.ID)), []string{"platform"})
+
+		err = RemoveGroupMember(db, design.ID, oncall.ID)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+	})
+
+	err = DeleteGroups(db, ByID(oncall.ID))
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, groupNames(ListIdentityGroups(db, alice.ID)), []string{"platform-oncall-primary"})
+	assert.DeepEqual(t, groupNames(ListGroupAncestors(db, primary.ID)), []string{})
+	assert.DeepEqual(t, groupNames(ListGroupMembers(db, platform.ID)), []string{})
+}
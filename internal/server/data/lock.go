@@ -0,0 +1,170 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Lock is held by one of the servers sharing a database at a time. On Postgres it is a session advisory lock, held on
+// a connection reserved for it, and released if the server loses the connection. SQLite databases are only shared by
+// servers in the same process, so the lock is held in memory.
+type Lock struct {
+	key int64
+
+	// conn holds a Postgres lock
+	conn *sql.Conn
+
+	// local holds a SQLite lock
+	local chan struct{}
+}
+
+// AcquireLock waits until the lock with the name is acquired, or the context is done
+func AcquireLock(ctx context.Context, db *gorm.DB, name string) (*Lock, error) {
+	return acquireLock(ctx, db, name, true)
+}
+
+// TryLock acquires the lock with the name, and returns nil when it is held by another server
+func TryLock(ctx context.Context, db *gorm.DB, name string) (*Lock, error) {
+	return acquireLock(ctx, db, name, false)
+}
+
+func acquireLock(ctx context.Context, db *gorm.DB, name string, wait bool) (*Lock, error) {
+	lock := &Lock{key: lockKey(name)}
+
+	if db.Dialector.Name() != "postgres" {
+		lock.local = localLock(db, name)
+
+		if wait {
+			select {
+			case lock.local <- struct{}{}:
+				return lock, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		select {
+		case lock.local <- struct{}{}:
+			return lock, nil
+		default:
+			return nil, nil
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	lock.conn, err = sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", name, err)
+	}
+
+	if wait {
+		if _, err := lock.conn.ExecContext(ctx, "select pg_advisory_lock($1)", lock.key); err != nil {
+			lock.conn.Close()
+			return nil, fmt.Errorf("lock %s: %w", name, err)
+		}
+
+		return lock, nil
+	}
+
+	var acquired bool
+	if err := lock.conn.QueryRowContext(ctx, "select pg_try_advisory_lock($1)", lock.key).Scan(&acquired); err != nil {
+		lock.conn.Close()
+		return nil, fmt.Errorf("lock %s: %w", name, err)
+	}
+
+	if !acquired {
+		lock.conn.Close()
+		return nil, nil
+	}
+
+	return lock, nil
+}
+
+// Held checks the lock is still held. A Postgres lock is lost with the connection it was acquired on.
+func (l *Lock) Held(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+
+	return l.conn.PingContext(ctx)
+}
+
+// Release releases the lock, for another server to acquire
+func (l *Lock) Release() error {
+	if l.conn == nil {
+		<-l.local
+		return nil
+	}
+
+	// closing the connection returns it to the pool, where the session and its locks live on, so the lock is
+	// released first
+	_, err := l.conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", l.key)
+
+	if closeErr := l.conn.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// lockTransaction holds the lock with the name until the transaction ends, to serialize changes that read before they
+// write. SQLite runs one write transaction at a time, and fails the others that read before it committed, so only
+// Postgres needs the lock.
+func lockTransaction(db *gorm.DB, name string) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	if err := db.Exec("select pg_advisory_xact_lock(?)", lockKey(name)).Error; err != nil {
+		return fmt.Errorf("lock %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// lockKey is the key of the advisory lock with the name, which is shared by all databases on the Postgres server
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("infra:" + name))
+
+	return int64(h.Sum64())
+}
+
+var (
+	localLocksMu sync.Mutex
+	localLocks   = map[string]chan struct{}{}
+)
+
+// localLock is the in-memory lock with the name, for the SQLite database. In-memory databases are not shared between
+// connection pools, so each has its own locks.
+func localLock(db *gorm.DB, name string) chan struct{} {
+	database := fmt.Sprintf("%p", db.ConnPool)
+
+	if dialector, ok := db.Dialector.(*sqlite.Dialector); ok && !strings.Contains(dialector.DSN, ":memory:") {
+		database = dialector.DSN
+	}
+
+	localLocksMu.Lock()
+	defer localLocksMu.Unlock()
+
+	key := database + "/" + name
+
+	lock, ok := localLocks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		localLocks[key] = lock
+	}
+
+	return lock
+}
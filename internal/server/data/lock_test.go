@@ -0,0 +1,74 @@
+package data
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gotest.tools/v3/assert"
+)
+
+func TestLock(t *testing.T) {
+	// two servers sharing one database
+	file := filepath.Join(t.TempDir(), "sqlite3.db")
+
+	open := func() *gorm.DB {
+		driver, err := NewSQLiteDriver(file)
+		assert.NilError(t, err)
+
+		db, err := NewDB(driver)
+		assert.NilError(t, err)
+
+		return db
+	}
+
+	first, second := open(), open()
+
+	lock, err := TryLock(context.Background(), first, "leader")
+	assert.NilError(t, err)
+	assert.Assert(t, lock != nil)
+	assert.NilError(t, lock.Held(context.Background()))
+
+	other, err := TryLock(context.Background(), second, "leader")
+	assert.NilError(t, err)
+	assert.Assert(t, other == nil)
+
+	t.Run("other names are not locked", func(t *testing.T) {
+		setup, err := TryLock(context.Background(), second, "setup")
+		assert.NilError(t, err)
+		assert.Assert(t, setup != nil)
+		assert.NilError(t, setup.Release())
+	})
+
+	t.Run("acquire waits until released", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := AcquireLock(ctx, second, "leader")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	assert.NilError(t, lock.Release())
+
+	other, err = TryLock(context.Background(), second, "leader")
+	assert.NilError(t, err)
+	assert.Assert(t, other != nil)
+	assert.NilError(t, other.Release())
+
+	t.Run("in-memory databases are not shared", func(t *testing.T) {
+		a, b := setup(t), setup(t)
+
+		lock, err := TryLock(context.Background(), a, "leader")
+		assert.NilError(t, err)
+		assert.Assert(t, lock != nil)
+
+		other, err := TryLock(context.Background(), b, "leader")
+		assert.NilError(t, err)
+		assert.Assert(t, other != nil)
+
+		assert.NilError(t, other.Release())
+		assert.NilError(t, lock.Release())
+	})
+}
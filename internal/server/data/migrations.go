@@ -13,7 +13,27 @@ import (
 )
 
 func migrate(db *gorm.DB) error {
-	m := gormigrate.New(db, gormigrate.DefaultOptions, []*gormigrate.Migration{
+	m := gormigrate.New(db, gormigrate.DefaultOptions, migrations(db))
+
+	m.InitSchema(func(db *gorm.DB) error {
+		// TODO: can optionally remove this skip after any existing users have migrated.
+		if db.Migrator().HasTable("providers") {
+			return nil
+		}
+		return automigrate(db)
+	})
+
+	if err := m.Migrate(); err != nil {
+		return err
+	}
+
+	// automigrate again, so that for simple things like adding db fields we don't necessarily need to do a migration
+	return automigrate(db)
+}
+
+// migrations are applied in order, and each one is only applied once
+func migrations(db *gorm.DB) []*gormigrate.Migration {
+	return []*gormigrate.Migration{
 		// rename grants.identity -> grants.subject
 		{
 			ID: "202203231621", // date the migration was created
@@ -315,38 +335,54 @@ func migrate(db *gorm.DB) error {
 			// context lost, cannot roll back
 		},
 		// next one here
-	})
+	}
+}
 
-	m.InitSchema(func(db *gorm.DB) error {
-		// TODO: can optionally remove this skip after any existing users have migrated.
-		if db.Migrator().HasTable("providers") {
-			return nil
-		}
-		return automigrate(db)
-	})
+// LatestMigrationID is the ID of the last migration, which the schema of this version of Infra is at
+func LatestMigrationID() string {
+	m := migrations(nil)
+	return m[len(m)-1].ID
+}
 
-	if err := m.Migrate(); err != nil {
-		return err
+// knownMigrationID checks the ID is of a migration this version of Infra has
+func knownMigrationID(id string) bool {
+	for _, m := range migrations(nil) {
+		if m.ID == id {
+			return true
+		}
 	}
 
-	// automigrate again, so that for simple things like adding db fields we don't necessarily need to do a migration
-	return automigrate(db)
+	return false
 }
 
 func automigrate(db *gorm.DB) error {
 	tables := []interface{}{
 		&models.Identity{},
 		&models.Group{},
+		&models.GroupMember{},
+		&models.GroupAncestor{},
 		&models.Grant{},
 		&models.Provider{},
 		&models.Destination{},
+		&models.DestinationTunnel{},
 		&models.AccessKey{},
 		&models.Settings{},
 		&models.EncryptionKey{},
 		&models.TrustedCertificate{},
 		&models.RootCertificate{},
+		&models.ClientCertificate{},
 		&models.Credential{},
 		&models.ProviderUser{},
+		&models.RefreshToken{},
+		&models.DeviceFlowAuthRequest{},
+		&models.ClusterTrust{},
+		&models.KubernetesAuditRecord{},
+		&models.SessionRecording{},
+		&models.AccessRequest{},
+		&models.Review{},
+		&models.ReviewItem{},
+		&models.BreakGlass{},
+		&models.BreakGlassEvent{},
 	}
 
 	for _, table := range tables {
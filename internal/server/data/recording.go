@@ -0,0 +1,22 @@
+package data
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func CreateSessionRecording(db *gorm.DB, recording *models.SessionRecording) error {
+	return add(db, recording)
+}
+
+func GetSessionRecording(db *gorm.DB, selectors ...SelectorFunc) (*models.SessionRecording, error) {
+	return get[models.SessionRecording](db, selectors...)
+}
+
+// ListSessionRecordings returns the matching recordings, the most recent first
+func ListSessionRecordings(db *gorm.DB, selectors ...SelectorFunc) ([]models.SessionRecording, error) {
+	return list[models.SessionRecording](db, append(selectors, func(db *gorm.DB) *gorm.DB {
+		return db.Order("started_at desc")
+	})...)
+}
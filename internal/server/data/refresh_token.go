@@ -0,0 +1,98 @@
+package data
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal/generate"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func ByFamilyID(id uid.ID) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("family_id = ?", id)
+	}
+}
+
+func CreateRefreshToken(db *gorm.DB, token *models.RefreshToken) (body string, err error) {
+	if token.KeyID == "" {
+		key, err := generate.CryptoRandom(models.AccessKeyKeyLength)
+		if err != nil {
+			return "", err
+		}
+
+		token.KeyID = key
+	}
+
+	if token.Secret == "" {
+		secret, err := generate.CryptoRandom(models.AccessKeySecretLength)
+		if err != nil {
+			return "", err
+		}
+
+		token.Secret = secret
+	}
+
+	chksm := sha256.Sum256([]byte(token.Secret))
+	token.SecretChecksum = chksm[:]
+
+	if err := add(db, token); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s.%s", token.KeyID, token.Secret), nil
+}
+
+func SaveRefreshToken(db *gorm.DB, token *models.RefreshToken) error {
+	return save(db, token)
+}
+
+// UseRefreshToken marks the token as used, unless it was used first by another request. It reports whether this
+// call used the token.
+func UseRefreshToken(db *gorm.DB, id uid.ID, usedAt time.Time) (bool, error) {
+	result := db.Model(&models.RefreshToken{}).Where("id = ? and used_at = ?", id, time.Time{}).Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func GetRefreshToken(db *gorm.DB, selectors ...SelectorFunc) (*models.RefreshToken, error) {
+	return get[models.RefreshToken](db, selectors...)
+}
+
+func ListRefreshTokens(db *gorm.DB, selectors ...SelectorFunc) ([]models.RefreshToken, error) {
+	return list[models.RefreshToken](db, selectors...)
+}
+
+func DeleteRefreshTokens(db *gorm.DB, selectors ...SelectorFunc) error {
+	return deleteAll[models.RefreshToken](db, selectors...)
+}
+
+// ValidateRefreshToken looks up a refresh token by its body and verifies the secret.
+// Expiry and reuse are left to the caller, which must also see tokens that were already used.
+func ValidateRefreshToken(db *gorm.DB, body string) (*models.RefreshToken, error) {
+	parts := strings.Split(body, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rejected refresh token format")
+	}
+
+	t, err := GetRefreshToken(db, ByKeyID(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not get refresh token from database, it may not exist", err)
+	}
+
+	sum := sha256.Sum256([]byte(parts[1]))
+	if subtle.ConstantTimeCompare(t.SecretChecksum, sum[:]) != 1 {
+		return nil, fmt.Errorf("refresh token invalid secret")
+	}
+
+	return t, nil
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func ByReviewID(id uid.ID) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("review_id = ?", id)
+	}
+}
+
+func CreateReview(db *gorm.DB, review *models.Review) error {
+	return add(db, review)
+}
+
+func SaveReview(db *gorm.DB, review *models.Review) error {
+	return save(db, review)
+}
+
+// GetReview gets a review, and its reviewers
+func GetReview(db *gorm.DB, selectors ...SelectorFunc) (*models.Review, error) {
+	return get[models.Review](db.Preload("Reviewers"), selectors...)
+}
+
+// ListReviews lists reviews, and their reviewers
+func ListReviews(db *gorm.DB, selectors ...SelectorFunc) ([]models.Review, error) {
+	return list[models.Review](db.Preload("Reviewers"), selectors...)
+}
+
+func CreateReviewItem(db *gorm.DB, item *models.ReviewItem) error {
+	return add(db, item)
+}
+
+func SaveReviewItem(db *gorm.DB, item *models.ReviewItem) error {
+	return save(db, item)
+}
+
+func GetReviewItem(db *gorm.DB, selectors ...SelectorFunc) (*models.ReviewItem, error) {
+	return get[models.ReviewItem](db, selectors...)
+}
+
+func ListReviewItems(db *gorm.DB, selectors ...SelectorFunc) ([]models.ReviewItem, error) {
+	return list[models.ReviewItem](db, selectors...)
+}
@@ -37,6 +37,17 @@ func ByOptionalName(name string) SelectorFunc {
 	}
 }
 
+// ByOptionalGroupMember selects the identities in a group, directly or through the groups that are members of it
+func ByOptionalGroupMember(groupID uid.ID) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		if groupID == 0 {
+			return db
+		}
+
+		return db.Where("id in (select identity_id from identities_groups where group_id = ? or group_id in (select group_id from group_ancestors where ancestor_id = ?))", groupID, groupID)
+	}
+}
+
 func ByName(name string) SelectorFunc {
 	return func(db *gorm.DB) *gorm.DB {
 		return db.Where("name = ?", name)
@@ -134,3 +145,10 @@ func NotName(name string) SelectorFunc {
 		return db.Not("name = ?", name)
 	}
 }
+
+// ByExample matches the fields of example that are set, and ignores the fields with zero values
+func ByExample[T models.Modelable](example T) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(&example)
+	}
+}
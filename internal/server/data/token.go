@@ -18,7 +18,7 @@ var signatureAlgorithmFromKeyAlgorithm = map[string]string{
 	"ED25519": "EdDSA", // elliptic curve 25519
 }
 
-func createJWT(db *gorm.DB, identity *models.Identity, groups []string, expires time.Time) (string, error) {
+func createJWT(db *gorm.DB, identity *models.Identity, groups []string, grants []claims.Grant, expires time.Time) (string, error) {
 	settings, err := GetSettings(db)
 	if err != nil {
 		return "", err
@@ -60,6 +60,7 @@ func createJWT(db *gorm.DB, identity *models.Identity, groups []string, expires
 		Name:   identity.Name,
 		Groups: groups,
 		Nonce:  nonce,
+		Grants: grants,
 	}
 
 	raw, err := jwt.Signed(signer).Claims(claim).Claims(custom).CompactSerialize()
@@ -70,7 +71,8 @@ func createJWT(db *gorm.DB, identity *models.Identity, groups []string, expires
 	return raw, nil
 }
 
-func CreateIdentityToken(db *gorm.DB, identityID uid.ID) (token *models.Token, err error) {
+// CreateIdentityToken issues a token for an identity, with the grants with conditions whose conditions were met
+func CreateIdentityToken(db *gorm.DB, identityID uid.ID, grants []claims.Grant) (token *models.Token, err error) {
 	identity, err := GetIdentity(db, ByID(identityID))
 	if err != nil {
 		return nil, err
@@ -88,7 +90,7 @@ func CreateIdentityToken(db *gorm.DB, identityID uid.ID) (token *models.Token, e
 
 	expires := time.Now().Add(time.Minute * 5).UTC()
 
-	jwt, err := createJWT(db, identity, groups, expires)
+	jwt, err := createJWT(db, identity, groups, grants, expires)
 	if err != nil {
 		return nil, err
 	}
@@ -67,3 +67,17 @@ func ByNotExpired() SelectorFunc {
 		return db.Where("expires_at is null or expires_at > ?", time.Now().UTC())
 	}
 }
+
+func BySerialNumber(serial string) SelectorFunc {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("serial_number = ?", serial)
+	}
+}
+
+func CreateClientCertificate(db *gorm.DB, cert *models.ClientCertificate) error {
+	return add(db, cert)
+}
+
+func GetClientCertificate(db *gorm.DB, selectors ...SelectorFunc) (*models.ClientCertificate, error) {
+	return get[models.ClientCertificate](db, selectors...)
+}
@@ -10,7 +10,7 @@ import (
 )
 
 func (a *API) pprofHandler(c *gin.Context) {
-	if _, err := access.RequireInfraRole(c, models.InfraAdminRole); err != nil {
+	if _, err := access.RequirePermission(c, models.PermissionDebugRead, access.ResourceInfraAPI); err != nil {
 		a.sendAPIError(c, err)
 		return
 	}
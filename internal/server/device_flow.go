@@ -0,0 +1,245 @@
+package server
+
+import (
+	"crypto/subtle"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/generate"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+//go:embed pages
+var pages embed.FS
+
+var devicePage = template.Must(template.ParseFS(pages, "pages/device.html"))
+
+// devicePageURL is the address of a device login page, under the configured public URL rather than the request's
+// Host header, which the client controls
+func (a *API) devicePageURL(path string) (string, error) {
+	if a.server.options.PublicURL == "" {
+		return "", fmt.Errorf("%w: device login requires the server's public URL to be configured", internal.ErrBadRequest)
+	}
+
+	return strings.TrimSuffix(a.server.options.PublicURL, "/") + path, nil
+}
+
+// deviceRedirectURL is where the identity provider sends the user after they log in to approve a device
+func (a *API) deviceRedirectURL() (string, error) {
+	return a.devicePageURL("/device/callback")
+}
+
+func renderDevicePage(c *gin.Context, status int, vals map[string]string) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+
+	if err := devicePage.Execute(c.Writer, vals); err != nil {
+		logging.S.Debugf("render device page: %v", err)
+	}
+}
+
+// deviceVerificationHandler asks the user for the code shown on their device, then shows them the details of the
+// device's request to confirm
+func (a *API) deviceVerificationHandler(c *gin.Context) {
+	userCode := c.Query("user_code")
+	if userCode == "" {
+		renderDevicePage(c, http.StatusOK, nil)
+		return
+	}
+
+	req, ok := getDeviceFlowAuthRequest(c, userCode)
+	if !ok {
+		return
+	}
+
+	provider, err := access.GetProvider(c, req.ProviderID)
+	if err != nil {
+		logging.S.Errorf("device verification provider: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return
+	}
+
+	token, err := generate.CryptoRandom(32)
+	if err != nil {
+		logging.S.Errorf("device verification token: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return
+	}
+
+	setDeviceConfirmCookie(c, token, req.ExpiresAt)
+
+	client := req.ClientID
+	if client == "" {
+		client = "none, the session can not be refreshed"
+	}
+
+	renderDevicePage(c, http.StatusOK, map[string]string{
+		"userCode":  req.UserCode,
+		"client":    client,
+		"sourceIP":  req.SourceIP,
+		"userAgent": req.UserAgent,
+		"requested": req.CreatedAt.UTC().Format(time.RFC1123),
+		"provider":  provider.Name,
+		"token":     token,
+	})
+}
+
+// deviceConfirmHandler sends the user to log in with the identity provider the device chose once they confirm the
+// request is from their device, or denies the request
+func (a *API) deviceConfirmHandler(c *gin.Context) {
+	cookie, err := c.Cookie(CookieDeviceConfirmName)
+	token := c.PostForm("token")
+
+	if err != nil || token == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(token)) != 1 {
+		renderDevicePage(c, http.StatusForbidden, map[string]string{"message": "This login request could not be confirmed.", "detail": "Enter the code shown on your device again."})
+		return
+	}
+
+	deleteDeviceConfirmCookie(c)
+
+	req, ok := getDeviceFlowAuthRequest(c, c.PostForm("user_code"))
+	if !ok {
+		return
+	}
+
+	if c.PostForm("action") != "approve" {
+		if err := access.DenyDeviceFlowAuthRequest(c, req); err != nil {
+			logging.S.Errorf("deny device: %v", err)
+			renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+			return
+		}
+
+		renderDevicePage(c, http.StatusOK, map[string]string{"message": "The device login was denied.", "detail": "You may now close this window."})
+
+		return
+	}
+
+	if err := access.ConfirmDeviceFlowAuthRequest(c, req); err != nil {
+		logging.S.Errorf("confirm device: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return
+	}
+
+	provider, err := access.GetProvider(c, req.ProviderID)
+	if err != nil {
+		logging.S.Errorf("device confirmation provider: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return
+	}
+
+	redirectURL, err := a.deviceRedirectURL()
+	if err != nil {
+		logging.S.Errorf("device confirmation redirect: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return
+	}
+
+	oidc, err := a.providerClient(c, provider, redirectURL)
+	if err != nil {
+		logging.S.Errorf("device confirmation provider client: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return
+	}
+
+	authorizeURL, err := oidc.AuthorizeURL(req.State)
+	if err != nil {
+		logging.S.Errorf("device confirmation authorize url: %v", err)
+		renderDevicePage(c, http.StatusBadGateway, map[string]string{"message": fmt.Sprintf("Could not reach %s, please try again.", provider.Name)})
+
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, authorizeURL)
+}
+
+// getDeviceFlowAuthRequest finds the pending request for the user code, or renders the page saying why it can not
+func getDeviceFlowAuthRequest(c *gin.Context, userCode string) (*models.DeviceFlowAuthRequest, bool) {
+	req, err := access.GetDeviceFlowAuthRequest(c, userCode)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			renderDevicePage(c, http.StatusNotFound, map[string]string{"error": "That code is invalid or has expired."})
+			return nil, false
+		}
+
+		logging.S.Errorf("device verification: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return nil, false
+	}
+
+	return req, true
+}
+
+// deviceCallbackHandler completes the login with the identity provider and approves the device
+func (a *API) deviceCallbackHandler(c *gin.Context) {
+	req, err := access.GetDeviceFlowAuthRequestByState(c, c.Query("state"))
+	if err != nil {
+		logging.S.Debugf("device callback: %v", err)
+		renderDevicePage(c, http.StatusNotFound, map[string]string{"message": "This login request is invalid or has expired.", "detail": "Start a new login from your device."})
+
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		if err := access.DenyDeviceFlowAuthRequest(c, req); err != nil {
+			logging.S.Errorf("deny device: %v", err)
+		}
+
+		renderDevicePage(c, http.StatusForbidden, map[string]string{"message": "The device login was denied.", "detail": c.Query("error_description")})
+
+		return
+	}
+
+	provider, err := access.GetProvider(c, req.ProviderID)
+	if err != nil {
+		logging.S.Errorf("device callback provider: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return
+	}
+
+	redirectURL, err := a.deviceRedirectURL()
+	if err != nil {
+		logging.S.Errorf("device callback redirect: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return
+	}
+
+	oidc, err := a.providerClient(c, provider, redirectURL)
+	if err != nil {
+		logging.S.Errorf("device callback provider client: %v", err)
+		renderDevicePage(c, http.StatusInternalServerError, map[string]string{"message": "Something went wrong, please contact your administrator for assistance."})
+
+		return
+	}
+
+	keyExpires, sessionExpires := a.loginExpiry(req.ClientID)
+
+	identity, err := access.ApproveDeviceFlowAuthRequest(c, req, c.Query("code"), provider, oidc, keyExpires, sessionExpires, redirectURL)
+	if err != nil {
+		logging.S.Errorf("approve device: %v", err)
+		renderDevicePage(c, http.StatusUnauthorized, map[string]string{"message": "Could not log in, please try again.", "detail": "If the problem continues, contact your administrator for assistance."})
+
+		return
+	}
+
+	renderDevicePage(c, http.StatusOK, map[string]string{"message": fmt.Sprintf("Your device is logged in as %s.", identity.Name), "detail": "You may now close this window and return to your device."})
+}
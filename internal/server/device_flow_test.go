@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestDeviceConfirmation(t *testing.T) {
+	s := setupServer(t)
+	s.options.PublicURL = "https://infra.example.com/"
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	provider := &models.Provider{Name: "mokta", URL: "example.com", ClientID: "aaa"}
+	err = data.CreateProvider(s.db, provider)
+	assert.NilError(t, err)
+
+	// start starts a device login, as the CLI does
+	start := func(t *testing.T) api.DeviceFlowResponse {
+		body := fmt.Sprintf(`{"providerID": %q, "clientID": "the-client"}`, provider.ID)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/device", strings.NewReader(body))
+		req.Header.Set("User-Agent", "Infra CLI")
+		req.Host = "attacker.example.com"
+		req.RemoteAddr = "192.0.2.10:40000"
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+		var flow api.DeviceFlowResponse
+		err := json.Unmarshal(resp.Body.Bytes(), &flow)
+		assert.NilError(t, err)
+
+		// the user is sent to the configured address, whatever the request's Host header
+		assert.Equal(t, flow.VerificationURI, "https://infra.example.com/device")
+
+		return flow
+	}
+
+	// verify opens the verification page, and returns the confirmation token and its cookie
+	verify := func(t *testing.T, userCode string) (string, *http.Cookie) {
+		req := httptest.NewRequest(http.MethodGet, "/device?user_code="+userCode, nil)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		// the request details are shown before the user logs in
+		page := resp.Body.String()
+		assert.Assert(t, is.Contains(page, "192.0.2.10"))
+		assert.Assert(t, is.Contains(page, "Infra CLI"))
+		assert.Assert(t, is.Contains(page, "the-client"))
+		assert.Assert(t, is.Contains(page, "mokta"))
+
+		var cookie *http.Cookie
+		for _, c := range resp.Result().Cookies() {
+			if c.Name == CookieDeviceConfirmName {
+				cookie = c
+			}
+		}
+
+		assert.Assert(t, cookie != nil)
+		assert.Assert(t, is.Contains(page, fmt.Sprintf(`name="token" value="%s"`, cookie.Value)))
+
+		return cookie.Value, cookie
+	}
+
+	confirm := func(t *testing.T, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/device", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	status := func(t *testing.T, deviceCode string) string {
+		body, err := json.Marshal(api.DeviceFlowStatusRequest{DeviceCode: deviceCode})
+		assert.NilError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/device/status", bytes.NewReader(body))
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+		var result api.DeviceFlowStatusResponse
+		err = json.Unmarshal(resp.Body.Bytes(), &result)
+		assert.NilError(t, err)
+
+		return result.Status
+	}
+
+	t.Run("without the confirmation cookie", func(t *testing.T) {
+		flow := start(t)
+		token, _ := verify(t, flow.UserCode)
+
+		// a form posted from another site does not carry the cookie
+		resp := confirm(t, url.Values{"user_code": {flow.UserCode}, "token": {token}, "action": {"approve"}}, nil)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+
+		assert.Equal(t, status(t, flow.DeviceCode), api.DeviceFlowStatusPending)
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		flow := start(t)
+		token, cookie := verify(t, flow.UserCode)
+
+		resp := confirm(t, url.Values{"user_code": {flow.UserCode}, "token": {token}, "action": {"deny"}}, cookie)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Assert(t, is.Contains(resp.Body.String(), "denied"))
+
+		assert.Equal(t, status(t, flow.DeviceCode), api.DeviceFlowStatusDenied)
+	})
+
+	t.Run("without a public URL", func(t *testing.T) {
+		s.options.PublicURL = ""
+		t.Cleanup(func() { s.options.PublicURL = "https://infra.example.com/" })
+
+		body := fmt.Sprintf(`{"providerID": %q}`, provider.ID)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/device", strings.NewReader(body))
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	})
+}
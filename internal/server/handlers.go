@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"regexp"
@@ -16,6 +18,7 @@ import (
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/server/authn"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/pki"
 	"github.com/infrahq/infra/secrets"
 )
 
@@ -25,7 +28,7 @@ type API struct {
 }
 
 func (a *API) ListIdentities(c *gin.Context, r *api.ListIdentitiesRequest) ([]api.Identity, error) {
-	identities, err := access.ListIdentities(c, r.Name)
+	identities, err := access.ListIdentities(c, r.Name, r.Group)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +71,7 @@ func (a *API) CreateIdentity(c *gin.Context, r *api.CreateIdentityRequest) (*api
 	}
 
 	defaultGrant := &models.Grant{Subject: identity.PolyID(), Privilege: models.InfraUserRole, Resource: access.ResourceInfraAPI}
-	if err := access.CreateGrant(c, defaultGrant); err != nil {
+	if err := access.CreateGrant(c, defaultGrant, a.server.options.OwnerPrivileges); err != nil {
 		return nil, err
 	}
 
@@ -205,6 +208,51 @@ func (a *API) ListGroupGrants(c *gin.Context, r *api.Resource) ([]api.Grant, err
 	return results, nil
 }
 
+func (a *API) ListGroupGroups(c *gin.Context, r *api.Resource) ([]api.Group, error) {
+	groups, err := access.ListGroupGroups(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.Group, len(groups))
+	for i, g := range groups {
+		results[i] = *g.ToAPI()
+	}
+
+	return results, nil
+}
+
+func (a *API) ListGroupMembers(c *gin.Context, r *api.Resource) ([]api.Group, error) {
+	groups, err := access.ListGroupMembers(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.Group, len(groups))
+	for i, g := range groups {
+		results[i] = *g.ToAPI()
+	}
+
+	return results, nil
+}
+
+func (a *API) AddGroupMember(c *gin.Context, r *api.AddGroupMemberRequest) (*api.Group, error) {
+	if err := access.AddGroupMember(c, r.ID, r.Group); err != nil {
+		return nil, err
+	}
+
+	member, err := access.GetGroup(c, r.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	return member.ToAPI(), nil
+}
+
+func (a *API) RemoveGroupMember(c *gin.Context, r *api.RemoveGroupMemberRequest) error {
+	return access.RemoveGroupMember(c, r.ID, r.Member)
+}
+
 // caution: this endpoint is unauthenticated, do not return sensitive info
 func (a *API) ListProviders(c *gin.Context, r *api.ListProvidersRequest) ([]api.Provider, error) {
 	exclude := []string{models.InternalInfraProviderName}
@@ -291,7 +339,7 @@ func (a *API) DeleteProvider(c *gin.Context, r *api.Resource) error {
 }
 
 func (a *API) ListDestinations(c *gin.Context, r *api.ListDestinationsRequest) ([]api.Destination, error) {
-	destinations, err := access.ListDestinations(c, r.UniqueID, r.Name)
+	destinations, err := access.ListDestinations(c, r.UniqueID, r.Name, r.Selector)
 	if err != nil {
 		return nil, err
 	}
@@ -325,10 +373,12 @@ func (a *API) GetDestination(c *gin.Context, r *api.Resource) (*api.Destination,
 
 func (a *API) CreateDestination(c *gin.Context, r *api.CreateDestinationRequest) (*api.Destination, error) {
 	destination := &models.Destination{
-		Name:          r.Name,
-		UniqueID:      r.UniqueID,
-		ConnectionURL: r.Connection.URL,
-		ConnectionCA:  r.Connection.CA,
+		Name:             r.Name,
+		UniqueID:         r.UniqueID,
+		ConnectionURL:    r.Connection.URL,
+		ConnectionCA:     r.Connection.CA,
+		ConnectionTunnel: r.Connection.Tunnel,
+		Labels:           r.Labels,
 	}
 
 	err := access.CreateDestination(c, destination)
@@ -344,10 +394,12 @@ func (a *API) UpdateDestination(c *gin.Context, r *api.UpdateDestinationRequest)
 		Model: models.Model{
 			ID: r.ID,
 		},
-		Name:          r.Name,
-		UniqueID:      r.UniqueID,
-		ConnectionURL: r.Connection.URL,
-		ConnectionCA:  r.Connection.CA,
+		Name:             r.Name,
+		UniqueID:         r.UniqueID,
+		ConnectionURL:    r.Connection.URL,
+		ConnectionCA:     r.Connection.CA,
+		ConnectionTunnel: r.Connection.Tunnel,
+		Labels:           r.Labels,
 	}
 
 	if err := access.SaveDestination(c, destination); err != nil {
@@ -361,6 +413,291 @@ func (a *API) DeleteDestination(c *gin.Context, r *api.Resource) error {
 	return access.DeleteDestination(c, r.ID)
 }
 
+// DestinationHeartbeat records the status of a destination, and returns the destination so the connector
+// learns about labels set through the API
+func (a *API) DestinationHeartbeat(c *gin.Context, r *api.DestinationHeartbeatRequest) (*api.Destination, error) {
+	heartbeat := &models.Destination{
+		Version:       r.Version,
+		LastSyncAt:    time.Time(r.LastSync),
+		SyncError:     r.SyncError,
+		RoleBindings:  r.RoleBindings,
+		SkippedGrants: r.SkippedGrants,
+		Labels:        r.Labels,
+	}
+
+	destination, err := access.RecordDestinationHeartbeat(c, r.ID, heartbeat)
+	if err != nil {
+		return nil, err
+	}
+
+	return destination.ToAPI(), nil
+}
+
+// SignDestinationCertificate issues a serving certificate to a connector, so clients trust it with the Infra CAs
+// instead of a CA for each destination
+func (a *API) SignDestinationCertificate(c *gin.Context, r *api.SignDestinationCertificateRequest) (*api.DestinationCertificate, error) {
+	csr, err := parseCertificateRequest(r.CSR)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, pemBytes, err := access.SignDestinationCertificate(c, r.ID, csr, a.server.certificateProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.DestinationCertificate{
+		Certificate: string(pemBytes),
+		CA:          string(pki.ActiveCAsPEM(a.server.certificateProvider)),
+		Expires:     api.Time(cert.NotAfter),
+	}, nil
+}
+
+func parseCertificateRequest(csrPEM string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("%w: csr is not a PEM encoded certificate request", internal.ErrBadRequest)
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+	}
+
+	return csr, nil
+}
+
+// RegisterDestination lets a connector register its cluster by presenting its service account token
+func (a *API) RegisterDestination(c *gin.Context, r *api.RegisterDestinationRequest) (*api.RegisterDestinationResponse, error) {
+	trust, err := access.GetClusterTrustForRegistration(c, r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	username, err := authn.ReviewClusterToken(c.Request.Context(), trust, r.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	destination := &models.Destination{
+		Name:             r.Name,
+		UniqueID:         r.UniqueID,
+		ConnectionURL:    r.Connection.URL,
+		ConnectionCA:     r.Connection.CA,
+		ConnectionTunnel: r.Connection.Tunnel,
+	}
+
+	expires := a.workloadKeyExpiry()
+
+	key, err := access.RegisterDestination(c, trust, username, destination, expires)
+	if err != nil {
+		return nil, err
+	}
+
+	a.t.Event(c, "login", Properties{"method": "cluster-trust"})
+
+	return &api.RegisterDestinationResponse{Destination: *destination.ToAPI(), AccessKey: key, Expires: api.Time(expires)}, nil
+}
+
+func (a *API) ListClusterTrusts(c *gin.Context, r *api.ListClusterTrustsRequest) ([]api.ClusterTrust, error) {
+	trusts, err := access.ListClusterTrusts(c, r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.ClusterTrust, len(trusts))
+	for i, t := range trusts {
+		results[i] = *t.ToAPI()
+	}
+
+	return results, nil
+}
+
+func (a *API) CreateClusterTrust(c *gin.Context, r *api.CreateClusterTrustRequest) (*api.ClusterTrust, error) {
+	trust := &models.ClusterTrust{
+		Name:           r.Name,
+		Server:         r.Server,
+		CA:             r.CA,
+		ReviewerToken:  models.EncryptedAtRest(r.ReviewerToken),
+		Issuer:         r.Issuer,
+		Audience:       r.Audience,
+		ServiceAccount: r.ServiceAccount,
+	}
+
+	if err := access.CreateClusterTrust(c, trust); err != nil {
+		return nil, fmt.Errorf("create cluster trust: %w", err)
+	}
+
+	return trust.ToAPI(), nil
+}
+
+func (a *API) DeleteClusterTrust(c *gin.Context, r *api.Resource) error {
+	return access.DeleteClusterTrust(c, r.ID)
+}
+
+func (a *API) ListBreakGlass(c *gin.Context, r *api.ListBreakGlassRequest) ([]api.BreakGlass, error) {
+	accounts, err := access.ListBreakGlass(c, r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.BreakGlass, len(accounts))
+	for i, b := range accounts {
+		results[i] = *b.ToAPI()
+	}
+
+	return results, nil
+}
+
+func (a *API) GetBreakGlass(c *gin.Context, r *api.Resource) (*api.BreakGlass, error) {
+	breakGlass, err := access.GetBreakGlass(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return breakGlass.ToAPI(), nil
+}
+
+func (a *API) CreateBreakGlass(c *gin.Context, r *api.CreateBreakGlassRequest) (*api.CreateBreakGlassResponse, error) {
+	// every unlock must alert someone, so there are no break-glass accounts without notifications
+	if !a.server.notifier.configured() {
+		return nil, fmt.Errorf("%w: break-glass accounts require notifications to be configured", internal.ErrBadRequest)
+	}
+
+	breakGlass := &models.BreakGlass{
+		Name:      r.Name,
+		Holders:   r.Holders,
+		Privilege: r.Privilege,
+		Resource:  r.Resource,
+		Duration:  time.Duration(r.Duration),
+	}
+
+	secrets, err := access.CreateBreakGlass(c, breakGlass)
+	if err != nil {
+		return nil, fmt.Errorf("create break-glass account: %w", err)
+	}
+
+	return &api.CreateBreakGlassResponse{BreakGlass: *breakGlass.ToAPI(), Secrets: secrets}, nil
+}
+
+func (a *API) DeleteBreakGlass(c *gin.Context, r *api.Resource) error {
+	return access.DeleteBreakGlass(c, r.ID)
+}
+
+func (a *API) LockBreakGlass(c *gin.Context, r *api.Resource) (*api.BreakGlass, error) {
+	breakGlass, err := access.LockBreakGlass(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return breakGlass.ToAPI(), nil
+}
+
+func (a *API) ListBreakGlassEvents(c *gin.Context, r *api.Resource) ([]api.BreakGlassEvent, error) {
+	events, err := access.ListBreakGlassEvents(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.BreakGlassEvent, len(events))
+	for i, e := range events {
+		results[i] = *e.ToAPI()
+	}
+
+	return results, nil
+}
+
+func (a *API) ListKubernetesAuditRecords(c *gin.Context, r *api.ListKubernetesAuditRecordsRequest) ([]api.KubernetesAuditRecord, error) {
+	filter := models.KubernetesAuditRecord{
+		Destination: r.Destination,
+		Identity:    r.Identity,
+		Namespace:   r.Namespace,
+		Verb:        r.Verb,
+		Resource:    r.Resource,
+	}
+
+	records, err := access.ListKubernetesAuditRecords(c, filter, r.Since, r.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.KubernetesAuditRecord, len(records))
+	for i, record := range records {
+		results[i] = *record.ToAPI()
+	}
+
+	return results, nil
+}
+
+func (a *API) ListSessionRecordings(c *gin.Context, r *api.ListSessionRecordingsRequest) ([]api.SessionRecording, error) {
+	recordings, err := access.ListSessionRecordings(c, r.Destination, r.Identity)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.SessionRecording, len(recordings))
+	for i, recording := range recordings {
+		results[i] = *recording.ToAPI()
+	}
+
+	return results, nil
+}
+
+func (a *API) GetSessionRecording(c *gin.Context, r *api.Resource) (*api.SessionRecording, error) {
+	recording, err := access.GetSessionRecording(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return recording.ToAPI(), nil
+}
+
+func (a *API) CreateSessionRecording(c *gin.Context, r *api.CreateSessionRecordingRequest) (*api.SessionRecording, error) {
+	recording := &models.SessionRecording{
+		Destination: r.Destination,
+		Identity:    r.Identity,
+		Kind:        r.Kind,
+		Namespace:   r.Namespace,
+		Pod:         r.Pod,
+		Container:   r.Container,
+		Command:     r.Command,
+		StartedAt:   time.Time(r.Started),
+		EndedAt:     time.Time(r.Ended),
+	}
+
+	if err := access.CreateSessionRecording(c, recording, a.server.recordings, r.Cast); err != nil {
+		return nil, err
+	}
+
+	return recording.ToAPI(), nil
+}
+
+func (a *API) CreateKubernetesAuditRecords(c *gin.Context, r *api.CreateKubernetesAuditRecordsRequest) (*api.EmptyResponse, error) {
+	records := make([]models.KubernetesAuditRecord, len(r.Records))
+	for i, record := range r.Records {
+		records[i] = models.KubernetesAuditRecord{
+			Time:        time.Time(record.Time),
+			Identity:    record.Identity,
+			Groups:      record.Groups,
+			Verb:        record.Verb,
+			APIGroup:    record.APIGroup,
+			Resource:    record.Resource,
+			Subresource: record.Subresource,
+			Namespace:   record.Namespace,
+			Name:        record.Name,
+			Path:        record.Path,
+			Code:        record.Code,
+			Latency:     time.Duration(record.Latency),
+		}
+	}
+
+	if err := access.CreateKubernetesAuditRecords(c, r.Destination, records); err != nil {
+		return nil, err
+	}
+
+	return &api.EmptyResponse{}, nil
+}
+
 func (a *API) CreateToken(c *gin.Context, r *api.EmptyRequest) (*api.CreateTokenResponse, error) {
 	if access.CurrentIdentity(c) != nil {
 		err := a.UpdateIdentityInfoFromProvider(c)
@@ -379,6 +716,26 @@ func (a *API) CreateToken(c *gin.Context, r *api.EmptyRequest) (*api.CreateToken
 	return nil, fmt.Errorf("no identity found in access key: %w", internal.ErrUnauthorized)
 }
 
+// CreateClientCertificate issues a client certificate to the calling identity, which it can authenticate with
+// instead of its access key
+func (a *API) CreateClientCertificate(c *gin.Context, r *api.CreateClientCertificateRequest) (*api.ClientCertificate, error) {
+	csr, err := parseCertificateRequest(r.CSR)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, pemBytes, err := access.CreateClientCertificate(c, csr, a.server.certificateProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.ClientCertificate{
+		Certificate: string(pemBytes),
+		CA:          string(pki.ActiveCAsPEM(a.server.certificateProvider)),
+		Expires:     api.Time(cert.NotAfter),
+	}, nil
+}
+
 func (a *API) ListAccessKeys(c *gin.Context, r *api.ListAccessKeysRequest) ([]api.AccessKey, error) {
 	accessKeys, err := access.ListAccessKeys(c, r.IdentityID, r.Name)
 	if err != nil {
@@ -431,6 +788,187 @@ func (a *API) CreateAccessKey(c *gin.Context, r *api.CreateAccessKeyRequest) (*a
 	}, nil
 }
 
+func (a *API) ListAccessRequests(c *gin.Context, r *api.ListAccessRequestsRequest) ([]api.AccessRequest, error) {
+	requests, err := access.ListAccessRequests(c, r.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.AccessRequest, len(requests))
+	for i, r := range requests {
+		results[i] = *r.ToAPI()
+	}
+
+	return results, nil
+}
+
+func (a *API) GetAccessRequest(c *gin.Context, r *api.Resource) (*api.AccessRequest, error) {
+	request, err := access.GetAccessRequest(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return request.ToAPI(), nil
+}
+
+func (a *API) CreateAccessRequest(c *gin.Context, r *api.CreateAccessRequestRequest) (*api.AccessRequest, error) {
+	request := &models.AccessRequest{
+		Privilege: r.Privilege,
+		Resource:  r.Resource,
+		Reason:    r.Reason,
+	}
+
+	if err := access.CreateAccessRequest(c, request); err != nil {
+		return nil, err
+	}
+
+	return request.ToAPI(), nil
+}
+
+// UpdateAccessRequest approves or denies an access request
+func (a *API) UpdateAccessRequest(c *gin.Context, r *api.UpdateAccessRequestRequest) (*api.AccessRequest, error) {
+	request, err := access.DecideAccessRequest(c, r.ID, r.Status, a.server.options.OwnerPrivileges)
+	if err != nil {
+		return nil, err
+	}
+
+	return request.ToAPI(), nil
+}
+
+func (a *API) ListReviews(c *gin.Context, r *api.ListReviewsRequest) ([]api.Review, error) {
+	reviews, err := access.ListReviews(c, r.Name, r.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.Review, len(reviews))
+	for i, r := range reviews {
+		results[i] = *r.ToAPI()
+	}
+
+	return results, nil
+}
+
+func (a *API) GetReview(c *gin.Context, r *api.Resource) (*api.Review, error) {
+	review, err := access.GetReview(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return review.ToAPI(), nil
+}
+
+func (a *API) CreateReview(c *gin.Context, r *api.CreateReviewRequest) (*api.Review, error) {
+	review := &models.Review{
+		Name:        r.Name,
+		Resource:    r.Resource,
+		Privilege:   r.Privilege,
+		SubjectKind: r.SubjectKind,
+	}
+
+	if err := access.CreateReview(c, review, r.Reviewers); err != nil {
+		return nil, err
+	}
+
+	return review.ToAPI(), nil
+}
+
+// UpdateReview closes a review
+func (a *API) UpdateReview(c *gin.Context, r *api.UpdateReviewRequest) (*api.Review, error) {
+	review, err := access.CloseReview(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return review.ToAPI(), nil
+}
+
+func (a *API) ListReviewItems(c *gin.Context, r *api.Resource) ([]api.ReviewItem, error) {
+	items, err := access.ListReviewItems(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]api.ReviewItem, len(items))
+	for i, item := range items {
+		results[i] = *item.ToAPI()
+	}
+
+	return results, nil
+}
+
+// UpdateReviewItem records a decision to keep or revoke a grant in a review
+func (a *API) UpdateReviewItem(c *gin.Context, r *api.UpdateReviewItemRequest) (*api.ReviewItem, error) {
+	item, err := access.DecideReviewItem(c, r.ReviewID, r.ID, r.Decision, r.Comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ToAPI(), nil
+}
+
+// ListPermissions lists the permissions on the Infra API, and the permissions each Infra role grants
+func (a *API) ListPermissions(c *gin.Context, r *api.EmptyRequest) (*api.PermissionMatrix, error) {
+	return models.PermissionMatrix(), nil
+}
+
+// CheckAuthz explains whether a subject has a privilege on a resource
+func (a *API) CheckAuthz(c *gin.Context, r *api.AuthzCheckRequest) (*api.AuthzDecision, error) {
+	decision, err := access.CheckAccess(c, r.Subject, r.Privilege, r.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.AuthzDecision{
+		Subject:   r.Subject,
+		Privilege: r.Privilege,
+		Resource:  r.Resource,
+		Allowed:   decision.Allowed,
+		Reason:    decision.Reason,
+		Grants:    appliedGrantsToAPI(decision.Grants),
+		Denials:   appliedGrantsToAPI(decision.Denials),
+		Related:   appliedGrantsToAPI(decision.Related),
+	}, nil
+}
+
+// GetEffectiveAccess lists every grant that applies to a subject
+func (a *API) GetEffectiveAccess(c *gin.Context, r *api.AuthzEffectiveRequest) (*api.EffectiveAccess, error) {
+	effective, err := access.GetEffectiveAccess(c, r.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &api.EffectiveAccess{
+		Subject:     r.Subject,
+		Grants:      appliedGrantsToAPI(effective.Grants),
+		Permissions: make([]string, len(effective.Permissions)),
+	}
+
+	for i, p := range effective.Permissions {
+		result.Permissions[i] = string(p)
+	}
+
+	return result, nil
+}
+
+func appliedGrantsToAPI(grants []access.AppliedGrant) []api.AppliedGrant {
+	if grants == nil {
+		return nil
+	}
+
+	results := make([]api.AppliedGrant, len(grants))
+	for i, g := range grants {
+		results[i] = api.AppliedGrant{Grant: *g.Grant.ToAPI(), Skipped: g.Skipped, DeniedBy: g.DeniedBy}
+
+		if g.Group != nil {
+			results[i].Group = g.Group.ID
+			results[i].GroupName = g.Group.Name
+		}
+	}
+
+	return results
+}
+
 func (a *API) ListGrants(c *gin.Context, r *api.ListGrantsRequest) ([]api.Grant, error) {
 	grants, err := access.ListGrants(c, r.Subject, r.Resource, r.Privilege)
 	if err != nil {
@@ -459,9 +997,14 @@ func (a *API) CreateGrant(c *gin.Context, r *api.CreateGrantRequest) (*api.Grant
 		Resource:  r.Resource,
 		Privilege: r.Privilege,
 		Subject:   r.Subject,
+		Deny:      r.Deny,
 	}
 
-	err := access.CreateGrant(c, grant)
+	if r.Conditions != nil {
+		grant.Conditions = models.GrantConditions(*r.Conditions)
+	}
+
+	err := access.CreateGrant(c, grant, a.server.options.OwnerPrivileges)
 	if err != nil {
 		return nil, err
 	}
@@ -470,7 +1013,7 @@ func (a *API) CreateGrant(c *gin.Context, r *api.CreateGrantRequest) (*api.Grant
 }
 
 func (a *API) DeleteGrant(c *gin.Context, r *api.Resource) error {
-	return access.DeleteGrant(c, r.ID)
+	return access.DeleteGrant(c, r.ID, a.server.options.OwnerPrivileges)
 }
 
 func (a *API) SetupRequired(c *gin.Context, _ *api.EmptyRequest) (*api.SetupRequiredResponse, error) {
@@ -501,32 +1044,70 @@ func (a *API) Setup(c *gin.Context, _ *api.EmptyRequest) (*api.CreateAccessKeyRe
 	}, nil
 }
 
+// loginExpiry returns when the access key and the session of a new login expire
+func (a *API) loginExpiry(clientID string) (keyExpires, sessionExpires time.Time) {
+	sessionExpires = time.Now().Add(a.server.options.SessionDuration)
+
+	// refreshable sessions get a short-lived access key, the refresh token lasts for the whole session
+	if clientID != "" && a.server.options.AccessKeyDuration > 0 {
+		if short := time.Now().Add(a.server.options.AccessKeyDuration); short.Before(sessionExpires) {
+			return short, sessionExpires
+		}
+	}
+
+	return sessionExpires, sessionExpires
+}
+
+// workloadKeyExpiry is when access keys expire for workloads that prove their identity with a token from
+// another issuer, and log in again with a fresh token instead of refreshing
+func (a *API) workloadKeyExpiry() time.Time {
+	if a.server.options.AccessKeyDuration > 0 {
+		return time.Now().Add(a.server.options.AccessKeyDuration)
+	}
+
+	return time.Now().Add(a.server.options.SessionDuration)
+}
+
 func (a *API) Login(c *gin.Context, r *api.LoginRequest) (*api.LoginResponse, error) {
-	expires := time.Now().Add(a.server.options.SessionDuration)
+	keyExpires, expires := a.loginExpiry(r.ClientID)
 
 	switch {
+	case r.RefreshToken != "":
+		key, refreshToken, identity, err := access.RefreshAccessKey(c, r.RefreshToken, r.ClientID, keyExpires)
+		if err != nil {
+			return nil, err
+		}
+
+		a.t.Event(c, "login", Properties{"method": "refresh"})
+
+		return &api.LoginResponse{PolymorphicID: identity.PolyID(), Name: identity.Name, AccessKey: key, RefreshToken: refreshToken, Expires: api.Time(keyExpires)}, nil
 	case r.AccessKey != "":
-		key, identity, err := access.ExchangeAccessKey(c, r.AccessKey, expires)
+		key, identity, sessionExpires, err := access.ExchangeAccessKey(c, r.AccessKey, keyExpires)
 		if err != nil {
 			return nil, err
 		}
 
-		setAuthCookie(c, key, expires)
+		// refreshing can not extend the session past the key that was exchanged
+		if sessionExpires.Before(expires) {
+			expires = sessionExpires
+		}
+
+		setAuthCookie(c, key, keyExpires)
 
 		a.t.Event(c, "login", Properties{"method": "exchange"})
 
-		return &api.LoginResponse{PolymorphicID: identity.PolyID(), Name: identity.Name, AccessKey: key, Expires: api.Time(expires)}, nil
+		return a.refreshableLogin(c, r, &api.LoginResponse{PolymorphicID: identity.PolyID(), Name: identity.Name, AccessKey: key, Expires: api.Time(keyExpires)}, expires)
 	case r.PasswordCredentials != nil:
-		key, user, requiresUpdate, err := access.LoginWithUserCredential(c, r.PasswordCredentials.Email, r.PasswordCredentials.Password, expires)
+		key, user, requiresUpdate, err := access.LoginWithUserCredential(c, r.PasswordCredentials.Email, r.PasswordCredentials.Password, keyExpires)
 		if err != nil {
 			return nil, fmt.Errorf("%w: %v", internal.ErrUnauthorized, err.Error())
 		}
 
-		setAuthCookie(c, key, expires)
+		setAuthCookie(c, key, keyExpires)
 
 		a.t.Event(c, "login", Properties{"method": "credentials"})
 
-		return &api.LoginResponse{PolymorphicID: user.PolyID(), Name: user.Name, AccessKey: key, Expires: api.Time(expires), PasswordUpdateRequired: requiresUpdate}, nil
+		return a.refreshableLogin(c, r, &api.LoginResponse{PolymorphicID: user.PolyID(), Name: user.Name, AccessKey: key, Expires: api.Time(keyExpires), PasswordUpdateRequired: requiresUpdate}, expires)
 	case r.OIDC != nil:
 		provider, err := access.GetProvider(c, r.OIDC.ProviderID)
 		if err != nil {
@@ -538,21 +1119,124 @@ func (a *API) Login(c *gin.Context, r *api.LoginRequest) (*api.LoginResponse, er
 			return nil, err
 		}
 
-		user, key, err := access.ExchangeAuthCodeForAccessKey(c, r.OIDC.Code, provider, oidc, expires, r.OIDC.RedirectURL)
+		user, key, err := access.ExchangeAuthCodeForAccessKey(c, r.OIDC.Code, provider, oidc, keyExpires, r.OIDC.RedirectURL)
 		if err != nil {
 			return nil, err
 		}
 
-		setAuthCookie(c, key, expires)
+		setAuthCookie(c, key, keyExpires)
 
 		a.t.Event(c, "login", Properties{"method": "oidc"})
 
-		return &api.LoginResponse{PolymorphicID: user.PolyID(), Name: user.Name, AccessKey: key, Expires: api.Time(expires)}, nil
+		return a.refreshableLogin(c, r, &api.LoginResponse{PolymorphicID: user.PolyID(), Name: user.Name, AccessKey: key, Expires: api.Time(keyExpires)}, expires)
+	case r.Federation != nil:
+		if a.server.federation == nil {
+			return nil, fmt.Errorf("%w: no trusted issuers are configured", internal.ErrUnauthorized)
+		}
+
+		federated, err := a.server.federation.Authenticate(c.Request.Context(), r.Federation.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		// workloads log in again with a fresh token instead of refreshing, and the access key never outlives the token
+		keyExpires = a.workloadKeyExpiry()
+
+		if !federated.Expiry.IsZero() && federated.Expiry.Before(keyExpires) {
+			keyExpires = federated.Expiry
+		}
+
+		key, machine, err := access.LoginWithFederatedIdentity(c, federated, keyExpires)
+		if err != nil {
+			return nil, err
+		}
+
+		a.t.Event(c, "login", Properties{"method": "federation"})
+
+		return &api.LoginResponse{PolymorphicID: machine.PolyID(), Name: machine.Name, AccessKey: key, Expires: api.Time(keyExpires)}, nil
+	case r.BreakGlass != nil:
+		// the session ends when the account is locked, so it is never refreshable
+		key, identity, expires, err := access.UnlockBreakGlass(c, r.BreakGlass.Name, r.BreakGlass.Secrets)
+		if err != nil {
+			return nil, err
+		}
+
+		setAuthCookie(c, key, expires)
+
+		a.t.Event(c, "login", Properties{"method": "break-glass"})
+
+		return &api.LoginResponse{PolymorphicID: identity.PolyID(), Name: identity.Name, AccessKey: key, Expires: api.Time(expires)}, nil
 	}
 
 	return nil, api.ErrBadRequest
 }
 
+// refreshableLogin adds a refresh token to the login response when the client asked for a refreshable session
+func (a *API) refreshableLogin(c *gin.Context, r *api.LoginRequest, resp *api.LoginResponse, sessionExpires time.Time) (*api.LoginResponse, error) {
+	if r.ClientID == "" {
+		return resp, nil
+	}
+
+	refreshToken, err := access.CreateRefreshToken(c, resp.AccessKey, r.ClientID, sessionExpires)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.RefreshToken = refreshToken
+
+	return resp, nil
+}
+
+func (a *API) StartDeviceFlow(c *gin.Context, r *api.StartDeviceFlowRequest) (*api.DeviceFlowResponse, error) {
+	verificationURI, err := a.devicePageURL("/device")
+	if err != nil {
+		return nil, err
+	}
+
+	req, deviceCode, err := access.CreateDeviceFlowAuthRequest(c, r.ProviderID, r.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.DeviceFlowResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                req.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: fmt.Sprintf("%s?user_code=%s", verificationURI, req.UserCode),
+		ExpiresIn:               int64(time.Until(req.ExpiresAt).Seconds()),
+		Interval:                int64(access.DeviceFlowPollInterval.Seconds()),
+	}, nil
+}
+
+func (a *API) GetDeviceFlowStatus(c *gin.Context, r *api.DeviceFlowStatusRequest) (*api.DeviceFlowStatusResponse, error) {
+	req, identity, err := access.PollDeviceFlowAuthRequest(c, r.DeviceCode)
+	switch {
+	case errors.Is(err, access.ErrDeviceFlowPending):
+		return &api.DeviceFlowStatusResponse{Status: api.DeviceFlowStatusPending}, nil
+	case errors.Is(err, access.ErrDeviceFlowSlowDown):
+		return &api.DeviceFlowStatusResponse{Status: api.DeviceFlowStatusSlowDown}, nil
+	case errors.Is(err, access.ErrDeviceFlowDenied):
+		return &api.DeviceFlowStatusResponse{Status: api.DeviceFlowStatusDenied}, nil
+	case errors.Is(err, access.ErrDeviceFlowExpired):
+		return &api.DeviceFlowStatusResponse{Status: api.DeviceFlowStatusExpired}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	a.t.Event(c, "login", Properties{"method": "device"})
+
+	return &api.DeviceFlowStatusResponse{
+		Status: api.DeviceFlowStatusApproved,
+		Login: &api.LoginResponse{
+			PolymorphicID: identity.PolyID(),
+			Name:          identity.Name,
+			AccessKey:     string(req.AccessKey),
+			RefreshToken:  string(req.RefreshToken),
+			Expires:       api.Time(req.AccessKeyExpires),
+		},
+	}, nil
+}
+
 func (a *API) Logout(c *gin.Context, r *api.EmptyRequest) (*api.EmptyResponse, error) {
 	err := access.DeleteRequestAccessKey(c)
 	if err != nil {
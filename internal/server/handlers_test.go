@@ -1,19 +1,39 @@
 package server
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/yamux"
 	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
 	"gotest.tools/v3/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/pki"
+	"github.com/infrahq/infra/secrets"
+	"github.com/infrahq/infra/uid"
 )
 
 func TestListProviders(t *testing.T) {
@@ -200,3 +220,1344 @@ func TestDeleteIdentity_NoDeleteSelf(t *testing.T) {
 
 	assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
 }
+
+func TestLoginRefreshableSession(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	s.options = Options{AdminAccessKey: adminAccessKey, SessionDuration: time.Hour, AccessKeyDuration: time.Minute}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	login := func(t *testing.T, loginReq api.LoginRequest) (*httptest.ResponseRecorder, *api.LoginResponse) {
+		body, err := json.Marshal(loginReq)
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/login", bytes.NewReader(body))
+		assert.NilError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		loginResp := &api.LoginResponse{}
+		if resp.Code == http.StatusCreated {
+			err = json.Unmarshal(resp.Body.Bytes(), loginResp)
+			assert.NilError(t, err)
+		}
+
+		return resp, loginResp
+	}
+
+	resp, first := login(t, api.LoginRequest{AccessKey: adminAccessKey, ClientID: "the-client"})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	assert.Assert(t, first.RefreshToken != "")
+	assert.Assert(t, time.Time(first.Expires).Before(time.Now().Add(2*time.Minute)))
+
+	resp, refreshed := login(t, api.LoginRequest{RefreshToken: first.RefreshToken, ClientID: "the-client"})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	assert.Assert(t, refreshed.AccessKey != first.AccessKey)
+	assert.Assert(t, refreshed.RefreshToken != first.RefreshToken)
+
+	// reusing the first refresh token revokes the session
+	resp, _ = login(t, api.LoginRequest{RefreshToken: first.RefreshToken, ClientID: "the-client"})
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, resp.Body.String())
+
+	resp, _ = login(t, api.LoginRequest{RefreshToken: refreshed.RefreshToken, ClientID: "the-client"})
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, resp.Body.String())
+
+	// a refresh token requires a client ID
+	resp, _ = login(t, api.LoginRequest{RefreshToken: refreshed.RefreshToken})
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+
+	t.Run("exchanged keys do not outlive their session", func(t *testing.T) {
+		admin, err := data.GetIdentity(s.db, data.ByName("admin"))
+		assert.NilError(t, err)
+
+		expires := time.Now().Add(10 * time.Minute)
+		session := &models.AccessKey{IssuedFor: admin.ID, ProviderID: data.InfraProvider(s.db).ID, ExpiresAt: expires, FamilyID: uid.New()}
+		key, err := data.CreateAccessKey(s.db, session)
+		assert.NilError(t, err)
+
+		resp, exchanged := login(t, api.LoginRequest{AccessKey: key, ClientID: "the-client"})
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		exchangedKey, err := data.ValidateAccessKey(s.db, exchanged.AccessKey)
+		assert.NilError(t, err)
+		assert.Equal(t, exchangedKey.FamilyID, session.FamilyID)
+
+		refreshToken, err := data.ValidateRefreshToken(s.db, exchanged.RefreshToken)
+		assert.NilError(t, err)
+		assert.Equal(t, refreshToken.FamilyID, session.FamilyID)
+		assert.Assert(t, !refreshToken.ExpiresAt.After(expires))
+	})
+}
+
+func TestLoginFederation(t *testing.T) {
+	s := setupServer(t)
+	s.options = Options{SessionDuration: time.Hour, AccessKeyDuration: time.Minute}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: key.Public(), KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"}}}
+
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(issuer.Close)
+
+	s.federation = loadFederation([]TrustedIssuer{
+		{
+			Issuer:   issuer.URL,
+			JWKSURL:  issuer.URL + "/keys",
+			Audience: "infra",
+			Rules:    []FederationRule{{Claims: map[string]string{"sub": "system:serviceaccount:infra:*"}, Machine: "connector"}},
+		},
+	})
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	login := func(t *testing.T, sub string) *httptest.ResponseRecorder {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+		assert.NilError(t, err)
+
+		token, err := jwt.Signed(signer).Claims(jwt.Claims{
+			Issuer:   issuer.URL,
+			Subject:  sub,
+			Audience: jwt.Audience{"infra"},
+			Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}).CompactSerialize()
+		assert.NilError(t, err)
+
+		body, err := json.Marshal(api.LoginRequest{Federation: &api.LoginRequestFederation{Token: token}})
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/login", bytes.NewReader(body))
+		assert.NilError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	resp := login(t, "system:serviceaccount:infra:connector")
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	loginResp := &api.LoginResponse{}
+	err = json.Unmarshal(resp.Body.Bytes(), loginResp)
+	assert.NilError(t, err)
+	assert.Equal(t, loginResp.Name, "connector")
+	assert.Equal(t, loginResp.RefreshToken, "")
+	assert.Assert(t, time.Time(loginResp.Expires).Before(time.Now().Add(2*time.Minute)))
+
+	machine, err := data.GetIdentity(s.db, data.ByName("connector"))
+	assert.NilError(t, err)
+	assert.Equal(t, machine.Kind, models.MachineKind)
+
+	resp = login(t, "system:serviceaccount:default:default")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, resp.Body.String())
+}
+
+func TestRegisterDestination(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+	s.options = Options{AdminAccessKey: adminAccessKey, AccessKey: connectorAccessKey, SessionDuration: time.Hour, AccessKeyDuration: time.Minute}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	// a fake Kubernetes API server that reviews service account tokens
+	cluster := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/authentication.k8s.io/v1/tokenreviews" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		review := &authenticationv1.TokenReview{}
+		if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch review.Spec.Token {
+		case "connector-token":
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "system:serviceaccount:infra:infra-connector"}}
+		case "default-token":
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "system:serviceaccount:default:default"}}
+		default:
+			review.Status = authenticationv1.TokenReviewStatus{Error: "invalid token"}
+		}
+
+		review.APIVersion = "authentication.k8s.io/v1"
+		review.Kind = "TokenReview"
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(review)
+	}))
+	t.Cleanup(cluster.Close)
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cluster.Certificate().Raw})
+
+	connection := api.DestinationConnection{URL: "10.0.0.1:443", CA: "ca"}
+
+	request := func(t *testing.T, method, path, key string, body interface{}) *httptest.ResponseRecorder {
+		raw, err := json.Marshal(body)
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(method, path, bytes.NewReader(raw))
+		assert.NilError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	resp := request(t, http.MethodPost, "/v1/cluster-trusts", adminAccessKey, api.CreateClusterTrustRequest{
+		Name:           "kubernetes.trusted",
+		Server:         cluster.URL,
+		CA:             string(ca),
+		ServiceAccount: "infra:infra-connector",
+	})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	register := func(t *testing.T, uniqueID, token string) *httptest.ResponseRecorder {
+		return request(t, http.MethodPost, "/v1/destinations/register", "", api.RegisterDestinationRequest{
+			Name:       "kubernetes.trusted",
+			UniqueID:   uniqueID,
+			Connection: connection,
+			Token:      token,
+		})
+	}
+
+	resp = register(t, "trusted-cluster", "connector-token")
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	registered := &api.RegisterDestinationResponse{}
+	err = json.Unmarshal(resp.Body.Bytes(), registered)
+	assert.NilError(t, err)
+	assert.Equal(t, registered.Destination.UniqueID, "trusted-cluster")
+	assert.Assert(t, time.Time(registered.Expires).Before(time.Now().Add(2*time.Minute)))
+
+	t.Run("registered connector can update its destination", func(t *testing.T) {
+		path := fmt.Sprintf("/v1/destinations/%s", registered.Destination.ID)
+
+		resp := request(t, http.MethodPut, path, registered.AccessKey, api.UpdateDestinationRequest{Name: "kubernetes.trusted", UniqueID: "trusted-cluster", Connection: api.DestinationConnection{URL: "10.0.0.2:443", CA: "ca"}})
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		resp = request(t, http.MethodPut, path, registered.AccessKey, api.UpdateDestinationRequest{Name: "kubernetes.other", UniqueID: "trusted-cluster", Connection: connection})
+		assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
+
+		resp = request(t, http.MethodPost, "/v1/destinations", registered.AccessKey, api.CreateDestinationRequest{Name: "kubernetes.other", UniqueID: "other-cluster", Connection: connection})
+		assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
+	})
+
+	t.Run("unique ID is bound", func(t *testing.T) {
+		resp := register(t, "impostor-cluster", "connector-token")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, resp.Body.String())
+	})
+
+	t.Run("untrusted service account", func(t *testing.T) {
+		resp := register(t, "trusted-cluster", "default-token")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, resp.Body.String())
+
+		resp = register(t, "trusted-cluster", "invalid-token")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, resp.Body.String())
+	})
+
+	t.Run("shared connector key can not overwrite a trusted destination", func(t *testing.T) {
+		path := fmt.Sprintf("/v1/destinations/%s", registered.Destination.ID)
+
+		resp := request(t, http.MethodPut, path, connectorAccessKey, api.UpdateDestinationRequest{Name: "kubernetes.trusted", UniqueID: "trusted-cluster", Connection: connection})
+		assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
+
+		resp = request(t, http.MethodPost, "/v1/destinations", connectorAccessKey, api.CreateDestinationRequest{Name: "kubernetes.trusted", UniqueID: "impostor-cluster", Connection: connection})
+		assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
+
+		resp = request(t, http.MethodPost, "/v1/destinations", connectorAccessKey, api.CreateDestinationRequest{Name: "kubernetes.untrusted", UniqueID: "untrusted-cluster", Connection: connection})
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	})
+}
+
+func TestDestinationHeartbeat(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+	s.options = Options{AdminAccessKey: adminAccessKey, AccessKey: connectorAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, method, path string, body interface{}) *httptest.ResponseRecorder {
+		raw, err := json.Marshal(body)
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(method, path, bytes.NewReader(raw))
+		assert.NilError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+connectorAccessKey)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	getDestination := func(t *testing.T, id string) *api.Destination {
+		resp := request(t, http.MethodGet, "/v1/destinations/"+id, nil)
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		destination := &api.Destination{}
+		err := json.Unmarshal(resp.Body.Bytes(), destination)
+		assert.NilError(t, err)
+
+		return destination
+	}
+
+	resp := request(t, http.MethodPost, "/v1/destinations", api.CreateDestinationRequest{
+		Name:       "kubernetes.heartbeat",
+		UniqueID:   "heartbeat-cluster",
+		Connection: api.DestinationConnection{URL: "10.0.0.1:443", CA: "ca"},
+	})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	created := &api.Destination{}
+	err = json.Unmarshal(resp.Body.Bytes(), created)
+	assert.NilError(t, err)
+	assert.Equal(t, created.Status, api.DestinationStatusPending)
+
+	id := created.ID.String()
+	lastSync := time.Now().Add(-time.Second).UTC().Truncate(time.Second)
+
+	resp = request(t, http.MethodPost, "/v1/destinations/"+id+"/heartbeat", &api.DestinationHeartbeatRequest{
+		Version:      "0.1.0",
+		LastSync:     api.Time(lastSync),
+		RoleBindings: 3,
+	})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	destination := getDestination(t, id)
+	assert.Equal(t, destination.Status, api.DestinationStatusConnected)
+	assert.Equal(t, destination.Version, "0.1.0")
+	assert.Equal(t, destination.RoleBindings, 3)
+	assert.Assert(t, time.Time(destination.LastSync).Equal(lastSync))
+	assert.Assert(t, !time.Time(destination.LastSeen).IsZero())
+
+	t.Run("skipped grants", func(t *testing.T) {
+		skipped := []api.SkippedGrant{
+			{Grant: uid.New(), Resource: "kubernetes.heartbeat.web", Privilege: "deployer", Reason: `no role "deployer" exists in namespace "web", and no cluster role by that name`},
+		}
+
+		resp := request(t, http.MethodPost, "/v1/destinations/"+id+"/heartbeat", &api.DestinationHeartbeatRequest{
+			Version:       "0.1.0",
+			LastSync:      api.Time(lastSync),
+			RoleBindings:  3,
+			SkippedGrants: skipped,
+		})
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		destination := getDestination(t, id)
+		assert.DeepEqual(t, destination.SkippedGrants, skipped)
+
+		// the grants skipped are replaced with each heartbeat
+		resp = request(t, http.MethodPost, "/v1/destinations/"+id+"/heartbeat", &api.DestinationHeartbeatRequest{
+			Version:      "0.1.0",
+			LastSync:     api.Time(lastSync),
+			RoleBindings: 3,
+		})
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		destination = getDestination(t, id)
+		assert.Equal(t, len(destination.SkippedGrants), 0)
+	})
+
+	t.Run("sync error", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/v1/destinations/"+id+"/heartbeat", &api.DestinationHeartbeatRequest{
+			Version:   "0.1.0",
+			SyncError: "forbidden",
+		})
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		destination := getDestination(t, id)
+		assert.Equal(t, destination.Status, api.DestinationStatusError)
+		assert.Equal(t, destination.SyncError, "forbidden")
+		// a heartbeat without a sync keeps the last successful sync
+		assert.Assert(t, time.Time(destination.LastSync).Equal(lastSync))
+	})
+
+	t.Run("update keeps heartbeat", func(t *testing.T) {
+		resp := request(t, http.MethodPut, "/v1/destinations/"+id, api.UpdateDestinationRequest{
+			Name:       "kubernetes.heartbeat",
+			UniqueID:   "heartbeat-cluster",
+			Connection: api.DestinationConnection{URL: "10.0.0.2:443", CA: "ca"},
+		})
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		destination := getDestination(t, id)
+		assert.Equal(t, destination.Version, "0.1.0")
+		assert.Assert(t, !time.Time(destination.LastSeen).IsZero())
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		stored, err := data.GetDestination(s.db, data.ByID(created.ID))
+		assert.NilError(t, err)
+
+		stored.LastSeenAt = time.Now().Add(-2 * models.DestinationStaleTimeout)
+		err = data.SaveDestination(s.db, stored)
+		assert.NilError(t, err)
+
+		destination := getDestination(t, id)
+		assert.Equal(t, destination.Status, api.DestinationStatusStale)
+	})
+}
+
+func TestDestinationLabels(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+	s.options = Options{AdminAccessKey: adminAccessKey, AccessKey: connectorAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, method, path, accessKey string, body interface{}) *httptest.ResponseRecorder {
+		raw, err := json.Marshal(body)
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(method, path, bytes.NewReader(raw))
+		assert.NilError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+accessKey)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	listDestinations := func(t *testing.T, selector string) []string {
+		resp := request(t, http.MethodGet, "/v1/destinations?selector="+url.QueryEscape(selector), adminAccessKey, nil)
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		var destinations []api.Destination
+		err := json.Unmarshal(resp.Body.Bytes(), &destinations)
+		assert.NilError(t, err)
+
+		var names []string
+		for _, d := range destinations {
+			names = append(names, d.Name)
+		}
+
+		return names
+	}
+
+	connection := api.DestinationConnection{URL: "10.0.0.1:443", CA: "ca"}
+
+	created := map[string]*api.Destination{}
+
+	for name, labels := range map[string]map[string]string{
+		"kubernetes.production": {"env": "production", "topology.kubernetes.io/region": "us-east-1"},
+		"kubernetes.staging":    {"env": "staging", "topology.kubernetes.io/region": "us-east-1"},
+		"kubernetes.eu":         {"env": "production", "topology.kubernetes.io/region": "eu-west-1"},
+	} {
+		resp := request(t, http.MethodPost, "/v1/destinations", connectorAccessKey, api.CreateDestinationRequest{Name: name, UniqueID: name, Connection: connection, Labels: labels})
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		destination := &api.Destination{}
+		err := json.Unmarshal(resp.Body.Bytes(), destination)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, destination.Labels, labels)
+
+		created[name] = destination
+	}
+
+	t.Run("selector", func(t *testing.T) {
+		assert.DeepEqual(t, listDestinations(t, "env=production"), []string{"kubernetes.eu", "kubernetes.production"})
+		assert.DeepEqual(t, listDestinations(t, "env=production,topology.kubernetes.io/region!=us-east-1"), []string{"kubernetes.eu"})
+		assert.DeepEqual(t, listDestinations(t, "!env"), []string(nil))
+		assert.Equal(t, len(listDestinations(t, "")), 3)
+
+		resp := request(t, http.MethodGet, "/v1/destinations?selector="+url.QueryEscape("env=production,"), adminAccessKey, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+	})
+
+	t.Run("invalid labels", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/v1/destinations", connectorAccessKey, api.CreateDestinationRequest{
+			Name: "kubernetes.invalid", UniqueID: "invalid", Connection: connection, Labels: map[string]string{"team": "a,b"},
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+	})
+
+	staging := created["kubernetes.staging"]
+	path := "/v1/destinations/" + staging.ID.String()
+
+	t.Run("update replaces labels", func(t *testing.T) {
+		resp := request(t, http.MethodPut, path, adminAccessKey, api.UpdateDestinationRequest{
+			Name: staging.Name, UniqueID: staging.UniqueID, Connection: connection, Labels: map[string]string{"env": "staging", "owner": "platform"},
+		})
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.DeepEqual(t, listDestinations(t, "owner=platform"), []string{"kubernetes.staging"})
+		assert.DeepEqual(t, listDestinations(t, "topology.kubernetes.io/region=us-east-1"), []string{"kubernetes.production"})
+	})
+
+	t.Run("update without labels keeps them", func(t *testing.T) {
+		resp := request(t, http.MethodPut, path, connectorAccessKey, api.UpdateDestinationRequest{
+			Name: staging.Name, UniqueID: staging.UniqueID, Connection: api.DestinationConnection{URL: "10.0.0.2:443", CA: "ca"},
+		})
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.DeepEqual(t, listDestinations(t, "owner=platform"), []string{"kubernetes.staging"})
+	})
+
+	t.Run("heartbeat sets connector labels", func(t *testing.T) {
+		resp := request(t, http.MethodPost, path+"/heartbeat", connectorAccessKey, &api.DestinationHeartbeatRequest{
+			Version: "0.1.0",
+			Labels:  map[string]string{"env": "staging", "topology.kubernetes.io/region": "us-west-2"},
+		})
+		assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		// the connector learns about the labels set through the API
+		destination := &api.Destination{}
+		err := json.Unmarshal(resp.Body.Bytes(), destination)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, destination.Labels, map[string]string{"env": "staging", "owner": "platform", "topology.kubernetes.io/region": "us-west-2"})
+	})
+}
+
+func TestKubernetesAuditRecords(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+	s.options = Options{AdminAccessKey: adminAccessKey, AccessKey: connectorAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, method, path, key string, body interface{}) *httptest.ResponseRecorder {
+		raw, err := json.Marshal(body)
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(method, path, bytes.NewReader(raw))
+		assert.NilError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	resp := request(t, http.MethodPost, "/v1/destinations", connectorAccessKey, api.CreateDestinationRequest{
+		Name:       "kubernetes.audited",
+		UniqueID:   "audited-cluster",
+		Connection: api.DestinationConnection{URL: "10.0.0.1:443", CA: "ca"},
+	})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	resp = request(t, http.MethodPost, "/v1/audit/kubernetes", connectorAccessKey, &api.CreateKubernetesAuditRecordsRequest{
+		Destination: "kubernetes.audited",
+		Records: []api.KubernetesAuditRecord{
+			{Time: api.Time(now.Add(-time.Hour)), Destination: "kubernetes.other", Identity: "alice@example.com", Groups: []string{"developers"}, Verb: "list", Resource: "pods", Namespace: "default", Code: 200},
+			{Time: api.Time(now), Identity: "bob@example.com", Verb: "delete", APIGroup: "apps", Resource: "deployments", Namespace: "default", Name: "web", Code: 200, Latency: api.Duration(20 * time.Millisecond)},
+		},
+	})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	list := func(t *testing.T, query string) []api.KubernetesAuditRecord {
+		resp := request(t, http.MethodGet, "/v1/audit/kubernetes"+query, adminAccessKey, nil)
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		var records []api.KubernetesAuditRecord
+		err := json.Unmarshal(resp.Body.Bytes(), &records)
+		assert.NilError(t, err)
+
+		return records
+	}
+
+	t.Run("most recent first", func(t *testing.T) {
+		records := list(t, "")
+		assert.Equal(t, len(records), 2)
+		assert.Equal(t, records[0].Identity, "bob@example.com")
+		assert.Equal(t, records[0].Latency, api.Duration(20*time.Millisecond))
+		assert.DeepEqual(t, records[1].Groups, []string{"developers"})
+
+		// records are attributed to the destination that shipped them
+		assert.Equal(t, records[1].Destination, "kubernetes.audited")
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		records := list(t, "?identity=alice@example.com")
+		assert.Equal(t, len(records), 1)
+		assert.Equal(t, records[0].Verb, "list")
+
+		records = list(t, "?verb=delete&destination=kubernetes.audited")
+		assert.Equal(t, len(records), 1)
+		assert.Equal(t, records[0].Name, "web")
+
+		records = list(t, "?since="+now.Add(-time.Minute).Format(time.RFC3339))
+		assert.Equal(t, len(records), 1)
+		assert.Equal(t, records[0].Identity, "bob@example.com")
+
+		records = list(t, "?limit=1")
+		assert.Equal(t, len(records), 1)
+	})
+
+	t.Run("only admins can list", func(t *testing.T) {
+		resp := request(t, http.MethodGet, "/v1/audit/kubernetes", connectorAccessKey, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
+	})
+
+	t.Run("unknown destination", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/v1/audit/kubernetes", connectorAccessKey, &api.CreateKubernetesAuditRecordsRequest{
+			Destination: "kubernetes.unknown",
+			Records:     []api.KubernetesAuditRecord{{Time: api.Time(now), Identity: "alice@example.com", Verb: "get"}},
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+	})
+}
+
+func TestSessionRecordings(t *testing.T) {
+	s := setupServer(t)
+	s.recordings = secrets.NewFileSecretProviderFromConfig(secrets.FileConfig{Path: t.TempDir()})
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+	s.options = Options{AdminAccessKey: adminAccessKey, AccessKey: connectorAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	auditor := &models.Identity{Name: "auditor@example.com", Kind: models.UserKind}
+	err = data.CreateIdentity(s.db, auditor)
+	assert.NilError(t, err)
+
+	err = data.CreateGrant(s.db, &models.Grant{Subject: auditor.PolyID(), Privilege: models.InfraAuditRole, Resource: access.ResourceInfraAPI})
+	assert.NilError(t, err)
+
+	auditorAccessKey, err := data.CreateAccessKey(s.db, &models.AccessKey{Name: "auditor", IssuedFor: auditor.ID, ExpiresAt: time.Now().Add(time.Hour), ProviderID: s.InternalProvider.ID})
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, method, path, key string, body interface{}) *httptest.ResponseRecorder {
+		raw, err := json.Marshal(body)
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(method, path, bytes.NewReader(raw))
+		assert.NilError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	resp := request(t, http.MethodPost, "/v1/destinations", connectorAccessKey, api.CreateDestinationRequest{
+		Name:       "kubernetes.recorded",
+		UniqueID:   "recorded-cluster",
+		Connection: api.DestinationConnection{URL: "10.0.0.1:443", CA: "ca"},
+	})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	cast := []byte(`{"version":2,"width":80,"height":24}` + "\n" + `[0.5,"o","hello\r\n"]` + "\n")
+	started := time.Now().UTC().Truncate(time.Second)
+
+	resp = request(t, http.MethodPost, "/v1/recordings", connectorAccessKey, &api.CreateSessionRecordingRequest{
+		Destination: "kubernetes.recorded",
+		Identity:    "alice@example.com",
+		Kind:        api.SessionRecordingExec,
+		Namespace:   "default",
+		Pod:         "web",
+		Command:     "sh",
+		Started:     api.Time(started),
+		Ended:       api.Time(started.Add(time.Minute)),
+		Cast:        cast,
+	})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	created := api.SessionRecording{}
+	err = json.Unmarshal(resp.Body.Bytes(), &created)
+	assert.NilError(t, err)
+	assert.Equal(t, created.Size, len(cast))
+
+	t.Run("list", func(t *testing.T) {
+		resp := request(t, http.MethodGet, "/v1/recordings?identity=alice@example.com", auditorAccessKey, nil)
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		var recordings []api.SessionRecording
+		err := json.Unmarshal(resp.Body.Bytes(), &recordings)
+		assert.NilError(t, err)
+		assert.Equal(t, len(recordings), 1)
+		assert.Equal(t, recordings[0].ID, created.ID)
+		assert.Equal(t, recordings[0].Pod, "web")
+		assert.Equal(t, recordings[0].Destination, "kubernetes.recorded")
+
+		resp = request(t, http.MethodGet, "/v1/recordings?identity=bob@example.com", adminAccessKey, nil)
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.Equal(t, resp.Body.String(), "[]")
+	})
+
+	t.Run("download", func(t *testing.T) {
+		resp := request(t, http.MethodGet, fmt.Sprintf("/v1/recordings/%s/cast", created.ID), auditorAccessKey, nil)
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("Content-Type"), "application/x-asciicast")
+		assert.DeepEqual(t, resp.Body.Bytes(), cast)
+	})
+
+	t.Run("connectors can not read recordings", func(t *testing.T) {
+		resp := request(t, http.MethodGet, "/v1/recordings", connectorAccessKey, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
+
+		resp = request(t, http.MethodGet, fmt.Sprintf("/v1/recordings/%s/cast", created.ID), connectorAccessKey, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
+	})
+
+	t.Run("unknown destination", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/v1/recordings", connectorAccessKey, &api.CreateSessionRecordingRequest{
+			Destination: "kubernetes.unknown",
+			Identity:    "alice@example.com",
+			Kind:        api.SessionRecordingExec,
+			Cast:        cast,
+		})
+		assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+	})
+}
+
+func TestCreateGrantResourcePattern(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	s.options = Options{AdminAccessKey: adminAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	createGrant := func(t *testing.T, resource string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(api.CreateGrantRequest{Subject: "i:1234", Privilege: "view", Resource: resource})
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/grants", bytes.NewReader(body))
+		assert.NilError(t, err)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	resp := createGrant(t, "kubernetes[env=staging].*.team-a-*")
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+	resp = createGrant(t, "kubernetes[env=staging.*")
+	assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	assert.Assert(t, strings.Contains(resp.Body.String(), "unclosed bracket"))
+}
+
+func TestListPermissions(t *testing.T) {
+	s := setupServer(t)
+
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+	s.options = Options{AccessKey: connectorAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/permissions", nil)
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer "+connectorAccessKey)
+
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+	var matrix api.PermissionMatrix
+	err = json.Unmarshal(resp.Body.Bytes(), &matrix)
+	assert.NilError(t, err)
+	assert.Equal(t, len(matrix.Permissions), len(models.Permissions))
+
+	roles := map[string][]string{}
+	for _, role := range matrix.Roles {
+		roles[role.Name] = role.Permissions
+	}
+
+	assert.Equal(t, len(roles[models.InfraAdminRole]), len(models.Permissions))
+	assert.DeepEqual(t, roles[models.InfraUserRole], []string{"destinations:read"})
+	assert.DeepEqual(t, roles[models.InfraAuditRole], []string{"audit:read", "break-glass:read", "recordings:read"})
+}
+
+func TestAccessRequests(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	s.options = Options{AdminAccessKey: adminAccessKey, OwnerPrivileges: []string{"view", "admin"}}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	identity := func(t *testing.T, name string) (*models.Identity, string) {
+		identity := &models.Identity{Name: name, Kind: models.UserKind}
+		err := data.CreateIdentity(s.db, identity)
+		assert.NilError(t, err)
+
+		key, err := data.CreateAccessKey(s.db, &models.AccessKey{IssuedFor: identity.ID, ExpiresAt: time.Now().Add(time.Hour), ProviderID: s.InternalProvider.ID})
+		assert.NilError(t, err)
+
+		return identity, key
+	}
+
+	owner, ownerAccessKey := identity(t, "owner@example.com")
+	_, devAccessKey := identity(t, "dev@example.com")
+
+	request := func(t *testing.T, method, path, key string, body interface{}) *httptest.ResponseRecorder {
+		raw, err := json.Marshal(body)
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(method, path, bytes.NewReader(raw))
+		assert.NilError(t, err)
+		req.Header.Set("Authorization", "Bearer "+key)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	resp := request(t, http.MethodPost, "/v1/grants", adminAccessKey, api.CreateGrantRequest{Subject: owner.PolyID(), Privilege: models.InfraOwnerRole, Resource: "kubernetes.staging"})
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+	decide := func(t *testing.T, privilege string) *httptest.ResponseRecorder {
+		resp := request(t, http.MethodPost, "/v1/access-requests", devAccessKey, api.CreateAccessRequestRequest{Privilege: privilege, Resource: "kubernetes.staging.web"})
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+		var created api.AccessRequest
+		err := json.Unmarshal(resp.Body.Bytes(), &created)
+		assert.NilError(t, err)
+
+		return request(t, http.MethodPut, "/v1/access-requests/"+created.ID.String(), ownerAccessKey, map[string]string{"status": models.AccessRequestApproved})
+	}
+
+	// the server only lets owners grant the configured privileges
+	resp = decide(t, "edit")
+	assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+
+	resp = decide(t, "admin")
+	assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+	var approved api.AccessRequest
+	err = json.Unmarshal(resp.Body.Bytes(), &approved)
+	assert.NilError(t, err)
+	assert.Equal(t, approved.Status, models.AccessRequestApproved)
+	assert.Assert(t, approved.Grant != 0)
+}
+
+func TestCheckAuthz(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	s.options = Options{AdminAccessKey: adminAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	srv := httptest.NewServer(routes)
+	t.Cleanup(srv.Close)
+
+	client := api.Client{URL: srv.URL, AccessKey: adminAccessKey}
+
+	dev := &models.Identity{Name: "dev@example.com", Kind: models.UserKind}
+	err = data.CreateIdentity(s.db, dev)
+	assert.NilError(t, err)
+
+	_, err = client.CreateGrant(&api.CreateGrantRequest{Subject: dev.PolyID(), Privilege: "view", Resource: "kubernetes.*"})
+	assert.NilError(t, err)
+
+	decision, err := client.CheckAuthz(api.AuthzCheckRequest{Subject: dev.PolyID(), Privilege: "view", Resource: "kubernetes.production.web"})
+	assert.NilError(t, err)
+	assert.Assert(t, decision.Allowed)
+	assert.Equal(t, len(decision.Grants), 1)
+	assert.Equal(t, decision.Grants[0].Grant.Resource, "kubernetes.*")
+
+	decision, err = client.CheckAuthz(api.AuthzCheckRequest{Subject: dev.PolyID(), Privilege: "edit", Resource: "kubernetes.production"})
+	assert.NilError(t, err)
+	assert.Assert(t, !decision.Allowed)
+	assert.Equal(t, decision.Reason, "no grant of edit applies to kubernetes.production")
+	assert.Equal(t, len(decision.Related), 1)
+
+	effective, err := client.GetEffectiveAccess(api.AuthzEffectiveRequest{Subject: dev.PolyID()})
+	assert.NilError(t, err)
+	assert.Equal(t, len(effective.Grants), 1)
+	assert.DeepEqual(t, effective.Permissions, []string{})
+}
+
+func TestExportReview(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	s.options = Options{AdminAccessKey: adminAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	srv := httptest.NewServer(routes)
+	t.Cleanup(srv.Close)
+
+	client := api.Client{URL: srv.URL, AccessKey: adminAccessKey}
+
+	reviewer := &models.Identity{Name: "manager@example.com", Kind: models.UserKind}
+	err = data.CreateIdentity(s.db, reviewer)
+	assert.NilError(t, err)
+
+	reviewerKey, err := data.CreateAccessKey(s.db, &models.AccessKey{IssuedFor: reviewer.ID, ExpiresAt: time.Now().Add(time.Hour), ProviderID: s.InternalProvider.ID})
+	assert.NilError(t, err)
+
+	dev := &models.Identity{Name: "dev@example.com", Kind: models.UserKind}
+	err = data.CreateIdentity(s.db, dev)
+	assert.NilError(t, err)
+
+	_, err = client.CreateGrant(&api.CreateGrantRequest{Subject: dev.PolyID(), Privilege: "edit", Resource: "kubernetes.production.web"})
+	assert.NilError(t, err)
+
+	review, err := client.CreateReview(&api.CreateReviewRequest{Name: "2022-q3", Resource: "kubernetes.production", Reviewers: []uid.ID{reviewer.ID}})
+	assert.NilError(t, err)
+
+	items, err := client.ListReviewItems(review.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(items), 1)
+
+	reviewerClient := api.Client{URL: srv.URL, AccessKey: reviewerKey}
+
+	_, err = reviewerClient.UpdateReviewItem(api.UpdateReviewItemRequest{ReviewID: review.ID, ID: items[0].ID, Decision: "revoke", Comment: "left the team"})
+	assert.NilError(t, err)
+
+	_, err = client.UpdateReview(api.UpdateReviewRequest{ID: review.ID, Status: "closed"})
+	assert.NilError(t, err)
+
+	grants, err := client.ListGrants(api.ListGrantsRequest{Subject: dev.PolyID()})
+	assert.NilError(t, err)
+	assert.Equal(t, len(grants), 0)
+
+	evidence, err := client.ExportReview(review.ID, "csv")
+	assert.NilError(t, err)
+
+	rows, err := csv.NewReader(bytes.NewReader(evidence)).ReadAll()
+	assert.NilError(t, err)
+	assert.Equal(t, len(rows), 2)
+	assert.DeepEqual(t, rows[1][:10], []string{"2022-q3", "closed", items[0].Grant.String(), dev.PolyID().String(), "dev@example.com", "edit", "kubernetes.production.web", "revoke", "left the team", "manager@example.com"})
+	assert.Assert(t, rows[1][11] != "")
+
+	evidence, err = client.ExportReview(review.ID, "json")
+	assert.NilError(t, err)
+
+	var exported api.ReviewEvidence
+	err = json.Unmarshal(evidence, &exported)
+	assert.NilError(t, err)
+	assert.Equal(t, exported.Review.Status, "closed")
+	assert.Equal(t, exported.Items[0].Decision, "revoke")
+
+	_, err = client.ExportReview(review.ID, "xml")
+	assert.ErrorContains(t, err, "unknown format")
+}
+
+func TestBreakGlassLogin(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	s.options = Options{AdminAccessKey: adminAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, method, path, key string, body interface{}) *httptest.ResponseRecorder {
+		raw, err := json.Marshal(body)
+		assert.NilError(t, err)
+
+		req, err := http.NewRequest(method, path, bytes.NewReader(raw))
+		assert.NilError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	createReq := api.CreateBreakGlassRequest{Name: "emergency", Holders: []string{"alice@example.com", "bob@example.com"}}
+
+	// every unlock must be notified, so there are no break-glass accounts without notifications
+	resp := request(t, http.MethodPost, "/v1/break-glass", adminAccessKey, createReq)
+	assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+
+	notified := make(chan notificationBody, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body notificationBody
+		assert.Check(t, json.NewDecoder(r.Body).Decode(&body))
+		notified <- body
+	}))
+	t.Cleanup(webhook.Close)
+
+	s.notifier = newWebhookNotifier([]Notification{{URL: webhook.URL}})
+
+	// notifications are sent by the leader once the requests are committed
+	sent := func(t *testing.T) []string {
+		err := s.notifier.sendPending(s.db)
+		assert.NilError(t, err)
+
+		var kinds []string
+		for len(notified) > 0 {
+			kinds = append(kinds, (<-notified).Event.Kind)
+		}
+
+		return kinds
+	}
+
+	resp = request(t, http.MethodPost, "/v1/break-glass", adminAccessKey, createReq)
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+	var created api.CreateBreakGlassResponse
+	err = json.Unmarshal(resp.Body.Bytes(), &created)
+	assert.NilError(t, err)
+	assert.Equal(t, len(created.Secrets), 2)
+
+	login := func(secrets []string) *httptest.ResponseRecorder {
+		return request(t, http.MethodPost, "/v1/login", "", api.LoginRequest{BreakGlass: &api.LoginRequestBreakGlass{Name: "emergency", Secrets: secrets}})
+	}
+
+	resp = login([]string{created.Secrets[0], "wrong"})
+	assert.Equal(t, resp.Code, http.StatusUnauthorized, resp.Body.String())
+	assert.DeepEqual(t, sent(t), []string{models.BreakGlassUnlockFailed})
+
+	resp = login(created.Secrets)
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+	assert.DeepEqual(t, sent(t), []string{models.BreakGlassUnlocked})
+
+	var loggedIn api.LoginResponse
+	err = json.Unmarshal(resp.Body.Bytes(), &loggedIn)
+	assert.NilError(t, err)
+	assert.Equal(t, loggedIn.Name, "emergency")
+	assert.Equal(t, loggedIn.RefreshToken, "")
+
+	// the account is an Infra admin until it is locked, and its first request is notified
+	for i := 0; i < 2; i++ {
+		resp = request(t, http.MethodGet, "/v1/identities", loggedIn.AccessKey, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+	}
+
+	assert.DeepEqual(t, sent(t), []string{models.BreakGlassUsed})
+
+	resp = request(t, http.MethodPost, "/v1/break-glass/"+created.BreakGlass.ID.String()+"/lock", adminAccessKey, &api.Resource{ID: created.BreakGlass.ID})
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+	assert.DeepEqual(t, sent(t), []string{models.BreakGlassLocked})
+
+	resp = request(t, http.MethodGet, "/v1/identities", loggedIn.AccessKey, nil)
+	assert.Equal(t, resp.Code, http.StatusUnauthorized, resp.Body.String())
+
+	resp = request(t, http.MethodGet, "/v1/break-glass/"+created.BreakGlass.ID.String()+"/events", adminAccessKey, nil)
+	assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+	var events []api.BreakGlassEvent
+	err = json.Unmarshal(resp.Body.Bytes(), &events)
+	assert.NilError(t, err)
+
+	kinds := make([]string, len(events))
+	for i, event := range events {
+		kinds[i] = event.Kind
+	}
+
+	assert.DeepEqual(t, kinds, []string{models.BreakGlassLocked, models.BreakGlassUsed, models.BreakGlassUsed, models.BreakGlassUnlocked, models.BreakGlassUnlockFailed})
+}
+
+func TestDestinationTunnel(t *testing.T) {
+	s := setupServer(t)
+
+	adminAccessKey := "BlgpvURSGF.NdcemBdzxLTGIcjPXwPoZNrb"
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+	s.options = Options{AdminAccessKey: adminAccessKey, AccessKey: connectorAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	// replicas sign the client address of the requests they forward with a key derived from the settings
+	_, err = data.InitializeSettings(s.db, false)
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	srv := httptest.NewServer(routes)
+	t.Cleanup(srv.Close)
+
+	client := api.Client{URL: srv.URL, AccessKey: connectorAccessKey}
+
+	direct, err := client.CreateDestination(&api.CreateDestinationRequest{Name: "kubernetes.public", UniqueID: "public", Connection: api.DestinationConnection{URL: "10.0.0.1:443", CA: "ca"}})
+	assert.NilError(t, err)
+
+	destination, err := client.CreateDestination(&api.CreateDestinationRequest{Name: "kubernetes.private", UniqueID: "private", Connection: api.DestinationConnection{Tunnel: true}})
+	assert.NilError(t, err)
+	assert.Assert(t, destination.Connection.Tunnel)
+
+	s.options.ReplicaURL = srv.URL
+
+	// another server replica, sharing the database, forwards requests to the replica the tunnel is connected to
+	replica := &Server{db: s.db, leader: newLeaderElection(s.db), notifier: newWebhookNotifier(nil), options: Options{ReplicaURL: "http://replica.example.com", TrustedProxies: []string{"127.0.0.1"}}}
+
+	replicaRoutes, err := replica.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	replicaSrv := httptest.NewServer(replicaRoutes)
+	t.Cleanup(replicaSrv.Close)
+
+	proxyTo := func(t *testing.T, server, path string, header http.Header) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/destinations/%s/proxy%s", server, destination.ID, path), nil)
+		assert.NilError(t, err)
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NilError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+
+	proxy := func(t *testing.T, path string, header http.Header) *http.Response {
+		return proxyTo(t, srv.URL, path, header)
+	}
+
+	t.Run("destination without a tunnel", func(t *testing.T) {
+		_, err := client.OpenDestinationTunnel(direct.ID)
+		assert.ErrorContains(t, err, "not reached through a tunnel")
+	})
+
+	t.Run("user can not open a tunnel", func(t *testing.T) {
+		user := &models.Identity{Name: "user@example.com", Kind: models.UserKind}
+		err := data.CreateIdentity(s.db, user)
+		assert.NilError(t, err)
+
+		accessKey, err := data.CreateAccessKey(s.db, &models.AccessKey{Name: "user", IssuedFor: user.ID, ExpiresAt: time.Now().Add(time.Hour), ProviderID: s.InternalProvider.ID})
+		assert.NilError(t, err)
+
+		_, err = api.Client{URL: srv.URL, AccessKey: accessKey}.OpenDestinationTunnel(destination.ID)
+		assert.ErrorIs(t, err, api.ErrForbidden)
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		resp := proxy(t, "/api", nil)
+		assert.Equal(t, resp.StatusCode, http.StatusBadGateway)
+	})
+
+	conn, err := client.OpenDestinationTunnel(destination.ID)
+	assert.NilError(t, err)
+
+	session, err := yamux.Server(conn, tunnelConfig())
+	assert.NilError(t, err)
+	t.Cleanup(func() { session.Close() })
+
+	connector := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s %s", r.URL.Path, r.URL.RawQuery, r.Header.Get(api.DestinationTunnelClientHeader))
+		}),
+	}
+
+	go func() {
+		_ = connector.Serve(session)
+	}()
+
+	t.Run("proxied through the tunnel", func(t *testing.T) {
+		resp := proxy(t, "/api/v1/namespaces/default/pods?watch=true", nil)
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+		body, err := io.ReadAll(resp.Body)
+		assert.NilError(t, err)
+		assert.Equal(t, string(body), "/api/v1/namespaces/default/pods watch=true 127.0.0.1")
+	})
+
+	t.Run("forwarded by another replica", func(t *testing.T) {
+		// the replica is behind a proxy it trusts, and passes on the client address it sees
+		resp := proxyTo(t, replicaSrv.URL, "/api/v1/namespaces", http.Header{"X-Forwarded-For": {"203.0.113.7"}})
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+		body, err := io.ReadAll(resp.Body)
+		assert.NilError(t, err)
+		assert.Equal(t, string(body), "/api/v1/namespaces  203.0.113.7")
+	})
+
+	t.Run("forwarded header not from a replica", func(t *testing.T) {
+		resp := proxy(t, "/api/v1/namespaces", http.Header{tunnelForwardedHeader: {"203.0.113.7 forged"}, "X-Forwarded-For": {"203.0.113.8"}})
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+		body, err := io.ReadAll(resp.Body)
+		assert.NilError(t, err)
+		assert.Equal(t, string(body), "/api/v1/namespaces  127.0.0.1")
+	})
+
+	t.Run("tunnel closed", func(t *testing.T) {
+		session.Close()
+
+		for deadline := time.Now().Add(5 * time.Second); s.tunnels.get(destination.ID) != nil; {
+			assert.Assert(t, time.Now().Before(deadline), "tunnel is still registered")
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		resp := proxy(t, "/api", nil)
+		assert.Equal(t, resp.StatusCode, http.StatusBadGateway)
+
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			tunnels, err := data.ListDestinationTunnels(s.db, data.ByDestinationID(destination.ID))
+			assert.NilError(t, err)
+
+			if len(tunnels) == 0 {
+				break
+			}
+
+			assert.Assert(t, time.Now().Before(deadline), "tunnel is still recorded")
+		}
+
+		resp = proxyTo(t, replicaSrv.URL, "/api", nil)
+		assert.Equal(t, resp.StatusCode, http.StatusBadGateway)
+	})
+}
+
+func TestSignDestinationCertificate(t *testing.T) {
+	s := setupServer(t)
+
+	connectorAccessKey := "aQ2CxSmgWF.WnjJrYWcvBWzbt6ffCPmUl4h"
+	s.options = Options{AccessKey: connectorAccessKey}
+
+	err := s.importAccessKeys()
+	assert.NilError(t, err)
+
+	s.certificateProvider, err = pki.NewNativeCertificateProvider(s.db, pki.NativeCertificateProviderConfig{FullKeyRotationDurationInDays: 365})
+	assert.NilError(t, err)
+
+	err = s.certificateProvider.CreateCA()
+	assert.NilError(t, err)
+
+	routes, err := s.GenerateRoutes(prometheus.NewRegistry())
+	assert.NilError(t, err)
+
+	srv := httptest.NewServer(routes)
+	t.Cleanup(srv.Close)
+
+	client := api.Client{URL: srv.URL, AccessKey: connectorAccessKey}
+
+	destination, err := client.CreateDestination(&api.CreateDestinationRequest{Name: "kubernetes.production", UniqueID: "production", Connection: api.DestinationConnection{URL: "10.0.0.1:443"}})
+	assert.NilError(t, err)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, commonName string, ip string) *api.SignDestinationCertificateRequest {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:     pkix.Name{CommonName: commonName},
+			IPAddresses: []net.IP{net.ParseIP(ip)},
+		}, key)
+		assert.NilError(t, err)
+
+		return &api.SignDestinationCertificateRequest{
+			ID:  destination.ID,
+			CSR: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		}
+	}
+
+	t.Run("signed for the destination endpoint", func(t *testing.T) {
+		res, err := client.SignDestinationCertificate(request(t, "Connector kubernetes.production", "10.0.0.1"))
+		assert.NilError(t, err)
+
+		block, _ := pem.Decode([]byte(res.Certificate))
+		assert.Assert(t, block != nil)
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		assert.NilError(t, err)
+		assert.Equal(t, res.Expires, api.Time(cert.NotAfter))
+
+		pool := x509.NewCertPool()
+		assert.Assert(t, pool.AppendCertsFromPEM([]byte(res.CA)))
+
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: "10.0.0.1", Roots: pool})
+		assert.NilError(t, err)
+	})
+
+	t.Run("other host", func(t *testing.T) {
+		_, err := client.SignDestinationCertificate(request(t, "Connector kubernetes.production", "10.0.0.2"))
+		assert.ErrorContains(t, err, "is not reached at")
+	})
+
+	t.Run("other destination", func(t *testing.T) {
+		_, err := client.SignDestinationCertificate(request(t, "Connector kubernetes.staging", "10.0.0.1"))
+		assert.ErrorContains(t, err, "invalid certificate common name")
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		_, err := client.SignDestinationCertificate(&api.SignDestinationCertificateRequest{ID: destination.ID, CSR: "not a request"})
+		assert.ErrorIs(t, err, api.ErrBadRequest)
+	})
+
+	t.Run("host of another destination", func(t *testing.T) {
+		_, err := client.CreateDestination(&api.CreateDestinationRequest{Name: "kubernetes.impostor", UniqueID: "impostor", Connection: api.DestinationConnection{URL: "https://10.0.0.1"}})
+		assert.NilError(t, err)
+
+		_, err = client.SignDestinationCertificate(request(t, "Connector kubernetes.production", "10.0.0.1"))
+		assert.ErrorContains(t, err, `"10.0.0.1" is the host of destination "kubernetes.impostor"`)
+	})
+}
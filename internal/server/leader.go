@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/repeat"
+	"github.com/infrahq/infra/internal/server/data"
+)
+
+// leaderLockName is the name of the database lock the leader holds
+const leaderLockName = "leader"
+
+// leaderElection elects one of the servers sharing a database to run background jobs, such as rotating the CAs, so
+// replicas do not race to make the same changes. Every replica serves the API. The leader holds a lock on the
+// database, and another replica takes over when it is released or the leader loses its connection.
+type leaderElection struct {
+	db       *gorm.DB
+	interval time.Duration
+	leading  int32
+	jobs     []leaderJob
+}
+
+// leaderJob runs on the leader at an interval, for as long as it leads
+type leaderJob struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+func newLeaderElection(db *gorm.DB) *leaderElection {
+	return &leaderElection{db: db, interval: 15 * time.Second}
+}
+
+// addJob adds a job the leader runs. Jobs are added before the election runs.
+func (e *leaderElection) addJob(name string, interval time.Duration, run func(ctx context.Context) error) {
+	e.jobs = append(e.jobs, leaderJob{name: name, interval: interval, run: run})
+}
+
+func (e *leaderElection) isLeader() bool {
+	return atomic.LoadInt32(&e.leading) == 1
+}
+
+// run campaigns to be the leader until the context is done
+func (e *leaderElection) run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		lock, err := data.TryLock(ctx, e.db, leaderLockName)
+		switch {
+		case err != nil:
+			logging.S.Warnf("leader election: %s", err)
+		case lock != nil:
+			e.lead(ctx, lock, ticker)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// lead runs the jobs for as long as the leader lock is held
+func (e *leaderElection) lead(ctx context.Context, lock *data.Lock, ticker *time.Ticker) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	atomic.StoreInt32(&e.leading, 1)
+	logging.S.Info("started leading")
+
+	defer func() {
+		atomic.StoreInt32(&e.leading, 0)
+		releaseLock(lock, leaderLockName)
+		logging.S.Info("stopped leading")
+	}()
+
+	e.startJobs(ctx)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := lock.Held(ctx); err != nil {
+			logging.S.Warnf("lost leader lock: %s", err)
+			return
+		}
+	}
+}
+
+func (e *leaderElection) startJobs(ctx context.Context) {
+	for _, job := range e.jobs {
+		job := job
+
+		repeat.Start(ctx, job.interval, func(ctx context.Context) {
+			if err := job.run(ctx); err != nil {
+				logging.S.Errorf("%s: %s", job.name, err)
+			}
+		})
+	}
+}
+
+func (e *leaderElection) registerMetrics(reg prometheus.Registerer) {
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "infra",
+		Subsystem: "server",
+		Name:      "leader",
+		Help:      "Whether this server is the leader, which runs background jobs for the servers sharing its database.",
+	}, func() float64 {
+		if e.isLeader() {
+			return 1
+		}
+
+		return 0
+	})
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+
+	"github.com/infrahq/infra/pki"
+)
+
+func TestLeaderElection(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{
+		DBEncryptionKeyProvider: "native",
+		DBEncryptionKey:         filepath.Join(dir, "sqlite3.db.key"),
+		TLSCache:                filepath.Join(dir, "tlscache"),
+		DBFile:                  filepath.Join(dir, "sqlite3.db"),
+		Addr: ListenerOptions{
+			HTTP:    "127.0.0.1:0",
+			HTTPS:   "127.0.0.1:0",
+			Metrics: "127.0.0.1:0",
+		},
+	}
+
+	// two replicas start at the same time against one database
+	replicas := make([]*Server, 2)
+
+	var wg sync.WaitGroup
+	for i := range replicas {
+		i := i
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			srv, err := New(opts)
+			assert.Check(t, err)
+
+			replicas[i] = srv
+		}()
+	}
+
+	wg.Wait()
+
+	for _, srv := range replicas {
+		assert.Assert(t, srv != nil)
+	}
+
+	first, second := replicas[0], replicas[1]
+
+	// they share the CAs the first one to set up the database created
+	assert.DeepEqual(t, pki.ActiveCAsPEM(first.certificateProvider), pki.ActiveCAsPEM(second.certificateProvider))
+
+	cancels := make([]context.CancelFunc, len(replicas))
+
+	for i, srv := range replicas {
+		srv.leader.interval = 10 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+
+		t.Cleanup(cancel)
+
+		go func(srv *Server) {
+			if err := srv.Run(ctx); err != nil {
+				t.Errorf("server errored: %v", err)
+			}
+		}(srv)
+	}
+
+	leaders := func() []int {
+		var leading []int
+
+		for i, srv := range replicas {
+			if srv.leader.isLeader() {
+				leading = append(leading, i)
+			}
+		}
+
+		return leading
+	}
+
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if len(leaders()) == 1 {
+			return poll.Success()
+		}
+
+		return poll.Continue("leaders: %v", leaders())
+	}, poll.WithTimeout(5*time.Second))
+
+	leader := leaders()[0]
+	follower := 1 - leader
+
+	ready := func(t *testing.T, srv *Server) bool {
+		resp, err := http.Get("http://" + srv.Addrs.HTTP.String() + "/readyz")
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+		var body struct {
+			Ready  bool `json:"ready"`
+			Leader bool `json:"leader"`
+		}
+
+		assert.NilError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Assert(t, body.Ready)
+
+		return body.Leader
+	}
+
+	t.Run("every replica is ready", func(t *testing.T) {
+		assert.Equal(t, ready(t, replicas[leader]), true)
+		assert.Equal(t, ready(t, replicas[follower]), false)
+	})
+
+	t.Run("followers reload rotated CAs", func(t *testing.T) {
+		err := replicas[leader].certificateProvider.RotateCA()
+		assert.NilError(t, err)
+
+		err = replicas[follower].certificateProvider.Reload()
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, pki.ActiveCAsPEM(replicas[follower].certificateProvider), pki.ActiveCAsPEM(replicas[leader].certificateProvider))
+	})
+
+	// the other replica takes over when the leader stops
+	cancels[leader]()
+
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if replicas[follower].leader.isLeader() && !replicas[leader].leader.isLeader() {
+			return poll.Success()
+		}
+
+		return poll.Continue("leaders: %v", leaders())
+	}, poll.WithTimeout(5*time.Second))
+}
@@ -11,8 +11,10 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/pki"
 )
 
 var requestTimeout = 60 * time.Second
@@ -56,10 +58,15 @@ func DatabaseMiddleware(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// AuthenticationMiddleware validates the incoming token
+// AuthenticationMiddleware validates the incoming client certificate, or the incoming token
 func AuthenticationMiddleware(a *API) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := RequireAccessKey(c); err != nil {
+		authenticated, err := RequireClientCertificate(c, a.server.certificateProvider)
+		if err == nil && !authenticated {
+			err = RequireAccessKey(c)
+		}
+
+		if err != nil {
 			a.sendAPIError(c, fmt.Errorf("%w: %s", internal.ErrUnauthorized, err))
 
 			return
@@ -69,6 +76,60 @@ func AuthenticationMiddleware(a *API) gin.HandlerFunc {
 	}
 }
 
+// RequireClientCertificate authenticates the identity a verified client certificate was issued to. Requests without
+// a valid certificate issued by the Infra CAs are not authenticated, and fall back to their token. A certificate is
+// only valid while the access key it was issued with is.
+func RequireClientCertificate(c *gin.Context, cp pki.CertificateProvider) (bool, error) {
+	if c.Request.TLS == nil || cp == nil {
+		return false, nil
+	}
+
+	id, cert, ok := pki.ClientCertIdentity(cp, c.Request.TLS.VerifiedChains)
+	if !ok {
+		return false, nil
+	}
+
+	db, ok := c.MustGet("db").(*gorm.DB)
+	if !ok {
+		return false, errors.New("unknown db type in context")
+	}
+
+	// a certificate that is no longer valid is ignored, so the request may still be authenticated by its token
+	issued, err := data.GetClientCertificate(db, data.BySerialNumber(cert.SerialNumber.String()))
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		logging.S.Debugf("client certificate %s was not issued by the server", cert.SerialNumber)
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("client certificate: %w", err)
+	case issued.IdentityID != id:
+		logging.S.Debugf("client certificate %s was issued to another identity", cert.SerialNumber)
+		return false, nil
+	}
+
+	accessKey, err := data.ValidateAccessKeyByID(db, issued.AccessKeyID)
+	if err != nil {
+		logging.S.Debugf("client certificate %s was revoked with its access key: %v", cert.SerialNumber, err)
+		return false, nil
+	}
+
+	c.Set("key", accessKey)
+
+	identity, err := data.GetIdentity(db, data.ByID(id))
+	if err != nil {
+		return false, fmt.Errorf("identity for client certificate: %w", err)
+	}
+
+	identity.LastSeenAt = time.Now().UTC()
+	if err = data.SaveIdentity(db, identity); err != nil {
+		return false, fmt.Errorf("%w: identity update fail: %s", internal.ErrUnauthorized, err)
+	}
+
+	c.Set("identity", identity)
+
+	return true, nil
+}
+
 // RequireAccessKey checks the bearer token is present and valid
 func RequireAccessKey(c *gin.Context) error {
 	db, ok := c.MustGet("db").(*gorm.DB)
@@ -117,5 +178,11 @@ func RequireAccessKey(c *gin.Context) error {
 
 	c.Set("identity", identity)
 
+	if accessKey.BreakGlassID != 0 {
+		if err := access.AuditBreakGlassUse(c, accessKey); err != nil {
+			return fmt.Errorf("audit break-glass: %w", err)
+		}
+	}
+
 	return nil
 }
@@ -22,6 +22,15 @@ type AccessKey struct {
 	Extension         time.Duration // how long to increase the lifetime extension deadline by
 	ExtensionDeadline time.Time
 
+	// FamilyID links the keys issued to a refreshable session, see RefreshToken
+	FamilyID uid.ID
+
+	// MFALevel is how the identity authenticated to get the key, checked against the conditions of grants
+	MFALevel int
+
+	// BreakGlassID is the break-glass account that was unlocked to issue the key, every request with it is audited
+	BreakGlassID uid.ID
+
 	KeyID          string `gorm:"<-;uniqueIndex:,where:deleted_at is NULL"`
 	Secret         string `gorm:"-"`
 	SecretChecksum []byte
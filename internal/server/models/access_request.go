@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+// Statuses of access requests
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+)
+
+// AccessRequest is an identity's request for a grant, which the owners of the resource approve or deny. Approving
+// it creates the grant.
+type AccessRequest struct {
+	Model
+
+	IdentityID uid.ID `gorm:"index" validate:"required"`
+	Privilege  string `validate:"required"`
+	Resource   string `validate:"required"`
+	Reason     string
+
+	Status    string `gorm:"index" validate:"required"`
+	DecidedBy uid.ID
+	DecidedAt time.Time
+	GrantID   uid.ID
+}
+
+func (r *AccessRequest) ToAPI() *api.AccessRequest {
+	return &api.AccessRequest{
+		ID:        r.ID,
+		Created:   api.Time(r.CreatedAt),
+		Updated:   api.Time(r.UpdatedAt),
+		Identity:  r.IdentityID,
+		Privilege: r.Privilege,
+		Resource:  r.Resource,
+		Reason:    r.Reason,
+		Status:    r.Status,
+		DecidedBy: r.DecidedBy,
+		Decided:   api.Time(r.DecidedAt),
+		Grant:     r.GrantID,
+	}
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/api"
+)
+
+// KubernetesAuditRecord is a request proxied by a connector to the Kubernetes API server
+type KubernetesAuditRecord struct {
+	Model
+
+	Time        time.Time `gorm:"index"`
+	Destination string    `gorm:"index" validate:"required"`
+	Identity    string    `gorm:"index"`
+	Groups      CommaSeparatedStrings
+	Verb        string
+	APIGroup    string
+	Resource    string
+	Subresource string
+	Namespace   string
+	Name        string
+	Path        string
+	Code        int
+	Latency     time.Duration
+}
+
+func (r *KubernetesAuditRecord) ToAPI() *api.KubernetesAuditRecord {
+	return &api.KubernetesAuditRecord{
+		ID:          r.ID,
+		Time:        api.Time(r.Time),
+		Destination: r.Destination,
+		Identity:    r.Identity,
+		Groups:      r.Groups,
+		Verb:        r.Verb,
+		APIGroup:    r.APIGroup,
+		Resource:    r.Resource,
+		Subresource: r.Subresource,
+		Namespace:   r.Namespace,
+		Name:        r.Name,
+		Path:        r.Path,
+		Code:        r.Code,
+		Latency:     api.Duration(r.Latency),
+	}
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+// BreakGlassHolders is how many people the secret of a break-glass account is split between
+const BreakGlassHolders = 2
+
+// Kinds of break-glass events
+const (
+	BreakGlassUnlocked     = "unlocked"
+	BreakGlassUnlockFailed = "unlock-failed"
+	BreakGlassUsed         = "used"
+	BreakGlassLocked       = "locked"
+	BreakGlassExpired      = "expired"
+)
+
+// BreakGlass is an emergency account, for when the identity providers are down. Its secret is split between two
+// holders, and unlocking it with both halves gives its identity an elevated grant for a limited time, after which
+// the grant and the identity's access keys are revoked.
+type BreakGlass struct {
+	Model
+
+	Name       string `gorm:"uniqueIndex:,where:deleted_at is NULL" validate:"required"`
+	IdentityID uid.ID `validate:"required"`
+
+	// Holders are who hold each half of the secret, in the order of SecretHashes
+	Holders      CommaSeparatedStrings
+	SecretHashes CommaSeparatedStrings `validate:"required"` // bcrypt hashes of the halves
+
+	Privilege string        `validate:"required"`
+	Resource  string        `validate:"required"`
+	Duration  time.Duration `validate:"required"`
+
+	CreatedBy uid.ID
+
+	// set while the account is unlocked
+	UnlockedAt time.Time
+	ExpiresAt  time.Time
+	GrantID    uid.ID
+}
+
+func (b *BreakGlass) ToAPI() *api.BreakGlass {
+	return &api.BreakGlass{
+		ID:        b.ID,
+		Created:   api.Time(b.CreatedAt),
+		Updated:   api.Time(b.UpdatedAt),
+		Name:      b.Name,
+		Identity:  b.IdentityID,
+		Holders:   b.Holders,
+		Privilege: b.Privilege,
+		Resource:  b.Resource,
+		Duration:  api.Duration(b.Duration),
+		CreatedBy: b.CreatedBy,
+		Unlocked:  api.Time(b.UnlockedAt),
+		Expires:   api.Time(b.ExpiresAt),
+		Grant:     b.GrantID,
+	}
+}
+
+// IsUnlocked checks if the account is unlocked and its time is not up
+func (b *BreakGlass) IsUnlocked(now time.Time) bool {
+	return !b.ExpiresAt.IsZero() && now.Before(b.ExpiresAt)
+}
+
+// BreakGlassEvent is an audit entry of a break-glass account being unlocked, used, or locked again. Every event is
+// also sent to the notifications the server is configured with once it is committed, except that of the requests
+// made while it is unlocked, only the first with each access key is.
+type BreakGlassEvent struct {
+	Model
+
+	Time         time.Time `gorm:"index"`
+	BreakGlassID uid.ID    `gorm:"index"`
+	Name         string
+	Kind         string `validate:"required"`
+	SourceIP     string
+	Detail       string // the request for used events, why an unlock failed, or who locked the account
+	AccessKeyID  uid.ID `gorm:"index"` // the access key of the request, for used events
+	Pending      bool   `gorm:"index"` // waiting to be sent to the notifications
+}
+
+func (e *BreakGlassEvent) ToAPI() *api.BreakGlassEvent {
+	return &api.BreakGlassEvent{
+		ID:         e.ID,
+		Time:       api.Time(e.Time),
+		BreakGlass: e.BreakGlassID,
+		Name:       e.Name,
+		Kind:       e.Kind,
+		SourceIP:   e.SourceIP,
+		Detail:     e.Detail,
+	}
+}
+
+// Summary describes the event in a sentence, for notifications
+func (e *BreakGlassEvent) Summary() string {
+	var summary string
+
+	switch e.Kind {
+	case BreakGlassUnlocked:
+		summary = fmt.Sprintf("break-glass account %s was unlocked from %s", e.Name, e.SourceIP)
+	case BreakGlassUnlockFailed:
+		summary = fmt.Sprintf("failed to unlock break-glass account %s from %s", e.Name, e.SourceIP)
+	case BreakGlassUsed:
+		summary = fmt.Sprintf("break-glass account %s was used from %s", e.Name, e.SourceIP)
+	case BreakGlassLocked:
+		summary = fmt.Sprintf("break-glass account %s was locked", e.Name)
+	case BreakGlassExpired:
+		summary = fmt.Sprintf("break-glass account %s was locked when its time was up", e.Name)
+	default:
+		summary = fmt.Sprintf("break-glass account %s: %s", e.Name, e.Kind)
+	}
+
+	if e.Detail != "" {
+		summary += ": " + e.Detail
+	}
+
+	return summary
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+// ClusterTrust pre-registers a Kubernetes cluster, so its connector can register the destination
+// by presenting its service account token instead of an access key
+type ClusterTrust struct {
+	Model
+
+	// Name is the name of the destination the cluster registers as
+	Name string `gorm:"uniqueIndex:,where:deleted_at is NULL" validate:"required"`
+
+	// tokens are reviewed by the cluster API server when Server is set, otherwise they are verified
+	// as OIDC tokens from Issuer
+	Server        string
+	CA            string
+	ReviewerToken EncryptedAtRest
+	Issuer        string
+	Audience      string
+
+	// ServiceAccount is the namespace and name of the connector service account, e.g. infra:infra-connector
+	ServiceAccount string `validate:"required"`
+
+	// UniqueID and IdentityID are bound by the first registration, and never change after
+	UniqueID   string
+	IdentityID uid.ID
+
+	CreatedBy uid.ID
+}
+
+func (t *ClusterTrust) ToAPI() *api.ClusterTrust {
+	return &api.ClusterTrust{
+		ID:             t.ID,
+		Created:        api.Time(t.CreatedAt),
+		Updated:        api.Time(t.UpdatedAt),
+		Name:           t.Name,
+		Server:         t.Server,
+		CA:             t.CA,
+		Issuer:         t.Issuer,
+		Audience:       t.Audience,
+		ServiceAccount: t.ServiceAccount,
+		UniqueID:       t.UniqueID,
+	}
+}
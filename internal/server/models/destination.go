@@ -1,17 +1,109 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
 )
 
+// DestinationStaleTimeout is how long after its last heartbeat a destination is considered stale
+var DestinationStaleTimeout = 3 * time.Minute
+
 type Destination struct {
 	Model
 
 	Name     string `validate:"required"`
 	UniqueID string `gorm:"uniqueIndex:,where:deleted_at is NULL"`
 
-	ConnectionURL string
-	ConnectionCA  string
+	ConnectionURL    string
+	ConnectionCA     string
+	ConnectionTunnel bool // reached through the tunnel the connector opens, instead of at its URL
+
+	// set through the API, and merged with the labels reported by the connector
+	Labels Labels
+
+	// reported by the connector heartbeat
+	Version       string
+	LastSeenAt    time.Time
+	LastSyncAt    time.Time
+	SyncError     string
+	RoleBindings  int
+	SkippedGrants SkippedGrants
+}
+
+// DestinationTunnel records which server replica a connector's tunnel is connected to, so the other replicas
+// forward requests for the destination to it
+type DestinationTunnel struct {
+	Model
+
+	DestinationID uid.ID `gorm:"index"`
+	ReplicaURL    string `gorm:"index"`
+}
+
+// SkippedGrants are the grants a connector could not apply, stored as a JSON array
+type SkippedGrants []api.SkippedGrant
+
+func (s SkippedGrants) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal([]api.SkippedGrant(s))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (s *SkippedGrants) Scan(v interface{}) error {
+	var b []byte
+
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	case nil:
+	default:
+		return fmt.Errorf("expected string type for %v", v)
+	}
+
+	if len(b) == 0 {
+		*s = nil
+		return nil
+	}
+
+	var skipped []api.SkippedGrant
+	if err := json.Unmarshal(b, &skipped); err != nil {
+		return fmt.Errorf("decoding skipped grants: %w", err)
+	}
+
+	*s = SkippedGrants(skipped)
+
+	return nil
+}
+
+func (s SkippedGrants) GormDataType() string {
+	return "text"
+}
+
+// Status is computed from the last heartbeat, so a connector that stops reporting becomes stale
+func (d *Destination) Status() string {
+	switch {
+	case d.LastSeenAt.IsZero():
+		return api.DestinationStatusPending
+	case time.Since(d.LastSeenAt) > DestinationStaleTimeout:
+		return api.DestinationStatusStale
+	case d.SyncError != "":
+		return api.DestinationStatusError
+	default:
+		return api.DestinationStatusConnected
+	}
 }
 
 func (d *Destination) ToAPI() *api.Destination {
@@ -22,8 +114,17 @@ func (d *Destination) ToAPI() *api.Destination {
 		Name:     d.Name,
 		UniqueID: d.UniqueID,
 		Connection: api.DestinationConnection{
-			URL: d.ConnectionURL,
-			CA:  d.ConnectionCA,
+			URL:    d.ConnectionURL,
+			CA:     d.ConnectionCA,
+			Tunnel: d.ConnectionTunnel,
 		},
+		Labels:        d.Labels,
+		Status:        d.Status(),
+		Version:       d.Version,
+		LastSeen:      api.Time(d.LastSeenAt),
+		LastSync:      api.Time(d.LastSyncAt),
+		SyncError:     d.SyncError,
+		RoleBindings:  d.RoleBindings,
+		SkippedGrants: d.SkippedGrants,
 	}
 }
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/uid"
+)
+
+// DeviceFlowAuthRequest tracks an OAuth 2.0 device authorization grant (RFC 8628) from the
+// time a device asks for a user code until the device collects its access key.
+type DeviceFlowAuthRequest struct {
+	Model
+	ProviderID uid.ID `validate:"required"`
+	ClientID   string // when set, the session is refreshable and bound to this client
+
+	UserCode           string    `gorm:"uniqueIndex:,where:deleted_at is NULL" validate:"required"`
+	DeviceCodeChecksum []byte    `gorm:"index"`
+	State              string    `gorm:"index" validate:"required"` // sent to the identity provider with the user's authorization request
+	ExpiresAt          time.Time `validate:"required"`
+	LastPolledAt       time.Time
+
+	// where the device asked for the user code, shown to the user to confirm before they log in
+	SourceIP  string
+	UserAgent string
+
+	Confirmed  bool // set once the user confirms the request is from their device
+	Denied     bool
+	IdentityID uid.ID // set once the user approves the request
+
+	// the credentials are held here until the device collects them, once
+	Collected        bool
+	AccessKey        EncryptedAtRest
+	AccessKeyExpires time.Time
+	RefreshToken     EncryptedAtRest
+}
@@ -10,6 +10,11 @@ const (
 	InfraViewRole      = "view"
 	InfraUserRole      = "user"
 	InfraConnectorRole = "connector"
+	InfraAuditRole     = "audit"
+
+	// InfraOwnerRole is granted on a resource, and lets its holders manage the grants on the resource and the
+	// resources under it
+	InfraOwnerRole = "owner"
 )
 
 const (
@@ -17,6 +22,9 @@ const (
 	CreatedByConfig = 1
 )
 
+// DenyAllPrivileges is the privilege of a deny grant that denies every privilege on its resource
+const DenyAllPrivileges = "*"
+
 // BasePermissionConnect is the first-principle permission that all other permissions are defined from.
 // This permission gives you permission to authenticate with a destination
 const BasePermissionConnect = "connect"
@@ -36,6 +44,8 @@ const BasePermissionConnect = "connect"
 // 		URN is Universal Resource Notation.
 // Expiry
 //    time you want the grant to expire at
+// Deny
+//    a deny grant takes away what the same grant would give, even when other grants give it. Deny beats allow.
 //
 type Grant struct {
 	Model
@@ -43,6 +53,10 @@ type Grant struct {
 	Subject   uid.PolymorphicID `validate:"required"` // usually an identity, but could be a role definition
 	Privilege string            `validate:"required"` // role or permission
 	Resource  string            `validate:"required"` // Universal Resource Notation
+	Deny      bool
+
+	// Conditions limit when the grant applies
+	Conditions GrantConditions
 
 	CreatedBy uid.ID
 }
@@ -57,5 +71,9 @@ func (r *Grant) ToAPI() *api.Grant {
 		Subject:   r.Subject,
 		Privilege: r.Privilege,
 		Resource:  r.Resource,
+		Deny:      r.Deny,
+
+		Conditions: r.Conditions.ToAPI(),
 	}
 }
+
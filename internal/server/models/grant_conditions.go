@@ -0,0 +1,274 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/infrahq/infra/api"
+)
+
+// MFA levels a grant can require, from how the identity authenticated
+const (
+	MFALevelNone     = 0
+	MFALevelAny      = 1 // a second factor, such as a one time password
+	MFALevelHardware = 2 // a hardware key, which resists phishing
+)
+
+// MFALevel is the level of the authentication methods an identity provider reports in the amr claim of an ID token,
+// see RFC 8176
+func MFALevel(amr []string) int {
+	level := MFALevelNone
+
+	for _, method := range amr {
+		switch method {
+		case "hwk":
+			return MFALevelHardware
+		case "mfa", "otp", "sms", "swk", "fpt", "face", "iris", "retina", "vbm":
+			level = MFALevelAny
+		}
+	}
+
+	return level
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ConditionContext is what the conditions of grants are checked against: when a request is made, the address it
+// comes from, and how its identity authenticated
+type ConditionContext struct {
+	Time     time.Time
+	SourceIP net.IP // nil when the address is not known
+	MFALevel int
+}
+
+// GrantConditions limit when a grant applies, stored as a JSON object. Empty conditions always apply.
+type GrantConditions api.GrantConditions
+
+func (gc GrantConditions) IsEmpty() bool {
+	return len(gc.CIDRs) == 0 && len(gc.Windows) == 0 && gc.MFALevel == MFALevelNone
+}
+
+func (gc GrantConditions) ToAPI() *api.GrantConditions {
+	if gc.IsEmpty() {
+		return nil
+	}
+
+	result := api.GrantConditions(gc)
+
+	return &result
+}
+
+// Equal checks if two grants have the same conditions
+func (gc GrantConditions) Equal(other GrantConditions) bool {
+	a, errA := gc.Value()
+	b, errB := other.Value()
+
+	return errA == nil && errB == nil && a == b
+}
+
+// Validate checks the addresses are CIDRs, and the windows are times of day on days of the week in a known zone
+func (gc GrantConditions) Validate() error {
+	for _, cidr := range gc.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid cidr %q", cidr)
+		}
+	}
+
+	for _, w := range gc.Windows {
+		for _, day := range w.Days {
+			if _, ok := weekdays[day]; !ok {
+				return fmt.Errorf("invalid day %q, days are mon, tue, wed, thu, fri, sat or sun", day)
+			}
+		}
+
+		start, err := time.Parse("15:04", w.Start)
+		if err != nil {
+			return fmt.Errorf("invalid start %q, times are HH:MM", w.Start)
+		}
+
+		end, err := time.Parse("15:04", w.End)
+		if err != nil {
+			return fmt.Errorf("invalid end %q, times are HH:MM", w.End)
+		}
+
+		if start.Equal(end) {
+			return errors.New("time windows must end at a different time than they start")
+		}
+
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("unknown time zone %q", w.Timezone)
+		}
+	}
+
+	if gc.MFALevel < MFALevelNone || gc.MFALevel > MFALevelHardware {
+		return fmt.Errorf("invalid mfa level %d, levels are 0, 1 or 2", gc.MFALevel)
+	}
+
+	return nil
+}
+
+// Check returns why the conditions are not met, or nil when they are
+func (gc GrantConditions) Check(cc ConditionContext) error {
+	if len(gc.CIDRs) > 0 && !gc.AllowsSource(cc.SourceIP) {
+		if cc.SourceIP == nil {
+			return errors.New("the source address is not known")
+		}
+
+		return fmt.Errorf("%s is not in the allowed source addresses", cc.SourceIP)
+	}
+
+	if len(gc.Windows) > 0 && gc.WindowEnd(cc.Time).IsZero() {
+		return fmt.Errorf("%s is outside the time windows", cc.Time.UTC().Format(time.RFC3339))
+	}
+
+	if cc.MFALevel < gc.MFALevel {
+		return fmt.Errorf("mfa level %d is required", gc.MFALevel)
+	}
+
+	return nil
+}
+
+// AllowsSource checks if an address is in one of the CIDRs, or there are none
+func (gc GrantConditions) AllowsSource(ip net.IP) bool {
+	if len(gc.CIDRs) == 0 {
+		return true
+	}
+
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range gc.CIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WindowEnd is when the time window a time is in ends, or zero when it is in none of them. The last ending window is
+// used when windows overlap.
+func (gc GrantConditions) WindowEnd(t time.Time) time.Time {
+	var end time.Time
+
+	for _, w := range gc.Windows {
+		if e := windowEnd(w, t); e.After(end) {
+			end = e
+		}
+	}
+
+	return end
+}
+
+// windowEnd is when a window ends, if the time is in it
+func windowEnd(w api.TimeWindow, t time.Time) time.Time {
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return time.Time{}
+	}
+
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return time.Time{}
+	}
+
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return time.Time{}
+	}
+
+	local := t.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	// the window may have started today, or yesterday when it ends on the next day
+	for _, day := range []time.Time{today, today.AddDate(0, 0, -1)} {
+		if !onDay(w, day.Weekday()) {
+			continue
+		}
+
+		from := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+		until := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+
+		if !until.After(from) {
+			until = time.Date(day.Year(), day.Month(), day.Day()+1, end.Hour(), end.Minute(), 0, 0, loc)
+		}
+
+		if !local.Before(from) && local.Before(until) {
+			return until
+		}
+	}
+
+	return time.Time{}
+}
+
+func onDay(w api.TimeWindow, day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, d := range w.Days {
+		if weekdays[d] == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (gc GrantConditions) Value() (driver.Value, error) {
+	if gc.IsEmpty() {
+		return "", nil
+	}
+
+	b, err := json.Marshal(api.GrantConditions(gc))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (gc *GrantConditions) Scan(v interface{}) error {
+	var b []byte
+
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	case nil:
+	default:
+		return fmt.Errorf("expected string type for %v", v)
+	}
+
+	if len(b) == 0 {
+		*gc = GrantConditions{}
+		return nil
+	}
+
+	var conditions api.GrantConditions
+	if err := json.Unmarshal(b, &conditions); err != nil {
+		return fmt.Errorf("decoding grant conditions: %w", err)
+	}
+
+	*gc = GrantConditions(conditions)
+
+	return nil
+}
+
+func (gc GrantConditions) GormDataType() string {
+	return "text"
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+)
+
+func TestMFALevel(t *testing.T) {
+	assert.Equal(t, MFALevel(nil), MFALevelNone)
+	assert.Equal(t, MFALevel([]string{"pwd"}), MFALevelNone)
+	assert.Equal(t, MFALevel([]string{"pwd", "otp"}), MFALevelAny)
+	assert.Equal(t, MFALevel([]string{"otp", "hwk"}), MFALevelHardware)
+}
+
+func TestGrantConditionsValidate(t *testing.T) {
+	tests := []struct {
+		conditions GrantConditions
+		err        string
+	}{
+		{GrantConditions{}, ""},
+		{GrantConditions{CIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}}, ""},
+		{GrantConditions{CIDRs: []string{"10.0.0.1"}}, `invalid cidr "10.0.0.1"`},
+		{GrantConditions{Windows: []api.TimeWindow{{Days: []string{"mon"}, Start: "22:00", End: "06:00", Timezone: "Europe/London"}}}, ""},
+		{GrantConditions{Windows: []api.TimeWindow{{Days: []string{"monday"}, Start: "09:00", End: "17:00"}}}, `invalid day "monday", days are mon, tue, wed, thu, fri, sat or sun`},
+		{GrantConditions{Windows: []api.TimeWindow{{Start: "9am", End: "17:00"}}}, `invalid start "9am", times are HH:MM`},
+		{GrantConditions{Windows: []api.TimeWindow{{Start: "09:00", End: "09:00"}}}, "time windows must end at a different time than they start"},
+		{GrantConditions{Windows: []api.TimeWindow{{Start: "09:00", End: "17:00", Timezone: "Mars/Olympus"}}}, `unknown time zone "Mars/Olympus"`},
+		{GrantConditions{MFALevel: 3}, "invalid mfa level 3, levels are 0, 1 or 2"},
+	}
+
+	for _, test := range tests {
+		err := test.conditions.Validate()
+		if test.err == "" {
+			assert.NilError(t, err)
+		} else {
+			assert.Error(t, err, test.err)
+		}
+	}
+}
+
+func TestGrantConditionsCheck(t *testing.T) {
+	// a wednesday
+	noon := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	conditions := GrantConditions{
+		CIDRs:    []string{"10.0.0.0/8"},
+		Windows:  []api.TimeWindow{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}},
+		MFALevel: MFALevelAny,
+	}
+
+	met := ConditionContext{Time: noon, SourceIP: net.ParseIP("10.1.2.3"), MFALevel: MFALevelHardware}
+	assert.NilError(t, conditions.Check(met))
+
+	from := met
+	from.SourceIP = net.ParseIP("192.168.1.1")
+	assert.Error(t, conditions.Check(from), "192.168.1.1 is not in the allowed source addresses")
+
+	from.SourceIP = nil
+	assert.Error(t, conditions.Check(from), "the source address is not known")
+
+	weekend := met
+	weekend.Time = noon.AddDate(0, 0, 3)
+	assert.Error(t, conditions.Check(weekend), "2022-06-18T12:00:00Z is outside the time windows")
+
+	mfa := met
+	mfa.MFALevel = MFALevelNone
+	assert.Error(t, conditions.Check(mfa), "mfa level 1 is required")
+
+	assert.NilError(t, GrantConditions{}.Check(ConditionContext{}))
+}
+
+func TestGrantConditionsWindowEnd(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	assert.NilError(t, err)
+
+	overnight := GrantConditions{Windows: []api.TimeWindow{{Days: []string{"fri"}, Start: "22:00", End: "06:00", Timezone: "Europe/London"}}}
+
+	// friday night, and early saturday morning, are in the window that started on friday
+	friday := time.Date(2022, 6, 17, 23, 0, 0, 0, london)
+	saturday := time.Date(2022, 6, 18, 5, 59, 0, 0, london)
+	end := time.Date(2022, 6, 18, 6, 0, 0, 0, london)
+
+	assert.Assert(t, overnight.WindowEnd(friday).Equal(end))
+	assert.Assert(t, overnight.WindowEnd(saturday).Equal(end))
+	assert.Assert(t, overnight.WindowEnd(end).IsZero())
+
+	// the window does not start on thursdays
+	assert.Assert(t, overnight.WindowEnd(time.Date(2022, 6, 16, 23, 0, 0, 0, london)).IsZero())
+
+	// windows are in their time zone, 09:00 in london is 08:00 UTC in the summer
+	daily := GrantConditions{Windows: []api.TimeWindow{{Start: "09:00", End: "17:00", Timezone: "Europe/London"}}}
+	assert.Assert(t, daily.WindowEnd(time.Date(2022, 6, 17, 8, 30, 0, 0, time.UTC)).Equal(time.Date(2022, 6, 17, 17, 0, 0, 0, london)))
+	assert.Assert(t, daily.WindowEnd(time.Date(2022, 6, 17, 7, 30, 0, 0, time.UTC)).IsZero())
+}
+
+func TestGrantConditionsValue(t *testing.T) {
+	value, err := GrantConditions{}.Value()
+	assert.NilError(t, err)
+	assert.Equal(t, value, "")
+
+	conditions := GrantConditions{CIDRs: []string{"10.0.0.0/8"}, MFALevel: MFALevelHardware}
+
+	value, err = conditions.Value()
+	assert.NilError(t, err)
+
+	var scanned GrantConditions
+	assert.NilError(t, scanned.Scan(value))
+	assert.DeepEqual(t, scanned, conditions)
+	assert.Assert(t, scanned.Equal(conditions))
+}
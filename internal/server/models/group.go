@@ -25,3 +25,16 @@ func (g *Group) ToAPI() *api.Group {
 func (g *Group) PolyID() uid.PolymorphicID {
 	return uid.NewGroupPolymorphicID(g.ID)
 }
+
+// GroupMember is a group's membership of another group. Identities in the member group are members of the group too.
+type GroupMember struct {
+	GroupID  uid.ID `gorm:"primaryKey"`
+	MemberID uid.ID `gorm:"primaryKey"`
+}
+
+// GroupAncestor caches the groups a group belongs to, directly or through other groups, so effective memberships are
+// looked up without walking the groups. It is rebuilt from GroupMember when memberships change.
+type GroupAncestor struct {
+	GroupID    uid.ID `gorm:"primaryKey"`
+	AncestorID uid.ID `gorm:"primaryKey;index"`
+}
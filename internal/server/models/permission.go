@@ -0,0 +1,291 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/infrahq/infra/api"
+)
+
+// Permission is an action on a kind of Infra API resource, such as grants:create. Permissions are granted on a
+// resource, which limits the resources they act on: grants:create on kubernetes.staging.* can only create grants
+// on the namespaces of the staging cluster, and a permission granted on infra acts on every resource.
+// A permission may use * as its action, e.g. grants:*, to grant every action on the kind of resource.
+type Permission string
+
+const (
+	PermissionGrantsRead   Permission = "grants:read"
+	PermissionGrantsCreate Permission = "grants:create"
+	PermissionGrantsDelete Permission = "grants:delete"
+
+	PermissionDestinationsRead   Permission = "destinations:read"
+	PermissionDestinationsCreate Permission = "destinations:create"
+	PermissionDestinationsUpdate Permission = "destinations:update"
+	PermissionDestinationsDelete Permission = "destinations:delete"
+
+	PermissionIdentitiesRead   Permission = "identities:read"
+	PermissionIdentitiesCreate Permission = "identities:create"
+	PermissionIdentitiesDelete Permission = "identities:delete"
+
+	PermissionGroupsRead   Permission = "groups:read"
+	PermissionGroupsCreate Permission = "groups:create"
+	PermissionGroupsUpdate Permission = "groups:update"
+
+	PermissionProvidersCreate Permission = "providers:create"
+	PermissionProvidersUpdate Permission = "providers:update"
+	PermissionProvidersDelete Permission = "providers:delete"
+
+	PermissionAccessKeysRead   Permission = "access-keys:read"
+	PermissionAccessKeysCreate Permission = "access-keys:create"
+	PermissionAccessKeysDelete Permission = "access-keys:delete"
+
+	PermissionCredentialsCreate Permission = "credentials:create"
+	PermissionCredentialsUpdate Permission = "credentials:update"
+
+	PermissionClusterTrustsRead   Permission = "cluster-trusts:read"
+	PermissionClusterTrustsCreate Permission = "cluster-trusts:create"
+	PermissionClusterTrustsDelete Permission = "cluster-trusts:delete"
+
+	PermissionRecordingsRead   Permission = "recordings:read"
+	PermissionRecordingsCreate Permission = "recordings:create"
+
+	PermissionAuditRead   Permission = "audit:read"
+	PermissionAuditCreate Permission = "audit:create"
+
+	PermissionBackupsCreate  Permission = "backups:create"
+	PermissionBackupsRestore Permission = "backups:restore"
+
+	PermissionDebugRead Permission = "debug:read"
+
+	PermissionAccessRequestsRead    Permission = "access-requests:read"
+	PermissionAccessRequestsApprove Permission = "access-requests:approve"
+
+	PermissionReviewsRead   Permission = "reviews:read"
+	PermissionReviewsCreate Permission = "reviews:create"
+	PermissionReviewsClose  Permission = "reviews:close"
+
+	PermissionBreakGlassRead   Permission = "break-glass:read"
+	PermissionBreakGlassCreate Permission = "break-glass:create"
+	PermissionBreakGlassDelete Permission = "break-glass:delete"
+	PermissionBreakGlassLock   Permission = "break-glass:lock"
+)
+
+// Permissions describes every permission
+var Permissions = map[Permission]string{
+	PermissionGrantsRead:   "List and get grants",
+	PermissionGrantsCreate: "Create grants on the resources the permission is granted on",
+	PermissionGrantsDelete: "Delete grants on the resources the permission is granted on",
+
+	PermissionDestinationsRead:   "List and get destinations",
+	PermissionDestinationsCreate: "Create destinations",
+	PermissionDestinationsUpdate: "Update destinations, and report their status as a connector",
+	PermissionDestinationsDelete: "Delete destinations",
+
+	PermissionIdentitiesRead:   "List and get identities",
+	PermissionIdentitiesCreate: "Create identities",
+	PermissionIdentitiesDelete: "Delete identities",
+
+	PermissionGroupsRead:   "List and get groups",
+	PermissionGroupsCreate: "Create groups",
+	PermissionGroupsUpdate: "Add and remove the groups that are members of groups",
+
+	PermissionProvidersCreate: "Create identity providers",
+	PermissionProvidersUpdate: "Update identity providers",
+	PermissionProvidersDelete: "Delete identity providers",
+
+	PermissionAccessKeysRead:   "List access keys",
+	PermissionAccessKeysCreate: "Create access keys for machines",
+	PermissionAccessKeysDelete: "Delete access keys",
+
+	PermissionCredentialsCreate: "Create credentials for users",
+	PermissionCredentialsUpdate: "Set one time passwords for other users",
+
+	PermissionClusterTrustsRead:   "List cluster trusts",
+	PermissionClusterTrustsCreate: "Create cluster trusts, and manage the destinations registered through them",
+	PermissionClusterTrustsDelete: "Delete cluster trusts",
+
+	PermissionRecordingsRead:   "List and play back session recordings",
+	PermissionRecordingsCreate: "Upload session recordings as a connector",
+
+	PermissionAuditRead:   "List Kubernetes audit records",
+	PermissionAuditCreate: "Upload Kubernetes audit records as a connector",
+
+	PermissionBackupsCreate:  "Download a backup of the server's database",
+	PermissionBackupsRestore: "Replace the server's database with a backup",
+
+	PermissionDebugRead: "Read the server's profiling data",
+
+	PermissionAccessRequestsRead:    "List the requests for access to the resources the permission is granted on",
+	PermissionAccessRequestsApprove: "Approve and deny requests for access to the resources the permission is granted on",
+
+	PermissionReviewsRead:   "List and export every access review, reviewers can read the reviews they are assigned",
+	PermissionReviewsCreate: "Start access reviews of grants",
+	PermissionReviewsClose:  "Close access reviews, revoking the grants their reviewers decided to revoke",
+
+	PermissionBreakGlassRead:   "List break-glass accounts and their audit events",
+	PermissionBreakGlassCreate: "Create break-glass accounts, and see the halves of their secrets",
+	PermissionBreakGlassDelete: "Delete break-glass accounts",
+	PermissionBreakGlassLock:   "Revoke the grant of an unlocked break-glass account before its time is up",
+}
+
+// InfraRoles are the bundles of permissions the Infra roles grant, when they are granted on infra
+var InfraRoles = map[string][]Permission{
+	InfraAdminRole: {
+		"grants:*",
+		"destinations:*",
+		"identities:*",
+		"groups:*",
+		"providers:*",
+		"access-keys:*",
+		"credentials:*",
+		"cluster-trusts:*",
+		"recordings:*",
+		"audit:*",
+		"backups:*",
+		"debug:*",
+		"access-requests:*",
+		"reviews:*",
+		"break-glass:*",
+	},
+	InfraViewRole: {
+		PermissionGrantsRead,
+		PermissionDestinationsRead,
+		PermissionIdentitiesRead,
+		PermissionGroupsRead,
+		PermissionAccessKeysRead,
+		PermissionClusterTrustsRead,
+	},
+	InfraUserRole: {
+		PermissionDestinationsRead,
+	},
+	InfraConnectorRole: {
+		PermissionGrantsRead,
+		PermissionDestinationsRead,
+		PermissionDestinationsCreate,
+		PermissionDestinationsUpdate,
+		PermissionIdentitiesRead,
+		PermissionGroupsRead,
+		PermissionRecordingsCreate,
+		PermissionAuditCreate,
+	},
+	InfraAuditRole: {
+		PermissionRecordingsRead,
+		PermissionAuditRead,
+		PermissionBreakGlassRead,
+	},
+}
+
+// OwnerPermissions are the permissions the owner role grants on the resources it is granted on, and the resources
+// under them
+var OwnerPermissions = []Permission{
+	PermissionGrantsRead,
+	PermissionGrantsCreate,
+	PermissionGrantsDelete,
+	PermissionAccessRequestsRead,
+	PermissionAccessRequestsApprove,
+}
+
+// DefaultOwnerPrivileges are the privileges owners may grant on their resources, unless the server is configured
+// with others
+var DefaultOwnerPrivileges = []string{BasePermissionConnect, "view", "edit"}
+
+// Kind is the kind of resource the permission acts on, e.g. grants
+func (p Permission) Kind() string {
+	kind, _, _ := strings.Cut(string(p), ":")
+	return kind
+}
+
+// Includes checks if the permission includes another, either because they are the same or because the permission is
+// every action on the kind of resource
+func (p Permission) Includes(other Permission) bool {
+	kind, action, ok := strings.Cut(string(p), ":")
+	if !ok {
+		return false
+	}
+
+	return p == other || (action == "*" && kind == other.Kind())
+}
+
+// IsPermission checks if a privilege is an Infra API permission, rather than a role
+func IsPermission(privilege string) bool {
+	if _, ok := Permissions[Permission(privilege)]; ok {
+		return true
+	}
+
+	kind, action, ok := strings.Cut(privilege, ":")
+
+	return ok && action == "*" && isPermissionKind(kind)
+}
+
+// IsInfraPrivilege checks if a privilege is an Infra permission or the owner role, which are not roles of the
+// resources they are granted on
+func IsInfraPrivilege(privilege string) bool {
+	return privilege == InfraOwnerRole || IsPermission(privilege)
+}
+
+// ValidatePermission checks a privilege that names a kind of Infra API resource is one of its permissions. Other
+// privileges, such as roles, are valid.
+func ValidatePermission(privilege string) error {
+	kind, _, ok := strings.Cut(privilege, ":")
+	if !ok || !isPermissionKind(kind) || IsPermission(privilege) {
+		return nil
+	}
+
+	return fmt.Errorf("unknown permission %q", privilege)
+}
+
+func isPermissionKind(kind string) bool {
+	for p := range Permissions {
+		if p.Kind() == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PermissionMatrix lists the permissions, and the permissions each Infra role grants
+func PermissionMatrix() *api.PermissionMatrix {
+	matrix := &api.PermissionMatrix{}
+
+	names := make([]string, 0, len(Permissions))
+	for p := range Permissions {
+		names = append(names, string(p))
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		matrix.Permissions = append(matrix.Permissions, api.Permission{Name: name, Description: Permissions[Permission(name)]})
+	}
+
+	bundles := map[string][]Permission{InfraOwnerRole: OwnerPermissions}
+	for role, bundle := range InfraRoles {
+		bundles[role] = bundle
+	}
+
+	roles := make([]string, 0, len(bundles))
+	for role := range bundles {
+		roles = append(roles, role)
+	}
+
+	sort.Strings(roles)
+
+	for _, role := range roles {
+		r := api.Role{Name: role}
+
+		for _, name := range names {
+			for _, p := range bundles[role] {
+				if p.Includes(Permission(name)) {
+					r.Permissions = append(r.Permissions, name)
+					break
+				}
+			}
+		}
+
+		matrix.Roles = append(matrix.Roles, r)
+	}
+
+	return matrix
+}
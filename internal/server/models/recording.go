@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/api"
+)
+
+// SessionRecording is the metadata of an interactive session recorded by a connector. The recording
+// itself is kept in the recording storage under StorageKey.
+type SessionRecording struct {
+	Model
+
+	Destination string `gorm:"index" validate:"required"`
+	Identity    string `gorm:"index" validate:"required"`
+	Kind        string `validate:"required"`
+	Namespace   string
+	Pod         string
+	Container   string
+	Command     string
+	StartedAt   time.Time
+	EndedAt     time.Time
+	Size        int
+	StorageKey  string `validate:"required"`
+}
+
+func (r *SessionRecording) ToAPI() *api.SessionRecording {
+	return &api.SessionRecording{
+		ID:          r.ID,
+		Destination: r.Destination,
+		Identity:    r.Identity,
+		Kind:        r.Kind,
+		Namespace:   r.Namespace,
+		Pod:         r.Pod,
+		Container:   r.Container,
+		Command:     r.Command,
+		Started:     api.Time(r.StartedAt),
+		Ended:       api.Time(r.EndedAt),
+		Size:        r.Size,
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/uid"
+)
+
+// RefreshToken is a single-use credential a client exchanges for a new access key.
+// Every refresh token issued for the same login session shares a FamilyID, so that
+// reuse of a consumed token can revoke the whole session.
+type RefreshToken struct {
+	Model
+	FamilyID   uid.ID `validate:"required"`
+	IssuedFor  uid.ID `validate:"required"`
+	ProviderID uid.ID `validate:"required"`
+	ClientID   string `validate:"required"` // the client the session is bound to
+
+	ExpiresAt time.Time `validate:"required"` // the end of the session, not extended by a refresh
+	UsedAt    time.Time
+
+	MFALevel int // how the identity authenticated to start the session
+
+	KeyID          string `gorm:"<-;uniqueIndex:,where:deleted_at is NULL"`
+	Secret         string `gorm:"-"`
+	SecretChecksum []byte
+}
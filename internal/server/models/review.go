@@ -0,0 +1,138 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+// Statuses of reviews
+const (
+	ReviewOpen   = "open"
+	ReviewClosed = "closed"
+)
+
+// Decisions on review items
+const (
+	ReviewPending = "pending"
+	ReviewKeep    = "keep"
+	ReviewRevoke  = "revoke"
+)
+
+// Kinds of subjects a review can be limited to
+const (
+	ReviewSubjectIdentity = "identity"
+	ReviewSubjectGroup    = "group"
+)
+
+// Review is a campaign to recertify the grants that matched its filter when it was created. Its reviewers decide to
+// keep or revoke each grant, and the grants they revoke are deleted when the review closes.
+type Review struct {
+	Model
+
+	Name string `gorm:"uniqueIndex:,where:deleted_at is NULL" validate:"required"`
+
+	// the filter the grants matched, empty fields match every grant
+	Resource    string
+	Privilege   string
+	SubjectKind string
+
+	Reviewers []Identity `gorm:"many2many:reviews_reviewers"`
+
+	Status    string `gorm:"index" validate:"required"`
+	CreatedBy uid.ID
+	ClosedBy  uid.ID
+	ClosedAt  time.Time
+}
+
+func (r *Review) ToAPI() *api.Review {
+	result := &api.Review{
+		ID:          r.ID,
+		Created:     api.Time(r.CreatedAt),
+		Updated:     api.Time(r.UpdatedAt),
+		Name:        r.Name,
+		Resource:    r.Resource,
+		Privilege:   r.Privilege,
+		SubjectKind: r.SubjectKind,
+		Reviewers:   make([]uid.ID, len(r.Reviewers)),
+		Status:      r.Status,
+		CreatedBy:   r.CreatedBy,
+		ClosedBy:    r.ClosedBy,
+		Closed:      api.Time(r.ClosedAt),
+	}
+
+	for i, reviewer := range r.Reviewers {
+		result.Reviewers[i] = reviewer.ID
+	}
+
+	return result
+}
+
+// IsReviewer checks if an identity is one of the review's reviewers
+func (r *Review) IsReviewer(id uid.ID) bool {
+	for _, reviewer := range r.Reviewers {
+		if reviewer.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Includes checks if a grant matches the review's filter. Grants match the review's resource when they are on it, or
+// on a resource under it.
+func (r *Review) Includes(g Grant) bool {
+	switch {
+	case r.Privilege != "" && g.Privilege != r.Privilege:
+		return false
+	case r.Resource != "" && g.Resource != r.Resource && !strings.HasPrefix(g.Resource, r.Resource+"."):
+		return false
+	case r.SubjectKind == ReviewSubjectIdentity && !g.Subject.IsIdentity():
+		return false
+	case r.SubjectKind == ReviewSubjectGroup && !g.Subject.IsGroup():
+		return false
+	}
+
+	return true
+}
+
+// ReviewItem is a snapshot of a grant in a review, and the decision to keep or revoke it. The grant is copied, so
+// the evidence stays the same after the grant changes or is revoked.
+type ReviewItem struct {
+	Model
+
+	ReviewID uid.ID `gorm:"index" validate:"required"`
+
+	GrantID     uid.ID            `validate:"required"`
+	Subject     uid.PolymorphicID `validate:"required"`
+	SubjectName string
+	Privilege   string `validate:"required"`
+	Resource    string `validate:"required"`
+
+	Decision  string `validate:"required"`
+	Comment   string
+	DecidedBy uid.ID
+	DecidedAt time.Time
+
+	// RevokedAt is when the grant was deleted, as the review closed
+	RevokedAt time.Time
+}
+
+func (i *ReviewItem) ToAPI() *api.ReviewItem {
+	return &api.ReviewItem{
+		ID:          i.ID,
+		Review:      i.ReviewID,
+		Grant:       i.GrantID,
+		Subject:     i.Subject,
+		SubjectName: i.SubjectName,
+		Privilege:   i.Privilege,
+		Resource:    i.Resource,
+		Decision:    i.Decision,
+		Comment:     i.Comment,
+		DecidedBy:   i.DecidedBy,
+		Decided:     api.Time(i.DecidedAt),
+		Revoked:     api.Time(i.RevokedAt),
+	}
+}
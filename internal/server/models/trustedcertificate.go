@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/infrahq/infra/uid"
 )
 
 type TrustedCertificate struct {
@@ -26,3 +28,14 @@ type RootCertificate struct {
 	SignedCert       EncryptedAtRest `validate:"required"` // contains private key? probably not pem encoded
 	ExpiresAt        time.Time       `validate:"required"`
 }
+
+// ClientCertificate is a client certificate the server issued to an identity. It authenticates the identity only while
+// the access key it was issued with is valid, so revoking the key also revokes the certificate.
+type ClientCertificate struct {
+	Model
+
+	SerialNumber string `gorm:"uniqueIndex:,where:deleted_at is NULL" validate:"required"`
+	IdentityID   uid.ID `validate:"required"`
+	AccessKeyID  uid.ID `gorm:"index" validate:"required"`
+	ExpiresAt    time.Time
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"strings"
 )
@@ -55,3 +56,51 @@ func (s *CommaSeparatedStrings) Scan(v interface{}) error {
 func (f CommaSeparatedStrings) GormDataType() string {
 	return "text"
 }
+
+// Labels are key/value pairs, stored as a JSON object
+type Labels map[string]string
+
+func (l Labels) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal(map[string]string(l))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (l *Labels) Scan(v interface{}) error {
+	var b []byte
+
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	case nil:
+	default:
+		return fmt.Errorf("expected string type for %v", v)
+	}
+
+	if len(b) == 0 {
+		*l = nil
+		return nil
+	}
+
+	labels := map[string]string{}
+	if err := json.Unmarshal(b, &labels); err != nil {
+		return fmt.Errorf("decoding labels: %w", err)
+	}
+
+	*l = Labels(labels)
+
+	return nil
+}
+
+func (l Labels) GormDataType() string {
+	return "text"
+}
@@ -40,3 +40,20 @@ func TestCommaSeparatedStringsScan(t *testing.T) {
 		assert.DeepEqual(t, test.expected, ([]string)(s))
 	}
 }
+
+func TestLabels(t *testing.T) {
+	val, err := Labels(nil).Value()
+	assert.NilError(t, err)
+	assert.Equal(t, val, "")
+
+	val, err = Labels{"env": "prod", "topology.kubernetes.io/region": "us-east-1"}.Value()
+	assert.NilError(t, err)
+	assert.Equal(t, val, `{"env":"prod","topology.kubernetes.io/region":"us-east-1"}`)
+
+	var l Labels
+	assert.NilError(t, l.Scan(val))
+	assert.DeepEqual(t, l, Labels{"env": "prod", "topology.kubernetes.io/region": "us-east-1"})
+
+	assert.NilError(t, l.Scan(""))
+	assert.Assert(t, l == nil)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+var notificationTimeout = 10 * time.Second
+
+// notificationInterval is how often the leader sends the break-glass events waiting to be sent
+var notificationInterval = 5 * time.Second
+
+// webhookNotifier posts events to the notifications the server is configured with. The body has a text field, which
+// chat webhooks such as Slack's show as the message, and the event itself.
+type webhookNotifier struct {
+	notifications []Notification
+	client        *http.Client
+}
+
+type notificationBody struct {
+	Text  string              `json:"text"`
+	Event api.BreakGlassEvent `json:"event"`
+}
+
+func newWebhookNotifier(notifications []Notification) *webhookNotifier {
+	return &webhookNotifier{
+		notifications: notifications,
+		client:        &http.Client{Timeout: notificationTimeout},
+	}
+}
+
+// configured checks there is a notification to send events to
+func (n *webhookNotifier) configured() bool {
+	return len(n.notifications) > 0
+}
+
+// sendPending sends the break-glass events waiting to be sent, oldest first. Events are recorded in the transaction
+// of the request or job they are for, and sent once it is committed, so an event that is rolled back is never sent,
+// and a slow webhook does not hold up requests. Notifications that fail are logged, and not sent again.
+func (n *webhookNotifier) sendPending(db *gorm.DB) error {
+	events, err := data.ListBreakGlassEvents(db, data.ByPendingNotification())
+	if err != nil {
+		return err
+	}
+
+	for i := range events {
+		n.Notify(&events[i])
+
+		if err := data.MarkBreakGlassEventSent(db, events[i].ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Notify sends the event to every notification, and waits for them to respond
+func (n *webhookNotifier) Notify(event *models.BreakGlassEvent) {
+	body, err := json.Marshal(&notificationBody{Text: event.Summary(), Event: *event.ToAPI()})
+	if err != nil {
+		logging.S.Errorf("notification: %s", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+
+	for _, notification := range n.notifications {
+		wg.Add(1)
+
+		go func(notification Notification) {
+			defer wg.Done()
+
+			if err := n.send(notification, body); err != nil {
+				logging.S.Errorf("notification to %s: %s", notification.URL, err)
+			}
+		}(notification)
+	}
+
+	wg.Wait()
+}
+
+func (n *webhookNotifier) send(notification Notification, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notification.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for key, value := range notification.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
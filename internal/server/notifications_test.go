@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan notificationBody, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body notificationBody
+		err := json.NewDecoder(r.Body).Decode(&body)
+		assert.Check(t, err)
+
+		received <- r
+		bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+
+	assert.Assert(t, !newWebhookNotifier(nil).configured())
+
+	notifier := newWebhookNotifier([]Notification{{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}})
+	assert.Assert(t, notifier.configured())
+
+	notifier.Notify(&models.BreakGlassEvent{Name: "emergency", Kind: models.BreakGlassUnlocked, SourceIP: "10.1.2.3", Detail: "admin on infra"})
+
+	select {
+	case r := <-received:
+		assert.Equal(t, r.Method, http.MethodPost)
+		assert.Equal(t, r.Header.Get("Authorization"), "Bearer secret")
+		assert.Equal(t, r.Header.Get("Content-Type"), "application/json")
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification was not sent")
+	}
+
+	body := <-bodies
+	assert.Equal(t, body.Text, "break-glass account emergency was unlocked from 10.1.2.3: admin on infra")
+	assert.Equal(t, body.Event.Kind, models.BreakGlassUnlocked)
+}
+
+func TestWebhookNotifierSendPending(t *testing.T) {
+	db := setupDB(t)
+
+	sent := make(chan notificationBody, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body notificationBody
+		assert.Check(t, json.NewDecoder(r.Body).Decode(&body))
+		sent <- body
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Now()
+
+	for _, event := range []*models.BreakGlassEvent{
+		{Name: "emergency", Kind: models.BreakGlassUnlocked, Time: now.Add(-time.Minute), Pending: true},
+		{Name: "emergency", Kind: models.BreakGlassUsed, Time: now.Add(-time.Second)},
+		{Name: "emergency", Kind: models.BreakGlassLocked, Time: now, Pending: true},
+	} {
+		err := data.CreateBreakGlassEvent(db, event)
+		assert.NilError(t, err)
+	}
+
+	notifier := newWebhookNotifier([]Notification{{URL: srv.URL}})
+
+	err := notifier.sendPending(db)
+	assert.NilError(t, err)
+
+	// sent in order, and only once
+	assert.Equal(t, len(sent), 2)
+	assert.Equal(t, (<-sent).Event.Kind, models.BreakGlassUnlocked)
+	assert.Equal(t, (<-sent).Event.Kind, models.BreakGlassLocked)
+
+	err = notifier.sendPending(db)
+	assert.NilError(t, err)
+	assert.Equal(t, len(sent), 0)
+
+	pending, err := data.ListBreakGlassEvents(db, data.ByPendingNotification())
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 0)
+}
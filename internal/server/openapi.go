@@ -23,15 +23,19 @@ var (
 	openAPISchema             = openapi3.T{}
 	pathIDReplacer            = regexp.MustCompile(`:\w+`)
 	funcPartialNameToTagNames = map[string]string{
-		"Grant":       "Grants",
-		"Identity":    "Identities",
-		"Group":       "Groups",
-		"AccessKey":   "Authentication",
-		"Provider":    "Providers",
-		"Destination": "Destinations",
-		"Token":       "Destinations",
-		"Login":       "Authentication",
-		"Logout":      "Authentication",
+		"Grant":        "Grants",
+		"Identity":     "Identities",
+		"Group":        "Groups",
+		"AccessKey":    "Authentication",
+		"Provider":     "Providers",
+		"Destination":  "Destinations",
+		"Token":        "Destinations",
+		"Login":        "Authentication",
+		"Logout":       "Authentication",
+		"DeviceFlow":   "Authentication",
+		"ClusterTrust": "Destinations",
+		"AuditRecord":  "Audit",
+		"Recording":    "Audit",
 	}
 )
 
@@ -201,6 +205,14 @@ func buildProperty(f reflect.StructField, t, parent reflect.Type, parentSchema *
 		s.Items = buildProperty(f, t.Elem(), parent, parentSchema)
 	}
 
+	if t.Kind() == reflect.Map {
+		value := &openapi3.Schema{}
+		setTypeInfo(t.Elem(), value)
+		s.AdditionalProperties = &openapi3.SchemaRef{Value: value}
+
+		return &openapi3.SchemaRef{Value: s}
+	}
+
 	if s.Type == "object" {
 		s.Properties = openapi3.Schemas{}
 
@@ -346,7 +358,7 @@ func setTypeInfo(t reflect.Type, schema *openapi3.Schema) {
 		schema.Type = "string"
 	case reflect.Slice:
 		schema.Type = "array"
-	case reflect.Struct:
+	case reflect.Struct, reflect.Map:
 		schema.Type = "object"
 	default:
 		panic("unexpected type " + t.Kind().String())
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+)
+
+// asciicastContentType is the media type of asciicast v2 recordings
+const asciicastContentType = "application/x-asciicast"
+
+func (a *API) downloadSessionRecordingHandler(c *gin.Context) {
+	r := &api.Resource{}
+	if err := c.ShouldBindUri(r); err != nil {
+		a.sendAPIError(c, fmt.Errorf("%w: %s", internal.ErrBadRequest, err))
+		return
+	}
+
+	recording, cast, err := access.GetSessionRecordingCast(c, r.ID, a.server.recordings)
+	if err != nil {
+		a.sendAPIError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.cast"`, recording.ID))
+	c.Data(http.StatusOK, asciicastContentType, cast)
+}
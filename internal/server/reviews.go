@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// exportReviewHandler downloads a review and its decisions as evidence, in csv or json
+func (a *API) exportReviewHandler(c *gin.Context) {
+	r := &api.Resource{}
+	if err := c.ShouldBindUri(r); err != nil {
+		a.sendAPIError(c, fmt.Errorf("%w: %s", internal.ErrBadRequest, err))
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		a.sendAPIError(c, fmt.Errorf("%w: unknown format %q, reviews are exported as json or csv", internal.ErrBadRequest, format))
+		return
+	}
+
+	review, err := access.GetReview(c, r.ID)
+	if err != nil {
+		a.sendAPIError(c, err)
+		return
+	}
+
+	items, err := access.ListReviewItems(c, r.ID)
+	if err != nil {
+		a.sendAPIError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="review-%s.%s"`, review.Name, format))
+
+	if format == "csv" {
+		c.Status(http.StatusOK)
+		c.Header("Content-Type", "text/csv")
+
+		if err := writeReviewCSV(c.Writer, review, items); err != nil {
+			_ = c.Error(err)
+		}
+
+		return
+	}
+
+	evidence := api.ReviewEvidence{Review: *review.ToAPI(), Items: make([]api.ReviewItem, len(items))}
+	for i, item := range items {
+		evidence.Items[i] = *item.ToAPI()
+	}
+
+	c.JSON(http.StatusOK, &evidence)
+}
+
+// writeReviewCSV writes a row for each grant in a review, with the decision on it
+func writeReviewCSV(w io.Writer, review *models.Review, items []models.ReviewItem) error {
+	reviewers := make(map[uid.ID]string, len(review.Reviewers))
+	for _, reviewer := range review.Reviewers {
+		reviewers[reviewer.ID] = reviewer.Name
+	}
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	out := csv.NewWriter(w)
+
+	header := []string{"review", "status", "grant", "subject", "subject_name", "privilege", "resource", "decision", "comment", "decided_by", "decided_at", "revoked_at"}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		row := []string{
+			review.Name,
+			review.Status,
+			item.GrantID.String(),
+			item.Subject.String(),
+			item.SubjectName,
+			item.Privilege,
+			item.Resource,
+			item.Decision,
+			item.Comment,
+			reviewers[item.DecidedBy],
+			formatTime(item.DecidedAt),
+			formatTime(item.RevokedAt),
+		}
+
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
@@ -22,8 +22,13 @@ type ReqResHandlerFunc[Req, Res any] func(c *gin.Context, req *Req) (Res, error)
 
 func (a *API) registerRoutes(router *gin.RouterGroup, promRegistry prometheus.Registerer) {
 	router.GET("/healthz", a.healthHandler)
+	router.GET("/readyz", a.readyHandler)
 	router.GET("/.well-known/jwks.json", DatabaseMiddleware(a.server.db), a.wellKnownJWKsHandler)
 
+	// proxied requests, such as watches and exec sessions, are long-lived, so they are not run in a database
+	// transaction. The connector authenticates them.
+	router.Any("/v1/destinations/:id/proxy/*path", a.destinationProxyHandler)
+
 	router.Use(
 		sentrygin.New(sentrygin.Options{}),
 		metrics.Middleware(promRegistry),
@@ -53,12 +58,32 @@ func (a *API) registerRoutes(router *gin.RouterGroup, promRegistry prometheus.Re
 		post(a, authorized, "/groups", a.CreateGroup)
 		get(a, authorized, "/groups/:id", a.GetGroup)
 		get(a, authorized, "/groups/:id/grants", a.ListGroupGrants)
+		get(a, authorized, "/groups/:id/groups", a.ListGroupGroups)
+		get(a, authorized, "/groups/:id/members", a.ListGroupMembers)
+		post(a, authorized, "/groups/:id/members", a.AddGroupMember)
+		delete(a, authorized, "/groups/:id/members/:member", a.RemoveGroupMember)
 
 		get(a, authorized, "/grants", a.ListGrants)
 		get(a, authorized, "/grants/:id", a.GetGrant)
 		post(a, authorized, "/grants", a.CreateGrant)
 		delete(a, authorized, "/grants/:id", a.DeleteGrant)
 
+		get(a, authorized, "/permissions", a.ListPermissions)
+		get(a, authorized, "/authz/check", a.CheckAuthz)
+		get(a, authorized, "/authz/effective", a.GetEffectiveAccess)
+
+		get(a, authorized, "/access-requests", a.ListAccessRequests)
+		get(a, authorized, "/access-requests/:id", a.GetAccessRequest)
+		post(a, authorized, "/access-requests", a.CreateAccessRequest)
+		put(a, authorized, "/access-requests/:id", a.UpdateAccessRequest)
+
+		get(a, authorized, "/reviews", a.ListReviews)
+		get(a, authorized, "/reviews/:id", a.GetReview)
+		post(a, authorized, "/reviews", a.CreateReview)
+		put(a, authorized, "/reviews/:id", a.UpdateReview)
+		get(a, authorized, "/reviews/:id/items", a.ListReviewItems)
+		put(a, authorized, "/reviews/:id/items/:item", a.UpdateReviewItem)
+
 		post(a, authorized, "/providers", a.CreateProvider)
 		put(a, authorized, "/providers/:id", a.UpdateProvider)
 		delete(a, authorized, "/providers/:id", a.DeleteProvider)
@@ -68,8 +93,29 @@ func (a *API) registerRoutes(router *gin.RouterGroup, promRegistry prometheus.Re
 		post(a, authorized, "/destinations", a.CreateDestination)
 		put(a, authorized, "/destinations/:id", a.UpdateDestination)
 		delete(a, authorized, "/destinations/:id", a.DeleteDestination)
+		post(a, authorized, "/destinations/:id/heartbeat", a.DestinationHeartbeat)
+		post(a, authorized, "/destinations/:id/certificate", a.SignDestinationCertificate)
+
+		get(a, authorized, "/cluster-trusts", a.ListClusterTrusts)
+		post(a, authorized, "/cluster-trusts", a.CreateClusterTrust)
+		delete(a, authorized, "/cluster-trusts/:id", a.DeleteClusterTrust)
+
+		get(a, authorized, "/break-glass", a.ListBreakGlass)
+		post(a, authorized, "/break-glass", a.CreateBreakGlass)
+		get(a, authorized, "/break-glass/:id", a.GetBreakGlass)
+		delete(a, authorized, "/break-glass/:id", a.DeleteBreakGlass)
+		post(a, authorized, "/break-glass/:id/lock", a.LockBreakGlass)
+		get(a, authorized, "/break-glass/:id/events", a.ListBreakGlassEvents)
+
+		get(a, authorized, "/audit/kubernetes", a.ListKubernetesAuditRecords)
+		post(a, authorized, "/audit/kubernetes", a.CreateKubernetesAuditRecords)
+
+		get(a, authorized, "/recordings", a.ListSessionRecordings)
+		get(a, authorized, "/recordings/:id", a.GetSessionRecording)
+		post(a, authorized, "/recordings", a.CreateSessionRecording)
 
 		post(a, authorized, "/tokens", a.CreateToken)
+		post(a, authorized, "/certificates", a.CreateClientCertificate)
 
 		post(a, authorized, "/logout", a.Logout)
 	}
@@ -83,12 +129,35 @@ func (a *API) registerRoutes(router *gin.RouterGroup, promRegistry prometheus.Re
 
 		post(a, unauthorized, "/login", a.Login)
 
+		post(a, unauthorized, "/device", a.StartDeviceFlow)
+		post(a, unauthorized, "/device/status", a.GetDeviceFlowStatus)
+
+		post(a, unauthorized, "/destinations/register", a.RegisterDestination)
+
 		get(a, unauthorized, "/providers", a.ListProviders)
 		get(a, unauthorized, "/providers/:id", a.GetProvider)
 
 		get(a, unauthorized, "/version", a.Version)
 	}
 
+	// recordings are downloaded in asciicast format, so they can be played with asciinema
+	authorized.GET("/recordings/:id/cast", a.downloadSessionRecordingHandler)
+
+	// reviews are exported as csv or json evidence of their decisions
+	authorized.GET("/reviews/:id/export", a.exportReviewHandler)
+
+	// backups are archives of the database, rather than API resources
+	authorized.GET("/backup", a.backupHandler)
+	authorized.PUT("/backup", a.restoreHandler)
+
+	// connectors of private clusters open a tunnel, which requests for the destination are proxied through
+	authorized.GET("/destinations/:id/tunnel", a.destinationTunnelHandler)
+
+	// pages for users approving a device login in their browser
+	router.GET("/device", a.deviceVerificationHandler)
+	router.POST("/device", a.deviceConfirmHandler)
+	router.GET("/device/callback", a.deviceCallbackHandler)
+
 	// pprof.Index does not work with a /v1 prefix
 	debug := router.Group("/debug/pprof", AuthenticationMiddleware(a))
 	debug.GET("/*profile", a.pprofHandler)
@@ -255,3 +324,20 @@ func (a *API) wellKnownJWKsHandler(c *gin.Context) {
 func (a *API) healthHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
+
+// readyHandler reports whether the server can serve requests, which needs its database, and whether it is the
+// leader. Every server sharing the database serves the API, so servers that are not leading are ready too.
+func (a *API) readyHandler(c *gin.Context) {
+	db, err := a.server.db.DB()
+	if err == nil {
+		err = db.PingContext(c.Request.Context())
+	}
+
+	if err != nil {
+		logging.S.Warnf("not ready: %s", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ready": true, "leader": a.server.leader.isLeader()})
+}
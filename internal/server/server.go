@@ -30,10 +30,12 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/certs"
 	"github.com/infrahq/infra/internal/ginutil"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/repeat"
+	"github.com/infrahq/infra/internal/server/authn"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/metrics"
@@ -51,6 +53,7 @@ type Options struct {
 	UIProxyURL           string        `mapstructure:"uiProxyURL"`
 	EnableSetup          bool          `mapstructure:"enableSetup"`
 	SessionDuration      time.Duration `mapstructure:"sessionDuration"`
+	AccessKeyDuration    time.Duration `mapstructure:"accessKeyDuration"` // lifetime of access keys in refreshable sessions
 
 	DBFile                  string `mapstructure:"dbFile"`
 	DBEncryptionKey         string `mapstructure:"dbEncryptionKey"`
@@ -65,6 +68,25 @@ type Options struct {
 	Keys    []KeyProvider    `mapstructure:"keys"`
 	Secrets []SecretProvider `mapstructure:"secrets"`
 
+	// OwnerPrivileges are the privileges owners of a resource may grant on it, defaults to models.DefaultOwnerPrivileges
+	OwnerPrivileges []string `mapstructure:"ownerPrivileges"`
+
+	// TrustedProxies are the addresses or CIDRs of proxies whose X-Forwarded-For header is trusted for the client
+	// address, which grant conditions and break-glass events depend on. No proxy is trusted by default.
+	TrustedProxies []string `mapstructure:"trustedProxies"`
+
+	// ReplicaURL is the address the other server replicas reach this one at, such as http://<pod ip>:80. Requests
+	// through connector tunnels are forwarded to the replica the tunnel is connected to, so it must be set when
+	// more than one replica runs and destinations use tunnels.
+	ReplicaURL string `mapstructure:"replicaURL"`
+
+	// PublicURL is the address users reach the server at, such as https://infra.example.com. Device login sends
+	// users, and the identity provider's redirect, to pages under it, so device login requires it to be set.
+	PublicURL string `mapstructure:"publicURL" validate:"omitempty,url"`
+
+	RecordingsDir    string `mapstructure:"recordingsDir"`
+	RecordingStorage string `mapstructure:"recordingStorage"` // secret storage to keep session recordings in, instead of RecordingsDir
+
 	Config `mapstructure:",squash"`
 
 	NetworkEncryption           string `mapstructure:"networkEncryption"` // mtls (default), e2ee, none.
@@ -89,8 +111,13 @@ type Server struct {
 	secrets             map[string]secrets.SecretStorage
 	keys                map[string]secrets.SymmetricKeyProvider
 	certificateProvider pki.CertificateProvider
+	federation          *authn.Federation
+	notifier            *webhookNotifier
+	recordings          secrets.SecretStorage
+	tunnels             tunnelRegistry
 	Addrs               Addrs
 	routines            []func() error
+	leader              *leaderElection
 
 	InternalProvider   *models.Provider
 	InternalIdentities map[string]*models.Identity
@@ -117,29 +144,21 @@ func New(options Options) (*Server, error) {
 		return nil, fmt.Errorf("configure sentry: %w", err)
 	}
 
-	if err := server.importSecrets(); err != nil {
-		return nil, fmt.Errorf("secrets config: %w", err)
-	}
-
-	if err := server.importSecretKeys(); err != nil {
-		return nil, fmt.Errorf("key config: %w", err)
+	if err := server.openDB(); err != nil {
+		return nil, err
 	}
 
-	driver, err := server.getDatabaseDriver()
-	if err != nil {
-		return nil, fmt.Errorf("driver: %w", err)
-	}
+	server.leader = newLeaderElection(server.db)
 
-	server.db, err = data.NewDB(driver)
+	// servers sharing the database set it up one at a time, so they do not race to create the same CAs and identities
+	setupLock, err := data.AcquireLock(context.Background(), server.db, setupLockName)
 	if err != nil {
-		return nil, fmt.Errorf("db: %w", err)
+		return nil, err
 	}
 
-	if err = server.loadDBKey(); err != nil {
-		return nil, fmt.Errorf("loading database key: %w", err)
-	}
+	defer releaseLock(setupLock, setupLockName)
 
-	if err = server.loadCertificates(); err != nil {
+	if err := server.loadCertificates(); err != nil {
 		return nil, fmt.Errorf("loading certificate provider: %w", err)
 	}
 
@@ -170,6 +189,33 @@ func New(options Options) (*Server, error) {
 		return nil, fmt.Errorf("configs: %w", err)
 	}
 
+	server.federation = loadFederation(server.options.TrustedIssuers)
+	server.notifier = newWebhookNotifier(server.options.Notifications)
+
+	if server.options.ReplicaURL != "" {
+		// tunnels this replica had before it restarted are gone
+		if err := data.DeleteDestinationTunnels(server.db, data.ByReplicaURL(server.options.ReplicaURL)); err != nil {
+			return nil, fmt.Errorf("destination tunnels: %w", err)
+		}
+	}
+
+	server.leader.addJob("lock expired break-glass accounts", time.Minute, func(context.Context) error {
+		return server.db.Transaction(func(tx *gorm.DB) error {
+			return access.ExpireBreakGlass(tx)
+		})
+	})
+
+	server.leader.addJob("send break-glass notifications", notificationInterval, func(context.Context) error {
+		return server.notifier.sendPending(server.db)
+	})
+
+	recordings, err := server.recordingStorage()
+	if err != nil {
+		return nil, fmt.Errorf("session recordings: %w", err)
+	}
+
+	server.recordings = recordings
+
 	if err := server.listen(); err != nil {
 		return nil, fmt.Errorf("listening: %w", err)
 	}
@@ -180,13 +226,26 @@ func (s *Server) Run(ctx context.Context) error {
 	// nolint: errcheck // if logs won't sync there is no way to report this error
 	defer logging.L.Sync()
 
-	// TODO: start telemetry goroutine here as well
-
 	group, _ := errgroup.WithContext(ctx)
 	for i := range s.routines {
 		group.Go(s.routines[i])
 	}
 
+	group.Go(func() error {
+		return s.leader.run(ctx)
+	})
+
+	// the leader rotates the CAs, and the other servers read them again
+	repeat.Start(ctx, time.Minute, func(context.Context) {
+		if s.leader.isLeader() {
+			return
+		}
+
+		if err := s.certificateProvider.Reload(); err != nil {
+			logging.S.Warnf("reload certificates: %s", err)
+		}
+	})
+
 	logging.S.Infof("starting infra (%s) - http:%s https:%s metrics:%s",
 		internal.Version, s.Addrs.HTTP, s.Addrs.HTTPS, s.Addrs.Metrics)
 
@@ -200,8 +259,10 @@ func configureTelemetry(server *Server) error {
 	}
 	server.tel = tel
 
-	repeat.Start(context.TODO(), 1*time.Hour, func(context.Context) {
+	// the heartbeat counts what every server shares, so only the leader sends it
+	server.leader.addJob("telemetry heartbeat", time.Hour, func(context.Context) error {
 		tel.EnqueueHeartbeat()
+		return nil
 	})
 
 	return nil
@@ -251,26 +312,18 @@ func (s *Server) loadCertificates() (err error) {
 		}
 	}
 
-	// automatically rotate CAs as the oldest one expires
-	if len(s.certificateProvider.ActiveCAs()) == 1 {
-		logging.S.Info("Rotating Root CA certificate")
-
-		if err := s.certificateProvider.RotateCA(); err != nil {
-			return fmt.Errorf("rotating CA: %w", err)
-		}
+	if err := s.rotateCertificates(); err != nil {
+		return err
 	}
 
-	// if the current cert is going to expire in less than FullKeyRotationDurationInDays/2 days, rotate.
-	rotationWindow := time.Now().AddDate(0, 0, fullRotationInDays/2)
-
-	activeCAs := s.certificateProvider.ActiveCAs()
-	if len(activeCAs) < 2 || activeCAs[1].NotAfter.Before(rotationWindow) {
-		logging.S.Info("Half-Rotating Root CA certificate")
-
-		if err := s.certificateProvider.RotateCA(); err != nil {
-			return fmt.Errorf("rotating CA: %w", err)
+	s.leader.addJob("rotate certificates", time.Hour, func(context.Context) error {
+		// another server may have rotated them while it was the leader
+		if err := s.certificateProvider.Reload(); err != nil {
+			return err
 		}
-	}
+
+		return s.rotateCertificates()
+	})
 
 	if len(s.options.TrustInitialClientPublicKey) > 0 {
 		key := s.options.TrustInitialClientPublicKey
@@ -298,6 +351,33 @@ func (s *Server) loadCertificates() (err error) {
 	return nil
 }
 
+// rotateCertificates rotates the CAs as the oldest one expires
+func (s *Server) rotateCertificates() error {
+	fullRotationInDays := s.options.FullKeyRotationInDays
+
+	if len(s.certificateProvider.ActiveCAs()) == 1 {
+		logging.S.Info("Rotating Root CA certificate")
+
+		if err := s.certificateProvider.RotateCA(); err != nil {
+			return fmt.Errorf("rotating CA: %w", err)
+		}
+	}
+
+	// if the current cert is going to expire in less than FullKeyRotationDurationInDays/2 days, rotate.
+	rotationWindow := time.Now().AddDate(0, 0, fullRotationInDays/2)
+
+	activeCAs := s.certificateProvider.ActiveCAs()
+	if len(activeCAs) < 2 || activeCAs[1].NotAfter.Before(rotationWindow) {
+		logging.S.Info("Half-Rotating Root CA certificate")
+
+		if err := s.certificateProvider.RotateCA(); err != nil {
+			return fmt.Errorf("rotating CA: %w", err)
+		}
+	}
+
+	return nil
+}
+
 //go:embed all:ui/*
 var assetFS embed.FS
 
@@ -356,6 +436,10 @@ func (s *Server) registerUIRoutes(router *gin.Engine) error {
 func (s *Server) GenerateRoutes(promRegistry prometheus.Registerer) (*gin.Engine, error) {
 	router := gin.New()
 
+	if err := router.SetTrustedProxies(s.options.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+
 	router.Use(gin.Recovery())
 	a := &API{
 		t:      s.tel,
@@ -374,6 +458,7 @@ func (s *Server) GenerateRoutes(promRegistry prometheus.Registerer) (*gin.Engine
 func (s *Server) listen() error {
 	ginutil.SetMode()
 	promRegistry := SetupMetrics(s.db)
+	s.leader.registerMetrics(promRegistry)
 	router, err := s.GenerateRoutes(promRegistry)
 	if err != nil {
 		return err
@@ -473,9 +558,10 @@ func (s *Server) serverTLSConfig() (*tls.Config, error) {
 			}
 		}
 
+		// clients without a certificate authenticate with an access key, which they can request a certificate with
 		return &tls.Config{
 			Certificates: serverTLSCerts,
-			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientAuth:   tls.VerifyClientCertIfGiven,
 			ClientCAs:    caPool,
 			MinVersion:   tls.VersionTLS12,
 			CipherSuites: []uint16{
@@ -524,6 +610,50 @@ func (s *Server) configureSentry() (err error, ok bool) {
 	return nil, false
 }
 
+// openDB configures the secret and key providers, and opens the database with its encryption key
+func (s *Server) openDB() error {
+	if err := s.importSecrets(); err != nil {
+		return fmt.Errorf("secrets config: %w", err)
+	}
+
+	if err := s.importSecretKeys(); err != nil {
+		return fmt.Errorf("key config: %w", err)
+	}
+
+	driver, err := s.getDatabaseDriver()
+	if err != nil {
+		return fmt.Errorf("driver: %w", err)
+	}
+
+	s.db, err = data.NewDB(driver)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	// the first server to start creates the database key
+	lock, err := data.AcquireLock(context.Background(), s.db, setupLockName)
+	if err != nil {
+		return err
+	}
+
+	defer releaseLock(lock, setupLockName)
+
+	if err := s.loadDBKey(); err != nil {
+		return fmt.Errorf("loading database key: %w", err)
+	}
+
+	return nil
+}
+
+// setupLockName is the name of the database lock servers set up the database with
+const setupLockName = "setup"
+
+func releaseLock(lock *data.Lock, name string) {
+	if err := lock.Release(); err != nil {
+		logging.S.Warnf("release %s lock: %s", name, err)
+	}
+}
+
 func (s *Server) getDatabaseDriver() (gorm.Dialector, error) {
 	postgres, err := s.getPostgresConnectionString()
 	if err != nil {
@@ -18,6 +18,7 @@ import (
 	is "gotest.tools/v3/assert/cmp"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
@@ -28,7 +29,7 @@ import (
 func setupServer(t *testing.T) *Server {
 	db := setupDB(t)
 
-	s := &Server{db: db}
+	s := &Server{db: db, leader: newLeaderElection(db), notifier: newWebhookNotifier(nil)}
 
 	err := s.setupInternalInfraIdentityProvider()
 	assert.NilError(t, err)
@@ -1079,3 +1080,64 @@ func TestServer_GenerateRoutes_UI(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_GenerateRoutes_TrustedProxies(t *testing.T) {
+	s := setupServer(t)
+
+	viewer := &models.Identity{Name: "viewer@example.com", Kind: models.UserKind}
+	err := data.CreateIdentity(s.db, viewer)
+	assert.NilError(t, err)
+
+	err = data.CreateGrant(s.db, &models.Grant{
+		Subject:    viewer.PolyID(),
+		Privilege:  models.InfraViewRole,
+		Resource:   access.ResourceInfraAPI,
+		Conditions: models.GrantConditions{CIDRs: []string{"10.0.0.0/8"}},
+	})
+	assert.NilError(t, err)
+
+	key, err := data.CreateAccessKey(s.db, &models.AccessKey{Name: "viewer", IssuedFor: viewer.ID, ExpiresAt: time.Now().Add(time.Hour), ProviderID: s.InternalProvider.ID})
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, trustedProxies []string, remoteAddr, forwardedFor string) int {
+		s.options.TrustedProxies = trustedProxies
+
+		router, err := s.GenerateRoutes(prometheus.NewRegistry())
+		assert.NilError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/identities", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", "Bearer "+key)
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		return resp.Code
+	}
+
+	t.Run("from an allowed address", func(t *testing.T) {
+		assert.Equal(t, request(t, nil, "10.1.2.3:41000", ""), http.StatusOK)
+	})
+
+	t.Run("spoofed forwarded address", func(t *testing.T) {
+		assert.Equal(t, request(t, nil, "192.168.1.1:41000", "10.1.2.3"), http.StatusForbidden)
+	})
+
+	t.Run("forwarded by a trusted proxy", func(t *testing.T) {
+		assert.Equal(t, request(t, []string{"192.168.1.1"}, "192.168.1.1:41000", "10.1.2.3"), http.StatusOK)
+	})
+
+	t.Run("forwarded by an untrusted proxy", func(t *testing.T) {
+		assert.Equal(t, request(t, []string{"192.168.1.1"}, "192.168.1.2:41000", "10.1.2.3"), http.StatusForbidden)
+	})
+
+	t.Run("invalid trusted proxy", func(t *testing.T) {
+		s.options.TrustedProxies = []string{"not-an-address"}
+
+		_, err := s.GenerateRoutes(prometheus.NewRegistry())
+		assert.ErrorContains(t, err, "trusted proxies")
+	})
+}
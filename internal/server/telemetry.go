@@ -20,6 +20,9 @@ type Properties = analytics.Properties
 type Telemetry struct {
 	client analytics.Client
 	db     *gorm.DB
+
+	// infraID identifies the installation in events, and is the same for every server sharing the database
+	infraID uid.ID
 }
 
 func NewTelemetry(db *gorm.DB) (*Telemetry, error) {
@@ -27,20 +30,18 @@ func NewTelemetry(db *gorm.DB) (*Telemetry, error) {
 		return nil, errors.New("db cannot be nil")
 	}
 
-	var err error
-	settings, err = data.GetSettings(db)
+	settings, err := data.GetSettings(db)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Telemetry{
-		client: analytics.New(internal.TelemetryWriteKey),
-		db:     db,
+		client:  analytics.New(internal.TelemetryWriteKey),
+		db:      db,
+		infraID: settings.ID,
 	}, nil
 }
 
-var settings *models.Settings
-
 func (t *Telemetry) Enqueue(track analytics.Message) error {
 	if internal.TelemetryWriteKey == "" {
 		return nil
@@ -52,14 +53,14 @@ func (t *Telemetry) Enqueue(track analytics.Message) error {
 			track.Properties = analytics.Properties{}
 		}
 
-		track.Properties.Set("infraId", settings.ID)
+		track.Properties.Set("infraId", t.infraID)
 		track.Properties.Set("version", internal.Version)
 	case analytics.Page:
 		if track.Properties == nil {
 			track.Properties = analytics.Properties{}
 		}
 
-		track.Properties.Set("infraId", settings.ID)
+		track.Properties.Set("infraId", t.infraID)
 		track.Properties.Set("version", internal.Version)
 	}
 
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hashicorp/yamux"
+	"gorm.io/gorm"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// tunnel is a connection a connector opened to the server, for a destination that accepts no inbound connections.
+// Requests for the destination are proxied to the connector over a new stream of the tunnel.
+type tunnel struct {
+	session *yamux.Session
+	proxy   *httputil.ReverseProxy
+}
+
+func newTunnel(session *yamux.Session) *tunnel {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return session.Open()
+		},
+		MaxIdleConnsPerHost: 16,
+	}
+
+	proxy := &httputil.ReverseProxy{
+		// the path is set by the proxy handler, and the connector serves plain HTTP inside the tunnel
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = "connector"
+		},
+		Transport: transport,
+		ErrorLog:  logging.StandardErrorLog(),
+	}
+
+	return &tunnel{session: session, proxy: proxy}
+}
+
+func (t *tunnel) close() {
+	if transport, ok := t.proxy.Transport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+
+	_ = t.session.Close()
+}
+
+// tunnelRegistry keeps the tunnels open to this server by destination. Each connector replica opens its own tunnel.
+// The tunnels are recorded in the database too, when the server has a replica URL, so the other server replicas
+// forward requests to the replica a tunnel is connected to.
+type tunnelRegistry struct {
+	mu      sync.Mutex
+	tunnels map[uid.ID][]*tunnel
+	next    int
+}
+
+func (r *tunnelRegistry) add(id uid.ID, t *tunnel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tunnels == nil {
+		r.tunnels = make(map[uid.ID][]*tunnel)
+	}
+
+	r.tunnels[id] = append(r.tunnels[id], t)
+}
+
+func (r *tunnelRegistry) remove(id uid.ID, t *tunnel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tunnels := r.tunnels[id]
+	for i := range tunnels {
+		if tunnels[i] == t {
+			tunnels = append(tunnels[:i], tunnels[i+1:]...)
+			break
+		}
+	}
+
+	r.tunnels[id] = tunnels
+}
+
+// get returns an open tunnel for the destination, spreading requests across the connector replicas
+func (r *tunnelRegistry) get(id uid.ID) *tunnel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tunnels := r.tunnels[id]
+	for range tunnels {
+		r.next++
+
+		t := tunnels[r.next%len(tunnels)]
+		if !t.session.IsClosed() {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func tunnelConfig() *yamux.Config {
+	config := yamux.DefaultConfig()
+	// the session ending is logged when the tunnel closes
+	config.LogOutput = io.Discard
+
+	return config
+}
+
+// destinationTunnelHandler upgrades the connection of a connector to a tunnel, which is kept open until the connector
+// closes it
+func (a *API) destinationTunnelHandler(c *gin.Context) {
+	r := &api.Resource{}
+	if err := c.ShouldBindUri(r); err != nil {
+		a.sendAPIError(c, fmt.Errorf("%w: %s", internal.ErrBadRequest, err))
+		return
+	}
+
+	destination, err := access.AuthorizeDestinationTunnel(c, r.ID)
+	if err != nil {
+		a.sendAPIError(c, err)
+		return
+	}
+
+	if !strings.EqualFold(c.GetHeader("Upgrade"), api.DestinationTunnelProtocol) {
+		a.sendAPIError(c, fmt.Errorf("%w: expected an upgrade to %s", internal.ErrBadRequest, api.DestinationTunnelProtocol))
+		return
+	}
+
+	conn, rw, err := c.Writer.Hijack()
+	if err != nil {
+		a.sendAPIError(c, fmt.Errorf("hijack tunnel connection: %w", err))
+		return
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 %d %s\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n",
+		http.StatusSwitchingProtocols, http.StatusText(http.StatusSwitchingProtocols), api.DestinationTunnelProtocol)
+
+	if err := rw.Flush(); err != nil {
+		logging.S.Debugf("tunnel for %s: %v", destination.Name, err)
+		conn.Close()
+
+		return
+	}
+
+	// the server opens the streams, so it is the client side of the session
+	session, err := yamux.Client(&bufferedConn{Conn: conn, reader: rw.Reader}, tunnelConfig())
+	if err != nil {
+		logging.S.Errorf("tunnel for %s: %v", destination.Name, err)
+		conn.Close()
+
+		return
+	}
+
+	t := newTunnel(session)
+	a.server.tunnels.add(destination.ID, t)
+
+	// the other replicas forward requests for the destination to this one, once the request's transaction commits
+	var record *models.DestinationTunnel
+
+	if replicaURL := a.server.options.ReplicaURL; replicaURL != "" {
+		db, _ := c.MustGet("db").(*gorm.DB)
+
+		record = &models.DestinationTunnel{DestinationID: destination.ID, ReplicaURL: replicaURL}
+		if err := data.CreateDestinationTunnel(db, record); err != nil {
+			logging.S.Errorf("tunnel for %s: %v", destination.Name, err)
+		}
+	}
+
+	logging.S.Infof("tunnel opened for %s", destination.Name)
+
+	// the handler returns so the request's database transaction is committed, and the tunnel is kept until either
+	// side closes it
+	go func() {
+		<-session.CloseChan()
+
+		a.server.tunnels.remove(destination.ID, t)
+		t.close()
+
+		if record != nil {
+			if err := data.DeleteDestinationTunnels(a.server.db, data.ByID(record.ID)); err != nil {
+				logging.S.Errorf("tunnel for %s: %v", destination.Name, err)
+			}
+		}
+
+		logging.S.Infof("tunnel closed for %s", destination.Name)
+	}()
+}
+
+// tunnelForwardedHeader marks a request another server replica forwarded, so it is not forwarded again. It carries the
+// client's address and a signature of it, so the replica the tunnel is connected to passes it on to the connector.
+const tunnelForwardedHeader = "Infra-Tunnel-Forwarded"
+
+// tunnelForwardedSignature signs the client address of a request forwarded for a destination, with a key derived
+// from the server's signing key, which the replicas share through the database
+func tunnelForwardedSignature(db *gorm.DB, id uid.ID, clientIP string) (string, error) {
+	settings, err := data.GetSettings(db)
+	if err != nil {
+		return "", err
+	}
+
+	key := sha256.Sum256(append([]byte("infra tunnel forwarding "), settings.PrivateJWK...))
+
+	mac := hmac.New(sha256.New, key[:])
+	fmt.Fprintf(mac, "%s %s", id, clientIP)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// tunnelForwardedClient returns the client address of a request another replica forwarded, and whether it was
+// forwarded. The header is ignored unless a replica signed it.
+func (a *API) tunnelForwardedClient(c *gin.Context, id uid.ID) (string, bool) {
+	header := c.GetHeader(tunnelForwardedHeader)
+	if header == "" {
+		return "", false
+	}
+
+	clientIP, signature, ok := strings.Cut(header, " ")
+	if !ok || net.ParseIP(clientIP) == nil {
+		logging.S.Debugf("ignoring malformed %s header", tunnelForwardedHeader)
+		return "", false
+	}
+
+	expected, err := tunnelForwardedSignature(a.server.db, id, clientIP)
+	if err != nil {
+		logging.S.Errorf("tunnel forwarded signature: %v", err)
+		return "", false
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		logging.S.Debugf("ignoring %s header not signed by a replica", tunnelForwardedHeader)
+		return "", false
+	}
+
+	return clientIP, true
+}
+
+// forwardToReplica forwards a request for a destination to another server replica its tunnel is connected to, and
+// reports whether there is one
+func (a *API) forwardToReplica(c *gin.Context, id uid.ID, clientIP string) bool {
+	signature, err := tunnelForwardedSignature(a.server.db, id, clientIP)
+	if err != nil {
+		logging.S.Errorf("tunnel forwarded signature: %v", err)
+		return false
+	}
+
+	tunnels, err := data.ListDestinationTunnels(a.server.db, data.ByDestinationID(id))
+	if err != nil {
+		logging.S.Errorf("destination tunnels: %v", err)
+		return false
+	}
+
+	for _, t := range tunnels {
+		if t.ReplicaURL == a.server.options.ReplicaURL {
+			continue
+		}
+
+		target, err := url.Parse(t.ReplicaURL)
+		if err != nil {
+			logging.S.Warnf("destination tunnel replica %q: %v", t.ReplicaURL, err)
+			continue
+		}
+
+		proxy := &httputil.ReverseProxy{
+			Director: func(req *http.Request) {
+				req.URL.Scheme = target.Scheme
+				req.URL.Host = target.Host
+				req.Header.Set(tunnelForwardedHeader, clientIP+" "+signature)
+			},
+			ErrorLog: logging.StandardErrorLog(),
+		}
+
+		proxy.ServeHTTP(c.Writer, c.Request)
+
+		return true
+	}
+
+	return false
+}
+
+// destinationProxyHandler proxies a request for a destination through a tunnel its connector opened. The connector
+// authenticates the request, as it does when it is reached directly. The client's address is passed on to the
+// connector for grant conditions, as the server sees it, so the server's trusted proxies must be set when it is
+// behind a load balancer or ingress.
+func (a *API) destinationProxyHandler(c *gin.Context) {
+	id, err := uid.Parse([]byte(c.Param("id")))
+	if err != nil {
+		a.sendAPIError(c, fmt.Errorf("%w: %s", internal.ErrBadRequest, err))
+		return
+	}
+
+	clientIP, forwarded := a.tunnelForwardedClient(c, id)
+	if !forwarded {
+		clientIP = c.ClientIP()
+	}
+
+	t := a.server.tunnels.get(id)
+	if t == nil {
+		// a forwarded request is not forwarded again
+		if forwarded || !a.forwardToReplica(c, id, clientIP) {
+			a.sendAPIError(c, fmt.Errorf("%w: destination is not connected through a tunnel", internal.ErrBadGateway))
+		}
+
+		return
+	}
+
+	c.Request.URL.Path = c.Param("path")
+	c.Request.URL.RawPath = ""
+	c.Request.Header.Del(tunnelForwardedHeader)
+	c.Request.Header.Set(api.DestinationTunnelClientHeader, clientIP)
+
+	t.proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// bufferedConn reads what the server buffered before the connection was hijacked, before reading from the connection
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
 )
 
 // the pki package defines an interface and implementations of public key encryption, specifically around certificates.
@@ -33,10 +34,14 @@ type CertificateProvider interface {
 	// Sign a cert with the latest active CA.
 	// Caller should have already validated that it's okay to sign this certificate by verifying the sender's authenticity, and that they own the resources they're asking to be certified for.
 	// A Certificate Signing Request can be parsed with `x509.ParseCertificateRequest()`
-	SignCertificate(csr x509.CertificateRequest) (pemBytes []byte, err error)
+	// The cert expires at notAfter, or in a day when that is sooner or notAfter is zero.
+	SignCertificate(csr x509.CertificateRequest, notAfter time.Time) (pemBytes []byte, err error)
 
 	// Preload attempts to preload the root certificate into the system. If this is not possible in this implementation of the certificate provider, it should return internal.ErrNotImplemented or a simple errors.New("not implemented")
 	Preload(rootCACertificate, publicKey []byte) error
+
+	// Reload reads the CAs from storage again, when they may have been rotated by another server sharing it
+	Reload() error
 }
 
 func MakeUserCert(commonName string, lifetime time.Duration) (*KeyPair, error) {
@@ -101,7 +106,7 @@ func SignUserCert(cp CertificateProvider, cert *x509.Certificate, user *models.I
 		Extensions:         cert.Extensions,
 		ExtraExtensions:    cert.ExtraExtensions,
 		SignatureAlgorithm: x509.PureEd25519,
-	})
+	}, time.Time{})
 	if err != nil {
 		return nil, nil, err
 	}
@@ -122,3 +127,137 @@ func SignUserCert(cp CertificateProvider, cert *x509.Certificate, user *models.I
 
 	return newCert, pem1, nil
 }
+
+// SignConnectorCert signs the serving certificate a connector requested for its destination. The certificate can only
+// be for the destination, and for the hosts it is reached at.
+func SignConnectorCert(cp CertificateProvider, csr *x509.CertificateRequest, destinationName string, hosts []string) (*x509.Certificate, []byte, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	if csr.Subject.CommonName != "Connector "+destinationName {
+		return nil, nil, fmt.Errorf("invalid certificate common name %q for destination %q", csr.Subject.CommonName, destinationName)
+	}
+
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowed[host] = true
+	}
+
+	for _, name := range csr.DNSNames {
+		if !allowed[name] {
+			return nil, nil, fmt.Errorf("destination %q is not reached at %q", destinationName, name)
+		}
+	}
+
+	for _, ip := range csr.IPAddresses {
+		if !allowed[ip.String()] {
+			return nil, nil, fmt.Errorf("destination %q is not reached at %q", destinationName, ip)
+		}
+	}
+
+	if len(csr.DNSNames) == 0 && len(csr.IPAddresses) == 0 {
+		return nil, nil, fmt.Errorf("certificate request has no hosts")
+	}
+
+	// only the fields checked above are signed, not any other extensions in the request
+	return signRequest(cp, x509.CertificateRequest{
+		Raw:                csr.Raw,
+		PublicKeyAlgorithm: csr.PublicKeyAlgorithm,
+		PublicKey:          csr.PublicKey,
+		Subject:            pkix.Name{CommonName: csr.Subject.CommonName},
+		DNSNames:           csr.DNSNames,
+		IPAddresses:        csr.IPAddresses,
+		SignatureAlgorithm: csr.SignatureAlgorithm,
+	}, time.Time{})
+}
+
+// ClientCertCommonName is the common name of the client certificate for an identity, which the server
+// authenticates the identity with
+func ClientCertCommonName(identityID uid.ID) string {
+	return "User " + identityID.String()
+}
+
+// SignClientCert signs the client certificate an identity requested, to authenticate to the server with. The
+// certificate expires by notAfter.
+func SignClientCert(cp CertificateProvider, csr *x509.CertificateRequest, identity *models.Identity, notAfter time.Time) (*x509.Certificate, []byte, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	if csr.Subject.CommonName != ClientCertCommonName(identity.ID) {
+		return nil, nil, fmt.Errorf("invalid certificate common name %q for identity %q", csr.Subject.CommonName, identity.Name)
+	}
+
+	// the certificate only names the identity, any hosts or extensions in the request are not signed
+	return signRequest(cp, x509.CertificateRequest{
+		Raw:                csr.Raw,
+		PublicKeyAlgorithm: csr.PublicKeyAlgorithm,
+		PublicKey:          csr.PublicKey,
+		Subject:            pkix.Name{CommonName: csr.Subject.CommonName},
+		SignatureAlgorithm: csr.SignatureAlgorithm,
+	}, notAfter)
+}
+
+// ClientCertIdentity is the identity a verified client certificate was issued to, and the certificate. Only
+// certificates signed by one of the active CAs identify an identity.
+func ClientCertIdentity(cp CertificateProvider, verifiedChains [][]*x509.Certificate) (uid.ID, *x509.Certificate, bool) {
+	for _, chain := range verifiedChains {
+		if len(chain) < 2 {
+			continue
+		}
+
+		root := chain[len(chain)-1]
+
+		for _, ca := range cp.ActiveCAs() {
+			if !ca.Equal(root) {
+				continue
+			}
+
+			name := chain[0].Subject.CommonName
+			if !strings.HasPrefix(name, "User ") {
+				return 0, nil, false
+			}
+
+			id, err := uid.ParseString(strings.TrimPrefix(name, "User "))
+			if err != nil {
+				return 0, nil, false
+			}
+
+			return id, chain[0], true
+		}
+	}
+
+	return 0, nil, false
+}
+
+func signRequest(cp CertificateProvider, csr x509.CertificateRequest, notAfter time.Time) (*x509.Certificate, []byte, error) {
+	pemBytes, err := cp.SignCertificate(csr, notAfter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, _ := pem.Decode(pemBytes)
+	if p == nil {
+		return nil, nil, fmt.Errorf("decoding certificate")
+	}
+
+	cert, err := x509.ParseCertificate(p.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+
+	return cert, pemBytes, nil
+}
+
+// ActiveCAsPEM returns the active CA certificates as a PEM bundle, for clients to trust the certificates signed by
+// either of them
+func ActiveCAsPEM(cp CertificateProvider) []byte {
+	var bundle []byte
+
+	for _, cert := range cp.ActiveCAs() {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	return bundle
+}
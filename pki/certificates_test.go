@@ -121,7 +121,7 @@ func TestCertificatesImplementations(t *testing.T) {
 				Extensions:         cert.Extensions,
 			}
 
-			pemBytes, err := p.SignCertificate(csr)
+			pemBytes, err := p.SignCertificate(csr, time.Time{})
 			assert.NilError(t, err)
 
 			block, rest := pem.Decode(pemBytes)
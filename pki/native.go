@@ -13,6 +13,7 @@ import (
 	"math/big"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -45,6 +46,8 @@ type NativeCertificateProvider struct {
 
 	db *gorm.DB
 
+	// mu guards the key pairs, which are replaced when the CAs are rotated or reloaded
+	mu              sync.RWMutex
 	activeKeypair   KeyPair
 	previousKeypair KeyPair
 }
@@ -115,6 +118,9 @@ func NewNativeCertificateProvider(db *gorm.DB, cfg NativeCertificateProviderConf
 }
 
 func (n *NativeCertificateProvider) Preload(rootCACertificate, publicKey []byte) (err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
 	if n.activeKeypair.SignedCert != nil {
 		return fmt.Errorf("cannot preload a certificate when another one is already loaded.")
 	}
@@ -172,12 +178,15 @@ func (n *NativeCertificateProvider) Preload(rootCACertificate, publicKey []byte)
 		SignedCert:       cert,
 	}
 
-	return n.RotateCA()
+	return n.rotateCA()
 }
 
 // CreateCA creates a new root CA and immediately does a half-rotation.
 // the new active key after rotation is the one that should be used.
 func (n *NativeCertificateProvider) CreateCA() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
 	pub, prv, err := ed25519.GenerateKey(randReader)
 	if err != nil {
 		return fmt.Errorf("generating keys: %w", err)
@@ -203,11 +212,14 @@ func (n *NativeCertificateProvider) CreateCA() error {
 	n.activeKeypair.KeyAlgorithm = x509.Ed25519.String()
 	n.activeKeypair.SigningAlgorithm = x509.PureEd25519.String()
 
-	return n.RotateCA()
+	return n.rotateCA()
 }
 
 // ActiveCAs returns the currently in-use CAs, the newest cert is always the last in the list
 func (n *NativeCertificateProvider) ActiveCAs() []x509.Certificate {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
 	result := []x509.Certificate{}
 
 	if n.previousKeypair.SignedCert != nil && certActive(n.previousKeypair.SignedCert) {
@@ -234,7 +246,10 @@ func certActive(cert *x509.Certificate) bool {
 }
 
 // TODO: SignCertificate should be renamed to SignUserCertificate?
-func (n *NativeCertificateProvider) SignCertificate(csr x509.CertificateRequest) (pemBytes []byte, err error) {
+func (n *NativeCertificateProvider) SignCertificate(csr x509.CertificateRequest, notAfter time.Time) (pemBytes []byte, err error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
 	switch {
 	case csr.Subject.CommonName == rootCAName:
 		return nil, fmt.Errorf("cannot sign cert pretending to be the root CA")
@@ -254,19 +269,32 @@ func (n *NativeCertificateProvider) SignCertificate(csr x509.CertificateRequest)
 		return nil, fmt.Errorf("%q is not an acceptable public key algorithm, expecting one of: %v", csr.PublicKeyAlgorithm, allowedPublicKeyAlgorithms)
 	}
 
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+
+	serial, err := rand.Int(randReader, serialNumberLimit)
+	if err != nil {
+		return nil, fmt.Errorf("creating random serial: %w", err)
+	}
+
+	if maxNotAfter := time.Now().Add(24 * time.Hour); notAfter.IsZero() || notAfter.After(maxNotAfter) {
+		notAfter = maxNotAfter
+	}
+
 	certTemplate := &x509.Certificate{
 		Signature:          csr.Signature,
 		SignatureAlgorithm: csr.SignatureAlgorithm,
 		PublicKeyAlgorithm: csr.PublicKeyAlgorithm,
 		PublicKey:          csr.PublicKey,
-		SerialNumber:       big.NewInt(2),
+		SerialNumber:       serial,
 		Issuer:             n.activeKeypair.SignedCert.Subject,
 		Subject:            csr.Subject,
 		EmailAddresses:     csr.EmailAddresses,
+		DNSNames:           csr.DNSNames,
+		IPAddresses:        csr.IPAddresses,
 		Extensions:         csr.Extensions,      // TODO: security issue?
 		ExtraExtensions:    csr.ExtraExtensions, // TODO: security issue?
 		NotBefore:          time.Now().Add(-5 * time.Minute).UTC(),
-		NotAfter:           time.Now().Add(24 * time.Hour).UTC(),
+		NotAfter:           notAfter.UTC(),
 		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 	}
@@ -294,6 +322,13 @@ func (n *NativeCertificateProvider) SignCertificate(csr x509.CertificateRequest)
 
 // RotateCA does a half-rotation. the current cert becomes the previous cert, and there are always two active certificates
 func (n *NativeCertificateProvider) RotateCA() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.rotateCA()
+}
+
+func (n *NativeCertificateProvider) rotateCA() error {
 	n.previousKeypair = n.activeKeypair
 	n.activeKeypair = KeyPair{}
 
@@ -387,6 +422,14 @@ func createCertSignedBy(signer, signee KeyPair, lifetime time.Duration) (*x509.C
 	return cert, rawCert, nil
 }
 
+// Reload reads the CAs from the database again, as another server sharing it may have rotated them
+func (n *NativeCertificateProvider) Reload() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.loadFromDB()
+}
+
 func (n *NativeCertificateProvider) loadFromDB() error {
 	certs, err := data.ListRootCertificates(n.db)
 	if err != nil {
@@ -411,7 +454,7 @@ func (n *NativeCertificateProvider) loadFromDB() error {
 }
 
 func certificateToKeyPair(c *models.RootCertificate) (KeyPair, error) {
-	// the certificate doesn't have pem armoring on it.
+	// the certificate doesn't have pem armoring on it, it is added back for the key pair
 	cert, err := x509.ParseCertificate([]byte(c.SignedCert))
 	if err != nil {
 		return KeyPair{}, fmt.Errorf("couldn't read certificate from db: %w", err)
@@ -422,7 +465,7 @@ func certificateToKeyPair(c *models.RootCertificate) (KeyPair, error) {
 		SigningAlgorithm: c.SigningAlgorithm,
 		PublicKey:        ed25519.PublicKey(c.PublicKey),
 		PrivateKey:       ed25519.PrivateKey(c.PrivateKey),
-		SignedCertPEM:    []byte(c.SignedCert),
+		SignedCertPEM:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte(c.SignedCert)}),
 		SignedCert:       cert,
 	}, nil
 }
@@ -467,6 +510,9 @@ func (n *NativeCertificateProvider) saveToDB() error {
 }
 
 func (n *NativeCertificateProvider) TLSCertificates() ([]tls.Certificate, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
 	result := []tls.Certificate{}
 
 	keyPairs := []KeyPair{
@@ -1,9 +1,13 @@
 package pki
 
 import (
+	"crypto/ed25519"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"gorm.io/gorm"
@@ -13,6 +17,7 @@ import (
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/secrets"
+	"github.com/infrahq/infra/uid"
 )
 
 func setupDB(t *testing.T) *gorm.DB {
@@ -86,3 +91,124 @@ func TestTLSCertificates(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Assert(t, is.Len(certs, 2))
 }
+
+func TestSignConnectorCert(t *testing.T) {
+	p, err := NewNativeCertificateProvider(setupDB(t), NativeCertificateProviderConfig{FullKeyRotationDurationInDays: 2})
+	assert.NilError(t, err)
+
+	err = p.CreateCA()
+	assert.NilError(t, err)
+
+	_, key, err := ed25519.GenerateKey(randReader)
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, commonName string, dnsNames []string, ips []net.IP) *x509.CertificateRequest {
+		raw, err := x509.CreateCertificateRequest(randReader, &x509.CertificateRequest{
+			Subject:     pkix.Name{CommonName: commonName},
+			DNSNames:    dnsNames,
+			IPAddresses: ips,
+		}, key)
+		assert.NilError(t, err)
+
+		csr, err := x509.ParseCertificateRequest(raw)
+		assert.NilError(t, err)
+
+		return csr
+	}
+
+	hosts := []string{"connector.example.com"}
+
+	t.Run("signed for the destination", func(t *testing.T) {
+		csr := request(t, "Connector kubernetes.prod", []string{"connector.example.com"}, nil)
+
+		cert, pemBytes, err := SignConnectorCert(p, csr, "kubernetes.prod", hosts)
+		assert.NilError(t, err)
+		assert.Assert(t, len(pemBytes) > 0)
+		assert.DeepEqual(t, cert.DNSNames, []string{"connector.example.com"})
+
+		roots := x509.NewCertPool()
+		assert.Assert(t, roots.AppendCertsFromPEM(ActiveCAsPEM(p)))
+
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: "connector.example.com", Roots: roots})
+		assert.NilError(t, err)
+	})
+
+	t.Run("another destination", func(t *testing.T) {
+		csr := request(t, "Connector kubernetes.dev", []string{"connector.example.com"}, nil)
+
+		_, _, err := SignConnectorCert(p, csr, "kubernetes.prod", hosts)
+		assert.ErrorContains(t, err, "invalid certificate common name")
+	})
+
+	t.Run("another host", func(t *testing.T) {
+		csr := request(t, "Connector kubernetes.prod", []string{"connector.example.com"}, []net.IP{net.ParseIP("10.0.0.1")})
+
+		_, _, err := SignConnectorCert(p, csr, "kubernetes.prod", hosts)
+		assert.ErrorContains(t, err, `not reached at "10.0.0.1"`)
+	})
+}
+
+func TestSignClientCert(t *testing.T) {
+	p, err := NewNativeCertificateProvider(setupDB(t), NativeCertificateProviderConfig{FullKeyRotationDurationInDays: 2})
+	assert.NilError(t, err)
+
+	err = p.CreateCA()
+	assert.NilError(t, err)
+
+	_, key, err := ed25519.GenerateKey(randReader)
+	assert.NilError(t, err)
+
+	identity := &models.Identity{Model: models.Model{ID: uid.New()}, Name: "connector", Kind: models.MachineKind}
+
+	request := func(t *testing.T, commonName string) *x509.CertificateRequest {
+		raw, err := x509.CreateCertificateRequest(randReader, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: commonName},
+			DNSNames: []string{"connector.example.com"},
+		}, key)
+		assert.NilError(t, err)
+
+		csr, err := x509.ParseCertificateRequest(raw)
+		assert.NilError(t, err)
+
+		return csr
+	}
+
+	t.Run("signed for the identity", func(t *testing.T) {
+		cert, _, err := SignClientCert(p, request(t, ClientCertCommonName(identity.ID)), identity, time.Time{})
+		assert.NilError(t, err)
+		assert.Assert(t, len(cert.DNSNames) == 0)
+		assert.Assert(t, cert.NotAfter.Before(time.Now().Add(24*time.Hour+time.Second)))
+
+		roots := x509.NewCertPool()
+		assert.Assert(t, roots.AppendCertsFromPEM(ActiveCAsPEM(p)))
+
+		chains, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+		assert.NilError(t, err)
+
+		id, leaf, ok := ClientCertIdentity(p, chains)
+		assert.Assert(t, ok)
+		assert.Equal(t, id, identity.ID)
+		assert.Equal(t, leaf.SerialNumber.Cmp(cert.SerialNumber), 0)
+	})
+
+	t.Run("expires with the access key", func(t *testing.T) {
+		expires := time.Now().Add(15 * time.Minute)
+
+		cert, _, err := SignClientCert(p, request(t, ClientCertCommonName(identity.ID)), identity, expires)
+		assert.NilError(t, err)
+		assert.Assert(t, !cert.NotAfter.After(expires))
+	})
+
+	t.Run("another identity", func(t *testing.T) {
+		_, _, err := SignClientCert(p, request(t, ClientCertCommonName(uid.New())), identity, time.Time{})
+		assert.ErrorContains(t, err, "invalid certificate common name")
+	})
+
+	t.Run("not issued by the CA", func(t *testing.T) {
+		keyPair, err := MakeUserCert(ClientCertCommonName(identity.ID), time.Hour)
+		assert.NilError(t, err)
+
+		_, _, ok := ClientCertIdentity(p, [][]*x509.Certificate{{keyPair.Cert, keyPair.Cert}})
+		assert.Assert(t, !ok)
+	})
+}